@@ -0,0 +1,228 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Net is an address with a mask, as matched by rules and some extensions. It is comparable,
+// and its zero value matches any address.
+type Net struct {
+	// Prefix is the address and prefix length; it has full length when Mask is valid.
+	netip.Prefix
+	// Mask is only valid for non-CIDR masks, like 255.0.255.0.
+	Mask netip.Addr
+}
+
+// NetFromPrefix returns a Net for a CIDR prefix; host bits are cleared, and zero-length prefixes match any address.
+func NetFromPrefix(p netip.Prefix) Net {
+	if !p.IsValid() || p.Bits() == 0 {
+		return Net{}
+	}
+	return Net{Prefix: p.Masked()}
+}
+
+// NetFromMask returns a Net for an address and a mask of the same family; the mask is
+// converted to a prefix length when possible.
+func NetFromMask(addr, mask netip.Addr) (Net, error) {
+	if !addr.IsValid() || !mask.IsValid() || addr.BitLen() != mask.BitLen() {
+		return Net{}, fmt.Errorf("invalid address %s with mask %s", addr, mask)
+	}
+	if mask.IsUnspecified() {
+		return Net{}, nil
+	}
+	if ones, ok := maskBits(mask); ok {
+		return Net{Prefix: netip.PrefixFrom(addr, ones).Masked()}, nil
+	}
+	return Net{Prefix: netip.PrefixFrom(andAddr(addr, mask), addr.BitLen()), Mask: mask}, nil
+}
+
+// NetFromIPNet converts a net.IPNet; nil matches any address.
+func NetFromIPNet(ipNet *net.IPNet) (Net, error) {
+	if ipNet == nil {
+		return Net{}, nil
+	}
+	addr, ok1 := netip.AddrFromSlice(ipNet.IP)
+	mask, ok2 := netip.AddrFromSlice(ipNet.Mask)
+	if !ok1 || !ok2 {
+		return Net{}, fmt.Errorf("invalid address %s", ipNet)
+	}
+	if len(ipNet.Mask) == net.IPv4len {
+		addr = addr.Unmap()
+	}
+	return NetFromMask(addr, mask)
+}
+
+// ParseNet parses an address optionally followed by a prefix length or a mask,
+// like "10.0.0.1", "10.0.0.0/8", "10.0.0.0/255.0.255.0" or "2001:db8::/32".
+func ParseNet(s string) (Net, error) {
+	addrStr, maskStr, hasMask := strings.Cut(s, "/")
+	addr, err := netip.ParseAddr(addrStr)
+	if err != nil {
+		return Net{}, err
+	}
+	if !hasMask {
+		return NetFromPrefix(netip.PrefixFrom(addr, addr.BitLen())), nil
+	}
+	if strings.ContainsAny(maskStr, ".:") {
+		mask, err := netip.ParseAddr(maskStr)
+		if err != nil {
+			return Net{}, err
+		}
+		return NetFromMask(addr, mask)
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return Net{}, err
+	}
+	return NetFromPrefix(p), nil
+}
+
+// parseFamilyNet parses a Net with ParseNet and checks that it belongs to family.
+func parseFamilyNet(family Family, s string) (Net, error) {
+	n, err := ParseNet(s)
+	if err != nil {
+		return Net{}, err
+	}
+	if !n.IsAny() && n.Addr().Is4() != (family == FamilyIPv4) {
+		return Net{}, fmt.Errorf("not an %s address: %s", family, s)
+	}
+	return n, nil
+}
+
+// IsAny returns true when any address is matched.
+func (n Net) IsAny() bool {
+	return !n.IsValid() || (n.Bits() == 0 && !n.Mask.IsValid())
+}
+
+// IsCIDR returns true unless the mask is not a prefix.
+func (n Net) IsCIDR() bool {
+	return !n.Mask.IsValid()
+}
+
+// MaskAddr returns the mask as an address; it is invalid when any address is matched.
+func (n Net) MaskAddr() netip.Addr {
+	if n.Mask.IsValid() {
+		return n.Mask
+	}
+	if n.IsAny() {
+		return netip.Addr{}
+	}
+	var b [16]byte
+	for i := 0; i < n.Bits(); i++ {
+		b[i/8] |= 0x80 >> uint(i%8)
+	}
+	if n.Addr().Is4() {
+		return netip.AddrFrom4([4]byte{b[0], b[1], b[2], b[3]})
+	}
+	return netip.AddrFrom16(b)
+}
+
+// Contains returns true when ip is matched.
+func (n Net) Contains(ip netip.Addr) bool {
+	switch {
+	case n.IsAny():
+		return true
+	case n.IsCIDR():
+		return n.Prefix.Contains(ip)
+	}
+	return ip.BitLen() == n.Mask.BitLen() && andAddr(ip, n.Mask) == n.Addr()
+}
+
+// String returns "any", the prefix or the address and mask, like "10.0.0.0/255.0.255.0".
+func (n Net) String() string {
+	switch {
+	case n.IsAny():
+		return "any"
+	case n.IsCIDR():
+		return n.Prefix.String()
+	}
+	return n.Addr().String() + "/" + n.Mask.String()
+}
+
+// IPNet returns the equivalent net.IPNet, or nil when any address is matched.
+func (n Net) IPNet() *net.IPNet {
+	if n.IsAny() {
+		return nil
+	}
+	return &net.IPNet{IP: n.Addr().AsSlice(), Mask: n.MaskAddr().AsSlice()}
+}
+
+// maskBits returns the prefix length of a contiguous mask.
+func maskBits(mask netip.Addr) (int, bool) {
+	b := mask.As16()
+	start := 0
+	if mask.Is4() {
+		start = 12
+	}
+	ones := 0
+	for i := start; i < 16; i++ {
+		ones += bits.LeadingZeros8(^b[i])
+		if b[i] != 0xff {
+			// remaining bits, here and in following bytes, must be all zeroes
+			if b[i]<<uint(bits.LeadingZeros8(^b[i])) != 0 {
+				return 0, false
+			}
+			for _, rest := range b[i+1:] {
+				if rest != 0 {
+					return 0, false
+				}
+			}
+			break
+		}
+	}
+	return ones, true
+}
+
+// andAddr applies a mask of the same family to an address.
+func andAddr(addr, mask netip.Addr) netip.Addr {
+	a, m := addr.As16(), mask.As16()
+	for i := range a {
+		a[i] &= m[i]
+	}
+	if addr.Is4() {
+		return netip.AddrFrom4([4]byte{a[12], a[13], a[14], a[15]})
+	}
+	return netip.AddrFrom16(a)
+}
+
+// MarshalText implements encoding.TextMarshaler, using the String representation.
+func (n Net) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting "any" and the formats of ParseNet.
+func (n *Net) UnmarshalText(text []byte) error {
+	if string(text) == "any" || len(text) == 0 {
+		*n = Net{}
+		return nil
+	}
+	parsed, err := ParseNet(string(text))
+	if err != nil {
+		return err
+	}
+	*n = parsed
+	return nil
+}
@@ -0,0 +1,247 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// FeatureKind is the kind of a kernel feature used by rules.
+type FeatureKind uint8
+
+const (
+	FeatureTable FeatureKind = iota
+	FeatureMatch
+	FeatureTarget
+)
+
+// String returns "table", "match" or "target".
+func (k FeatureKind) String() string {
+	switch k {
+	case FeatureTable:
+		return "table"
+	case FeatureMatch:
+		return "match"
+	case FeatureTarget:
+		return "target"
+	}
+	return fmt.Sprintf("FeatureKind(%d)", uint8(k))
+}
+
+// Feature is a table, match or target, which is available once the kernel module providing it is loaded.
+type Feature struct {
+	Kind FeatureKind
+	Name string
+}
+
+// TableFeature returns the feature of a table, like TableFeature("nat").
+func TableFeature(name string) Feature {
+	return Feature{FeatureTable, name}
+}
+
+// MatchFeature returns the feature of a match extension, like MatchFeature("conntrack").
+func MatchFeature(name string) Feature {
+	return Feature{FeatureMatch, name}
+}
+
+// TargetFeature returns the feature of a target extension, like TargetFeature("REJECT").
+func TargetFeature(name string) Feature {
+	return Feature{FeatureTarget, name}
+}
+
+// String returns the kind and name of the feature, like "table nat".
+func (f Feature) String() string {
+	return f.Kind.String() + " " + f.Name
+}
+
+// Module returns the name under which the kernel requests the module of the feature, like iptable_nat,
+// ip6table_nat or ipt_REJECT; x_tables modules declare it as an alias of their own name.
+func (f Feature) Module(family Family) string {
+	prefix := "ip"
+	if family == FamilyIPv6 {
+		prefix = "ip6"
+	}
+	if f.Kind == FeatureTable {
+		return prefix + "table_" + f.Name
+	}
+	return prefix + "t_" + f.Name
+}
+
+// files listing the extensions registered by the kernel, replaceable for testing
+var (
+	matchesNamesFile = map[Family]string{
+		FamilyIPv4: "/proc/net/ip_tables_matches",
+		FamilyIPv6: "/proc/net/ip6_tables_matches",
+	}
+	targetsNamesFile = map[Family]string{
+		FamilyIPv4: "/proc/net/ip_tables_targets",
+		FamilyIPv6: "/proc/net/ip6_tables_targets",
+	}
+)
+
+// Matches returns the names of the match extensions currently registered by the kernel for family.
+func Matches(family Family) ([]string, error) {
+	path, ok := matchesNamesFile[family]
+	if !ok {
+		return nil, fmt.Errorf("invalid family %d", uint8(family))
+	}
+	return readNames(path)
+}
+
+// Targets returns the names of the target extensions currently registered by the kernel for family.
+func Targets(family Family) ([]string, error) {
+	path, ok := targetsNamesFile[family]
+	if !ok {
+		return nil, fmt.Errorf("invalid family %d", uint8(family))
+	}
+	return readNames(path)
+}
+
+// Availability lists the tables and extensions currently registered by the kernel for a family.
+type Availability struct {
+	Family  Family   `json:"family" yaml:"family"`
+	Tables  []string `json:"tables" yaml:"tables"`
+	Matches []string `json:"matches" yaml:"matches"`
+	Targets []string `json:"targets" yaml:"targets"`
+}
+
+// GetAvailability returns the tables and extensions currently registered by the kernel for family.
+func GetAvailability(family Family) (*Availability, error) {
+	a := &Availability{Family: family}
+	var err error
+	if a.Tables, err = Tables(family); err != nil {
+		return nil, err
+	}
+	if a.Matches, err = Matches(family); err != nil {
+		return nil, err
+	}
+	if a.Targets, err = Targets(family); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Has returns whether the feature is registered.
+func (a *Availability) Has(f Feature) bool {
+	names := a.Tables
+	switch f.Kind {
+	case FeatureMatch:
+		names = a.Matches
+	case FeatureTarget:
+		names = a.Targets
+	}
+	for _, name := range names {
+		if name == f.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureStatus is the availability of a feature, as reported by CheckAvailability.
+type FeatureStatus struct {
+	Feature
+	// Module is the module providing the feature, see Feature.Module.
+	Module    string
+	Available bool
+	// Loaded is set when the feature became available by loading Module.
+	Loaded bool
+	// LoadErr is the error of modprobe, when the feature was missing and Module could not be loaded.
+	LoadErr error
+}
+
+// modprobe loads a kernel module, replaceable for testing.
+var modprobe = func(module string) error {
+	out, err := exec.Command("modprobe", module).CombinedOutput()
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) != 0 {
+			return fmt.Errorf("modprobe %s: %v: %s", module, err, out)
+		}
+		return fmt.Errorf("modprobe %s: %v", module, err)
+	}
+	return nil
+}
+
+// CheckAvailability reports whether each of the features is currently available for family; when load is
+// set, the modules of missing features are loaded with modprobe, which requires CAP_SYS_MODULE.
+// Errors are only returned when the kernel lists cannot be read; load failures are reported per feature.
+func CheckAvailability(family Family, load bool, features ...Feature) ([]FeatureStatus, error) {
+	a, err := GetAvailability(family)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]FeatureStatus, len(features))
+	missing := false
+	for i, f := range features {
+		statuses[i] = FeatureStatus{Feature: f, Module: f.Module(family), Available: a.Has(f)}
+		missing = missing || !statuses[i].Available
+	}
+	if !load || !missing {
+		return statuses, nil
+	}
+
+	for i := range statuses {
+		s := &statuses[i]
+		if s.Available {
+			continue
+		}
+		s.LoadErr = modprobe(s.Module)
+	}
+	if a, err = GetAvailability(family); err != nil {
+		return nil, err
+	}
+	for i := range statuses {
+		s := &statuses[i]
+		if !s.Available && a.Has(s.Feature) {
+			s.Available, s.Loaded = true, true
+			s.LoadErr = nil
+		}
+	}
+	return statuses, nil
+}
+
+// UnavailableError reports a table or extension that is not registered by the kernel.
+type UnavailableError struct {
+	Family  Family
+	Feature Feature
+}
+
+// Error returns a description of the missing feature, including the module providing it.
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s %s not available (module %s not loaded)", e.Family, e.Feature, e.Feature.Module(e.Family))
+}
+
+// CheckTable returns an *UnavailableError if the table is not registered by the kernel; it is meant to
+// explain a failure to initialize a handle.
+func CheckTable(family Family, table string) error {
+	tables, err := Tables(family)
+	if err != nil {
+		return err
+	}
+	for _, name := range tables {
+		if name == table {
+			return nil
+		}
+	}
+	return &UnavailableError{family, TableFeature(table)}
+}
@@ -0,0 +1,147 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeProcNames replaces the IPv4 names files with files in a temporary directory, returning their paths.
+func fakeProcNames(t *testing.T) (tables, matches, targets string) {
+	files := []map[Family]string{tablesNamesFile, matchesNamesFile, targetsNamesFile}
+	var saved []string
+	for _, f := range files {
+		saved = append(saved, f[FamilyIPv4])
+	}
+	t.Cleanup(func() {
+		for i, f := range files {
+			f[FamilyIPv4] = saved[i]
+		}
+	})
+
+	dir := t.TempDir()
+	tables, matches, targets = filepath.Join(dir, "names"), filepath.Join(dir, "matches"), filepath.Join(dir, "targets")
+	tablesNamesFile[FamilyIPv4], matchesNamesFile[FamilyIPv4], targetsNamesFile[FamilyIPv4] = tables, matches, targets
+	return
+}
+
+func writeNames(t *testing.T, path, names string) {
+	if err := os.WriteFile(path, []byte(names), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFeatureModule(t *testing.T) {
+	for _, tc := range []struct {
+		feature Feature
+		family  Family
+		module  string
+	}{
+		{TableFeature("nat"), FamilyIPv4, "iptable_nat"},
+		{TableFeature("nat"), FamilyIPv6, "ip6table_nat"},
+		{MatchFeature("conntrack"), FamilyIPv4, "ipt_conntrack"},
+		{TargetFeature("REJECT"), FamilyIPv6, "ip6t_REJECT"},
+	} {
+		if module := tc.feature.Module(tc.family); module != tc.module {
+			t.Errorf("%s: expected %s, got %s", tc.feature, tc.module, module)
+		}
+	}
+}
+
+func TestCheckAvailability(t *testing.T) {
+	tables, matches, targets := fakeProcNames(t)
+	writeNames(t, tables, "filter\n")
+	// extensions with several revisions are listed once per revision
+	writeNames(t, matches, "conntrack\nconntrack\nudp\n")
+	writeNames(t, targets, "LOG\n")
+
+	a, err := GetAvailability(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Availability{FamilyIPv4, []string{"filter"}, []string{"conntrack", "udp"}, []string{"LOG"}}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("expected %+v, got %+v", expected, a)
+	}
+
+	var loaded []string
+	defer func(saved func(string) error) {
+		modprobe = saved
+	}(modprobe)
+	modprobe = func(module string) error {
+		loaded = append(loaded, module)
+		if module != "iptable_nat" {
+			return errors.New("modprobe: FATAL: Module " + module + " not found")
+		}
+		writeNames(t, tables, "filter\nnat\n")
+		return nil
+	}
+
+	features := []Feature{TableFeature("filter"), TableFeature("nat"), MatchFeature("udp"), TargetFeature("MASQUERADE")}
+	statuses, err := CheckAvailability(FamilyIPv4, false, features...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, available := range []bool{true, false, true, false} {
+		if statuses[i].Available != available || statuses[i].Loaded || statuses[i].LoadErr != nil {
+			t.Errorf("unexpected status %+v", statuses[i])
+		}
+	}
+	if loaded != nil {
+		t.Errorf("modules loaded without load: %v", loaded)
+	}
+
+	statuses, err = CheckAvailability(FamilyIPv4, true, features...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"iptable_nat", "ipt_MASQUERADE"}; !reflect.DeepEqual(loaded, expected) {
+		t.Errorf("expected modules %v to be loaded, got %v", expected, loaded)
+	}
+	if s := statuses[1]; !s.Available || !s.Loaded || s.LoadErr != nil || s.Module != "iptable_nat" {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if s := statuses[3]; s.Available || s.Loaded || s.LoadErr == nil {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if s := statuses[0]; !s.Available || s.Loaded {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
+
+func TestCheckTable(t *testing.T) {
+	tables, _, _ := fakeProcNames(t)
+	writeNames(t, tables, "filter\n")
+
+	if err := CheckTable(FamilyIPv4, "filter"); err != nil {
+		t.Error(err)
+	}
+	err := CheckTable(FamilyIPv4, "nat")
+	if _, ok := err.(*UnavailableError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err.Error() != "ipv4 table nat not available (module iptable_nat not loaded)" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
@@ -0,0 +1,472 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"unsafe"
+)
+
+// Family is the protocol family of a table; some extensions are encoded differently depending on it.
+type Family uint8
+
+const (
+	// the constants are copied from NFPROTO_* values in linux/netfilter.h
+	FamilyIPv4 Family = 2
+	FamilyIPv6 Family = 10
+)
+
+// String returns the name of the family.
+func (f Family) String() string {
+	switch f {
+	case FamilyIPv4:
+		return "ipv4"
+	case FamilyIPv6:
+		return "ipv6"
+	}
+	return fmt.Sprintf("family(%d)", uint8(f))
+}
+
+// MarshalText implements encoding.TextMarshaler, returning "ipv4" or "ipv6".
+func (f Family) MarshalText() ([]byte, error) {
+	if f != FamilyIPv4 && f != FamilyIPv6 {
+		return nil, fmt.Errorf("invalid family %d", uint8(f))
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting "ipv4" and "ipv6".
+func (f *Family) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "ipv4":
+		*f = FamilyIPv4
+	case "ipv6":
+		*f = FamilyIPv6
+	default:
+		return fmt.Errorf("invalid family %q", text)
+	}
+	return nil
+}
+
+const (
+	// XT_EXTENSION_MAXNAMELEN is the size of the name field of match and target headers, including terminating NUL.
+	XT_EXTENSION_MAXNAMELEN = 29
+
+	// size of struct xt_entry_match and struct xt_entry_target
+	extensionHeaderSize = 32
+	// alignment of all entries and extensions, as XT_ALIGN()
+	extensionAlign = 8
+)
+
+// Match is a match extension of a rule, as specified with 'iptables -m <name>'.
+// Payload layouts follow the 64-bit kernel ABI.
+type Match interface {
+	// Name returns the name of the match extension.
+	Name() string
+	// Revision returns the revision of the match payload layout.
+	Revision() uint8
+	// Encode returns the match payload for the specified family, without header.
+	Encode(family Family) ([]byte, error)
+}
+
+// ProtocolMatch is implemented by matches that are valid only in rules for a specific protocol, like 'tcp'.
+type ProtocolMatch interface {
+	Match
+	// Protocol returns the protocol number required by the match.
+	Protocol() uint16
+}
+
+// MatchDecoder decodes a match payload (without header) for the specified family.
+type MatchDecoder func(family Family, data []byte) (Match, error)
+
+type extensionKey struct {
+	name     string
+	revision uint8
+}
+
+var matchDecoders = map[extensionKey]MatchDecoder{}
+
+// RegisterMatch registers the decoder for a specific revision of a match extension.
+// It is meant to be called from init() functions and it is not safe for concurrent use.
+func RegisterMatch(name string, revision uint8, decoder MatchDecoder) {
+	key := extensionKey{name, revision}
+	if _, ok := matchDecoders[key]; ok {
+		panic("match already registered: " + name)
+	}
+	matchDecoders[key] = decoder
+}
+
+// RawMatch is a match extension for which no decoder is registered; its payload is kept verbatim.
+type RawMatch struct {
+	MatchName     string
+	MatchRevision uint8
+	Data          []byte
+}
+
+// Name returns the name of the match extension.
+func (m *RawMatch) Name() string {
+	return m.MatchName
+}
+
+// Revision returns the revision of the match payload layout.
+func (m *RawMatch) Revision() uint8 {
+	return m.MatchRevision
+}
+
+// Encode returns the verbatim payload.
+func (m *RawMatch) Encode(family Family) ([]byte, error) {
+	return m.Data, nil
+}
+
+// EncodeMatches returns the sequence of xt_entry_match structures for the specified matches,
+// ready to be placed after an ipt_entry/ip6t_entry header.
+func EncodeMatches(family Family, matches []Match) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, m := range matches {
+		payload, err := m.Encode(family)
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %s", m.Name(), err)
+		}
+		ext, err := encodeExtension(m.Name(), m.Revision(), payload)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(ext)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMatches decodes a sequence of xt_entry_match structures, as found between
+// an ipt_entry/ip6t_entry header and its target.
+// Matches without a registered decoder, or whose payload cannot be decoded, are returned as RawMatch.
+func DecodeMatches(family Family, data []byte) ([]Match, error) {
+	var matches []Match
+	for len(data) != 0 {
+		name, revision, payload, size, err := decodeExtension(data)
+		if err != nil {
+			return matches, err
+		}
+		data = data[size:]
+
+		if decoder, ok := matchDecoders[extensionKey{name, revision}]; ok {
+			m, err := decoder(family, payload)
+			if err == nil {
+				matches = append(matches, m)
+				continue
+			}
+		}
+
+		raw := &RawMatch{MatchName: name, MatchRevision: revision}
+		raw.Data = append(raw.Data, payload...)
+		matches = append(matches, raw)
+	}
+	return matches, nil
+}
+
+// Target is a target extension of a rule, as specified with 'iptables -j <name>' for
+// targets other than verdicts and user-defined chains. Payload layouts follow the 64-bit kernel ABI.
+type Target interface {
+	// Name returns the name of the target extension.
+	Name() string
+	// Revision returns the revision of the target payload layout.
+	Revision() uint8
+	// Encode returns the target payload for the specified family, without header.
+	Encode(family Family) ([]byte, error)
+}
+
+// TargetDecoder decodes a target payload (without header) for the specified family.
+type TargetDecoder func(family Family, data []byte) (Target, error)
+
+var targetDecoders = map[extensionKey]TargetDecoder{}
+
+// RegisterTarget registers the decoder for a specific revision of a target extension.
+// It is meant to be called from init() functions and it is not safe for concurrent use.
+func RegisterTarget(name string, revision uint8, decoder TargetDecoder) {
+	key := extensionKey{name, revision}
+	if _, ok := targetDecoders[key]; ok {
+		panic("target already registered: " + name)
+	}
+	targetDecoders[key] = decoder
+}
+
+// RawTarget is a target extension for which no decoder is registered; its payload is kept verbatim.
+type RawTarget struct {
+	TargetName     string
+	TargetRevision uint8
+	Data           []byte
+}
+
+// Name returns the name of the target extension.
+func (t *RawTarget) Name() string {
+	return t.TargetName
+}
+
+// Revision returns the revision of the target payload layout.
+func (t *RawTarget) Revision() uint8 {
+	return t.TargetRevision
+}
+
+// Encode returns the verbatim payload.
+func (t *RawTarget) Encode(family Family) ([]byte, error) {
+	return t.Data, nil
+}
+
+// EncodeTarget returns a xt_entry_target structure for the specified target extension.
+func EncodeTarget(family Family, t Target) ([]byte, error) {
+	payload, err := t.Encode(family)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %s", t.Name(), err)
+	}
+	return encodeExtension(t.Name(), t.Revision(), payload)
+}
+
+const (
+	// the constants are copied from #define declarations in netfilter.h and x_tables.h
+	NF_DROP   = 0
+	NF_ACCEPT = 1
+	NF_QUEUE  = 3
+	NF_REPEAT = 4
+	XT_RETURN = -NF_REPEAT - 1
+)
+
+// verdicts maps standard verdict labels to the values stored in a xt_standard_target.
+var verdicts = map[string]int32{
+	IPTC_LABEL_ACCEPT: -NF_ACCEPT - 1,
+	IPTC_LABEL_DROP:   -NF_DROP - 1,
+	IPTC_LABEL_QUEUE:  -NF_QUEUE - 1,
+	IPTC_LABEL_RETURN: XT_RETURN,
+}
+
+// EncodeStandardTarget returns a xt_standard_target structure for the specified verdict or chain label;
+// the verdict of jumps is the offset of the chain, and is resolved by libiptc.
+func EncodeStandardTarget(name string) ([]byte, error) {
+	var verdict int32
+	if v, ok := verdicts[name]; ok {
+		verdict = v
+	}
+	return encodeExtension(name, 0, encodeStruct(&verdict))
+}
+
+// EncodeRuleTarget returns the target structure of an entry for the rule, and whether the entry needs
+// the goto flag (IPT_F_GOTO or IP6T_F_GOTO, depending on family).
+func EncodeRuleTarget(family Family, r *Rule) (target []byte, isGoto bool, err error) {
+	return encodeRuleTarget(family, r, EncodeTarget)
+}
+
+// encodeRuleTarget implements EncodeRuleTarget, encoding target extensions with encode.
+func encodeRuleTarget(family Family, r *Rule, encode func(Family, Target) ([]byte, error)) (target []byte, isGoto bool, err error) {
+	kind := r.TargetKind()
+	if r.Goto && kind != TargetGoto {
+		err = fmt.Errorf("goto requires a user-defined chain, not %s %q", kind, r.Target)
+		return
+	}
+	switch kind {
+	case TargetExtension:
+		target, err = encode(family, r.TargetExt)
+	default:
+		target, err = EncodeStandardTarget(r.Target)
+	}
+	isGoto = kind == TargetGoto
+	return
+}
+
+// DecodeTarget decodes a xt_entry_target structure, as found at the target offset of an ipt_entry/ip6t_entry.
+// Standard targets (verdicts and jumps) are returned as nil, as their name is available through libiptc.
+// Targets without a registered decoder, or whose payload cannot be decoded, are returned as RawTarget.
+func DecodeTarget(family Family, data []byte) (Target, error) {
+	name, revision, payload, _, err := decodeExtension(data)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	if decoder, ok := targetDecoders[extensionKey{name, revision}]; ok {
+		t, err := decoder(family, payload)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	raw := &RawTarget{TargetName: name, TargetRevision: revision}
+	raw.Data = append(raw.Data, payload...)
+	return raw, nil
+}
+
+func xtAlign(size int) int {
+	return (size + extensionAlign - 1) &^ (extensionAlign - 1)
+}
+
+// encodeExtension prefixes the payload with a xt_entry_match/xt_entry_target header and aligns it.
+func encodeExtension(name string, revision uint8, payload []byte) ([]byte, error) {
+	if len(name) >= XT_EXTENSION_MAXNAMELEN {
+		return nil, fmt.Errorf("extension name too long: %q", name)
+	}
+	size := extensionHeaderSize + xtAlign(len(payload))
+	if size > 0xffff {
+		return nil, fmt.Errorf("extension %s: payload too big", name)
+	}
+
+	ext := make([]byte, size)
+	nativeEndian.PutUint16(ext[0:2], uint16(size))
+	copy(ext[2:2+XT_EXTENSION_MAXNAMELEN], name)
+	ext[extensionHeaderSize-1] = revision
+	copy(ext[extensionHeaderSize:], payload)
+	return ext, nil
+}
+
+// decodeExtension parses the header of a xt_entry_match/xt_entry_target structure.
+func decodeExtension(data []byte) (name string, revision uint8, payload []byte, size int, err error) {
+	if len(data) < extensionHeaderSize {
+		err = fmt.Errorf("truncated extension header: %d bytes", len(data))
+		return
+	}
+	size = int(nativeEndian.Uint16(data[0:2]))
+	if size < extensionHeaderSize || size > len(data) {
+		err = fmt.Errorf("invalid extension size %d", size)
+		return
+	}
+	name = cString(data[2 : 2+XT_EXTENSION_MAXNAMELEN])
+	revision = data[extensionHeaderSize-1]
+	payload = data[extensionHeaderSize:size]
+	return
+}
+
+// PortRange is an inclusive range of ports; a single port has Min equal to Max.
+type PortRange struct {
+	Min uint16
+	Max uint16
+}
+
+// IsSingle returns true if the range contains exactly one port.
+func (p PortRange) IsSingle() bool {
+	return p.Min == p.Max
+}
+
+// String returns the range in iptables notation, either "port" or "min:max".
+func (p PortRange) String() string {
+	if p.IsSingle() {
+		return fmt.Sprintf("%d", p.Min)
+	}
+	return fmt.Sprintf("%d:%d", p.Min, p.Max)
+}
+
+// putInetAddr stores an address and its mask as two union nf_inet_addr; any address is stored as all zeroes.
+func putInetAddr(family Family, n Net) (addr, mask [16]byte, err error) {
+	if n.IsAny() {
+		return
+	}
+	if addr, err = putInetIP(family, n.Addr()); err != nil {
+		return
+	}
+	mask, err = putInetIP(family, n.MaskAddr())
+	return
+}
+
+// getInetAddr is the counterpart of putInetAddr.
+func getInetAddr(family Family, addr, mask [16]byte) Net {
+	// addresses and masks of the same family are always valid
+	n, _ := NetFromMask(getInetIP(family, addr), getInetIP(family, mask))
+	return n
+}
+
+// putInetIP stores an address as a union nf_inet_addr.
+func putInetIP(family Family, ip netip.Addr) (addr [16]byte, err error) {
+	switch {
+	case family == FamilyIPv4 && ip.Is4():
+		a := ip.As4()
+		copy(addr[:], a[:])
+		return
+	case family == FamilyIPv6 && ip.Is6() && !ip.Is4In6():
+		addr = ip.As16()
+		return
+	}
+	err = fmt.Errorf("not an %s address: %s", family, ip)
+	return
+}
+
+// getInetIP is the counterpart of putInetIP.
+func getInetIP(family Family, addr [16]byte) netip.Addr {
+	if family == FamilyIPv4 {
+		return netip.AddrFrom4([4]byte{addr[0], addr[1], addr[2], addr[3]})
+	}
+	return netip.AddrFrom16(addr)
+}
+
+// hton16 converts a 16-bit value between host and network byte order.
+func hton16(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return nativeEndian.Uint16(b[:])
+}
+
+// nativeEndian is the byte order used by the kernel for extension payloads.
+var nativeEndian = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// encodeStruct serializes a fixed-size struct mirroring a kernel payload layout;
+// padding must be spelled out with blank fields.
+func encodeStruct(v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, nativeEndian, v); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// sizeOf returns the size of a payload struct, as encoded by encodeStruct.
+func sizeOf(v interface{}) int {
+	return binary.Size(v)
+}
+
+// decodeStruct is the counterpart of encodeStruct; trailing alignment bytes in data are ignored.
+func decodeStruct(data []byte, v interface{}) error {
+	size := binary.Size(v)
+	if len(data) < size {
+		return fmt.Errorf("payload too short: %d bytes, expected %d", len(data), size)
+	}
+	return binary.Read(bytes.NewReader(data[:size]), nativeEndian, v)
+}
+
+// cString converts a NUL-terminated fixed-size C char array to a string.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// putCString copies a string in a fixed-size C char array, failing if there is no room for the terminating NUL.
+func putCString(dst []byte, s string) error {
+	if len(s) >= len(dst) {
+		return fmt.Errorf("string too long (max %d characters): %q", len(dst)-1, s)
+	}
+	copy(dst, s)
+	return nil
+}
@@ -0,0 +1,442 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// roundTripMatch encodes and decodes a single match.
+func roundTripMatch(t *testing.T, family Family, m Match) Match {
+	data, err := EncodeMatches(family, []Match{m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeMatches(family, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(decoded))
+	}
+	if _, ok := decoded[0].(*RawMatch); ok {
+		t.Fatalf("match %s/%d not decoded", m.Name(), m.Revision())
+	}
+	return decoded[0]
+}
+
+// roundTripTarget encodes and decodes a single target.
+func roundTripTarget(t *testing.T, family Family, target Target) Target {
+	data, err := EncodeTarget(family, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeTarget(family, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.(*RawTarget); ok || decoded == nil {
+		t.Fatalf("target %s/%d not decoded", target.Name(), target.Revision())
+	}
+	return decoded
+}
+
+// payloadOf returns the payload of an extension encoded for family.
+func payloadOf(t *testing.T, family Family, ext extension) []byte {
+	t.Helper()
+	data, err := ext.Encode(family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPayloadSizes(t *testing.T) {
+	// sizes as reported by sizeof() on x86_64; field offsets are checked by the tests of each extension
+	for _, tc := range []struct {
+		v    interface{}
+		size int
+	}{
+		{xtStateInfo{}, 4},
+		{xtConntrackMtinfo1{}, 152},
+		{xtConntrackMtinfo2{}, 156},
+		{xtConntrackMtinfo3{}, 164},
+		{xtTCP{}, 12},
+		{xtUDP{}, 10},
+		{xtICMP{}, 4},
+		{xtMultiportV1{}, 48},
+		{xtIPRangeMtinfo{}, 68},
+		{xtAddrTypeInfoV1{}, 8},
+		{xtMarkMtinfo1{}, 12},
+		{xtMarkTginfo2{}, 8},
+		{xtConnMarkTginfo1{}, 16},
+		{xtConnMarkTginfo2{}, 16},
+		{xtLogInfo{}, 32},
+		{xtNFLogInfo{}, 76},
+		{xtRejectInfo{}, 4},
+		{xtRateinfo{}, 40},
+		{xtHashlimitMtinfo1{}, 56},
+		{xtHashlimitMtinfo2{}, 304},
+		{xtHashlimitMtinfo3{}, 312},
+		{xtConnlimitInfo{}, 32},
+		{xtSetInfo{}, 4},
+		{xtSetInfoMatchV3{}, 48},
+		{xtSetInfoMatchV4{}, 48},
+		{xtRecentMtinfoV1{}, 228},
+		{xtStringInfo{}, 160},
+		{xtOwnerMatchInfo{}, 20},
+		{xtMacInfo{}, 12},
+		{xtPhysdevInfo{}, 66},
+		{xtPkttypeInfo{}, 8},
+		{xtLengthInfo{}, 6},
+		{xtU32Test{}, 180},
+		{xtU32{}, 1984},
+		{xtBpfInfoV1{}, 528},
+		{xtTproxyTargetInfoV1{}, 28},
+		{xtTcpmssInfo{}, 2},
+		{xtCtTargetInfoV1{}, 72},
+		{xtDSCPInfo{}, 1},
+		{xtTosTargetInfo{}, 2},
+		{xtDscpInfo{}, 2},
+		{xtTosMatchInfo{}, 3},
+		{xtTTLInfo{}, 2},
+		{xtClassifyTargetInfo{}, 4},
+		{xtNFQInfoV3{}, 6},
+	} {
+		if sizeOf(tc.v) != tc.size {
+			t.Errorf("%T: size %d, expected %d", tc.v, sizeOf(tc.v), tc.size)
+		}
+	}
+}
+
+func TestEncodeDecodeMatches(t *testing.T) {
+	matches := []Match{
+		&Comment{Text: "hello world"},
+		&RawMatch{MatchName: "unknown-match", MatchRevision: 3, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+	}
+
+	data, err := EncodeMatches(FamilyIPv4, matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != extensionHeaderSize+XT_MAX_COMMENT_LEN+extensionHeaderSize+8 {
+		t.Fatalf("unexpected encoded size %d", len(data))
+	}
+
+	decoded, err := DecodeMatches(FamilyIPv4, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(decoded))
+	}
+	if c, ok := decoded[0].(*Comment); !ok || c.Text != "hello world" {
+		t.Errorf("comment not decoded: %#v", decoded[0])
+	}
+	raw, ok := decoded[1].(*RawMatch)
+	if !ok || raw.Name() != "unknown-match" || raw.Revision() != 3 || !bytes.Equal(raw.Data, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("raw match not preserved: %#v", decoded[1])
+	}
+}
+
+func TestDecodeMatchesTruncated(t *testing.T) {
+	data, err := EncodeMatches(FamilyIPv6, []Match{&Comment{Text: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecodeMatches(FamilyIPv6, data[:len(data)-8])
+	if err == nil {
+		t.Fatal("truncated match decoded")
+	}
+}
+
+func TestCommentTooLong(t *testing.T) {
+	_, err := EncodeMatches(FamilyIPv4, []Match{&Comment{Text: string(make([]byte, XT_MAX_COMMENT_LEN))}})
+	if err == nil {
+		t.Fatal("comment too long encoded")
+	}
+}
+
+func TestOwner(t *testing.T) {
+	var r Rule
+	if _, ok := r.Owner(); ok {
+		t.Fatal("untagged rule has an owner")
+	}
+
+	r.Matches = []Match{&Comment{Text: "unrelated"}}
+	r.SetOwner("daemon-a")
+	r.SetOwner("daemon-b")
+	if len(r.Matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(r.Matches))
+	}
+	owner, ok := r.Owner()
+	if !ok || owner != "daemon-b" {
+		t.Fatalf("unexpected owner %q", owner)
+	}
+	if r.IsOwnedBy("daemon-a") || !r.IsOwnedBy("daemon-b") {
+		t.Fatal("wrong ownership")
+	}
+}
+
+func TestStandardTarget(t *testing.T) {
+	data, err := EncodeStandardTarget(IPTC_LABEL_ACCEPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sizeof(struct xt_standard_target), aligned
+	if len(data) != 40 {
+		t.Fatalf("unexpected size %d", len(data))
+	}
+
+	// libiptc clears the name of standard targets
+	data[2] = 0
+	target, err := DecodeTarget(FamilyIPv4, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != nil {
+		t.Fatalf("standard target decoded as %#v", target)
+	}
+
+	raw := &RawTarget{TargetName: "UNKNOWN", TargetRevision: 1, Data: make([]byte, 8)}
+	data, err = EncodeTarget(FamilyIPv6, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err = DecodeTarget(FamilyIPv6, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target, raw) {
+		t.Fatalf("expected %#v, got %#v", raw, target)
+	}
+}
+
+func TestRuleTarget(t *testing.T) {
+	for _, tc := range []struct {
+		rule    Rule
+		kind    TargetKind
+		verdict int32
+	}{
+		{Rule{}, TargetNone, 0},
+		{Rule{Target: IPTC_LABEL_ACCEPT}, TargetVerdict, -NF_ACCEPT - 1},
+		{Rule{Target: IPTC_LABEL_DROP}, TargetVerdict, -NF_DROP - 1},
+		{Rule{Target: IPTC_LABEL_RETURN}, TargetVerdict, XT_RETURN},
+		{Rule{Target: "CHAIN"}, TargetJump, 0},
+		{Rule{Target: "CHAIN", Goto: true}, TargetGoto, 0},
+		{Rule{Target: "MARK", TargetExt: NewOrMark(1)}, TargetExtension, 0},
+	} {
+		if kind := tc.rule.TargetKind(); kind != tc.kind {
+			t.Errorf("%q: kind %s, expected %s", tc.rule.Target, kind, tc.kind)
+		}
+		data, isGoto, err := EncodeRuleTarget(FamilyIPv4, &tc.rule)
+		if err != nil {
+			t.Errorf("%q: %v", tc.rule.Target, err)
+			continue
+		}
+		if isGoto != (tc.kind == TargetGoto) {
+			t.Errorf("%q: unexpected goto flag", tc.rule.Target)
+		}
+		if tc.kind == TargetExtension {
+			continue
+		}
+		var verdict int32
+		if err := decodeStruct(data[extensionHeaderSize:], &verdict); err != nil || verdict != tc.verdict {
+			t.Errorf("%q: verdict %d, expected %d", tc.rule.Target, verdict, tc.verdict)
+		}
+	}
+
+	for _, rule := range []Rule{
+		{Goto: true},
+		{Target: IPTC_LABEL_ACCEPT, Goto: true},
+		{Target: "MARK", TargetExt: NewOrMark(1), Goto: true},
+	} {
+		if _, _, err := EncodeRuleTarget(FamilyIPv6, &rule); err == nil {
+			t.Errorf("%q: goto encoded", rule.Target)
+		}
+	}
+}
+
+func TestInterface(t *testing.T) {
+	for _, tc := range []struct {
+		pattern    Interface
+		matches    []string
+		notMatches []string
+	}{
+		{"", []string{"eth0", "lo"}, nil},
+		{"eth0", []string{"eth0"}, []string{"eth", "eth00", "eth1"}},
+		{"eth+", []string{"eth", "eth0", "eth10"}, []string{"et", "wlan0"}},
+		{"+", []string{"eth0", "lo"}, nil},
+	} {
+		for _, name := range tc.matches {
+			if !tc.pattern.MatchesInterface(name) {
+				t.Errorf("%q does not match %q", tc.pattern, name)
+			}
+		}
+		for _, name := range tc.notMatches {
+			if tc.pattern.MatchesInterface(name) {
+				t.Errorf("%q matches %q", tc.pattern, name)
+			}
+		}
+
+		iface, mask, err := tc.pattern.Entry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded := InterfaceFromEntry(iface, mask); decoded != tc.pattern {
+			t.Errorf("%q decoded as %q", tc.pattern, decoded)
+		}
+	}
+
+	// exact names include the terminating NUL in the mask
+	_, mask, _ := Interface("eth0").Entry()
+	if mask != [IFNAMSIZ]byte{0xff, 0xff, 0xff, 0xff, 0xff} {
+		t.Errorf("unexpected mask %x", mask)
+	}
+
+	// prefix without trailing '+', as created by other tools
+	var iface [IFNAMSIZ]byte
+	copy(iface[:], "eth")
+	if decoded := InterfaceFromEntry(iface, [IFNAMSIZ]byte{0xff, 0xff, 0xff}); decoded != "eth+" {
+		t.Errorf("prefix decoded as %q", decoded)
+	}
+
+	if _, _, err := Interface("averyveryverylongname").Entry(); err == nil {
+		t.Error("long name encoded")
+	}
+}
+
+func TestNet(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		str   string
+		cidr  bool
+		mask  string
+		in    []string
+		notIn []string
+	}{
+		{"0.0.0.0/0", "any", true, "", []string{"10.0.0.1", "::1"}, nil},
+		{"10.1.2.3", "10.1.2.3/32", true, "255.255.255.255", []string{"10.1.2.3"}, []string{"10.1.2.4"}},
+		{"10.1.2.3/8", "10.0.0.0/8", true, "255.0.0.0", []string{"10.255.0.1"}, []string{"11.0.0.1"}},
+		{"10.1.2.3/255.255.0.0", "10.1.0.0/16", true, "255.255.0.0", []string{"10.1.9.9"}, []string{"10.2.0.1"}},
+		{"10.1.2.3/255.0.255.0", "10.0.2.0/255.0.255.0", false, "255.0.255.0", []string{"10.9.2.9"}, []string{"10.1.3.3", "::1"}},
+		{"2001:db8::1/32", "2001:db8::/32", true, "ffff:ffff::", []string{"2001:db8:1::1"}, []string{"2001:db9::1", "10.0.0.1"}},
+	} {
+		n, err := ParseNet(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.String() != tc.str || n.IsCIDR() != tc.cidr {
+			t.Errorf("%s: parsed as %s (CIDR: %v)", tc.s, n, n.IsCIDR())
+		}
+		if mask := n.MaskAddr(); (tc.mask == "" && mask.IsValid()) || (tc.mask != "" && mask.String() != tc.mask) {
+			t.Errorf("%s: unexpected mask %s", tc.s, mask)
+		}
+		for _, s := range tc.in {
+			if !n.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s does not contain %s", n, s)
+			}
+		}
+		for _, s := range tc.notIn {
+			if n.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s contains %s", n, s)
+			}
+		}
+
+		decoded, err := NetFromIPNet(n.IPNet())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != n {
+			t.Errorf("%s: IPNet round trip returned %s", n, decoded)
+		}
+	}
+
+	_, ipNet, _ := net.ParseCIDR("192.168.0.0/16")
+	if n, err := NetFromIPNet(ipNet); err != nil || n != NetFromPrefix(netip.MustParsePrefix("192.168.0.0/16")) {
+		t.Errorf("unexpected conversion of %s: %s", ipNet, n)
+	}
+
+	for _, s := range []string{"", "10.0.0.1/33", "10.0.0.1/ffff::", "host"} {
+		if _, err := ParseNet(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestRuleKey(t *testing.T) {
+	newRule := func() Rule {
+		r := Rule{
+			Src:       NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8")),
+			InDev:     "eth+",
+			Proto:     6,
+			Matches:   []Match{&Comment{Text: "web"}},
+			Target:    "MARK",
+			TargetExt: NewOrMark(1),
+		}
+		r.Not.Src = true
+		return r
+	}
+
+	seen := map[RuleKey]bool{}
+	a, b := newRule(), newRule()
+	b.Pcnt, b.Bcnt = 10, 1000
+	for _, r := range []Rule{a, b} {
+		k, err := r.Key(FamilyIPv4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[k] = true
+	}
+	if len(seen) != 1 {
+		t.Errorf("expected equal keys, got %d", len(seen))
+	}
+
+	b.Matches = []Match{&Comment{Text: "ssh"}}
+	k, err := b.Key(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen[k] {
+		t.Error("different matches have the same key")
+	}
+
+	// as read back from the kernel
+	c := newRule()
+	c.Proto, c.Target = 0, ""
+	c.Matches = append(c.Matches, &TCP{DstPort: &PortRange{22, 22}})
+	d := c
+	d.Proto, d.Target = IPPROTO_TCP, "MARK"
+	kc, err := c.Key(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kd, err := d.Key(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kc != kd {
+		t.Error("implied protocol or extension target name changed the key")
+	}
+}
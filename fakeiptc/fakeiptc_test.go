@@ -0,0 +1,499 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package fakeiptc
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+const seed = `*filter
+:INPUT DROP [10:600]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:SSH - [0:0]
+[3:180] -A INPUT -p tcp -m tcp --dport 22 -j SSH
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A SSH -s 10.0.0.0/8 -j ACCEPT
+COMMIT
+`
+
+func newHandle(t *testing.T, family common.Family, tableName string) (*Kernel, *Handle) {
+	k := NewKernel(family)
+	h, err := k.TableInit(tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, h
+}
+
+func expectError(t *testing.T, err error, message string) {
+	t.Helper()
+	if err == nil || err.Error() != message {
+		t.Errorf("expected error %q, got %v", message, err)
+	}
+}
+
+func TestTableInit(t *testing.T) {
+	k := NewKernel(common.FamilyIPv4)
+	if tables := k.Tables(); !reflect.DeepEqual(tables, []string{"filter", "mangle", "nat", "raw", "security"}) {
+		t.Errorf("unexpected tables %v", tables)
+	}
+	h, err := k.TableInit("nat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains, _ := h.Chains()
+	if !reflect.DeepEqual(chains, []common.XtChainLabel{"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"}) {
+		t.Errorf("unexpected chains %v", chains)
+	}
+	policy, _, err := h.GetPolicy("POSTROUTING")
+	if err != nil || policy != common.IPTC_LABEL_ACCEPT {
+		t.Errorf("unexpected policy %q, %v", policy, err)
+	}
+
+	_, err = k.TableInit("nonexistent")
+	if _, ok := err.(*common.UnavailableError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestChains(t *testing.T) {
+	_, h := newHandle(t, common.FamilyIPv4, "filter")
+
+	for _, name := range []common.XtChainLabel{"b", "a"} {
+		if _, err := h.CreateChain(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chains, _ := h.Chains()
+	if !reflect.DeepEqual(chains, []common.XtChainLabel{"INPUT", "FORWARD", "OUTPUT", "a", "b"}) {
+		t.Errorf("unexpected chains %v", chains)
+	}
+	_, err := h.CreateChain("a")
+	expectError(t, err, "iptc_create_chain: Chain already exists")
+	_, err = h.CreateChain("ACCEPT")
+	expectError(t, err, "iptc_create_chain: Chain already exists")
+	_, err = h.CreateChain("0123456789012345678901234567890123")
+	expectError(t, err, "iptc_create_chain: Invalid argument")
+
+	if err := h.AppendRule("INPUT", &common.Rule{Target: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if refs, err := h.GetReferences("a"); err != nil || refs != 1 {
+		t.Errorf("unexpected references %d, %v", refs, err)
+	}
+	_, err = h.DeleteChain("a")
+	expectError(t, err, "iptc_delete_chain: Can't delete chain with references left")
+	_, err = h.DeleteChain("INPUT")
+	expectError(t, err, "iptc_delete_chain: Can't delete built-in chain")
+	_, err = h.DeleteChain("c")
+	expectError(t, err, "iptc_delete_chain: No chain/target/match by that name")
+	if err := h.AppendRule("b", &common.Rule{Target: "ACCEPT"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.DeleteChain("b")
+	expectError(t, err, "iptc_delete_chain: Chain is not empty")
+
+	// jumps follow renamed chains
+	if _, err := h.RenameChain("a", "z"); err != nil {
+		t.Fatal(err)
+	}
+	rules, _ := h.Rules("INPUT")
+	if rules[0].Target != "z" {
+		t.Errorf("jump not renamed: %+v", rules[0])
+	}
+	_, err = h.RenameChain("b", "z")
+	expectError(t, err, "iptc_rename_chain: File exists")
+	_, err = h.RenameChain("OUTPUT", "y")
+	expectError(t, err, "iptc_rename_chain: No chain/target/match by that name")
+
+	_, err = h.SetPolicy("z", "DROP", nil)
+	expectError(t, err, "iptc_set_policy: Bad built-in chain name")
+	_, err = h.SetPolicy("INPUT", "RETURN", nil)
+	expectError(t, err, "iptc_set_policy: Bad policy name")
+	_, _, err = h.GetPolicy("z")
+	expectError(t, err, "iptc_get_policy: Incompatible with this kernel")
+
+	if _, err := h.FlushEntries("INPUT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DeleteChain("z"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	_, h := newHandle(t, common.FamilyIPv6, "mangle")
+
+	ssh := &common.Rule{
+		Src:       common.NetFromPrefix(netip.MustParsePrefix("2001:db8::/32")),
+		InDev:     "eth+",
+		Matches:   []common.Match{&common.TCP{DstPort: &common.PortRange{Min: 22, Max: 22}}},
+		TargetExt: common.NewOrMark(1),
+	}
+	if err := h.AppendRule("PREROUTING", ssh); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.InsertRule("PREROUTING", &common.Rule{Target: "ACCEPT"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	err := h.InsertRule("PREROUTING", &common.Rule{Target: "ACCEPT"}, 3)
+	expectError(t, err, "ip6tc_insert_entry: Index of insertion too big")
+	err = h.AppendRule("FOO", &common.Rule{Target: "ACCEPT"})
+	expectError(t, err, "ip6tc_append_entry: No chain/target/match by that name")
+	err = h.AppendRule("INPUT", &common.Rule{Target: "FOO"})
+	expectError(t, err, `chain "FOO" does not exist`)
+	err = h.AppendRule("INPUT", &common.Rule{Target: "OUTPUT"})
+	expectError(t, err, `cannot jump to built-in chain "OUTPUT"`)
+	err = h.AppendRule("INPUT", &common.Rule{Src: common.NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8"))})
+	expectError(t, err, "not an IPv6 address: 10.0.0.0/8")
+
+	// rules are read back as from the kernel
+	rules, err := h.Rules("PREROUTING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Target != "ACCEPT" {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+	if r := rules[1]; r.Proto != common.IPPROTO_TCP || r.Target != "MARK" || !reflect.DeepEqual(r.TargetExt, ssh.TargetExt) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if found, err := h.CheckRule("PREROUTING", ssh); err != nil || !found {
+		t.Errorf("rule not found: %v", err)
+	}
+	if deleted, err := h.DeleteRule("PREROUTING", ssh); err != nil || !deleted {
+		t.Errorf("rule not deleted: %v", err)
+	}
+	if deleted, err := h.DeleteRule("PREROUTING", ssh); err != nil || deleted {
+		t.Errorf("rule deleted twice: %v", err)
+	}
+	_, err = h.DeleteNumEntry("PREROUTING", 1)
+	expectError(t, err, "ip6tc_delete_num_entry: Index of deletion too big")
+	_, err = h.Rules("FOO")
+	expectError(t, err, "ip6tc_first_rule: No chain/target/match by that name")
+}
+
+func TestCommit(t *testing.T) {
+	k, h := newHandle(t, common.FamilyIPv4, "filter")
+	if err := k.SeedString(seed); err != nil {
+		t.Fatal(err)
+	}
+	// the handle was initialized before seeding, which changed the number of entries
+	expectError(t, h.Commit(), "iptc_commit: Resource temporarily unavailable")
+
+	h, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.CreateChain("LOGDROP"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := other.IsChain("LOGDROP"); ok {
+		t.Error("uncommitted chain visible to other handles")
+	}
+	if err := h.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, other.Commit(), "iptc_commit: Resource temporarily unavailable")
+
+	h, err = k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := h.IsChain("LOGDROP"); !ok {
+		t.Error("committed chain not visible")
+	}
+	if rules, _ := h.Rules("SSH"); len(rules) != 1 || rules[0].Src.String() != "10.0.0.0/8" {
+		t.Errorf("unexpected seeded rules %v", rules)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	k := NewKernel(common.FamilyIPv4)
+	if err := k.SeedString(seed); err != nil {
+		t.Fatal(err)
+	}
+	h, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := h.ReadCounter("INPUT", 1); err != nil || c != (common.XtCounters{Pcnt: 3, Bcnt: 180}) {
+		t.Errorf("unexpected counters %+v, %v", c, err)
+	}
+	_, err = h.ReadCounter("INPUT", 0)
+	expectError(t, err, "iptc_read_counter: Index of counter too big")
+	_, err = h.ZeroCounter("INPUT", 3)
+	expectError(t, err, "iptc_read_counter: Index of counter too big")
+	_, err = h.SetCounter("INPUT", 3, common.XtCounters{})
+	expectError(t, err, "iptc_set_counter: Argument list too long")
+
+	// traffic counted while the handle is in use is kept on commit, unless counters are set
+	if _, err := h.ZeroCounter("INPUT", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.SetCounter("SSH", 1, common.XtCounters{Pcnt: 1, Bcnt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct {
+		chain   common.XtChainLabel
+		ruleNum uint
+	}{{"INPUT", 1}, {"INPUT", 2}, {"SSH", 1}} {
+		if err := k.Count("filter", r.chain, r.ruleNum, 1, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.CountPolicy("filter", "INPUT", 2, 120); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := h.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, ssh := table.Chain("INPUT"), table.Chain("SSH")
+	for _, c := range []struct {
+		got, expected common.XtCounters
+	}{
+		{input.Counters, common.XtCounters{Pcnt: 12, Bcnt: 720}},
+		{input.Rules[0].XtCounters, common.XtCounters{Pcnt: 1, Bcnt: 100}},
+		{input.Rules[1].XtCounters, common.XtCounters{Pcnt: 1, Bcnt: 100}},
+		{ssh.Rules[0].XtCounters, common.XtCounters{Pcnt: 1, Bcnt: 2}},
+	} {
+		if c.got != c.expected {
+			t.Errorf("expected counters %+v, got %+v", c.expected, c.got)
+		}
+	}
+}
+
+func TestOwnedAndRestore(t *testing.T) {
+	k := NewKernel(common.FamilyIPv4)
+	if err := k.SeedString(seed); err != nil {
+		t.Fatal(err)
+	}
+	h, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := h.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[common.XtChainLabel][]*common.Rule{"INPUT": {{Target: "ACCEPT", InDev: "lo"}}}
+	if err := h.ReplaceOwned("test", rules); err != nil {
+		t.Fatal(err)
+	}
+	h, err = k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owned, err := h.ListOwned("test")
+	if err != nil || len(owned["INPUT"]) != 1 || owned["INPUT"][0].InDev != "lo" {
+		t.Errorf("unexpected owned rules %v, %v", owned, err)
+	}
+	if deleted, err := h.DeleteOwned("test"); err != nil || deleted != 1 {
+		t.Errorf("unexpected deletion %d, %v", deleted, err)
+	}
+
+	h, err = k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.CreateChain("EXTRA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Restore(saved); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := h.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, saved) {
+		t.Errorf("expected %+v, got %+v", saved, restored)
+	}
+}
+
+func TestPoller(t *testing.T) {
+	k := NewKernel(common.FamilyIPv4)
+	if err := k.SeedString(seed); err != nil {
+		t.Fatal(err)
+	}
+	p := k.NewPoller("filter")
+	d, err := p.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Table != "filter" || d.Interval != 0 || len(d.Rules) != 3 || len(d.Chains) != 4 {
+		t.Fatalf("unexpected first poll %+v", d)
+	}
+	for _, rd := range d.Rules {
+		if !rd.New || rd.Delta != (common.XtCounters{}) {
+			t.Errorf("unexpected delta of first poll %+v", rd)
+		}
+	}
+
+	// inserting a rule shifts the numbers of the following ones
+	h, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := &common.Rule{Proto: common.IPPROTO_TCP, Target: common.IPTC_LABEL_ACCEPT,
+		Matches: []common.Match{&common.Comment{Text: "web"}, &common.TCP{DstPort: &common.PortRange{Min: 80, Max: 80}}}}
+	if err := h.InsertRule("INPUT", web, 0); err != nil {
+		t.Fatal(err)
+	}
+	duplicate := &common.Rule{Src: common.NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8")), Target: common.IPTC_LABEL_ACCEPT}
+	if err := h.AppendRule("SSH", duplicate); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		chain   common.XtChainLabel
+		ruleNum uint
+		packets uint64
+	}{{"INPUT", 1, 7}, {"INPUT", 3, 5}, {"SSH", 1, 2}} {
+		if err := k.Count("filter", c.chain, c.ruleNum, c.packets, c.packets*100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.CountPolicy("filter", "INPUT", 2, 120); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+	d, err = p.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Interval <= 0 || len(d.Rules) != 5 {
+		t.Fatalf("unexpected poll %+v", d)
+	}
+	expected := []struct {
+		id    string
+		num   uint
+		new   bool
+		delta common.XtCounters
+	}{
+		{"INPUT/comment:web", 1, true, common.XtCounters{}},
+		{"INPUT/", 2, false, common.XtCounters{}},
+		{"INPUT/", 3, false, common.XtCounters{Pcnt: 5, Bcnt: 500}},
+		{"SSH/", 1, false, common.XtCounters{Pcnt: 2, Bcnt: 200}},
+		{"SSH/", 2, true, common.XtCounters{}},
+	}
+	for i, e := range expected {
+		rd := d.Rules[i]
+		if !strings.HasPrefix(rd.ID.String(), e.id) || rd.Num != e.num || rd.New != e.new || rd.Delta != e.delta {
+			t.Errorf("rule %d: unexpected delta %+v", i, rd)
+		}
+	}
+	if d.Rules[3].ID.Hash != d.Rules[4].ID.Hash || d.Rules[4].ID.Occurrence != 1 {
+		t.Errorf("duplicate rules not told apart: %v, %v", d.Rules[3].ID, d.Rules[4].ID)
+	}
+	input := d.Chains[0]
+	if input.Chain != "INPUT" || input.Rules.Delta != (common.XtCounters{Pcnt: 5, Bcnt: 500}) ||
+		input.Policy.Delta != (common.XtCounters{Pcnt: 2, Bcnt: 120}) {
+		t.Errorf("unexpected chain delta %+v", input)
+	}
+	if seconds := d.Interval.Seconds(); input.Rules.PacketsPerSecond != 5/seconds || input.Rules.BytesPerSecond != 500/seconds {
+		t.Errorf("unexpected rates %+v over %v", input.Rules, d.Interval)
+	}
+
+	// zeroed counters are taken as reset
+	h, err = k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ZeroEntries("INPUT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Count("filter", "INPUT", 3, 1, 50); err != nil {
+		t.Fatal(err)
+	}
+	d, err = p.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Rules[0].New || d.Rules[0].Delta != (common.XtCounters{}) || d.Rules[2].Delta != (common.XtCounters{Pcnt: 1, Bcnt: 50}) {
+		t.Errorf("unexpected deltas after zeroing %+v", d.Rules)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *common.CounterDeltas)
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx, time.Millisecond, ch)
+	}()
+	if d := <-ch; d == nil || d.Interval <= 0 {
+		t.Errorf("unexpected deltas %+v", d)
+	}
+	cancel()
+	for range ch {
+	}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestMalformedEntry(t *testing.T) {
+	k := NewKernel(common.FamilyIPv4)
+	if err := k.SeedString(seed); err != nil {
+		t.Fatal(err)
+	}
+	h, err := k.TableInit("filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a match header with a size bigger than the matches
+	h.table.chain("INPUT").entries[1].matches[0] = 0xff
+	if _, err := h.Rules("INPUT"); err == nil {
+		t.Error("malformed entry decoded")
+	}
+	if _, err := h.Snapshot(); err == nil {
+		t.Error("malformed entry decoded")
+	}
+	if _, err := h.ListOwned("test"); err == nil {
+		t.Error("malformed entry decoded")
+	}
+}
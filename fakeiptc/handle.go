@@ -0,0 +1,612 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package fakeiptc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+var _ common.Handle = (*Handle)(nil)
+
+// errAgain is the error of the kernel when a table changed since a handle was initialized.
+var errAgain = syscall.EAGAIN
+
+// messages are the ones of iptc_strerror(), which looks for the function being called first.
+var messages = []struct {
+	fn      string
+	errno   syscall.Errno
+	message string
+}{
+	{"delete_chain", syscall.ENOTEMPTY, "Chain is not empty"},
+	{"delete_chain", syscall.EINVAL, "Can't delete built-in chain"},
+	{"delete_chain", syscall.EMLINK, "Can't delete chain with references left"},
+	{"create_chain", syscall.EEXIST, "Chain already exists"},
+	{"insert_entry", syscall.E2BIG, "Index of insertion too big"},
+	{"delete_num_entry", syscall.E2BIG, "Index of deletion too big"},
+	{"read_counter", syscall.E2BIG, "Index of counter too big"},
+	{"zero_counter", syscall.E2BIG, "Index of counter too big"},
+	{"set_policy", syscall.ENOENT, "Bad built-in chain name"},
+	{"set_policy", syscall.EINVAL, "Bad policy name"},
+	{"", 0, "Incompatible with this kernel"},
+	{"", syscall.ENOENT, "No chain/target/match by that name"},
+}
+
+// strerror returns the message of iptc_strerror() for an error of a libiptc function, like "create_chain";
+// other errors are described as by strerror().
+func strerror(fn string, errno syscall.Errno) string {
+	for _, m := range messages {
+		if (m.fn == "" || m.fn == fn) && m.errno == errno {
+			return m.message
+		}
+	}
+	s := errno.Error()
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Handle is a handle on a table of a Kernel, implementing the API of the real handles with the same
+// errors; it must not be used once freed, and it is not safe for concurrent use.
+type Handle struct {
+	kernel *Kernel
+	name   string
+	table  *tableState
+	// numEntries is the number of entries of the committed table when the handle was initialized
+	numEntries int
+}
+
+// fail returns the error of a real handle for a libiptc function, like "create_chain"; context is the
+// function named in the error, which differs for ZeroCounter.
+func (h *Handle) fail(context, fn string, errno syscall.Errno) error {
+	prefix := "iptc_"
+	if h.kernel.family == common.FamilyIPv6 {
+		prefix = "ip6tc_"
+	}
+	return fmt.Errorf("%s%s: %s", prefix, context, strerror(fn, errno))
+}
+
+// IsChain returns whether the chain exists.
+func (h *Handle) IsChain(chain string) (bool, error) {
+	return h.table.chain(common.XtChainLabel(chain)) != nil, nil
+}
+
+// IsBuiltin returns whether the chain is a built-in chain.
+func (h *Handle) IsBuiltin(chain string) (bool, error) {
+	c := h.table.chain(common.XtChainLabel(chain))
+	return c != nil && c.policy != "", nil
+}
+
+// Chains returns the names of all chains of the table.
+func (h *Handle) Chains() ([]common.XtChainLabel, error) {
+	var chains []common.XtChainLabel
+	for _, c := range h.table.chains {
+		chains = append(chains, c.name)
+	}
+	return chains, nil
+}
+
+// GetPolicy returns the policy and counters of a built-in chain.
+func (h *Handle) GetPolicy(chain string) (policy string, counters common.XtCounters, err error) {
+	c := h.table.chain(common.XtChainLabel(chain))
+	if c == nil {
+		return "", counters, h.fail("get_policy", "get_policy", syscall.ENOENT)
+	}
+	if c.policy == "" {
+		// libiptc fails without setting errno
+		return "", counters, h.fail("get_policy", "get_policy", 0)
+	}
+	return c.policy, c.counters, nil
+}
+
+// GetReferences returns the number of rules jumping to the chain.
+func (h *Handle) GetReferences(chain common.XtChainLabel) (uint, error) {
+	if h.table.chain(chain) == nil {
+		return 0, h.fail("get_references", "get_references", syscall.ENOENT)
+	}
+	return h.table.references(chain), nil
+}
+
+// CreateChain creates a user-defined chain.
+func (h *Handle) CreateChain(chain common.XtChainLabel) (bool, error) {
+	if h.table.chain(chain) != nil || common.IsVerdict(string(chain)) {
+		return false, h.fail("create_chain", "create_chain", syscall.EEXIST)
+	}
+	if len(chain) >= common.XT_TABLE_MAXNAMELEN {
+		return false, h.fail("create_chain", "create_chain", syscall.EINVAL)
+	}
+	h.table.chains = append(h.table.chains, &chainState{name: chain})
+	h.table.sortChains()
+	return true, nil
+}
+
+// DeleteChain deletes an empty user-defined chain that no rule jumps to.
+func (h *Handle) DeleteChain(chain common.XtChainLabel) (bool, error) {
+	c := h.table.chain(chain)
+	switch {
+	case c == nil:
+		return false, h.fail("delete_chain", "delete_chain", syscall.ENOENT)
+	case c.policy != "":
+		return false, h.fail("delete_chain", "delete_chain", syscall.EINVAL)
+	case h.table.references(chain) != 0:
+		return false, h.fail("delete_chain", "delete_chain", syscall.EMLINK)
+	case len(c.entries) != 0:
+		return false, h.fail("delete_chain", "delete_chain", syscall.ENOTEMPTY)
+	}
+	for i, tc := range h.table.chains {
+		if tc == c {
+			h.table.chains = append(h.table.chains[:i], h.table.chains[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// RenameChain renames a user-defined chain; rules jumping to it follow, as libiptc refers to chains by position.
+func (h *Handle) RenameChain(oldName, newName common.XtChainLabel) (bool, error) {
+	if h.table.chain(newName) != nil || common.IsVerdict(string(newName)) {
+		return false, h.fail("rename_chain", "rename_chain", syscall.EEXIST)
+	}
+	c := h.table.chain(oldName)
+	if c == nil || c.policy != "" {
+		return false, h.fail("rename_chain", "rename_chain", syscall.ENOENT)
+	}
+	if len(newName) >= common.XT_TABLE_MAXNAMELEN {
+		return false, h.fail("rename_chain", "rename_chain", syscall.EINVAL)
+	}
+	for _, tc := range h.table.chains {
+		for _, e := range tc.entries {
+			if kind := e.rule.TargetKind(); (kind == common.TargetJump || kind == common.TargetGoto) && e.rule.Target == string(oldName) {
+				e.rule.Target = string(newName)
+			}
+		}
+	}
+	c.name = newName
+	h.table.sortChains()
+	return true, nil
+}
+
+// SetPolicy sets the policy of a built-in chain, and its counters unless nil.
+func (h *Handle) SetPolicy(chain, policy common.XtChainLabel, counters *common.XtCounters) (bool, error) {
+	c := h.table.chain(chain)
+	if c == nil || c.policy == "" {
+		return false, h.fail("set_policy", "set_policy", syscall.ENOENT)
+	}
+	if policy != common.IPTC_LABEL_ACCEPT && policy != common.IPTC_LABEL_DROP {
+		return false, h.fail("set_policy", "set_policy", syscall.EINVAL)
+	}
+	c.policy = string(policy)
+	if counters != nil {
+		c.counters, c.countersSet = *counters, true
+	}
+	return true, nil
+}
+
+// FlushEntries deletes all rules of the chain.
+func (h *Handle) FlushEntries(chain common.XtChainLabel) (bool, error) {
+	c := h.table.chain(chain)
+	if c == nil {
+		return false, h.fail("flush_entries", "flush_entries", syscall.ENOENT)
+	}
+	c.entries = nil
+	return true, nil
+}
+
+// ZeroEntries zeroes the counters of all rules of the chain.
+func (h *Handle) ZeroEntries(chain common.XtChainLabel) (bool, error) {
+	c := h.table.chain(chain)
+	if c == nil {
+		return false, h.fail("zero_entries", "zero_entries", syscall.ENOENT)
+	}
+	for _, e := range c.entries {
+		e.zero()
+	}
+	return true, nil
+}
+
+// zero clears the counters; traffic counted from now on is kept on commit.
+func (e *entry) zero() {
+	e.rule.XtCounters = common.XtCounters{}
+	if e.origin == nil {
+		return
+	}
+	e.counters, e.base = countersZeroed, e.origin.rule.XtCounters
+}
+
+// Rules returns the rules of a chain, as read back from a kernel.
+func (h *Handle) Rules(chain common.XtChainLabel) ([]*common.Rule, error) {
+	c := h.table.chain(chain)
+	if c == nil {
+		return nil, h.fail("first_rule", "first_rule", syscall.ENOENT)
+	}
+	var rules []*common.Rule
+	for _, e := range c.entries {
+		rule, err := e.toRule(h.kernel.family)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// newEntry checks a rule as the real handles do before passing it to libiptc.
+func (h *Handle) newEntry(rule *common.Rule) (*entry, error) {
+	e, err := newEntry(h.kernel.family, rule)
+	if err != nil {
+		return nil, err
+	}
+	if kind := rule.TargetKind(); kind == common.TargetJump || kind == common.TargetGoto {
+		c := h.table.chain(common.XtChainLabel(rule.Target))
+		if c == nil {
+			return nil, fmt.Errorf("chain %q does not exist", rule.Target)
+		}
+		if c.policy != "" {
+			return nil, fmt.Errorf("cannot jump to built-in chain %q", rule.Target)
+		}
+	}
+	return e, nil
+}
+
+// InsertRule inserts a rule at position ruleNum of the chain, starting at 0.
+func (h *Handle) InsertRule(chain common.XtChainLabel, rule *common.Rule, ruleNum uint) error {
+	e, err := h.newEntry(rule)
+	if err != nil {
+		return err
+	}
+	c := h.table.chain(chain)
+	if c == nil {
+		return h.fail("insert_entry", "insert_entry", syscall.ENOENT)
+	}
+	if ruleNum > uint(len(c.entries)) {
+		return h.fail("insert_entry", "insert_entry", syscall.E2BIG)
+	}
+	c.entries = append(c.entries, nil)
+	copy(c.entries[ruleNum+1:], c.entries[ruleNum:])
+	c.entries[ruleNum] = e
+	return nil
+}
+
+// AppendRule appends a rule to the chain.
+func (h *Handle) AppendRule(chain common.XtChainLabel, rule *common.Rule) error {
+	e, err := h.newEntry(rule)
+	if err != nil {
+		return err
+	}
+	c := h.table.chain(chain)
+	if c == nil {
+		return h.fail("append_entry", "append_entry", syscall.ENOENT)
+	}
+	c.entries = append(c.entries, e)
+	return nil
+}
+
+// CheckRule returns whether the chain has a rule equal to rule, as compared by common.Rule.Key.
+func (h *Handle) CheckRule(chain common.XtChainLabel, rule *common.Rule) (bool, error) {
+	rules, err := h.Rules(chain)
+	if err != nil {
+		return false, err
+	}
+	i, err := common.IndexRule(h.kernel.family, rules, rule)
+	return i >= 0, err
+}
+
+// DeleteRule deletes the first rule of the chain equal to rule, as compared by common.Rule.Key;
+// it returns false if there is none.
+func (h *Handle) DeleteRule(chain common.XtChainLabel, rule *common.Rule) (bool, error) {
+	rules, err := h.Rules(chain)
+	if err != nil {
+		return false, err
+	}
+	i, err := common.IndexRule(h.kernel.family, rules, rule)
+	if err != nil || i < 0 {
+		return false, err
+	}
+	return h.DeleteNumEntry(chain, uint(i))
+}
+
+// DeleteNumEntry deletes the rule at position ruleNum of the chain, starting at 0.
+func (h *Handle) DeleteNumEntry(chain common.XtChainLabel, ruleNum uint) (bool, error) {
+	c := h.table.chain(chain)
+	if c == nil {
+		return false, h.fail("delete_num_entry", "delete_num_entry", syscall.ENOENT)
+	}
+	if ruleNum >= uint(len(c.entries)) {
+		return false, h.fail("delete_num_entry", "delete_num_entry", syscall.E2BIG)
+	}
+	c.entries = append(c.entries[:ruleNum], c.entries[ruleNum+1:]...)
+	return true, nil
+}
+
+// counterEntry returns the entry at ruleNum, starting at 1, with errors for function fn.
+func (h *Handle) counterEntry(context, fn string, chain common.XtChainLabel, ruleNum uint) (*entry, error) {
+	c := h.table.chain(chain)
+	if c == nil {
+		return nil, h.fail(context, fn, syscall.ENOENT)
+	}
+	if ruleNum == 0 || ruleNum > uint(len(c.entries)) {
+		return nil, h.fail(context, fn, syscall.E2BIG)
+	}
+	return c.entries[ruleNum-1], nil
+}
+
+// ReadCounter returns the counters of the rule at position ruleNum of the chain, starting at 1; they are
+// the ones of when the handle was initialized, unless changed through it.
+func (h *Handle) ReadCounter(chain common.XtChainLabel, ruleNum uint) (common.XtCounters, error) {
+	e, err := h.counterEntry("read_counter", "read_counter", chain, ruleNum)
+	if err != nil {
+		return common.XtCounters{}, err
+	}
+	return e.rule.XtCounters, nil
+}
+
+// ZeroCounter zeroes the counters of the rule at position ruleNum of the chain, starting at 1.
+func (h *Handle) ZeroCounter(chain common.XtChainLabel, ruleNum uint) (bool, error) {
+	// the real handles name iptc_read_counter in errors
+	e, err := h.counterEntry("read_counter", "zero_counter", chain, ruleNum)
+	if err != nil {
+		return false, err
+	}
+	e.zero()
+	return true, nil
+}
+
+// SetCounter sets the counters of the rule at position ruleNum of the chain, starting at 1.
+func (h *Handle) SetCounter(chain common.XtChainLabel, ruleNum uint, counters common.XtCounters) (bool, error) {
+	e, err := h.counterEntry("set_counter", "set_counter", chain, ruleNum)
+	if err != nil {
+		return false, err
+	}
+	e.rule.XtCounters, e.counters = counters, countersSet
+	return true, nil
+}
+
+// Commit replaces the table of the kernel with the one of the handle. As with a real kernel, it fails
+// when the number of entries of the table changed since the handle was initialized, and changes made
+// by other handles in the meantime are lost otherwise.
+func (h *Handle) Commit() error {
+	if err := h.kernel.commit(h.name, h.table, h.numEntries); err != nil {
+		return h.fail("commit", "commit", errAgain)
+	}
+	return nil
+}
+
+// Free releases the handle, discarding uncommitted changes.
+func (h *Handle) Free() error {
+	h.table = nil
+	return nil
+}
+
+// ListOwned returns all rules tagged with the specified owner, grouped by chain.
+func (h *Handle) ListOwned(owner string) (map[common.XtChainLabel][]*common.Rule, error) {
+	if owner == "" {
+		return nil, errors.New("empty owner")
+	}
+	result := map[common.XtChainLabel][]*common.Rule{}
+	for _, c := range h.table.chains {
+		for _, e := range c.entries {
+			rule, err := e.toRule(h.kernel.family)
+			if err != nil {
+				return nil, err
+			}
+			if rule.IsOwnedBy(owner) {
+				result[c.name] = append(result[c.name], rule)
+			}
+		}
+	}
+	return result, nil
+}
+
+// deleteOwned deletes all rules tagged with the specified owner from all chains, without committing.
+func (h *Handle) deleteOwned(owner string) (deleted uint, err error) {
+	for _, c := range h.table.chains {
+		var kept []*entry
+		for _, e := range c.entries {
+			rule, err := e.toRule(h.kernel.family)
+			if err != nil {
+				return deleted, err
+			}
+			if rule.IsOwnedBy(owner) {
+				deleted++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		c.entries = kept
+	}
+	return
+}
+
+// DeleteOwned deletes all rules tagged with the specified owner from all chains and commits the changes.
+func (h *Handle) DeleteOwned(owner string) (uint, error) {
+	if owner == "" {
+		return 0, errors.New("empty owner")
+	}
+	deleted, err := h.deleteOwned(owner)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, h.Commit()
+}
+
+// ReplaceOwned deletes all rules tagged with the specified owner from all chains, then appends
+// the specified rules to their chains and commits all changes at once.
+// Appended rules are tagged with the owner; the rules passed in are not modified.
+func (h *Handle) ReplaceOwned(owner string, rules map[common.XtChainLabel][]*common.Rule) error {
+	if owner == "" {
+		return errors.New("empty owner")
+	}
+
+	entries := map[common.XtChainLabel][]*entry{}
+	for chain, chainRules := range rules {
+		for _, rule := range chainRules {
+			tagged := *rule
+			tagged.SetOwner(owner)
+			e, err := h.newEntry(&tagged)
+			if err != nil {
+				return err
+			}
+			entries[chain] = append(entries[chain], e)
+		}
+	}
+
+	if _, err := h.deleteOwned(owner); err != nil {
+		return err
+	}
+	for chain, chainEntries := range entries {
+		c := h.table.chain(chain)
+		if c == nil {
+			return h.fail("append_entry", "append_entry", syscall.ENOENT)
+		}
+		c.entries = append(c.entries, chainEntries...)
+	}
+	return h.Commit()
+}
+
+// Snapshot returns all chains of the table with their policies, rules and counters.
+func (h *Handle) Snapshot() (*common.Table, error) {
+	table := &common.Table{Name: h.name, Family: h.kernel.family}
+	for _, c := range h.table.chains {
+		chain := &common.Chain{Name: c.name, Policy: c.policy, Counters: c.counters, Rules: []*common.Rule{}}
+		for _, e := range c.entries {
+			rule, err := e.toRule(h.kernel.family)
+			if err != nil {
+				return nil, err
+			}
+			chain.Rules = append(chain.Rules, rule)
+		}
+		table.Chains = append(table.Chains, chain)
+	}
+	return table, nil
+}
+
+// Restore replaces all chains of the table with the ones of a snapshot, as iptables-restore does, without
+// committing; counters of rules and policies are restored too. On error, changes are left partially applied
+// and the handle should be freed without committing.
+func (h *Handle) Restore(table *common.Table) error {
+	if table.Family != h.kernel.family {
+		return fmt.Errorf("cannot restore a %s table", table.Family)
+	}
+	if table.Name != "" && table.Name != h.name {
+		return fmt.Errorf("cannot restore table %s into table %s", table.Name, h.name)
+	}
+	if err := table.Validate(); err != nil {
+		return err
+	}
+
+	// user-defined chains are deleted, built-in ones flushed
+	var builtins []*chainState
+	for _, c := range h.table.chains {
+		if c.policy != "" {
+			c.entries = nil
+			builtins = append(builtins, c)
+		}
+	}
+	h.table.chains = builtins
+
+	for _, chain := range table.Chains {
+		builtin, _ := h.IsBuiltin(string(chain.Name))
+		if builtin != chain.IsBuiltin() {
+			return fmt.Errorf("chain %s: built-in chains must have a policy, user-defined ones must not", chain.Name)
+		}
+		var err error
+		if builtin {
+			counters := chain.Counters
+			_, err = h.SetPolicy(chain.Name, common.XtChainLabel(chain.Policy), &counters)
+		} else {
+			_, err = h.CreateChain(chain.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, chain := range table.Chains {
+		for _, rule := range chain.Rules {
+			if err := h.AppendRule(chain.Name, rule); err != nil {
+				return fmt.Errorf("chain %s: %v", chain.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// newEntry encodes a rule as the real handles do, without kernel checks.
+func newEntry(family common.Family, rule *common.Rule) (*entry, error) {
+	e := &entry{rule: *rule, counters: countersSet}
+	e.rule.Matches, e.rule.TargetExt = nil, nil
+
+	var err error
+	for _, n := range []*common.Net{&e.rule.Src, &e.rule.Dest} {
+		if n.IsAny() {
+			continue
+		}
+		if family == common.FamilyIPv4 && !n.Addr().Is4() {
+			return nil, fmt.Errorf("not an IPv4 address: %s", n)
+		}
+		if family == common.FamilyIPv6 && (!n.Addr().Is6() || n.Addr().Is4In6()) {
+			return nil, fmt.Errorf("not an IPv6 address: %s", n)
+		}
+		// as read back from an entry
+		if *n, err = common.NetFromMask(n.Addr(), n.MaskAddr()); err != nil {
+			return nil, err
+		}
+	}
+	for _, i := range []*common.Interface{&e.rule.InDev, &e.rule.OutDev} {
+		iface, mask, err := i.Entry()
+		if err != nil {
+			return nil, err
+		}
+		*i = common.InterfaceFromEntry(iface, mask)
+	}
+	if e.rule.Proto, err = rule.EffectiveProto(); err != nil {
+		return nil, err
+	}
+	if e.matches, err = common.EncodeMatches(family, rule.Matches); err != nil {
+		return nil, err
+	}
+	if _, _, err = common.EncodeRuleTarget(family, rule); err != nil {
+		return nil, err
+	}
+	if rule.TargetExt != nil {
+		if e.targetExt, err = common.EncodeTarget(family, rule.TargetExt); err != nil {
+			return nil, err
+		}
+		e.rule.Target, e.rule.Goto = rule.TargetExt.Name(), false
+	}
+	return e, nil
+}
+
+// toRule decodes the entry as the real handles do.
+func (e *entry) toRule(family common.Family) (*common.Rule, error) {
+	rule := e.rule
+	matches, err := common.DecodeMatches(family, e.matches)
+	if err != nil {
+		return nil, fmt.Errorf("matches: %v", err)
+	}
+	rule.Matches = matches
+	if e.targetExt != nil {
+		if rule.TargetExt, err = common.DecodeTarget(family, e.targetExt); err != nil {
+			return nil, fmt.Errorf("target: %v", err)
+		}
+	}
+	return &rule, nil
+}
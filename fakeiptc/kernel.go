@@ -0,0 +1,324 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package fakeiptc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+// builtinChains are the built-in chains of the standard tables, in hook order.
+var builtinChains = map[string][]common.XtChainLabel{
+	"filter":   {"INPUT", "FORWARD", "OUTPUT"},
+	"nat":      {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"mangle":   {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	"raw":      {"PREROUTING", "OUTPUT"},
+	"security": {"INPUT", "FORWARD", "OUTPUT"},
+}
+
+// Kernel is an in-memory replacement for the tables of a family in the kernel, from which handles are
+// initialized and to which they commit; it is safe for concurrent use.
+type Kernel struct {
+	family common.Family
+	mu     sync.Mutex
+	tables map[string]*tableState
+}
+
+// tableState is a table as committed, or as modified by a handle.
+type tableState struct {
+	// chains are the built-in chains in hook order, followed by user-defined ones sorted by name
+	chains []*chainState
+}
+
+type chainState struct {
+	name common.XtChainLabel
+	// policy is empty for user-defined chains
+	policy   string
+	counters common.XtCounters
+	// countersSet is set when the policy counters were set by a handle, which otherwise keeps the committed ones
+	countersSet bool
+	entries     []*entry
+}
+
+// entry is a rule in the form stored by the kernel: matches and target extension are kept encoded, so
+// that rules are read back as from a real kernel.
+type entry struct {
+	// rule has the header fields, the effective protocol, the target label and counters
+	rule      common.Rule
+	matches   []byte
+	targetExt []byte
+	// origin is the committed entry this one was copied from, nil for new entries
+	origin *entry
+	// counters tells how counters are committed for copied entries
+	counters counterMode
+	// base are the counters of origin when the entry was copied
+	base common.XtCounters
+}
+
+// counterMode mirrors the counter maps of libiptc.
+type counterMode uint8
+
+const (
+	// countersKept takes the committed counters, including traffic counted while the handle was in use
+	countersKept counterMode = iota
+	// countersZeroed only keeps the traffic counted since the entry was copied
+	countersZeroed
+	// countersSet takes the counters of the entry
+	countersSet
+)
+
+// NewKernel returns a kernel with the standard tables of family (filter, nat, mangle, raw and security),
+// having empty built-in chains with ACCEPT policy.
+func NewKernel(family common.Family) *Kernel {
+	k := &Kernel{family: family, tables: map[string]*tableState{}}
+	for name, builtins := range builtinChains {
+		t := &tableState{}
+		for _, c := range builtins {
+			t.chains = append(t.chains, &chainState{name: c, policy: common.IPTC_LABEL_ACCEPT})
+		}
+		k.tables[name] = t
+	}
+	return k
+}
+
+// Seed replaces tables with the ones of iptables-save or ip6tables-save output, as iptables-restore does;
+// other tables are kept. Built-in chains are the ones with a policy.
+func (k *Kernel) Seed(r io.Reader) error {
+	tables, err := common.ParseSave(k.family, r)
+	if err != nil {
+		return err
+	}
+
+	seeded := map[string]*tableState{}
+	for _, st := range tables {
+		t := &tableState{}
+		for _, sc := range st.Chains {
+			t.chains = append(t.chains, &chainState{name: sc.Name, policy: sc.Policy, counters: sc.Counters})
+		}
+		t.sortChains()
+		for _, sc := range st.Chains {
+			c := t.chain(sc.Name)
+			for i, rule := range sc.Rules {
+				e, err := newEntry(k.family, rule)
+				if err != nil {
+					return fmt.Errorf("table %s: chain %s: rule %d: %v", st.Name, sc.Name, i+1, err)
+				}
+				c.entries = append(c.entries, e)
+			}
+		}
+		seeded[st.Name] = t
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for name, t := range seeded {
+		k.tables[name] = t
+	}
+	return nil
+}
+
+// SeedString is like Seed, for iptables-save output in a string.
+func (k *Kernel) SeedString(s string) error {
+	return k.Seed(strings.NewReader(s))
+}
+
+// Tables returns the names of the tables, sorted.
+func (k *Kernel) Tables() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var names []string
+	for name := range k.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Count simulates traffic matching a committed rule, with ruleNum starting at 1 as for ReadCounter.
+func (k *Kernel) Count(tableName string, chainName common.XtChainLabel, ruleNum uint, packets, bytes uint64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	c, err := k.committedChain(tableName, chainName)
+	if err != nil {
+		return err
+	}
+	if ruleNum == 0 || ruleNum > uint(len(c.entries)) {
+		return fmt.Errorf("chain %s has no rule %d", chainName, ruleNum)
+	}
+	e := c.entries[ruleNum-1]
+	e.rule.Pcnt += packets
+	e.rule.Bcnt += bytes
+	return nil
+}
+
+// CountPolicy simulates traffic reaching the policy of a committed built-in chain.
+func (k *Kernel) CountPolicy(tableName string, chainName common.XtChainLabel, packets, bytes uint64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	c, err := k.committedChain(tableName, chainName)
+	if err != nil {
+		return err
+	}
+	if c.policy == "" {
+		return fmt.Errorf("chain %s is not a built-in chain", chainName)
+	}
+	c.counters.Pcnt += packets
+	c.counters.Bcnt += bytes
+	return nil
+}
+
+func (k *Kernel) committedChain(tableName string, chainName common.XtChainLabel) (*chainState, error) {
+	t, ok := k.tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("no table %s", tableName)
+	}
+	c := t.chain(chainName)
+	if c == nil {
+		return nil, fmt.Errorf("table %s has no chain %s", tableName, chainName)
+	}
+	return c, nil
+}
+
+// TableInit returns a handle on a copy of the committed table, as libip4tc.TableInit and libip6tc.TableInit do.
+func (k *Kernel) TableInit(tableName string) (*Handle, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	t, ok := k.tables[tableName]
+	if !ok {
+		// as the real handles do once they found that the table is not registered
+		return nil, &common.UnavailableError{Family: k.family, Feature: common.TableFeature(tableName)}
+	}
+	return &Handle{kernel: k, name: tableName, table: t.copy(), numEntries: t.numEntries()}, nil
+}
+
+// NewPoller returns a poller of the counters of a table, as libip4tc.NewPoller and libip6tc.NewPoller do.
+func (k *Kernel) NewPoller(tableName string) *common.Poller {
+	return common.NewPoller(func() (common.Handle, error) {
+		h, err := k.TableInit(tableName)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+}
+
+// commit replaces the committed table with the one of a handle, failing as the kernel does when the number
+// of entries changed since the handle was initialized.
+func (k *Kernel) commit(name string, t *tableState, numEntries int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	committed, ok := k.tables[name]
+	if !ok || committed.numEntries() != numEntries {
+		return errAgain
+	}
+
+	result := &tableState{}
+	for _, c := range t.chains {
+		rc := &chainState{name: c.name, policy: c.policy, counters: c.counters}
+		if oc := committed.chain(c.name); oc != nil && c.policy != "" && !c.countersSet {
+			rc.counters = oc.counters
+		}
+		for _, e := range c.entries {
+			re := &entry{rule: e.rule, matches: e.matches, targetExt: e.targetExt}
+			if e.origin != nil {
+				switch e.counters {
+				case countersKept:
+					re.rule.XtCounters = e.origin.rule.XtCounters
+				case countersZeroed:
+					re.rule.Pcnt = e.origin.rule.Pcnt - e.base.Pcnt
+					re.rule.Bcnt = e.origin.rule.Bcnt - e.base.Bcnt
+				}
+			}
+			rc.entries = append(rc.entries, re)
+		}
+		result.chains = append(result.chains, rc)
+	}
+	k.tables[name] = result
+	return nil
+}
+
+// copy returns a copy of the table whose entries refer to the ones of t.
+func (t *tableState) copy() *tableState {
+	result := &tableState{}
+	for _, c := range t.chains {
+		cc := &chainState{name: c.name, policy: c.policy, counters: c.counters}
+		for _, e := range c.entries {
+			ce := *e
+			ce.origin, ce.counters, ce.base = e, countersKept, e.rule.XtCounters
+			cc.entries = append(cc.entries, &ce)
+		}
+		result.chains = append(result.chains, cc)
+	}
+	return result
+}
+
+// numEntries returns the number of entries of the table in the kernel: rules, policies of built-in chains,
+// heads and returns of user-defined chains, and the final error entry.
+func (t *tableState) numEntries() int {
+	n := 1
+	for _, c := range t.chains {
+		n += len(c.entries) + 1
+		if c.policy == "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *tableState) chain(name common.XtChainLabel) *chainState {
+	for _, c := range t.chains {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// sortChains sorts user-defined chains by name, after built-in ones, as libiptc does.
+func (t *tableState) sortChains() {
+	sort.SliceStable(t.chains, func(i, j int) bool {
+		a, b := t.chains[i], t.chains[j]
+		if (a.policy != "") != (b.policy != "") {
+			return a.policy != ""
+		}
+		return a.policy == "" && a.name < b.name
+	})
+}
+
+// references returns the number of rules jumping to the chain.
+func (t *tableState) references(name common.XtChainLabel) uint {
+	var n uint
+	for _, c := range t.chains {
+		for _, e := range c.entries {
+			switch e.rule.TargetKind() {
+			case common.TargetJump, common.TargetGoto:
+				if e.rule.Target == string(name) {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,175 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formatter is implemented by matches and targets that can be rendered as iptables arguments.
+type Formatter interface {
+	// Args returns the options of the extension, as printed by iptables-save after '-m NAME' or '-j NAME'.
+	// Options holding the kernel defaults may be printed explicitly even when iptables-save omits them.
+	Args() []string
+}
+
+var protoNames = []struct {
+	proto uint16
+	name  string
+}{
+	// same names as /etc/protocols, as printed by iptables-save
+	{IPPROTO_ICMP, "icmp"},
+	{2, "igmp"},
+	{IPPROTO_TCP, "tcp"},
+	{IPPROTO_UDP, "udp"},
+	{47, "gre"},
+	{50, "esp"},
+	{51, "ah"},
+	{IPPROTO_ICMPV6, "ipv6-icmp"},
+	{132, "sctp"},
+	{136, "udplite"},
+}
+
+// ProtoName returns the name of a layer 4 protocol as printed by iptables-save, like "tcp",
+// or its number when it has no well-known name.
+func ProtoName(proto uint16) string {
+	for _, p := range protoNames {
+		if p.proto == proto {
+			return p.name
+		}
+	}
+	return strconv.FormatUint(uint64(proto), 10)
+}
+
+// Args returns the arguments of the rule in the form used by iptables-save, like
+// "-s 10.0.0.0/8 -p tcp -m tcp --dport 22 -j ACCEPT"; counters are not included.
+// The protocol implied by matches is included. Matches and targets that do not implement Formatter,
+// like RawMatch, cannot be formatted.
+func (r Rule) Args() ([]string, error) {
+	var args []string
+	if !r.Src.IsAny() {
+		args = appendOpt(args, r.Not.Src, "-s", r.Src.String())
+	}
+	if !r.Dest.IsAny() {
+		args = appendOpt(args, r.Not.Dest, "-d", r.Dest.String())
+	}
+	if !r.InDev.IsAny() {
+		args = appendOpt(args, r.Not.InDev, "-i", string(r.InDev))
+	}
+	if !r.OutDev.IsAny() {
+		args = appendOpt(args, r.Not.OutDev, "-o", string(r.OutDev))
+	}
+	// iptables requires the protocol implied by matches like tcp to be explicit
+	proto, err := r.EffectiveProto()
+	if err != nil {
+		return nil, err
+	}
+	if proto != 0 {
+		args = appendOpt(args, r.Not.Proto, "-p", ProtoName(proto))
+	}
+
+	for _, m := range r.Matches {
+		f, ok := m.(Formatter)
+		if !ok {
+			return nil, fmt.Errorf("match %s cannot be formatted", m.Name())
+		}
+		args = append(args, "-m", m.Name())
+		args = append(args, f.Args()...)
+	}
+
+	switch r.TargetKind() {
+	case TargetExtension:
+		f, ok := r.TargetExt.(Formatter)
+		if !ok {
+			return nil, fmt.Errorf("target %s cannot be formatted", r.TargetExt.Name())
+		}
+		args = append(args, "-j", r.TargetExt.Name())
+		args = append(args, f.Args()...)
+	case TargetGoto:
+		args = append(args, "-g", r.Target)
+	case TargetVerdict, TargetJump:
+		args = append(args, "-j", r.Target)
+	}
+	return args, nil
+}
+
+// Format returns the rule as an iptables-save line appending it to chain, like "-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT";
+// arguments are quoted when needed.
+func (r Rule) Format(chain XtChainLabel) (string, error) {
+	args, err := r.Args()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("-A ")
+	b.WriteString(QuoteArg(string(chain)))
+	for _, arg := range args {
+		b.WriteByte(' ')
+		b.WriteString(QuoteArg(arg))
+	}
+	return b.String(), nil
+}
+
+// QuoteArg quotes arg as iptables-save quotes strings: unless it only contains characters that are safe
+// in iptables-save lines and shells, it is enclosed in double quotes, with double quotes, single quotes
+// and backslashes escaped. Addresses and lists like "10.0.0.0/8" are left unquoted, as iptables-save does.
+func QuoteArg(arg string) string {
+	safe := arg != ""
+	for _, c := range arg {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-.:/,+=@%!", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '"' || arg[i] == '\\' || arg[i] == '\'' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(arg[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// appendOpt appends an option and its values, preceded by '!' when negated.
+func appendOpt(args []string, not Not, opt string, values ...string) []string {
+	if not {
+		args = append(args, "!")
+	}
+	args = append(args, opt)
+	return append(args, values...)
+}
+
+// hexArg returns a value in hexadecimal notation, like "0xff".
+func hexArg(v uint32) string {
+	return "0x" + strconv.FormatUint(uint64(v), 16)
+}
+
+// decArg returns a value in decimal notation.
+func decArg(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
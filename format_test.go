@@ -0,0 +1,164 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleFormat(t *testing.T) {
+	src := NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+	negated := Rule{Src: src, InDev: "eth+", Proto: IPPROTO_UDP, Target: IPTC_LABEL_DROP,
+		Matches: []Match{&UDP{DstPort: &PortRange{53, 53}}}}
+	negated.Not.Src = true
+	negated.Not.InDev = true
+	negated.Matches[0].(*UDP).Not.DstPort = true
+
+	for _, tc := range []struct {
+		rule     Rule
+		expected string
+	}{
+		{Rule{}, "-A INPUT"},
+		{Rule{Src: src, Proto: IPPROTO_TCP, Matches: []Match{&TCP{DstPort: &PortRange{22, 22}}}, Target: IPTC_LABEL_ACCEPT},
+			"-A INPUT -s 10.0.0.0/8 -p tcp -m tcp --dport 22 -j ACCEPT"},
+		// the protocol implied by the match must be explicit
+		{Rule{Matches: []Match{&TCP{DstPort: &PortRange{22, 22}}}, Target: IPTC_LABEL_ACCEPT},
+			"-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT"},
+		{negated, "-A INPUT ! -s 10.0.0.0/8 ! -i eth+ -p udp -m udp ! --dport 53 -j DROP"},
+		{Rule{Matches: []Match{&Comment{Text: "allow \"web\""}}, TargetExt: &LogTarget{Level: LogLevelInfo, Prefix: "web: "}},
+			`-A INPUT -m comment --comment "allow \"web\"" -j LOG --log-prefix "web: " --log-level 6`},
+		{Rule{Matches: []Match{&Conntrack{Flags: XT_CONNTRACK_STATE, State: ConnStateRelated | ConnStateEstablished}}, Target: "CHAIN", Goto: true},
+			"-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -g CHAIN"},
+		{Rule{Proto: IPPROTO_TCP, Matches: []Match{&Multiport{Mode: XT_MULTIPORT_DESTINATION, Ports: []PortRange{{80, 80}, {8000, 8080}}, Not: true}},
+			TargetExt: NewOrMark(1)},
+			"-A INPUT -p tcp -m multiport ! --dports 80,8000:8080 -j MARK --set-xmark 0x1/0x1"},
+		{Rule{Dest: NetFromPrefix(netip.MustParsePrefix("2001:db8::/32")), Proto: IPPROTO_ICMPV6, Matches: []Match{&ICMPv6{Type: 128}},
+			TargetExt: &Reject6Target{With: IP6T_ICMP6_ADM_PROHIBITED}},
+			"-A INPUT -d 2001:db8::/32 -p ipv6-icmp -m icmp6 --icmpv6-type 128 -j REJECT --reject-with icmp6-adm-prohibited"},
+	} {
+		line, err := tc.rule.Format("INPUT")
+		if err != nil {
+			t.Errorf("%s: %v", tc.expected, err)
+			continue
+		}
+		if line != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, line)
+		}
+	}
+
+	if _, err := (Rule{Matches: []Match{&RawMatch{MatchName: "foo"}}}).Args(); err == nil {
+		t.Error("raw match formatted")
+	}
+	if _, err := (Rule{TargetExt: &RawTarget{TargetName: "FOO"}}).Args(); err == nil {
+		t.Error("raw target formatted")
+	}
+	if _, err := (Rule{Proto: IPPROTO_UDP, Matches: []Match{&TCP{}}}).Args(); err == nil {
+		t.Error("rule with conflicting protocols formatted")
+	}
+}
+
+func TestExtensionArgs(t *testing.T) {
+	for _, tc := range []struct {
+		ext      Formatter
+		expected string
+	}{
+		{&TCP{SrcPort: &PortRange{1024, 65535}, FlagsMask: TCPFlagSYN | TCPFlagRST | TCPFlagACK | TCPFlagFIN, FlagsSet: TCPFlagSYN},
+			"--sport 1024:65535 --tcp-flags FIN,SYN,RST,ACK SYN"},
+		{&ICMP{Type: 3, Codes: &ICMPCodes{1, 1}, Not: true}, "! --icmp-type 3/1"},
+		{&Mark{Mark: 0x10, Mask: 0xffffffff}, "--mark 0x10"},
+		{&ConnMark{Mark: 0x1, Mask: 0xf, Not: true}, "! --mark 0x1/0xf"},
+		{&IPRange{Src: &AddrRange{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.9")}}, "--src-range 10.0.0.1-10.0.0.9"},
+		{&AddrType{Dst: AddrTypeLocal, LimitIfaceIn: true}, "--dst-type LOCAL --limit-iface-in"},
+		{&Limit{Rate: Rate{3, time.Minute}, Burst: 5}, "--limit 3/min"},
+		{&HashLimit{Table: "ssh", Mode: XT_HASHLIMIT_HASH_SIP | XT_HASHLIMIT_INVERT, Rate: Rate{10, time.Second}, Burst: 20, SrcMask: 24},
+			"--hashlimit-above 10/sec --hashlimit-burst 20 --hashlimit-mode srcip --hashlimit-srcmask 24 --hashlimit-name ssh"},
+		{&ConnLimit{Limit: 16, MaskLen: 24, DstAddr: true, Not: true}, "--connlimit-upto 16 --connlimit-mask 24 --connlimit-daddr"},
+		{&Owner{UID: &IDRange{1000, 1999}, SocketExists: true}, "--socket-exists --uid-owner 1000-1999"},
+		{&Length{Min: 0, Max: 64, Not: true}, "! --length 0:64"},
+		{&Recent{Command: XT_RECENT_UPDATE, Seconds: 60, HitCount: 4, List: "ssh", Not: true},
+			"! --update --seconds 60 --hitcount 4 --name ssh --rsource"},
+		{&Set{SetName: "blacklist", Dirs: []SetDir{SetSrc, SetDst}, NoUpdateCounters: true, Packets: &SetCounter{IPSET_COUNTER_NE, 0}},
+			"--match-set blacklist src,dst ! --update-counters ! --packets-eq 0"},
+		{&String{Algo: "bm", Pattern: []byte("\r\n"), To: 100}, "--hex-string |0d0a| --algo bm --to 100"},
+		{&TTL{Mode: IPT_TTL_NE, Value: 64}, "! --ttl-eq 64"},
+		{&HLTarget{Mode: IP6T_HL_DEC, Value: 1}, "--hl-dec 1"},
+		{&ConnMarkTarget{Mode: XT_CONNMARK_RESTORE, NfMask: 0xff, CtMask: 0xff00, ShiftDir: D_SHIFT_RIGHT, ShiftBits: 8},
+			"--restore-mark --nfmask 0xff --ctmask 0xff00 --right-shift-mark 8"},
+		{&NFQueueTarget{Num: 4, Total: 4, Bypass: true}, "--queue-balance 4:7 --queue-bypass"},
+		{&TProxyTarget{Port: 3128, Mark: 0x1, Mask: 0x1}, "--on-port 3128 --tproxy-mark 0x1/0x1"},
+		{&TCPMSSTarget{MSS: XT_TCPMSS_CLAMP_PMTU}, "--clamp-mss-to-pmtu"},
+		{&CTTarget{Helper: "ftp", Zone: 1, ZoneOrig: true}, "--helper ftp --zone-orig 1"},
+	} {
+		if args := strings.Join(tc.ext.Args(), " "); args != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, args)
+		}
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	for arg, expected := range map[string]string{
+		"ACCEPT":        "ACCEPT",
+		"10.0.0.0/8":    "10.0.0.0/8",
+		"":              `""`,
+		"two words":     `"two words"`,
+		`back\slash"`:   `"back\\slash\""`,
+		"it's":          `"it\'s"`,
+		"RELATED,NEW":   "RELATED,NEW",
+		"--log-prefix=": "--log-prefix=",
+	} {
+		if quoted := QuoteArg(arg); quoted != expected {
+			t.Errorf("%q: expected %s, got %s", arg, expected, quoted)
+		}
+	}
+}
+
+func TestFormatQuotedComment(t *testing.T) {
+	for _, text := range []string{"it's", `say "hi"`, `back\slash`, `'\"`} {
+		rule := Rule{Matches: []Match{&Comment{Text: text}}, Target: IPTC_LABEL_ACCEPT}
+		line, err := rule.Format("INPUT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, err := SplitArgs(line)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		parsed, err := ParseRule(FamilyIPv4, args[2:])
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if comment := parsed.Matches[0].(*Comment).Text; comment != text {
+			t.Errorf("%s: comment %q, expected %q", line, comment, text)
+		}
+	}
+}
+
+// all typed extensions can be formatted
+var _ = []Formatter{
+	&AddrType{}, &BPF{}, &Comment{}, &ConnLimit{}, &ConnMark{}, &Conntrack{}, &DSCP{}, &HL{}, &HashLimit{},
+	&ICMP{}, &ICMPv6{}, &IPRange{}, &Length{}, &Limit{}, &MAC{}, &Mark{}, &Multiport{}, &Owner{}, &Physdev{},
+	&PktType{}, &Recent{}, &Set{}, &String{}, &TCP{}, &TOS{}, &TTL{}, &U32{}, &UDP{},
+	&CTTarget{}, &ClassifyTarget{}, &ConnMarkTarget{}, &DSCPTarget{}, &HLTarget{}, &LogTarget{}, &MarkTarget{},
+	&NFLogTarget{}, &NFQueueTarget{}, &NoTrackTarget{}, &Reject6Target{}, &RejectTarget{}, &TCPMSSTarget{},
+	&TOSTarget{}, &TProxyTarget{}, &TTLTarget{},
+}
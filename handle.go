@@ -0,0 +1,84 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+// Handle is the rule-level API of a table handle, implemented by the handles of the libip4tc, libip6tc
+// and fakeiptc packages; code using it can be tested without privileges with the latter.
+// Changes are only visible to other handles once committed.
+type Handle interface {
+	IsChain(chain string) (bool, error)
+	IsBuiltin(chain string) (bool, error)
+	// Chains returns the names of all chains: built-in ones in hook order, then user-defined ones sorted by name.
+	Chains() ([]XtChainLabel, error)
+	GetPolicy(chain string) (policy string, counters XtCounters, err error)
+	GetReferences(chain XtChainLabel) (uint, error)
+
+	CreateChain(chain XtChainLabel) (bool, error)
+	DeleteChain(chain XtChainLabel) (bool, error)
+	RenameChain(oldName, newName XtChainLabel) (bool, error)
+	SetPolicy(chain, policy XtChainLabel, counters *XtCounters) (bool, error)
+	FlushEntries(chain XtChainLabel) (bool, error)
+	ZeroEntries(chain XtChainLabel) (bool, error)
+
+	// Rules returns the rules of a chain, decoded as read back from the kernel.
+	Rules(chain XtChainLabel) ([]*Rule, error)
+	// InsertRule inserts a rule at position ruleNum of the chain, starting at 0.
+	InsertRule(chain XtChainLabel, rule *Rule, ruleNum uint) error
+	AppendRule(chain XtChainLabel, rule *Rule) error
+	// CheckRule returns whether the chain has a rule equal to rule, as compared by Rule.Key.
+	CheckRule(chain XtChainLabel, rule *Rule) (bool, error)
+	// DeleteRule deletes the first rule of the chain equal to rule, returning false if there is none.
+	DeleteRule(chain XtChainLabel, rule *Rule) (bool, error)
+	// DeleteNumEntry deletes the rule at position ruleNum of the chain, starting at 0.
+	DeleteNumEntry(chain XtChainLabel, ruleNum uint) (bool, error)
+
+	// ReadCounter, ZeroCounter and SetCounter address rules by number, starting at 1.
+	ReadCounter(chain XtChainLabel, ruleNum uint) (XtCounters, error)
+	ZeroCounter(chain XtChainLabel, ruleNum uint) (bool, error)
+	SetCounter(chain XtChainLabel, ruleNum uint, counters XtCounters) (bool, error)
+
+	ListOwned(owner string) (map[XtChainLabel][]*Rule, error)
+	DeleteOwned(owner string) (uint, error)
+	ReplaceOwned(owner string, rules map[XtChainLabel][]*Rule) error
+	Snapshot() (*Table, error)
+	Restore(table *Table) error
+
+	Commit() error
+	Free() error
+}
+
+// IndexRule returns the position of the first of rules equal to rule, as compared by Rule.Key for family,
+// or -1 if there is none.
+func IndexRule(family Family, rules []*Rule, rule *Rule) (int, error) {
+	key, err := rule.Key(family)
+	if err != nil {
+		return -1, err
+	}
+	for i, r := range rules {
+		k, err := r.Key(family)
+		if err != nil {
+			return -1, err
+		}
+		if k == key {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
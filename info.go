@@ -0,0 +1,127 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	// #include "rawtable.h"
+	"C"
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// hookChains are the names of the built-in chains attached to each hook.
+var hookChains = [NF_INET_NUMHOOKS]XtChainLabel{"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"}
+
+// TableInfo is the kernel metadata of a table, as reported by IPT_SO_GET_INFO and IP6T_SO_GET_INFO.
+type TableInfo struct {
+	Name string
+	// ValidHooks is a bitmask of the hooks, like 1<<NF_INET_LOCAL_IN, to which the table is attached.
+	ValidHooks uint32
+	// HookEntry and Underflow are the offsets of the first and of the policy entry of each built-in chain.
+	HookEntry  [NF_INET_NUMHOOKS]uint32
+	Underflow  [NF_INET_NUMHOOKS]uint32
+	NumEntries uint32
+	// Size is the size of all entries, in bytes.
+	Size uint32
+}
+
+// GetTableInfo returns the metadata of a table as currently installed in the kernel; uncommitted changes
+// of handles are not reflected.
+func GetTableInfo(family Family, table string) (*TableInfo, error) {
+	cFamily, err := socketFamily(family)
+	if err != nil {
+		return nil, err
+	}
+	if table == "" || len(table) >= XT_TABLE_MAXNAMELEN {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	info, err := rawInfo(cFamily, table)
+	if err != nil {
+		return nil, fmt.Errorf("%s table %s: %v", family, table, err)
+	}
+	return newTableInfo(&info), nil
+}
+
+func newTableInfo(info *C.struct_ipt_getinfo) *TableInfo {
+	i := &TableInfo{
+		Name:       C.GoString(&info.name[0]),
+		ValidHooks: uint32(info.valid_hooks),
+		NumEntries: uint32(info.num_entries),
+		Size:       uint32(info.size),
+	}
+	for hook := range i.HookEntry {
+		i.HookEntry[hook] = uint32(info.hook_entry[hook])
+		i.Underflow[hook] = uint32(info.underflow[hook])
+	}
+	return i
+}
+
+// Chains returns the names of the built-in chains of the table, in hook order.
+func (i *TableInfo) Chains() []XtChainLabel {
+	var chains []XtChainLabel
+	for hook, chain := range hookChains {
+		if i.ValidHooks&(1<<uint(hook)) != 0 {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// tablesNamesFile is the file listing the tables of each family, replaceable for testing.
+var tablesNamesFile = map[Family]string{
+	FamilyIPv4: "/proc/net/ip_tables_names",
+	FamilyIPv6: "/proc/net/ip6_tables_names",
+}
+
+// Tables returns the names of the tables currently registered by the kernel for family; tables
+// are registered when their module is loaded, usually on first use.
+func Tables(family Family) ([]string, error) {
+	path, ok := tablesNamesFile[family]
+	if !ok {
+		return nil, fmt.Errorf("invalid family %d", uint8(family))
+	}
+	return readNames(path)
+}
+
+// readNames reads a file of /proc/net listing a name per line; names listed more than once, like
+// those of extensions with several revisions, are only returned once.
+func readNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// the file is only created along with the first table
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := scanner.Text(); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,66 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	saved := tablesNamesFile[FamilyIPv4]
+	defer func() {
+		tablesNamesFile[FamilyIPv4] = saved
+	}()
+
+	path := filepath.Join(t.TempDir(), "ip_tables_names")
+	tablesNamesFile[FamilyIPv4] = path
+	tables, err := Tables(FamilyIPv4)
+	if err != nil || tables != nil {
+		t.Errorf("missing file: expected no tables, got %v, %v", tables, err)
+	}
+
+	if err := os.WriteFile(path, []byte("nat\nfilter\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tables, err = Tables(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"nat", "filter"}; !reflect.DeepEqual(tables, expected) {
+		t.Errorf("expected %v, got %v", expected, tables)
+	}
+
+	if _, err := Tables(Family(0)); err == nil {
+		t.Error("invalid family accepted")
+	}
+}
+
+func TestTableInfoChains(t *testing.T) {
+	info := TableInfo{ValidHooks: 1<<NF_INET_PRE_ROUTING | 1<<NF_INET_LOCAL_OUT}
+	if chains, expected := info.Chains(), []XtChainLabel{"PREROUTING", "OUTPUT"}; !reflect.DeepEqual(chains, expected) {
+		t.Errorf("expected %v, got %v", expected, chains)
+	}
+	if _, err := GetTableInfo(FamilyIPv4, ""); err == nil {
+		t.Error("empty table name accepted")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Interface is an interface pattern, using the same convention as iptables: a trailing '+'
+// matches any interface with such prefix, otherwise the name must match exactly; an empty
+// pattern matches any interface.
+type Interface string
+
+// IsAny returns true for the empty pattern, which matches any interface.
+func (i Interface) IsAny() bool {
+	return i == ""
+}
+
+// IsPrefix returns true for wildcard patterns like "eth+".
+func (i Interface) IsPrefix() bool {
+	return strings.HasSuffix(string(i), "+")
+}
+
+// Prefix returns the part of the pattern that is compared with interface names,
+// that is the pattern without the trailing '+' of wildcards.
+func (i Interface) Prefix() string {
+	return strings.TrimSuffix(string(i), "+")
+}
+
+// MatchesInterface returns true when the interface name matches the pattern, as the kernel would do;
+// negation of the pattern in a rule is not considered.
+func (i Interface) MatchesInterface(name string) bool {
+	switch {
+	case i.IsAny():
+		return true
+	case i.IsPrefix():
+		return strings.HasPrefix(name, i.Prefix())
+	}
+	return name == string(i)
+}
+
+// Entry returns the interface name and mask for an entry: the mask covers the prefix of
+// wildcards, or the whole name including terminating NUL for exact matches.
+func (i Interface) Entry() (iface, mask [IFNAMSIZ]byte, err error) {
+	if len(i) >= IFNAMSIZ {
+		err = fmt.Errorf("interface name too long (max %d characters): %q", IFNAMSIZ-1, string(i))
+		return
+	}
+	if i.IsAny() {
+		return
+	}
+	// the trailing '+' is kept in the name, as iptables does
+	copy(iface[:], i)
+	n := len(i) + 1
+	if i.IsPrefix() {
+		n = len(i) - 1
+	}
+	for j := 0; j < n; j++ {
+		mask[j] = 0xff
+	}
+	return
+}
+
+// InterfaceFromEntry is the counterpart of Interface.Entry; the mask is authoritative, thus entries
+// created by other tools without the trailing '+' in the name are still decoded as wildcards.
+func InterfaceFromEntry(iface, mask [IFNAMSIZ]byte) Interface {
+	name := cString(iface[:])
+	n := 0
+	for n < IFNAMSIZ && mask[n] == 0xff {
+		n++
+	}
+	switch {
+	case n > len(name):
+		return Interface(name)
+	case n == 0 && name == "":
+		return ""
+	}
+	return Interface(name[:n] + "+")
+}
+
+// ParseInterface returns the interface name and mask for an entry; see Interface.Entry.
+func ParseInterface(name string) (iface, mask [IFNAMSIZ]byte, err error) {
+	return Interface(name).Entry()
+}
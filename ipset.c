@@ -0,0 +1,88 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+#include <errno.h>
+#include <string.h>
+#include <unistd.h>
+#include <sys/socket.h>
+#include <netinet/in.h>
+#include <linux/netfilter/ipset/ip_set.h>
+
+#include "ipset.h"
+
+// performs a request through the same getsockopt() interface used by iptables' set match,
+// after having negotiated the protocol version with the kernel
+static int ipset_request(struct ip_set_req_get_set *req) {
+	int sockfd = socket(AF_INET, SOCK_RAW, IPPROTO_RAW);
+	if (sockfd < 0)
+		return -1;
+
+	struct ip_set_req_version req_version;
+	socklen_t size = sizeof(req_version);
+	memset(&req_version, 0, sizeof(req_version));
+	req_version.op = IP_SET_OP_VERSION;
+	int ret = getsockopt(sockfd, SOL_IP, SO_IP_SET, &req_version, &size);
+	if (ret == 0) {
+		req->version = req_version.version;
+		size = sizeof(*req);
+		ret = getsockopt(sockfd, SOL_IP, SO_IP_SET, req, &size);
+	}
+
+	// close() must not clobber errno of the failed request
+	int saved_errno = errno;
+	close(sockfd);
+	errno = saved_errno;
+	return ret;
+}
+
+int ipset_get_index(const char *name, uint16_t *index) {
+	struct ip_set_req_get_set req;
+	memset(&req, 0, sizeof(req));
+	req.op = IP_SET_OP_GET_BYNAME;
+	strncpy(req.set.name, name, IPSET_MAXNAMELEN - 1);
+
+	if (ipset_request(&req) != 0)
+		return -1;
+	if (req.set.index == IPSET_INVALID_ID) {
+		errno = ENOENT;
+		return -1;
+	}
+
+	*index = req.set.index;
+	return 0;
+}
+
+// name must be at least IPSET_MAXNAMELEN bytes long
+int ipset_get_name(uint16_t index, char *name) {
+	struct ip_set_req_get_set req;
+	memset(&req, 0, sizeof(req));
+	req.op = IP_SET_OP_GET_BYINDEX;
+	req.set.index = index;
+
+	if (ipset_request(&req) != 0)
+		return -1;
+	if (req.set.name[0] == '\0') {
+		errno = ENOENT;
+		return -1;
+	}
+
+	memcpy(name, req.set.name, IPSET_MAXNAMELEN);
+	name[IPSET_MAXNAMELEN - 1] = '\0';
+	return 0;
+}
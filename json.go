@@ -0,0 +1,335 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// jsonMatches and jsonTargets are the typed extensions that can be encoded as JSON, by Go type name;
+// their values use the Go field names.
+var (
+	jsonMatches = map[string]reflect.Type{}
+	jsonTargets = map[string]reflect.Type{}
+)
+
+func init() {
+	for _, m := range []Match{
+		&AddrType{}, &BPF{}, &Comment{}, &ConnLimit{}, &ConnMark{}, &Conntrack{}, &DSCP{}, &HL{}, &HashLimit{},
+		&ICMP{}, &ICMPv6{}, &IPRange{}, &Length{}, &Limit{}, &MAC{}, &Mark{}, &Multiport{}, &Owner{}, &Physdev{},
+		&PktType{}, &Recent{}, &Set{}, &String{}, &TCP{}, &TOS{}, &TTL{}, &U32{}, &UDP{}, &RawMatch{},
+	} {
+		t := reflect.TypeOf(m).Elem()
+		jsonMatches[t.Name()] = t
+	}
+	for _, target := range []Target{
+		&CTTarget{}, &ClassifyTarget{}, &ConnMarkTarget{}, &DSCPTarget{}, &HLTarget{}, &LogTarget{}, &MarkTarget{},
+		&NFLogTarget{}, &NFQueueTarget{}, &NoTrackTarget{}, &Reject6Target{}, &RejectTarget{}, &TCPMSSTarget{},
+		&TOSTarget{}, &TProxyTarget{}, &TTLTarget{}, &RawTarget{},
+	} {
+		t := reflect.TypeOf(target).Elem()
+		jsonTargets[t.Name()] = t
+	}
+}
+
+// extensionJSON is the JSON representation of a match or target; Type is the name of the Go type
+// and Name the name of the extension, which is informative.
+type extensionJSON struct {
+	Type  string          `json:"type"`
+	Name  string          `json:"name"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ruleJSON is the JSON representation of a Rule; Not lists the negated fields among "src", "dst", "in", "out" and "proto".
+type ruleJSON struct {
+	Src       *Net            `json:"src,omitempty"`
+	Dest      *Net            `json:"dst,omitempty"`
+	InDev     Interface       `json:"in,omitempty"`
+	OutDev    Interface       `json:"out,omitempty"`
+	Proto     string          `json:"proto,omitempty"`
+	Not       []string        `json:"not,omitempty"`
+	Matches   []extensionJSON `json:"matches,omitempty"`
+	Target    string          `json:"target,omitempty"`
+	Goto      bool            `json:"goto,omitempty"`
+	TargetExt *extensionJSON  `json:"target_ext,omitempty"`
+	Packets   uint64          `json:"packets,omitempty"`
+	Bytes     uint64          `json:"bytes,omitempty"`
+}
+
+func marshalExtension(types map[string]reflect.Type, ext interface{ Name() string }) (extensionJSON, error) {
+	t := reflect.TypeOf(ext)
+	if t.Kind() != reflect.Ptr || types[t.Elem().Name()] != t.Elem() {
+		return extensionJSON{}, fmt.Errorf("extension %s: type %s cannot be encoded", ext.Name(), t)
+	}
+	value, err := json.Marshal(ext)
+	if err != nil {
+		return extensionJSON{}, fmt.Errorf("extension %s: %v", ext.Name(), err)
+	}
+	return extensionJSON{Type: t.Elem().Name(), Name: ext.Name(), Value: value}, nil
+}
+
+func unmarshalExtension(types map[string]reflect.Type, e extensionJSON) (interface{}, error) {
+	t, ok := types[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("extension %s: unknown type %q", e.Name, e.Type)
+	}
+	ext := reflect.New(t).Interface()
+	if len(e.Value) != 0 {
+		d := json.NewDecoder(bytes.NewReader(e.Value))
+		d.DisallowUnknownFields()
+		if err := d.Decode(ext); err != nil {
+			return nil, fmt.Errorf("extension %s: %v", e.Name, err)
+		}
+	}
+	return ext, nil
+}
+
+// MarshalJSON implements json.Marshaler. Addresses and interfaces are strings as accepted by iptables,
+// the protocol is a name when known and extensions are objects with "type", "name" and "value" keys.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	j := ruleJSON{
+		InDev:   r.InDev,
+		OutDev:  r.OutDev,
+		Target:  r.Target,
+		Goto:    r.Goto,
+		Packets: r.Pcnt,
+		Bytes:   r.Bcnt,
+	}
+	if !r.Src.IsAny() {
+		j.Src = &r.Src
+	}
+	if !r.Dest.IsAny() {
+		j.Dest = &r.Dest
+	}
+	if r.Proto != 0 {
+		j.Proto = ProtoName(r.Proto)
+	}
+	for _, n := range []struct {
+		not  Not
+		name string
+	}{{r.Not.Src, "src"}, {r.Not.Dest, "dst"}, {r.Not.InDev, "in"}, {r.Not.OutDev, "out"}, {r.Not.Proto, "proto"}} {
+		if n.not {
+			j.Not = append(j.Not, n.name)
+		}
+	}
+	for _, m := range r.Matches {
+		e, err := marshalExtension(jsonMatches, m)
+		if err != nil {
+			return nil, err
+		}
+		j.Matches = append(j.Matches, e)
+	}
+	if r.TargetExt != nil {
+		e, err := marshalExtension(jsonTargets, r.TargetExt)
+		if err != nil {
+			return nil, err
+		}
+		j.TargetExt = &e
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, as the counterpart of MarshalJSON.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var j ruleJSON
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&j); err != nil {
+		return err
+	}
+	rule := Rule{
+		InDev:      j.InDev,
+		OutDev:     j.OutDev,
+		Target:     j.Target,
+		Goto:       j.Goto,
+		XtCounters: XtCounters{Pcnt: j.Packets, Bcnt: j.Bytes},
+	}
+	if j.Src != nil {
+		rule.Src = *j.Src
+	}
+	if j.Dest != nil {
+		rule.Dest = *j.Dest
+	}
+	if j.Proto != "" {
+		proto, err := ParseProto(j.Proto)
+		if err != nil {
+			return err
+		}
+		rule.Proto = proto
+	}
+	for _, name := range j.Not {
+		switch name {
+		case "src":
+			rule.Not.Src = true
+		case "dst":
+			rule.Not.Dest = true
+		case "in":
+			rule.Not.InDev = true
+		case "out":
+			rule.Not.OutDev = true
+		case "proto":
+			rule.Not.Proto = true
+		default:
+			return fmt.Errorf("invalid negated field %q", name)
+		}
+	}
+	for _, e := range j.Matches {
+		ext, err := unmarshalExtension(jsonMatches, e)
+		if err != nil {
+			return err
+		}
+		rule.Matches = append(rule.Matches, ext.(Match))
+	}
+	if j.TargetExt != nil {
+		ext, err := unmarshalExtension(jsonTargets, *j.TargetExt)
+		if err != nil {
+			return err
+		}
+		rule.TargetExt = ext.(Target)
+	}
+	*r = rule
+	return nil
+}
+
+// MarshalYAML implements the Marshaler interface of gopkg.in/yaml.v2 and gopkg.in/yaml.v3;
+// the YAML document has the same structure as the JSON one.
+func (r Rule) MarshalYAML() (interface{}, error) {
+	return yamlFromJSON(r)
+}
+
+// UnmarshalYAML implements the Unmarshaler interface of gopkg.in/yaml.v2, which is also supported by gopkg.in/yaml.v3.
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return jsonFromYAML(unmarshal, r)
+}
+
+// MarshalYAML implements the Marshaler interface of gopkg.in/yaml.v2 and gopkg.in/yaml.v3.
+func (c Chain) MarshalYAML() (interface{}, error) {
+	return yamlFromJSON(c)
+}
+
+// UnmarshalYAML implements the Unmarshaler interface of gopkg.in/yaml.v2 and gopkg.in/yaml.v3.
+func (c *Chain) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Chain
+	return jsonFromYAML(unmarshal, (*plain)(c))
+}
+
+// MarshalYAML implements the Marshaler interface of gopkg.in/yaml.v2 and gopkg.in/yaml.v3.
+func (t Table) MarshalYAML() (interface{}, error) {
+	return yamlFromJSON(t)
+}
+
+// UnmarshalYAML implements the Unmarshaler interface of gopkg.in/yaml.v2 and gopkg.in/yaml.v3.
+func (t *Table) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Table
+	return jsonFromYAML(unmarshal, (*plain)(t))
+}
+
+// yamlFromJSON returns the JSON representation of v as generic maps and slices, for YAML encoders;
+// numbers are kept as integers when possible, so that counters do not lose precision.
+func yamlFromJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(generic), nil
+}
+
+func fromJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fromJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fromJSONNumbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// jsonFromYAML decodes a YAML document into generic values with unmarshal, then decodes their
+// JSON representation into v.
+func jsonFromYAML(unmarshal func(interface{}) error, v interface{}) error {
+	var generic interface{}
+	if err := unmarshal(&generic); err != nil {
+		return err
+	}
+	generic, err := toJSONMaps(generic)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// toJSONMaps converts the map[interface{}]interface{} values produced by gopkg.in/yaml.v2 to map[string]interface{}.
+func toJSONMaps(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v", k)
+			}
+			if m[key], err = toJSONMaps(e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case map[string]interface{}:
+		for k, e := range v {
+			if v[k], err = toJSONMaps(e); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if v[i], err = toJSONMaps(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,161 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jsonTestTable returns a table of family with extensions of all kinds, addresses being in src and dest.
+func jsonTestTable(family Family, src, dest string) *Table {
+	rule := &Rule{Src: NetFromPrefix(netip.MustParsePrefix(src)), InDev: "eth+", Proto: IPPROTO_TCP,
+		Matches: []Match{&TCP{DstPort: &PortRange{22, 22}},
+			&Set{SetName: "blacklist", Dirs: []SetDir{SetSrc}, Packets: &SetCounter{IPSET_COUNTER_GT, 10}},
+			&Limit{Rate: Rate{3, time.Minute}, Burst: 5},
+			&RawMatch{MatchName: "foo", MatchRevision: 1, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		Target: "LOG", TargetExt: &LogTarget{Level: LogLevelInfo, Prefix: "ssh: "},
+		XtCounters: XtCounters{Pcnt: 1 << 60, Bcnt: 1<<64 - 1}}
+	rule.Not.Src = true
+	jump := &Rule{Dest: NetFromPrefix(netip.MustParsePrefix(dest)), Target: "SSH", Goto: true}
+	return &Table{Name: "filter", Family: family, Chains: []*Chain{
+		{Name: "INPUT", Policy: IPTC_LABEL_DROP, Counters: XtCounters{Pcnt: 1, Bcnt: 60}, Rules: []*Rule{jump}},
+		{Name: "SSH", Rules: []*Rule{rule, {Target: IPTC_LABEL_ACCEPT}}},
+	}}
+}
+
+// jsonTestTables returns a test table for each family.
+func jsonTestTables() []*Table {
+	return []*Table{
+		jsonTestTable(FamilyIPv4, "10.0.0.0/8", "192.0.2.0/24"),
+		jsonTestTable(FamilyIPv6, "2001:db8:1::/48", "2001:db8::/32"),
+	}
+}
+
+func TestRuleJSON(t *testing.T) {
+	table := jsonTestTables()[0]
+	rule := table.Chains[1].Rules[0]
+	data, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"src":"10.0.0.0/8"`, `"proto":"tcp"`, `"not":["src"]`, `"type":"TCP","name":"tcp"`, `"bytes":18446744073709551615`} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("%s not found in %s", s, data)
+		}
+	}
+
+	var decoded Rule
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, rule) {
+		t.Errorf("expected %+v, got %+v", rule, decoded)
+	}
+
+	for _, doc := range []string{
+		`{"matches":[{"type":"Bogus","name":"bogus","value":{}}]}`,
+		`{"matches":[{"type":"LogTarget","name":"LOG","value":{}}]}`,
+		`{"target_ext":{"type":"TCP","name":"tcp","value":{}}}`,
+		`{"matches":[{"type":"TCP","name":"tcp","value":{"Bogus":1}}]}`,
+		`{"not":["bogus"]}`,
+		`{"src":"10.0.0.300"}`,
+		`{"bogus":true}`,
+	} {
+		if err := json.Unmarshal([]byte(doc), &decoded); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+
+	if _, err := json.Marshal(Rule{Matches: []Match{&unknownMatch{}}}); err == nil {
+		t.Error("unregistered match type encoded")
+	}
+}
+
+type unknownMatch struct{ RawMatch }
+
+// toYAMLv2 converts maps as gopkg.in/yaml.v2 decodes them.
+func toYAMLv2(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := map[interface{}]interface{}{}
+		for k, e := range v {
+			m[k] = toYAMLv2(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = toYAMLv2(e)
+		}
+	}
+	return v
+}
+
+func TestTableJSONAndYAML(t *testing.T) {
+	for _, table := range jsonTestTables() {
+		if err := table.Validate(); err != nil {
+			t.Fatalf("%s: %v", table.Family, err)
+		}
+
+		data, err := json.Marshal(table)
+		if err != nil {
+			t.Fatalf("%s: %v", table.Family, err)
+		}
+		var decoded Table
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: %v", table.Family, err)
+		}
+		if !reflect.DeepEqual(&decoded, table) {
+			t.Errorf("%s JSON: expected %+v, got %+v", table.Family, table, decoded)
+		}
+
+		generic, err := table.MarshalYAML()
+		if err != nil {
+			t.Fatalf("%s: %v", table.Family, err)
+		}
+		decoded = Table{}
+		err = decoded.UnmarshalYAML(func(v interface{}) error {
+			*v.(*interface{}) = toYAMLv2(generic)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", table.Family, err)
+		}
+		if !reflect.DeepEqual(&decoded, table) {
+			t.Errorf("%s YAML: expected %+v, got %+v", table.Family, table, decoded)
+		}
+		if decoded.Chain("SSH") != decoded.Chains[1] || decoded.Chain("OUTPUT") != nil {
+			t.Errorf("%s: unexpected chain lookup result", table.Family)
+		}
+
+		table.Chains[0].Rules[0].Target = "MISSING"
+		if err := table.Validate(); err == nil {
+			t.Errorf("%s: jump to unknown chain validated", table.Family)
+		}
+		table.Chains[0].Name = "SSH"
+		if err := table.Validate(); err == nil {
+			t.Errorf("%s: duplicate chain validated", table.Family)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gdm85/go-libiptc/nstest"
+)
+
+// TestMain runs the tests in a throwaway network namespace, so that kernel tables can be changed.
+func TestMain(m *testing.M) {
+	nstest.Main(m)
+}
+
+func TestKernelRawTable(t *testing.T) {
+	nstest.Require(t)
+
+	acquired, err := XtablesLock(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.FailNow()
+	}
+	defer XtablesUnlock()
+
+	for _, family := range []Family{FamilyIPv4, FamilyIPv6} {
+		table, err := ExportRaw(family, "filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a new network namespace starts with empty tables
+		if err := table.Validate(); err != nil || table.NumEntries != 4 {
+			t.Fatalf("%s: unexpected table %+v: %v", family, table, err)
+		}
+
+		info, err := GetTableInfo(family, "filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Chains()) != 3 || info.NumEntries != table.NumEntries {
+			t.Errorf("%s: unexpected table info %+v", family, info)
+		}
+		if err := CheckTable(family, "filter"); err != nil {
+			t.Error(err)
+		}
+
+		if err := ImportRaw(table); err != nil {
+			t.Fatalf("%s: %v", family, err)
+		}
+		imported, err := ExportRaw(family, "filter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(imported.Entries, table.Entries) {
+			t.Errorf("%s: imported table differs from the exported one", family)
+		}
+	}
+}
+
+func TestKernelRevision(t *testing.T) {
+	nstest.Require(t)
+
+	for _, family := range []Family{FamilyIPv4, FamilyIPv6} {
+		if _, err := SupportedRevision(family, ExtensionMatch, "udp"); err != nil {
+			t.Error(err)
+		}
+		if _, err := SupportedRevision(family, ExtensionTarget, "NONEXISTENT"); err == nil {
+			t.Errorf("%s: expected an error for an unknown target", family)
+		}
+		if _, ok := CheckTable(family, "nonexistent").(*UnavailableError); !ok {
+			t.Errorf("%s: expected an unavailable table", family)
+		}
+	}
+}
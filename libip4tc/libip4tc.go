@@ -25,27 +25,44 @@ package libip4tc
 import "C"
 
 import (
-	"net"
-	"runtime"
+	"fmt"
+	"net/netip"
 	"unsafe"
 
 	common "github.com/gdm85/go-libiptc"
 )
 
-func cuint2ip(cAaddr, cMask C.in_addr_t) *net.IPNet {
-	addr := uint32(cAaddr)
-	ip := new(net.IPNet)
-	ip.IP = net.IPv4(byte(addr&0xff),
-		byte((addr>>8)&0xff),
-		byte((addr>>16)&0xff),
-		byte((addr>>24)&0xff))
-	mask := uint32(cMask)
-	ip.Mask = net.IPv4Mask(byte(mask&0xff),
-		byte((mask>>8)&0xff),
-		byte((mask>>16)&0xff),
-		byte((mask>>24)&0xff),
-	)
-	return ip
+// cuint2net converts an address and mask of an entry, both in network byte order.
+func cuint2net(cAddr, cMask C.in_addr_t) common.Net {
+	addr := netip.AddrFrom4(*(*[4]byte)(unsafe.Pointer(&cAddr)))
+	mask := netip.AddrFrom4(*(*[4]byte)(unsafe.Pointer(&cMask)))
+	// both addresses are IPv4, thus cannot be rejected
+	n, _ := common.NetFromMask(addr, mask)
+	return n
+}
+
+// net2cuint is the counterpart of cuint2net; host bits of the address are cleared.
+func net2cuint(n common.Net) (cAddr, cMask C.in_addr_t, err error) {
+	if n.IsAny() {
+		return
+	}
+	if !n.Addr().Is4() {
+		err = fmt.Errorf("not an IPv4 address: %s", n)
+		return
+	}
+	*(*[4]byte)(unsafe.Pointer(&cAddr)) = n.Addr().As4()
+	*(*[4]byte)(unsafe.Pointer(&cMask)) = n.MaskAddr().As4()
+	return
+}
+
+// cIface2Interface converts the interface name and mask of an entry.
+func cIface2Interface(cIface [common.IFNAMSIZ]C.char, cMask [common.IFNAMSIZ]C.uchar) common.Interface {
+	var iface, mask [common.IFNAMSIZ]byte
+	for i := 0; i < common.IFNAMSIZ; i++ {
+		iface[i] = byte(cIface[i])
+		mask[i] = byte(cMask[i])
+	}
+	return common.InterfaceFromEntry(iface, mask)
 }
 
 type IptEntry struct {
@@ -58,15 +75,35 @@ func (h IptEntry) IsEmpty() bool {
 
 type XtcHandle struct {
 	handle *C.struct_xtc_handle
+	// table is the name passed to TableInit
+	table string
 }
 
+// IptEntry2Rule decodes an entry returned by FirstRule or NextRule, see DecodeEntry; extensions following
+// a malformed extension header are left out of the rule.
 func (h XtcHandle) IptEntry2Rule(e *IptEntry) *common.Rule {
+	rule, _ := h.decodeEntry(e)
+	return rule
+}
+
+// DecodeEntry decodes an entry returned by FirstRule or NextRule; it fails for malformed extension headers,
+// while extension payloads that cannot be decoded are returned as RawMatch and RawTarget.
+func (h XtcHandle) DecodeEntry(e *IptEntry) (*common.Rule, error) {
+	rule, err := h.decodeEntry(e)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// decodeEntry returns the rule of an entry, with the extensions which could be decoded when it fails.
+func (h XtcHandle) decodeEntry(e *IptEntry) (*common.Rule, error) {
 	entry := e.handle
 	rule := new(common.Rule)
 	rule.Pcnt = uint64(entry.counters.pcnt)
 	rule.Bcnt = uint64(entry.counters.bcnt)
-	rule.InDev = C.GoString(&entry.ip.iniface[0])
-	rule.OutDev = C.GoString(&entry.ip.outiface[0])
+	rule.InDev = cIface2Interface(entry.ip.iniface, entry.ip.iniface_mask)
+	rule.OutDev = cIface2Interface(entry.ip.outiface, entry.ip.outiface_mask)
 	if entry.ip.invflags&C.IPT_INV_VIA_IN != 0 {
 		rule.Not.InDev = true
 	}
@@ -74,21 +111,145 @@ func (h XtcHandle) IptEntry2Rule(e *IptEntry) *common.Rule {
 		rule.Not.OutDev = true
 	}
 
-	rule.Src = cuint2ip(entry.ip.src.s_addr, entry.ip.smsk.s_addr)
+	rule.Proto = uint16(entry.ip.proto)
+	if entry.ip.invflags&C.IPT_INV_PROTO != 0 {
+		rule.Not.Proto = true
+	}
+
+	rule.Src = cuint2net(entry.ip.src.s_addr, entry.ip.smsk.s_addr)
 	if entry.ip.invflags&C.IPT_INV_SRCIP != 0 {
 		rule.Not.Src = true
 	}
 
-	rule.Dest = cuint2ip(entry.ip.dst.s_addr, entry.ip.dmsk.s_addr)
+	rule.Dest = cuint2net(entry.ip.dst.s_addr, entry.ip.dmsk.s_addr)
 	if entry.ip.invflags&C.IPT_INV_DSTIP != 0 {
 		rule.Not.Dest = true
 	}
 
+	// matches and target follow the entry header
+	data := C.GoBytes(unsafe.Pointer(entry), C.int(entry.next_offset))
+	var decodeErr error
+	matches, err := common.DecodeMatches(common.FamilyIPv4, data[C.sizeof_struct_ipt_entry:entry.target_offset])
+	if err != nil {
+		decodeErr = fmt.Errorf("matches: %v", err)
+	}
+	rule.Matches = matches
+	rule.TargetExt, err = common.DecodeTarget(common.FamilyIPv4, data[entry.target_offset:])
+	if err != nil && decodeErr == nil {
+		decodeErr = fmt.Errorf("target: %v", err)
+	}
+
+	if entry.ip.flags&C.IPT_F_GOTO != 0 {
+		rule.Goto = true
+	}
 	target := C.iptc_get_target(entry, h.handle)
 	if target != nil {
 		rule.Target = C.GoString(target)
 	}
-	return rule
+	return rule, decodeErr
+}
+
+// Rule2IptEntry builds an entry out of a rule, to be used with InsertEntry, AppendEntry and the other entry functions.
+// The target is resolved by libiptc to either a standard verdict or a jump to a user-defined chain.
+// Extensions are encoded with the highest revision supported by both the library and the kernel.
+func (h XtcHandle) Rule2IptEntry(rule *common.Rule) (result IptEntry, err error) {
+	src, smsk, err := net2cuint(rule.Src)
+	if err != nil {
+		return
+	}
+	dst, dmsk, err := net2cuint(rule.Dest)
+	if err != nil {
+		return
+	}
+	inIface, inMask, err := rule.InDev.Entry()
+	if err != nil {
+		return
+	}
+	outIface, outMask, err := rule.OutDev.Entry()
+	if err != nil {
+		return
+	}
+	proto, err := rule.EffectiveProto()
+	if err != nil {
+		return
+	}
+	matches, err := common.EncodeSupportedMatches(common.FamilyIPv4, rule.Matches)
+	if err != nil {
+		return
+	}
+	target, isGoto, err := common.EncodeSupportedRuleTarget(common.FamilyIPv4, rule)
+	if err != nil {
+		return
+	}
+	if kind := rule.TargetKind(); kind == common.TargetJump || kind == common.TargetGoto {
+		if err = h.checkJumpTarget(rule.Target); err != nil {
+			return
+		}
+	}
+
+	// entry, matches and target are laid out contiguously; memory is owned by Go
+	targetOffset := C.sizeof_struct_ipt_entry + len(matches)
+	buf := make([]byte, targetOffset+len(target))
+	copy(buf[C.sizeof_struct_ipt_entry:], matches)
+	copy(buf[targetOffset:], target)
+
+	entry := (*C.struct_ipt_entry)(unsafe.Pointer(&buf[0]))
+	entry.ip.src.s_addr = src
+	entry.ip.smsk.s_addr = smsk
+	entry.ip.dst.s_addr = dst
+	entry.ip.dmsk.s_addr = dmsk
+	for i := 0; i < common.IFNAMSIZ; i++ {
+		entry.ip.iniface[i] = C.char(inIface[i])
+		entry.ip.iniface_mask[i] = C.uchar(inMask[i])
+		entry.ip.outiface[i] = C.char(outIface[i])
+		entry.ip.outiface_mask[i] = C.uchar(outMask[i])
+	}
+	entry.ip.proto = C.__u16(proto)
+	if rule.Not.Proto {
+		entry.ip.invflags |= C.IPT_INV_PROTO
+	}
+	if rule.Not.InDev {
+		entry.ip.invflags |= C.IPT_INV_VIA_IN
+	}
+	if rule.Not.OutDev {
+		entry.ip.invflags |= C.IPT_INV_VIA_OUT
+	}
+	if rule.Not.Src {
+		entry.ip.invflags |= C.IPT_INV_SRCIP
+	}
+	if rule.Not.Dest {
+		entry.ip.invflags |= C.IPT_INV_DSTIP
+	}
+	if isGoto {
+		entry.ip.flags |= C.IPT_F_GOTO
+	}
+	entry.target_offset = C.__u16(targetOffset)
+	entry.next_offset = C.__u16(len(buf))
+	entry.counters.pcnt = C.__u64(rule.Pcnt)
+	entry.counters.bcnt = C.__u64(rule.Bcnt)
+
+	result.handle = entry
+	return
+}
+
+// checkJumpTarget verifies that chain is an existing user-defined chain; libiptc would otherwise take
+// its name for the name of an extension target, and the kernel would reject the entry on commit.
+func (h XtcHandle) checkJumpTarget(chain string) error {
+	isChain, err := h.IsChain(chain)
+	if err != nil {
+		return err
+	}
+	if !isChain {
+		return fmt.Errorf("chain %q does not exist", chain)
+	}
+	isBuiltin, err := h.IsBuiltin(chain)
+	if err != nil {
+		return err
+	}
+	if isBuiltin {
+		return fmt.Errorf("cannot jump to built-in chain %q", chain)
+	}
+	return nil
 }
 
 func getNativeError() string {
@@ -105,19 +266,24 @@ func (h *XtcHandle) Free() error {
 	}, "iptc_free", getNativeError)
 }
 
+// TableInit returns a handle of the table. Callers must now release it with Free, as it is no longer
+// released by a finalizer: handles are copied by value, so the finalizer freed them while still in use.
 func TableInit(tableName string) (result XtcHandle, osErr error) {
 	osErr = common.RelayCall(func() bool {
 		cStr := C.CString(tableName)
 		defer C.free(unsafe.Pointer(cStr))
 
 		h := C.iptc_init(cStr)
-		result = XtcHandle{h}
+		result = XtcHandle{h, tableName}
 
 		return h != nil
 	}, "iptc_init", getNativeError)
-
-	// set the finalizer before returning the usable result
-	runtime.SetFinalizer(&result, (*XtcHandle).Free)
+	if osErr != nil {
+		// explain the failure when the table is not registered, usually because its module is not loaded
+		if err, ok := common.CheckTable(common.FamilyIPv4, tableName).(*common.UnavailableError); ok {
+			osErr = err
+		}
+	}
 
 	return
 }
@@ -132,8 +298,9 @@ func (h XtcHandle) IsChain(chain string) (result bool, osErr error) {
 			result = true
 			return result
 		} else if r == 0 {
+			// a false result is not a failure
 			result = false
-			return result
+			return true
 		}
 		panic("invalid return value")
 	}, "iptc_is_chain", getNativeError)
@@ -150,8 +317,9 @@ func (h XtcHandle) IsBuiltin(chain string) (result bool, osErr error) {
 			result = true
 			return result
 		} else if r == 0 {
+			// a false result is not a failure
 			result = false
-			return result
+			return true
 		}
 		panic("invalid return value")
 	}, "iptc_builtin", getNativeError)
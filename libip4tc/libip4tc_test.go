@@ -20,12 +20,61 @@ Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
 package libip4tc
 
 import (
+	"net"
+	"net/netip"
+	"reflect"
+	"runtime"
 	"testing"
 
 	common "github.com/gdm85/go-libiptc"
+	"github.com/gdm85/go-libiptc/nstest"
 )
 
+// TestMain runs the tests in a throwaway network namespace, so that root privileges are not needed
+// and the host tables are left alone.
+func TestMain(m *testing.M) {
+	nstest.Main(m)
+}
+
+// lockTable acquires the xtables lock for the duration of the test and returns a handle of the table.
+func lockTable(t *testing.T, table string) XtcHandle {
+	t.Helper()
+	acquired, err := common.XtablesLock(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		if _, err := common.XtablesUnlock(); err != nil {
+			t.Error(err)
+		}
+	})
+	return initTable(t, table)
+}
+
+// initTable returns a handle of the table, freed at the end of the test.
+func initTable(t *testing.T, table string) XtcHandle {
+	t.Helper()
+	handle, err := TableInit(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { handle.Free() })
+	return handle
+}
+
+func commit(t *testing.T, handle XtcHandle) {
+	t.Helper()
+	if err := handle.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestXtablesLock(t *testing.T) {
+	nstest.Require(t)
+
 	acquired, err := common.XtablesLock(false, 0)
 	if err != nil {
 		t.Error(err)
@@ -49,6 +98,8 @@ func TestXtablesLock(t *testing.T) {
 }
 
 func TestInit(t *testing.T) {
+	nstest.Require(t)
+
 	acquired, err := common.XtablesLock(false, 0)
 	if err != nil {
 		t.Fatal(err)
@@ -68,8 +119,402 @@ func TestInit(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	info, err := handle.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "filter" || len(info.Chains()) != 3 || info.NumEntries < 4 {
+		t.Errorf("unexpected table info %+v", info)
+	}
+	tables, err := Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, table := range tables {
+		found = found || table == "filter"
+	}
+	if !found {
+		t.Errorf("filter table not found in %v", tables)
+	}
+
+	if _, err := SupportedRevision(common.ExtensionMatch, "udp"); err != nil {
+		t.Error(err)
+	}
+	if _, err := SupportedRevision(common.ExtensionTarget, "NONEXISTENT"); err == nil {
+		t.Error("expected an error for an unknown target")
+	}
+
+	if _, err := TableInit("nonexistent"); err == nil {
+		t.Error("expected an error for an unknown table")
+	} else if _, ok := err.(*common.UnavailableError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+
 	err = handle.Free()
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestOwned(t *testing.T) {
+	nstest.Require(t)
+	handle := lockTable(t, "filter")
+
+	const chain = common.XtChainLabel("GO-LIBIPTC-TEST")
+	const owner = "go-libiptc-test"
+
+	if _, err := handle.CreateChain(chain); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		handle, err := TableInit("filter")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer handle.Free()
+		if _, err := handle.FlushEntries(chain); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := handle.DeleteChain(chain); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := handle.Commit(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	src := common.NetFromPrefix(netip.MustParsePrefix("10.1.2.0/24"))
+	rules := map[common.XtChainLabel][]*common.Rule{
+		chain: {
+			{Src: src, Target: common.IPTC_LABEL_ACCEPT},
+			{InDev: "eth+", Target: common.IPTC_LABEL_DROP},
+		},
+	}
+	if err := handle.ReplaceOwned(owner, rules); err != nil {
+		t.Fatal(err)
+	}
+
+	check := initTable(t, "filter")
+	owned, err := check.ListOwned(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned[chain]) != 2 {
+		t.Fatalf("expected 2 owned rules, got %d", len(owned[chain]))
+	}
+	if owned[chain][0].Src.String() != "10.1.2.0/24" || owned[chain][1].InDev != "eth+" {
+		t.Fatalf("unexpected rules: %v", owned[chain])
+	}
+
+	deleted, err := check.DeleteOwned(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted rules, got %d", deleted)
+	}
+}
+
+func TestJumpTarget(t *testing.T) {
+	nstest.Require(t)
+	handle := initTable(t, "filter")
+
+	// the handle is never committed, thus the chain is not created in the kernel
+	const chain = common.XtChainLabel("GO-LIBIPTC-JUMP")
+	if _, err := handle.CreateChain(chain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle.Rule2IptEntry(&common.Rule{Target: string(chain)}); err != nil {
+		t.Errorf("jump to a user-defined chain: %v", err)
+	}
+	if _, err := handle.Rule2IptEntry(&common.Rule{Target: string(chain), Goto: true}); err != nil {
+		t.Errorf("goto a user-defined chain: %v", err)
+	}
+	for _, target := range []string{"GO-LIBIPTC-MISSING", "INPUT"} {
+		if _, err := handle.Rule2IptEntry(&common.Rule{Target: target}); err == nil {
+			t.Errorf("jump to %s encoded", target)
+		}
+	}
+}
+
+func TestChainLifecycle(t *testing.T) {
+	nstest.Require(t)
+	handle := lockTable(t, "filter")
+
+	for _, chain := range []common.XtChainLabel{"GO-LIFECYCLE-B", "GO-LIFECYCLE-A"} {
+		if _, err := handle.CreateChain(chain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := handle.AppendRule("GO-LIFECYCLE-A", &common.Rule{Target: "GO-LIFECYCLE-B"}); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+
+	handle = initTable(t, "filter")
+	chains, err := handle.Chains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.XtChainLabel{"INPUT", "FORWARD", "OUTPUT", "GO-LIFECYCLE-A", "GO-LIFECYCLE-B"}
+	if !reflect.DeepEqual(chains, expected) {
+		t.Errorf("expected chains %v, got %v", expected, chains)
+	}
+	if builtin, err := handle.IsBuiltin("GO-LIFECYCLE-A"); err != nil || builtin {
+		t.Errorf("user chain reported as built-in: %v", err)
+	}
+	if refs, err := handle.GetReferences("GO-LIFECYCLE-B"); err != nil || refs != 1 {
+		t.Errorf("unexpected references %d, %v", refs, err)
+	}
+	if _, err := handle.DeleteChain("GO-LIFECYCLE-B"); err == nil {
+		t.Error("deleted a referenced chain")
+	}
+
+	// jumps follow renamed chains
+	if _, err := handle.RenameChain("GO-LIFECYCLE-B", "GO-LIFECYCLE-C"); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+
+	handle = initTable(t, "filter")
+	rules, err := handle.Rules("GO-LIFECYCLE-A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Target != "GO-LIFECYCLE-C" {
+		t.Fatalf("jump not renamed: %v", rules)
+	}
+	if _, err := handle.FlushEntries("GO-LIFECYCLE-A"); err != nil {
+		t.Fatal(err)
+	}
+	for _, chain := range []common.XtChainLabel{"GO-LIFECYCLE-A", "GO-LIFECYCLE-C"} {
+		if _, err := handle.DeleteChain(chain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(t, handle)
+
+	handle = initTable(t, "filter")
+	for _, chain := range []string{"GO-LIFECYCLE-A", "GO-LIFECYCLE-B", "GO-LIFECYCLE-C"} {
+		if exists, err := handle.IsChain(chain); err != nil || exists {
+			t.Errorf("chain %s still exists: %v", chain, err)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	nstest.Require(t)
+	handle := lockTable(t, "filter")
+
+	counters := common.XtCounters{Pcnt: 5, Bcnt: 500}
+	if _, err := handle.SetPolicy("FORWARD", common.IPTC_LABEL_DROP, &counters); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle.SetPolicy("FORWARD", common.IPTC_LABEL_RETURN, nil); err == nil {
+		t.Error("set an invalid policy")
+	}
+	commit(t, handle)
+
+	handle = initTable(t, "filter")
+	policy, read, err := handle.GetPolicy("FORWARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != common.IPTC_LABEL_DROP || read != counters {
+		t.Errorf("unexpected policy %s %v", policy, read)
+	}
+	if _, err := handle.SetPolicy("FORWARD", common.IPTC_LABEL_ACCEPT, nil); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+}
+
+func TestCounters(t *testing.T) {
+	nstest.Require(t)
+	handle := lockTable(t, "filter")
+
+	rule := &common.Rule{
+		Dest:   common.NetFromPrefix(netip.MustParsePrefix("127.0.0.2/32")),
+		Proto:  common.IPPROTO_UDP,
+		Target: common.IPTC_LABEL_ACCEPT,
+	}
+	if err := handle.AppendRule("OUTPUT", rule); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+	defer func() {
+		handle := initTable(t, "filter")
+		if _, err := handle.DeleteRule("OUTPUT", rule); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, handle)
+	}()
+
+	// packets are received, as an ICMP port unreachable error would fail the next writes
+	listener, err := net.ListenPacket("udp4", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("udp4", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := conn.Write(make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// IPv4 header, UDP header and payload
+	expected := common.XtCounters{Pcnt: 3, Bcnt: 3 * (20 + 8 + 10)}
+	handle = initTable(t, "filter")
+	counters, err := handle.ReadCounter("OUTPUT", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters != expected {
+		t.Errorf("expected counters %v, got %v", expected, counters)
+	}
+
+	expected = common.XtCounters{Pcnt: 10, Bcnt: 1000}
+	if _, err := handle.SetCounter("OUTPUT", 1, expected); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+	handle = initTable(t, "filter")
+	if counters, err := handle.ReadCounter("OUTPUT", 1); err != nil || counters != expected {
+		t.Errorf("expected counters %v, got %v: %v", expected, counters, err)
+	}
+
+	if _, err := handle.ZeroEntries("OUTPUT"); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+	handle = initTable(t, "filter")
+	if counters, err := handle.ReadCounter("OUTPUT", 1); err != nil || counters != (common.XtCounters{}) {
+		t.Errorf("counters not zeroed: %v, %v", counters, err)
+	}
+}
+
+func TestNat(t *testing.T) {
+	nstest.Require(t)
+	handle, err := TableInit("nat")
+	if _, ok := err.(*common.UnavailableError); ok {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	handle.Free()
+	handle = lockTable(t, "nat")
+
+	chains, err := handle.Chains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []common.XtChainLabel{"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"}; !reflect.DeepEqual(chains, expected) {
+		t.Errorf("expected chains %v, got %v", expected, chains)
+	}
+
+	const chain = common.XtChainLabel("GO-NAT")
+	rule := &common.Rule{
+		Proto:   common.IPPROTO_TCP,
+		Matches: []common.Match{&common.TCP{DstPort: &common.PortRange{Min: 8080, Max: 8080}}},
+		Target:  string(chain),
+	}
+	if _, err := handle.CreateChain(chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.AppendRule(chain, &common.Rule{Target: common.IPTC_LABEL_RETURN}); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.AppendRule("PREROUTING", rule); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+
+	handle = initTable(t, "nat")
+	if found, err := handle.CheckRule("PREROUTING", rule); err != nil || !found {
+		t.Errorf("rule not found: %v", err)
+	}
+	if _, err := handle.DeleteRule("PREROUTING", rule); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle.FlushEntries(chain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle.DeleteChain(chain); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+}
+
+func TestPoller(t *testing.T) {
+	nstest.Require(t)
+	handle := lockTable(t, "filter")
+
+	rule := &common.Rule{
+		Dest:    common.NetFromPrefix(netip.MustParsePrefix("127.0.0.3/32")),
+		Proto:   common.IPPROTO_UDP,
+		Matches: []common.Match{&common.Comment{Text: "go-poller"}},
+		Target:  common.IPTC_LABEL_ACCEPT,
+	}
+	if err := handle.InsertRule("OUTPUT", rule, 0); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+
+	poller := NewPoller("filter")
+	if _, err := poller.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenPacket("udp4", "127.0.0.3:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("udp4", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write(make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// handles of previous polls must not be freed again
+	runtime.GC()
+
+	deltas, err := poller.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := common.XtCounters{Pcnt: 2, Bcnt: 2 * (20 + 8 + 10)}
+	found := false
+	for _, rd := range deltas.Rules {
+		if rd.ID.Tag == "go-poller" {
+			found = true
+			if rd.New || rd.Delta != expected {
+				t.Errorf("expected delta %v, got %+v", expected, rd)
+			}
+		}
+	}
+	if !found {
+		t.Error("rule not polled")
+	}
+	if deltas.Chains[2].Chain != "OUTPUT" || deltas.Chains[2].Rules.Delta.Pcnt < 2 {
+		t.Errorf("unexpected chain deltas %+v", deltas.Chains[2])
+	}
+
+	handle = initTable(t, "filter")
+	if _, err := handle.DeleteRule("OUTPUT", rule); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, handle)
+}
@@ -0,0 +1,39 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libip4tc
+
+import (
+	"fmt"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+// ExportRaw reads the kernel representation of an IPv4 table, see common.ExportRaw.
+func ExportRaw(table string) (*common.RawTable, error) {
+	return common.ExportRaw(common.FamilyIPv4, table)
+}
+
+// ImportRaw atomically replaces an IPv4 table with one read by ExportRaw, see common.ImportRaw.
+func ImportRaw(table *common.RawTable) error {
+	if table.Family != common.FamilyIPv4 {
+		return fmt.Errorf("cannot import a %s table", table.Family)
+	}
+	return common.ImportRaw(table)
+}
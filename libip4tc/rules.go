@@ -0,0 +1,85 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libip4tc
+
+import (
+	"fmt"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+var _ common.Handle = (*XtcHandle)(nil)
+
+// Rules returns the rules of a chain.
+func (h XtcHandle) Rules(chain common.XtChainLabel) ([]*common.Rule, error) {
+	var rules []*common.Rule
+	e, err := h.FirstRule(string(chain))
+	for err == nil && !e.IsEmpty() {
+		var rule *common.Rule
+		if rule, err = h.DecodeEntry(&e); err != nil {
+			return nil, fmt.Errorf("chain %s: rule %d: %v", chain, len(rules)+1, err)
+		}
+		rules = append(rules, rule)
+		e, err = h.NextRule(e)
+	}
+	return rules, err
+}
+
+// InsertRule inserts a rule at position ruleNum of the chain, starting at 0.
+func (h XtcHandle) InsertRule(chain common.XtChainLabel, rule *common.Rule, ruleNum uint) error {
+	entry, err := h.Rule2IptEntry(rule)
+	if err != nil {
+		return err
+	}
+	return h.InsertEntry(chain, entry, ruleNum)
+}
+
+// AppendRule appends a rule to the chain.
+func (h XtcHandle) AppendRule(chain common.XtChainLabel, rule *common.Rule) error {
+	entry, err := h.Rule2IptEntry(rule)
+	if err != nil {
+		return err
+	}
+	return h.AppendEntry(chain, entry)
+}
+
+// CheckRule returns whether the chain has a rule equal to rule, as compared by common.Rule.Key.
+func (h XtcHandle) CheckRule(chain common.XtChainLabel, rule *common.Rule) (bool, error) {
+	rules, err := h.Rules(chain)
+	if err != nil {
+		return false, err
+	}
+	i, err := common.IndexRule(common.FamilyIPv4, rules, rule)
+	return i >= 0, err
+}
+
+// DeleteRule deletes the first rule of the chain equal to rule, as compared by common.Rule.Key;
+// it returns false if there is none.
+func (h XtcHandle) DeleteRule(chain common.XtChainLabel, rule *common.Rule) (bool, error) {
+	rules, err := h.Rules(chain)
+	if err != nil {
+		return false, err
+	}
+	i, err := common.IndexRule(common.FamilyIPv4, rules, rule)
+	if err != nil || i < 0 {
+		return false, err
+	}
+	return h.DeleteNumEntry(chain, uint(i))
+}
@@ -24,22 +24,44 @@ import (
 	// #include <libiptc/libip6tc.h>
 	// #include <stdlib.h>
 	"C"
-	"net"
-	"runtime"
+	"fmt"
+	"net/netip"
 	"unsafe"
 
 	common "github.com/gdm85/go-libiptc"
 )
 
-func cin6addr2ip(cAaddr, cMask C.struct_in6_addr) *net.IPNet {
-	ip := new(net.IPNet)
+// cin6addr2net converts an address and mask of an entry.
+func cin6addr2net(cAddr, cMask C.struct_in6_addr) common.Net {
+	addr := netip.AddrFrom16(*(*[16]byte)(unsafe.Pointer(&cAddr)))
+	mask := netip.AddrFrom16(*(*[16]byte)(unsafe.Pointer(&cMask)))
+	// both addresses are IPv6, thus cannot be rejected
+	n, _ := common.NetFromMask(addr, mask)
+	return n
+}
 
-	ip.IP = make(net.IP, 16)
-	copy(ip.IP, cAaddr.__in6_u[:])
-	ip.Mask = make(net.IPMask, 16)
-	copy(ip.Mask, cMask.__in6_u[:])
+// net2cin6addr is the counterpart of cin6addr2net; host bits of the address are cleared.
+func net2cin6addr(n common.Net) (cAddr, cMask C.struct_in6_addr, err error) {
+	if n.IsAny() {
+		return
+	}
+	if !n.Addr().Is6() || n.Addr().Is4In6() {
+		err = fmt.Errorf("not an IPv6 address: %s", n)
+		return
+	}
+	*(*[16]byte)(unsafe.Pointer(&cAddr)) = n.Addr().As16()
+	*(*[16]byte)(unsafe.Pointer(&cMask)) = n.MaskAddr().As16()
+	return
+}
 
-	return ip
+// cIface2Interface converts the interface name and mask of an entry.
+func cIface2Interface(cIface [common.IFNAMSIZ]C.char, cMask [common.IFNAMSIZ]C.uchar) common.Interface {
+	var iface, mask [common.IFNAMSIZ]byte
+	for i := 0; i < common.IFNAMSIZ; i++ {
+		iface[i] = byte(cIface[i])
+		mask[i] = byte(cMask[i])
+	}
+	return common.InterfaceFromEntry(iface, mask)
 }
 
 type IptEntry struct {
@@ -52,15 +74,35 @@ func (h IptEntry) IsEmpty() bool {
 
 type XtcHandle struct {
 	handle *C.struct_xtc_handle
+	// table is the name passed to TableInit
+	table string
 }
 
+// IptEntry2Rule decodes an entry returned by FirstRule or NextRule, see DecodeEntry; extensions following
+// a malformed extension header are left out of the rule.
 func (h XtcHandle) IptEntry2Rule(e *IptEntry) *common.Rule {
+	rule, _ := h.decodeEntry(e)
+	return rule
+}
+
+// DecodeEntry decodes an entry returned by FirstRule or NextRule; it fails for malformed extension headers,
+// while extension payloads that cannot be decoded are returned as RawMatch and RawTarget.
+func (h XtcHandle) DecodeEntry(e *IptEntry) (*common.Rule, error) {
+	rule, err := h.decodeEntry(e)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// decodeEntry returns the rule of an entry, with the extensions which could be decoded when it fails.
+func (h XtcHandle) decodeEntry(e *IptEntry) (*common.Rule, error) {
 	entry := e.handle
 	rule := new(common.Rule)
 	rule.Pcnt = uint64(entry.counters.pcnt)
 	rule.Bcnt = uint64(entry.counters.bcnt)
-	rule.InDev = C.GoString(&entry.ipv6.iniface[0])
-	rule.OutDev = C.GoString(&entry.ipv6.outiface[0])
+	rule.InDev = cIface2Interface(entry.ipv6.iniface, entry.ipv6.iniface_mask)
+	rule.OutDev = cIface2Interface(entry.ipv6.outiface, entry.ipv6.outiface_mask)
 	if entry.ipv6.invflags&C.IP6T_INV_VIA_IN != 0 {
 		rule.Not.InDev = true
 	}
@@ -68,21 +110,148 @@ func (h XtcHandle) IptEntry2Rule(e *IptEntry) *common.Rule {
 		rule.Not.OutDev = true
 	}
 
-	rule.Src = cin6addr2ip(entry.ipv6.src, entry.ipv6.smsk)
+	rule.Proto = uint16(entry.ipv6.proto)
+	if entry.ipv6.invflags&C.IP6T_INV_PROTO != 0 {
+		rule.Not.Proto = true
+	}
+
+	rule.Src = cin6addr2net(entry.ipv6.src, entry.ipv6.smsk)
 	if entry.ipv6.invflags&C.IP6T_INV_SRCIP != 0 {
 		rule.Not.Src = true
 	}
 
-	rule.Dest = cin6addr2ip(entry.ipv6.dst, entry.ipv6.dmsk)
+	rule.Dest = cin6addr2net(entry.ipv6.dst, entry.ipv6.dmsk)
 	if entry.ipv6.invflags&C.IP6T_INV_DSTIP != 0 {
 		rule.Not.Dest = true
 	}
 
+	// matches and target follow the entry header
+	data := C.GoBytes(unsafe.Pointer(entry), C.int(entry.next_offset))
+	var decodeErr error
+	matches, err := common.DecodeMatches(common.FamilyIPv6, data[C.sizeof_struct_ip6t_entry:entry.target_offset])
+	if err != nil {
+		decodeErr = fmt.Errorf("matches: %v", err)
+	}
+	rule.Matches = matches
+	rule.TargetExt, err = common.DecodeTarget(common.FamilyIPv6, data[entry.target_offset:])
+	if err != nil && decodeErr == nil {
+		decodeErr = fmt.Errorf("target: %v", err)
+	}
+
+	if entry.ipv6.flags&C.IP6T_F_GOTO != 0 {
+		rule.Goto = true
+	}
 	target := C.ip6tc_get_target(entry, h.handle)
 	if target != nil {
 		rule.Target = C.GoString(target)
 	}
-	return rule
+	return rule, decodeErr
+}
+
+// Rule2IptEntry builds an entry out of a rule, to be used with InsertEntry, AppendEntry and the other entry functions.
+// The target is resolved by libip6tc to either a standard verdict or a jump to a user-defined chain.
+// Extensions are encoded with the highest revision supported by both the library and the kernel.
+func (h XtcHandle) Rule2IptEntry(rule *common.Rule) (result IptEntry, err error) {
+	src, smsk, err := net2cin6addr(rule.Src)
+	if err != nil {
+		return
+	}
+	dst, dmsk, err := net2cin6addr(rule.Dest)
+	if err != nil {
+		return
+	}
+	inIface, inMask, err := rule.InDev.Entry()
+	if err != nil {
+		return
+	}
+	outIface, outMask, err := rule.OutDev.Entry()
+	if err != nil {
+		return
+	}
+	proto, err := rule.EffectiveProto()
+	if err != nil {
+		return
+	}
+	matches, err := common.EncodeSupportedMatches(common.FamilyIPv6, rule.Matches)
+	if err != nil {
+		return
+	}
+	target, isGoto, err := common.EncodeSupportedRuleTarget(common.FamilyIPv6, rule)
+	if err != nil {
+		return
+	}
+	if kind := rule.TargetKind(); kind == common.TargetJump || kind == common.TargetGoto {
+		if err = h.checkJumpTarget(rule.Target); err != nil {
+			return
+		}
+	}
+
+	// entry, matches and target are laid out contiguously; memory is owned by Go
+	targetOffset := C.sizeof_struct_ip6t_entry + len(matches)
+	buf := make([]byte, targetOffset+len(target))
+	copy(buf[C.sizeof_struct_ip6t_entry:], matches)
+	copy(buf[targetOffset:], target)
+
+	entry := (*C.struct_ip6t_entry)(unsafe.Pointer(&buf[0]))
+	entry.ipv6.src = src
+	entry.ipv6.smsk = smsk
+	entry.ipv6.dst = dst
+	entry.ipv6.dmsk = dmsk
+	for i := 0; i < common.IFNAMSIZ; i++ {
+		entry.ipv6.iniface[i] = C.char(inIface[i])
+		entry.ipv6.iniface_mask[i] = C.uchar(inMask[i])
+		entry.ipv6.outiface[i] = C.char(outIface[i])
+		entry.ipv6.outiface_mask[i] = C.uchar(outMask[i])
+	}
+	if proto != 0 {
+		entry.ipv6.proto = C.__u16(proto)
+		entry.ipv6.flags |= C.IP6T_F_PROTO
+	}
+	if rule.Not.Proto {
+		entry.ipv6.invflags |= C.IP6T_INV_PROTO
+	}
+	if rule.Not.InDev {
+		entry.ipv6.invflags |= C.IP6T_INV_VIA_IN
+	}
+	if rule.Not.OutDev {
+		entry.ipv6.invflags |= C.IP6T_INV_VIA_OUT
+	}
+	if rule.Not.Src {
+		entry.ipv6.invflags |= C.IP6T_INV_SRCIP
+	}
+	if rule.Not.Dest {
+		entry.ipv6.invflags |= C.IP6T_INV_DSTIP
+	}
+	if isGoto {
+		entry.ipv6.flags |= C.IP6T_F_GOTO
+	}
+	entry.target_offset = C.__u16(targetOffset)
+	entry.next_offset = C.__u16(len(buf))
+	entry.counters.pcnt = C.__u64(rule.Pcnt)
+	entry.counters.bcnt = C.__u64(rule.Bcnt)
+
+	result.handle = entry
+	return
+}
+
+// checkJumpTarget verifies that chain is an existing user-defined chain; libiptc would otherwise take
+// its name for the name of an extension target, and the kernel would reject the entry on commit.
+func (h XtcHandle) checkJumpTarget(chain string) error {
+	isChain, err := h.IsChain(chain)
+	if err != nil {
+		return err
+	}
+	if !isChain {
+		return fmt.Errorf("chain %q does not exist", chain)
+	}
+	isBuiltin, err := h.IsBuiltin(chain)
+	if err != nil {
+		return err
+	}
+	if isBuiltin {
+		return fmt.Errorf("cannot jump to built-in chain %q", chain)
+	}
+	return nil
 }
 
 func getNativeError() string {
@@ -99,19 +268,24 @@ func (h *XtcHandle) Free() error {
 	}, "ip6tc_free", getNativeError)
 }
 
+// TableInit returns a handle of the table. Callers must now release it with Free, as it is no longer
+// released by a finalizer: handles are copied by value, so the finalizer freed them while still in use.
 func TableInit(tableName string) (result XtcHandle, osErr error) {
 	osErr = common.RelayCall(func() bool {
 		cStr := C.CString(tableName)
 		defer C.free(unsafe.Pointer(cStr))
 
 		h := C.ip6tc_init(cStr)
-		result = XtcHandle{h}
+		result = XtcHandle{h, tableName}
 
 		return h != nil
 	}, "ip6tc_init", getNativeError)
-
-	// set the finalizer before returning the usable result
-	runtime.SetFinalizer(&result, (*XtcHandle).Free)
+	if osErr != nil {
+		// explain the failure when the table is not registered, usually because its module is not loaded
+		if err, ok := common.CheckTable(common.FamilyIPv6, tableName).(*common.UnavailableError); ok {
+			osErr = err
+		}
+	}
 
 	return
 }
@@ -126,8 +300,9 @@ func (h XtcHandle) IsChain(chain string) (result bool, osErr error) {
 			result = true
 			return result
 		} else if r == 0 {
+			// a false result is not a failure
 			result = false
-			return result
+			return true
 		}
 		panic("invalid return value")
 	}, "ip6tc_is_chain", getNativeError)
@@ -144,8 +319,9 @@ func (h XtcHandle) IsBuiltin(chain string) (result bool, osErr error) {
 			result = true
 			return result
 		} else if r == 0 {
+			// a false result is not a failure
 			result = false
-			return result
+			return true
 		}
 		panic("invalid return value")
 	}, "ip6tc_builtin", getNativeError)
@@ -0,0 +1,153 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libip6tc
+
+import (
+	"errors"
+	"fmt"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+// Chains returns the names of all chains of the table.
+func (h XtcHandle) Chains() ([]common.XtChainLabel, error) {
+	var chains []common.XtChainLabel
+	chain, err := h.FirstChain()
+	for err == nil && chain != "" {
+		chains = append(chains, common.XtChainLabel(chain))
+		chain, err = h.NextChain()
+	}
+	return chains, err
+}
+
+// ownedRules returns the rules of a chain that are tagged with the specified owner,
+// along with their positions in the chain (starting at 0, as used by DeleteNumEntry).
+func (h XtcHandle) ownedRules(chain common.XtChainLabel, owner string) (positions []uint, rules []*common.Rule, osErr error) {
+	e, osErr := h.FirstRule(string(chain))
+	for i := uint(0); osErr == nil && !e.IsEmpty(); i++ {
+		rule, err := h.DecodeEntry(&e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("chain %s: rule %d: %v", chain, i+1, err)
+		}
+		if rule.IsOwnedBy(owner) {
+			positions = append(positions, i)
+			rules = append(rules, rule)
+		}
+		e, osErr = h.NextRule(e)
+	}
+	return
+}
+
+// ListOwned returns all rules tagged with the specified owner, grouped by chain.
+func (h XtcHandle) ListOwned(owner string) (map[common.XtChainLabel][]*common.Rule, error) {
+	if owner == "" {
+		return nil, errors.New("empty owner")
+	}
+	chains, err := h.Chains()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[common.XtChainLabel][]*common.Rule{}
+	for _, chain := range chains {
+		_, rules, err := h.ownedRules(chain, owner)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) != 0 {
+			result[chain] = rules
+		}
+	}
+	return result, nil
+}
+
+// deleteOwned deletes all rules tagged with the specified owner from all chains, without committing.
+func (h XtcHandle) deleteOwned(owner string) (deleted uint, osErr error) {
+	chains, osErr := h.Chains()
+	if osErr != nil {
+		return
+	}
+
+	for _, chain := range chains {
+		positions, _, err := h.ownedRules(chain, owner)
+		if err != nil {
+			return deleted, err
+		}
+		// delete from the bottom so that positions of the remaining rules do not shift
+		for i := len(positions) - 1; i >= 0; i-- {
+			_, err = h.DeleteNumEntry(chain, positions[i])
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return
+}
+
+// DeleteOwned deletes all rules tagged with the specified owner from all chains and commits the changes.
+func (h XtcHandle) DeleteOwned(owner string) (deleted uint, osErr error) {
+	if owner == "" {
+		return 0, errors.New("empty owner")
+	}
+	deleted, osErr = h.deleteOwned(owner)
+	if osErr != nil {
+		return
+	}
+	osErr = h.Commit()
+	return
+}
+
+// ReplaceOwned deletes all rules tagged with the specified owner from all chains, then appends
+// the specified rules to their chains and commits all changes at once.
+// Appended rules are tagged with the owner; the rules passed in are not modified.
+func (h XtcHandle) ReplaceOwned(owner string, rules map[common.XtChainLabel][]*common.Rule) error {
+	if owner == "" {
+		return errors.New("empty owner")
+	}
+
+	// build all entries first, so that invalid rules do not cause a partial change
+	entries := map[common.XtChainLabel][]IptEntry{}
+	for chain, chainRules := range rules {
+		for _, rule := range chainRules {
+			tagged := *rule
+			tagged.SetOwner(owner)
+			entry, err := h.Rule2IptEntry(&tagged)
+			if err != nil {
+				return err
+			}
+			entries[chain] = append(entries[chain], entry)
+		}
+	}
+
+	_, err := h.deleteOwned(owner)
+	if err != nil {
+		return err
+	}
+	for chain, chainEntries := range entries {
+		for _, entry := range chainEntries {
+			err = h.AppendEntry(chain, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return h.Commit()
+}
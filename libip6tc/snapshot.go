@@ -0,0 +1,126 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libip6tc
+
+import (
+	"fmt"
+
+	common "github.com/gdm85/go-libiptc"
+)
+
+// Snapshot returns all chains of the table with their policies, rules and counters.
+func (h XtcHandle) Snapshot() (*common.Table, error) {
+	chains, err := h.Chains()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &common.Table{Name: h.table, Family: common.FamilyIPv6}
+	for _, name := range chains {
+		chain := &common.Chain{Name: name, Rules: []*common.Rule{}}
+		builtin, err := h.IsBuiltin(string(name))
+		if err != nil {
+			return nil, err
+		}
+		if builtin {
+			chain.Policy, chain.Counters, err = h.GetPolicy(string(name))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rules, err := h.Rules(name)
+		if err != nil {
+			return nil, err
+		}
+		chain.Rules = append(chain.Rules, rules...)
+		table.Chains = append(table.Chains, chain)
+	}
+	return table, nil
+}
+
+// Restore replaces all chains of the table with the ones of a snapshot, as iptables-restore does, without
+// committing; counters of rules and policies are restored too. On error, changes are left partially applied
+// and the handle should be freed without committing.
+func (h XtcHandle) Restore(table *common.Table) error {
+	if table.Family != common.FamilyIPv6 {
+		return fmt.Errorf("cannot restore a %s table", table.Family)
+	}
+	if table.Name != "" && table.Name != h.table {
+		return fmt.Errorf("cannot restore table %s into table %s", table.Name, h.table)
+	}
+	if err := table.Validate(); err != nil {
+		return err
+	}
+
+	// flush all chains before deleting user-defined ones, so that they are not referenced anymore
+	chains, err := h.Chains()
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		if _, err := h.FlushEntries(chain); err != nil {
+			return err
+		}
+	}
+	for _, chain := range chains {
+		builtin, err := h.IsBuiltin(string(chain))
+		if err != nil {
+			return err
+		}
+		if !builtin {
+			if _, err := h.DeleteChain(chain); err != nil {
+				return err
+			}
+		}
+	}
+
+	// create all chains before adding rules, as jumps are checked against existing chains
+	for _, chain := range table.Chains {
+		builtin, err := h.IsBuiltin(string(chain.Name))
+		if err != nil {
+			return err
+		}
+		if builtin != chain.IsBuiltin() {
+			return fmt.Errorf("chain %s: built-in chains must have a policy, user-defined ones must not", chain.Name)
+		}
+		if builtin {
+			counters := chain.Counters
+			_, err = h.SetPolicy(chain.Name, common.XtChainLabel(chain.Policy), &counters)
+		} else {
+			_, err = h.CreateChain(chain.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, chain := range table.Chains {
+		for _, rule := range chain.Rules {
+			entry, err := h.Rule2IptEntry(rule)
+			if err != nil {
+				return fmt.Errorf("chain %s: %v", chain.Name, err)
+			}
+			if err := h.AppendEntry(chain.Name, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -24,7 +24,6 @@ import (
 	// #include "xtables-lock.h"
 	"C"
 	"fmt"
-	"net"
 	"runtime"
 )
 
@@ -39,12 +38,86 @@ const (
 	IPTC_LABEL_RETURN = "RETURN"
 )
 
+// IsVerdict returns true for the labels of standard verdicts, like ACCEPT and RETURN.
+func IsVerdict(label string) bool {
+	switch label {
+	case IPTC_LABEL_ACCEPT, IPTC_LABEL_DROP, IPTC_LABEL_QUEUE, IPTC_LABEL_RETURN:
+		return true
+	}
+	return false
+}
+
+// TargetKind is the kind of target of a rule.
+type TargetKind uint8
+
+const (
+	// TargetNone is for rules without target, which only update counters.
+	TargetNone TargetKind = iota
+	// TargetVerdict is for standard verdicts, like '-j ACCEPT'.
+	TargetVerdict
+	// TargetJump is for jumps to user-defined chains, like '-j CHAIN'.
+	TargetJump
+	// TargetGoto is for gotos to user-defined chains, like '-g CHAIN'.
+	TargetGoto
+	// TargetExtension is for extension targets, like '-j LOG'.
+	TargetExtension
+)
+
+// String returns the kind name.
+func (k TargetKind) String() string {
+	switch k {
+	case TargetNone:
+		return "none"
+	case TargetVerdict:
+		return "verdict"
+	case TargetJump:
+		return "jump"
+	case TargetGoto:
+		return "goto"
+	case TargetExtension:
+		return "extension"
+	}
+	return fmt.Sprintf("TargetKind(%d)", uint8(k))
+}
+
+const (
+	// the constants are copied from IPPROTO_* declarations in netinet/in.h
+	IPPROTO_ICMP   = 1
+	IPPROTO_TCP    = 6
+	IPPROTO_UDP    = 17
+	IPPROTO_ICMPV6 = 58
+)
+
+// EffectiveProto returns the protocol of the rule; when Proto is zero, the protocol is implied
+// by protocol-specific matches, as iptables does for '-p tcp --dport 22'.
+func (r Rule) EffectiveProto() (uint16, error) {
+	proto := r.Proto
+	for _, m := range r.Matches {
+		pm, ok := m.(ProtocolMatch)
+		if !ok {
+			continue
+		}
+		if r.Not.Proto {
+			return 0, fmt.Errorf("match %s cannot be used with a negated protocol", m.Name())
+		}
+		if proto == 0 {
+			proto = pm.Protocol()
+		} else if proto != pm.Protocol() {
+			return 0, fmt.Errorf("match %s requires protocol %d, rule has %d", m.Name(), pm.Protocol(), proto)
+		}
+	}
+	return proto, nil
+}
+
+// IFNAMSIZ is the size of an interface name, including terminating NUL.
+const IFNAMSIZ = 16
+
 // XtCounters contains packet and byte counters.
 type XtCounters struct {
 	// Pcnt is the packet counter.
-	Pcnt uint64
+	Pcnt uint64 `json:"packets" yaml:"packets"`
 	// Bcnt is the byte counter.
-	Bcnt uint64
+	Bcnt uint64 `json:"bytes" yaml:"bytes"`
 }
 
 // Not is a shortand for rule negation description.
@@ -60,28 +133,116 @@ func (n Not) String() string {
 
 // Rule is a complete iptables rule descriptor.
 type Rule struct {
-	Src    *net.IPNet
-	Dest   *net.IPNet
-	InDev  string
-	OutDev string
-	Not    struct {
+	// Src and Dest are the source and destination addresses; the zero Net matches any address.
+	Src    Net
+	Dest   Net
+	InDev  Interface
+	OutDev Interface
+	// Proto is the layer 4 protocol number, zero for any protocol.
+	Proto uint16
+	Not   struct {
 		Src    Not
 		Dest   Not
 		InDev  Not
 		OutDev Not
+		Proto  Not
 	}
+	// Matches are the match extensions of the rule, in kernel order.
+	Matches []Match
+	// Target is the label of a verdict or user-defined chain, or the name of an extension target.
 	Target string
+	// Goto is set for '-g CHAIN': processing continues in the chain without returning here.
+	Goto bool
+	// TargetExt is the payload of an extension target like MARK or LOG; it is nil for verdicts
+	// and jumps to user-defined chains. When set, it takes precedence over Target for new entries.
+	TargetExt Target
 	XtCounters
 }
 
+// RuleKey is a comparable form of a Rule, usable as a map key; counters are not part of it.
+// Extensions are compared by their encoded payloads.
+type RuleKey struct {
+	Src    Net
+	Dest   Net
+	InDev  Interface
+	OutDev Interface
+	Proto  uint16
+	Not    struct {
+		Src    Not
+		Dest   Not
+		InDev  Not
+		OutDev Not
+		Proto  Not
+	}
+	Target    string
+	Goto      bool
+	Matches   string
+	TargetExt string
+}
+
+// Key returns the comparable form of the rule, encoding its extensions for family. Rules are compared as
+// entries, thus a rule has the same key as when read back: the protocol implied by matches is used,
+// Target is ignored for extension targets, and extensions with several revisions compare equal
+// whichever revision was installed.
+func (r Rule) Key(family Family) (RuleKey, error) {
+	proto, err := r.EffectiveProto()
+	if err != nil {
+		return RuleKey{}, err
+	}
+	k := RuleKey{
+		Src:    r.Src,
+		Dest:   r.Dest,
+		InDev:  r.InDev,
+		OutDev: r.OutDev,
+		Proto:  proto,
+		Not:    r.Not,
+		Target: r.Target,
+		Goto:   r.Goto,
+	}
+	for _, m := range r.Matches {
+		match, err := encodeKeyExtension(family, ExtensionMatch, m)
+		if err != nil {
+			return RuleKey{}, err
+		}
+		k.Matches += string(match)
+	}
+	if r.TargetExt != nil {
+		target, err := encodeKeyExtension(family, ExtensionTarget, r.TargetExt)
+		if err != nil {
+			return RuleKey{}, err
+		}
+		k.Target, k.TargetExt = "", string(target)
+	}
+	return k, nil
+}
+
+// TargetKind returns the kind of target of the rule.
+func (r Rule) TargetKind() TargetKind {
+	switch {
+	case r.TargetExt != nil:
+		return TargetExtension
+	case r.Target == "":
+		return TargetNone
+	case IsVerdict(r.Target):
+		return TargetVerdict
+	case r.Goto:
+		return TargetGoto
+	}
+	return TargetJump
+}
+
 // String returns a human-readable description of a rule.
 func (r Rule) String() string {
+	target := r.Target
+	if r.Goto {
+		target = "goto " + target
+	}
 	return fmt.Sprintf("in: %s%s, out: %s%s, %s%s -> %s%s -> %s: %d packets, %d bytes",
 		r.Not.InDev, r.InDev,
 		r.Not.OutDev, r.OutDev,
 		r.Not.Src, r.Src,
 		r.Not.Dest, r.Dest,
-		r.Target,
+		target,
 		r.Pcnt, r.Bcnt)
 }
 
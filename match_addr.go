@@ -0,0 +1,347 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPRange is the 'iprange' match (revision 1).
+type IPRange struct {
+	// Src and Dst are nil when not matched.
+	Src *AddrRange
+	Dst *AddrRange
+	Not struct {
+		Src Not
+		Dst Not
+	}
+}
+
+// AddrRange is an inclusive range of addresses of the same family.
+type AddrRange struct {
+	Min netip.Addr
+	Max netip.Addr
+}
+
+// String returns the range in iptables notation, "min-max".
+func (r AddrRange) String() string {
+	return r.Min.String() + "-" + r.Max.String()
+}
+
+const (
+	// the constants are copied from the flags enum in xt_iprange.h
+	IPRANGE_SRC     = 1 << 0
+	IPRANGE_DST     = 1 << 1
+	IPRANGE_SRC_INV = 1 << 4
+	IPRANGE_DST_INV = 1 << 5
+)
+
+// xt_iprange_mtinfo
+type xtIPRangeMtinfo struct {
+	SrcMin, SrcMax [16]byte
+	DstMin, DstMax [16]byte
+	Flags          uint8
+	_              [3]byte
+}
+
+// AddrTypeMask is a bitmask of address types, as classified by the routing subsystem.
+type AddrTypeMask uint16
+
+const (
+	AddrTypeUnspec AddrTypeMask = 1 << iota
+	AddrTypeUnicast
+	AddrTypeLocal
+	AddrTypeBroadcast
+	AddrTypeAnycast
+	AddrTypeMulticast
+	AddrTypeBlackhole
+	AddrTypeUnreachable
+	AddrTypeProhibit
+	AddrTypeThrow
+	AddrTypeNAT
+	AddrTypeXResolve
+)
+
+var addrTypeNames = []string{"UNSPEC", "UNICAST", "LOCAL", "BROADCAST", "ANYCAST", "MULTICAST",
+	"BLACKHOLE", "UNREACHABLE", "PROHIBIT", "THROW", "NAT", "XRESOLVE"}
+
+// String returns the comma-separated list of address types, as printed by iptables-save.
+func (t AddrTypeMask) String() string {
+	var names []string
+	for i, name := range addrTypeNames {
+		if t&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseAddrTypeMask parses a comma-separated list of address types, like "LOCAL,BROADCAST".
+func ParseAddrTypeMask(s string) (AddrTypeMask, error) {
+	var t AddrTypeMask
+next:
+	for _, name := range strings.Split(s, ",") {
+		for i, n := range addrTypeNames {
+			if strings.EqualFold(name, n) {
+				t |= 1 << uint(i)
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid address type %q", name)
+	}
+	return t, nil
+}
+
+const (
+	// the constants are copied from the flags enum in xt_addrtype.h
+	XT_ADDRTYPE_INVERT_SOURCE   = 0x0001
+	XT_ADDRTYPE_INVERT_DEST     = 0x0002
+	XT_ADDRTYPE_LIMIT_IFACE_IN  = 0x0004
+	XT_ADDRTYPE_LIMIT_IFACE_OUT = 0x0008
+)
+
+// AddrType is the 'addrtype' match (revision 1).
+type AddrType struct {
+	// Src and Dst are zero when not matched.
+	Src AddrTypeMask
+	Dst AddrTypeMask
+	// LimitIfaceIn and LimitIfaceOut restrict the lookup to the incoming/outgoing interface.
+	LimitIfaceIn  bool
+	LimitIfaceOut bool
+	Not           struct {
+		Src Not
+		Dst Not
+	}
+}
+
+// xt_addrtype_info_v1
+type xtAddrTypeInfoV1 struct {
+	Source uint16
+	Dest   uint16
+	Flags  uint32
+}
+
+func init() {
+	RegisterMatch("iprange", 1, decodeIPRange)
+	RegisterMatch("addrtype", 1, decodeAddrType)
+	registerMatchParser("iprange", map[string]optionSpec{"--src-range": {1, true}, "--dst-range": {1, true}}, parseIPRange)
+	registerMatchParser("addrtype", map[string]optionSpec{
+		"--src-type": {1, true}, "--dst-type": {1, true}, "--limit-iface-in": {0, false}, "--limit-iface-out": {0, false},
+	}, parseAddrType)
+}
+
+// Name returns "iprange".
+func (m *IPRange) Name() string {
+	return "iprange"
+}
+
+// Revision returns 1.
+func (m *IPRange) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--src-range' and '--dst-range' options in use.
+func (m *IPRange) Args() []string {
+	var args []string
+	if m.Src != nil {
+		args = appendOpt(args, m.Not.Src, "--src-range", m.Src.String())
+	}
+	if m.Dst != nil {
+		args = appendOpt(args, m.Not.Dst, "--dst-range", m.Dst.String())
+	}
+	return args
+}
+
+// Encode returns a xt_iprange_mtinfo payload.
+func (m *IPRange) Encode(family Family) ([]byte, error) {
+	var info xtIPRangeMtinfo
+	var err error
+	if m.Src != nil {
+		info.Flags |= IPRANGE_SRC
+		if info.SrcMin, err = putInetIP(family, m.Src.Min); err != nil {
+			return nil, err
+		}
+		if info.SrcMax, err = putInetIP(family, m.Src.Max); err != nil {
+			return nil, err
+		}
+		if m.Not.Src {
+			info.Flags |= IPRANGE_SRC_INV
+		}
+	}
+	if m.Dst != nil {
+		info.Flags |= IPRANGE_DST
+		if info.DstMin, err = putInetIP(family, m.Dst.Min); err != nil {
+			return nil, err
+		}
+		if info.DstMax, err = putInetIP(family, m.Dst.Max); err != nil {
+			return nil, err
+		}
+		if m.Not.Dst {
+			info.Flags |= IPRANGE_DST_INV
+		}
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeIPRange(family Family, data []byte) (Match, error) {
+	var info xtIPRangeMtinfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &IPRange{}
+	if info.Flags&IPRANGE_SRC != 0 {
+		m.Src = &AddrRange{getInetIP(family, info.SrcMin), getInetIP(family, info.SrcMax)}
+		m.Not.Src = info.Flags&IPRANGE_SRC_INV != 0
+	}
+	if info.Flags&IPRANGE_DST != 0 {
+		m.Dst = &AddrRange{getInetIP(family, info.DstMin), getInetIP(family, info.DstMax)}
+		m.Not.Dst = info.Flags&IPRANGE_DST_INV != 0
+	}
+	return m, nil
+}
+
+// Name returns "addrtype".
+func (m *AddrType) Name() string {
+	return "addrtype"
+}
+
+// Revision returns 1.
+func (m *AddrType) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--src-type', '--dst-type' and '--limit-iface-*' options in use.
+func (m *AddrType) Args() []string {
+	var args []string
+	if m.Src != 0 {
+		args = appendOpt(args, m.Not.Src, "--src-type", m.Src.String())
+	}
+	if m.Dst != 0 {
+		args = appendOpt(args, m.Not.Dst, "--dst-type", m.Dst.String())
+	}
+	if m.LimitIfaceIn {
+		args = append(args, "--limit-iface-in")
+	}
+	if m.LimitIfaceOut {
+		args = append(args, "--limit-iface-out")
+	}
+	return args
+}
+
+// Encode returns a xt_addrtype_info_v1 payload.
+func (m *AddrType) Encode(family Family) ([]byte, error) {
+	if m.LimitIfaceIn && m.LimitIfaceOut {
+		return nil, fmt.Errorf("cannot limit to both incoming and outgoing interface")
+	}
+	info := xtAddrTypeInfoV1{Source: uint16(m.Src), Dest: uint16(m.Dst)}
+	if m.Not.Src {
+		info.Flags |= XT_ADDRTYPE_INVERT_SOURCE
+	}
+	if m.Not.Dst {
+		info.Flags |= XT_ADDRTYPE_INVERT_DEST
+	}
+	if m.LimitIfaceIn {
+		info.Flags |= XT_ADDRTYPE_LIMIT_IFACE_IN
+	}
+	if m.LimitIfaceOut {
+		info.Flags |= XT_ADDRTYPE_LIMIT_IFACE_OUT
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeAddrType(family Family, data []byte) (Match, error) {
+	var info xtAddrTypeInfoV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &AddrType{
+		Src:           AddrTypeMask(info.Source),
+		Dst:           AddrTypeMask(info.Dest),
+		LimitIfaceIn:  info.Flags&XT_ADDRTYPE_LIMIT_IFACE_IN != 0,
+		LimitIfaceOut: info.Flags&XT_ADDRTYPE_LIMIT_IFACE_OUT != 0,
+	}
+	m.Not.Src = info.Flags&XT_ADDRTYPE_INVERT_SOURCE != 0
+	m.Not.Dst = info.Flags&XT_ADDRTYPE_INVERT_DEST != 0
+	return m, nil
+}
+
+// ParseAddrRange parses a range in iptables notation, "min-max" or a single address, for family.
+func ParseAddrRange(family Family, s string) (*AddrRange, error) {
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		maxStr = minStr
+	}
+	min, err1 := netip.ParseAddr(minStr)
+	max, err2 := netip.ParseAddr(maxStr)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid address range %q", s)
+	}
+	if _, err := putInetIP(family, min); err != nil {
+		return nil, err
+	}
+	if _, err := putInetIP(family, max); err != nil {
+		return nil, err
+	}
+	return &AddrRange{min, max}, nil
+}
+
+func parseIPRange(family Family, opts []parsedOption) (Match, error) {
+	m := &IPRange{}
+	for _, o := range opts {
+		r, err := ParseAddrRange(family, o.value())
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+		if o.name == "--src-range" {
+			m.Src, m.Not.Src = r, o.not
+		} else {
+			m.Dst, m.Not.Dst = r, o.not
+		}
+	}
+	if m.Src == nil && m.Dst == nil {
+		return nil, fmt.Errorf("--src-range or --dst-range is required")
+	}
+	return m, nil
+}
+
+func parseAddrType(family Family, opts []parsedOption) (Match, error) {
+	m := &AddrType{}
+	var err error
+	for _, o := range opts {
+		switch o.name {
+		case "--src-type":
+			m.Src, err = ParseAddrTypeMask(o.value())
+			m.Not.Src = o.not
+		case "--dst-type":
+			m.Dst, err = ParseAddrTypeMask(o.value())
+			m.Not.Dst = o.not
+		case "--limit-iface-in":
+			m.LimitIfaceIn = true
+		case "--limit-iface-out":
+			m.LimitIfaceOut = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,108 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestMultiport(t *testing.T) {
+	m := &Multiport{
+		Mode:  XT_MULTIPORT_DESTINATION,
+		Ports: []PortRange{{22, 22}, {80, 80}, {8000, 8080}, {443, 443}},
+		Not:   true,
+	}
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+
+	// 8 ranges take 16 slots
+	m.Ports = nil
+	for i := 0; i < 8; i++ {
+		m.Ports = append(m.Ports, PortRange{uint16(i * 10), uint16(i*10 + 1)})
+	}
+	if _, err := m.Encode(FamilyIPv4); err == nil {
+		t.Fatal("too many ports encoded")
+	}
+}
+
+func TestIPRange(t *testing.T) {
+	m := &IPRange{Src: &AddrRange{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.20")}}
+	m.Not.Src = true
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+
+	m6 := &IPRange{Dst: &AddrRange{netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::ff")}}
+	decoded = roundTripMatch(t, FamilyIPv6, m6)
+	if !reflect.DeepEqual(decoded, m6) {
+		t.Fatalf("expected %#v, got %#v", m6, decoded)
+	}
+
+	if _, err := m6.Encode(FamilyIPv4); err == nil {
+		t.Fatal("IPv6 range encoded for IPv4")
+	}
+}
+
+func TestAddrType(t *testing.T) {
+	m := &AddrType{Dst: AddrTypeLocal | AddrTypeBroadcast, LimitIfaceIn: true}
+	m.Not.Dst = true
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+	if m.Dst.String() != "LOCAL,BROADCAST" {
+		t.Fatalf("unexpected types %q", m.Dst.String())
+	}
+	types, err := ParseAddrTypeMask("local,BROADCAST")
+	if err != nil || types != m.Dst {
+		t.Fatalf("unexpected types %s, %v", types, err)
+	}
+}
+
+func TestAddrLayout(t *testing.T) {
+	// a port range takes two slots, the first one being flagged in pflags
+	data := payloadOf(t, FamilyIPv4, &Multiport{Mode: XT_MULTIPORT_DESTINATION, Ports: []PortRange{{80, 80}, {8000, 8080}}, Not: true})
+	if data[0] != uint8(XT_MULTIPORT_DESTINATION) || data[1] != 3 {
+		t.Errorf("flags %d, count %d", data[0], data[1])
+	}
+	for i, port := range []uint16{80, 8000, 8080} {
+		if p := nativeEndian.Uint16(data[2+2*i:]); p != port {
+			t.Errorf("ports[%d] %d, expected %d", i, p, port)
+		}
+	}
+	if data[32] != 0 || data[33] != 1 || data[47] != 1 {
+		t.Errorf("pflags % x, invert %d", data[32:34], data[47])
+	}
+
+	// addresses are in network order
+	r := &AddrRange{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.9")}
+	data = payloadOf(t, FamilyIPv4, &IPRange{Dst: r})
+	if max, _ := netip.AddrFromSlice(data[48:52]); max != r.Max {
+		t.Errorf("dst_max %s", max)
+	}
+	if data[64] != IPRANGE_DST {
+		t.Errorf("flags %#x", data[64])
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the constants are copied from xt_bpf.h
+	XT_BPF_MAX_NUM_INSTR = 64
+	XT_BPF_PATH_MAX      = XT_BPF_MAX_NUM_INSTR * 8
+
+	XT_BPF_MODE_BYTECODE    = 0
+	XT_BPF_MODE_FD_PINNED   = 1
+	XT_BPF_MODE_FD_ELF      = 2
+	XT_BPF_MODE_PATH_PINNED = XT_BPF_MODE_FD_PINNED
+)
+
+// BPFInstruction is a classic BPF instruction (struct sock_filter).
+type BPFInstruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// BPF is the 'bpf' match (revision 1), running either classic BPF bytecode or a pinned eBPF program;
+// it cannot be inverted.
+type BPF struct {
+	// Program is the bytecode; it must be empty when Path is used.
+	Program []BPFInstruction
+	// Path is the location of a pinned eBPF object, like "/sys/fs/bpf/filter".
+	Path string
+}
+
+// xt_bpf_info_v1; Data is the union of bpf_program and path
+type xtBpfInfoV1 struct {
+	Mode    uint16
+	NumElem uint16
+	Fd      int32
+	Data    [XT_BPF_PATH_MAX]byte
+	Filter  uint64
+}
+
+func init() {
+	RegisterMatch("bpf", 1, decodeBPF)
+	registerMatchParser("bpf", map[string]optionSpec{"--bytecode": {1, false}, "--object-pinned": {1, false}}, parseBPF)
+}
+
+// ParseBPFBytecode parses bytecode in the format used by iptables and emitted by nfbpf_compile,
+// like "4,48 0 0 9,21 0 1 6,6 0 0 1,6 0 0 0": the number of instructions followed by
+// "code jt jf k" for each of them.
+func ParseBPFBytecode(s string) ([]BPFInstruction, error) {
+	parts := strings.Split(strings.TrimSpace(s), ",")
+	count, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytecode: bad instruction count %q", parts[0])
+	}
+	if int(count) != len(parts)-1 {
+		return nil, fmt.Errorf("invalid bytecode: %d instructions declared, %d found", count, len(parts)-1)
+	}
+	program := make([]BPFInstruction, count)
+	for i, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid bytecode: bad instruction %q", part)
+		}
+		code, err1 := strconv.ParseUint(fields[0], 10, 16)
+		jt, err2 := strconv.ParseUint(fields[1], 10, 8)
+		jf, err3 := strconv.ParseUint(fields[2], 10, 8)
+		k, err4 := strconv.ParseUint(fields[3], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("invalid bytecode: bad instruction %q", part)
+		}
+		program[i] = BPFInstruction{Code: uint16(code), Jt: uint8(jt), Jf: uint8(jf), K: uint32(k)}
+	}
+	return program, nil
+}
+
+// FormatBPFBytecode is the counterpart of ParseBPFBytecode, returning bytecode as printed by iptables-save.
+func FormatBPFBytecode(program []BPFInstruction) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(len(program)))
+	for _, ins := range program {
+		fmt.Fprintf(&b, ",%d %d %d %d", ins.Code, ins.Jt, ins.Jf, ins.K)
+	}
+	return b.String()
+}
+
+// Name returns "bpf".
+func (m *BPF) Name() string {
+	return "bpf"
+}
+
+// Revision returns 1.
+func (m *BPF) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--object-pinned' option when Path is set, '--bytecode' otherwise.
+func (m *BPF) Args() []string {
+	if m.Path != "" {
+		return []string{"--object-pinned", m.Path}
+	}
+	return []string{"--bytecode", FormatBPFBytecode(m.Program)}
+}
+
+// Encode returns a xt_bpf_info_v1 payload.
+func (m *BPF) Encode(family Family) ([]byte, error) {
+	var info xtBpfInfoV1
+	switch {
+	case m.Path != "" && len(m.Program) != 0:
+		return nil, fmt.Errorf("bpf match requires either bytecode or a pinned object path, not both")
+	case m.Path != "":
+		info.Mode = XT_BPF_MODE_PATH_PINNED
+		// the kernel opens the object by path, the descriptor is only meaningful to iptables itself
+		info.Fd = -1
+		if err := putCString(info.Data[:], m.Path); err != nil {
+			return nil, err
+		}
+	case len(m.Program) == 0:
+		return nil, fmt.Errorf("bpf match requires bytecode or a pinned object path")
+	case len(m.Program) > XT_BPF_MAX_NUM_INSTR:
+		return nil, fmt.Errorf("too many bpf instructions (max %d): %d", XT_BPF_MAX_NUM_INSTR, len(m.Program))
+	default:
+		info.Mode = XT_BPF_MODE_BYTECODE
+		info.NumElem = uint16(len(m.Program))
+		for i, ins := range m.Program {
+			copy(info.Data[8*i:], encodeStruct(&ins))
+		}
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeBPF(family Family, data []byte) (Match, error) {
+	var info xtBpfInfoV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	switch info.Mode {
+	case XT_BPF_MODE_BYTECODE:
+		if info.NumElem > XT_BPF_MAX_NUM_INSTR {
+			return nil, fmt.Errorf("too many bpf instructions: %d", info.NumElem)
+		}
+		m := &BPF{Program: make([]BPFInstruction, info.NumElem)}
+		for i := range m.Program {
+			if err := decodeStruct(info.Data[8*i:8*i+8], &m.Program[i]); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case XT_BPF_MODE_PATH_PINNED:
+		return &BPF{Path: cString(info.Data[:])}, nil
+	}
+	// XT_BPF_MODE_FD_ELF refers to a file descriptor of the process that added the rule
+	return nil, fmt.Errorf("unsupported bpf mode %d", info.Mode)
+}
+
+func parseBPF(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --bytecode and --object-pinned is required")
+	}
+	o := opts[0]
+	if o.name == "--object-pinned" {
+		if len(o.value()) >= XT_BPF_PATH_MAX {
+			return nil, o.errorf("path too long")
+		}
+		return &BPF{Path: o.value()}, nil
+	}
+	program, err := ParseBPFBytecode(o.value())
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return &BPF{Program: program}, nil
+}
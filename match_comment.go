@@ -0,0 +1,79 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// XT_MAX_COMMENT_LEN is the size of a comment, including terminating NUL.
+const XT_MAX_COMMENT_LEN = 256
+
+// Comment is the 'comment' match, which attaches a free-form text to a rule and always matches.
+type Comment struct {
+	Text string
+}
+
+// xt_comment_info
+type xtCommentInfo struct {
+	Comment [XT_MAX_COMMENT_LEN]byte
+}
+
+func init() {
+	RegisterMatch("comment", 0, decodeComment)
+	registerMatchParser("comment", map[string]optionSpec{"--comment": {1, false}}, parseComment)
+}
+
+// Name returns "comment".
+func (m *Comment) Name() string {
+	return "comment"
+}
+
+// Revision returns 0.
+func (m *Comment) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--comment' option.
+func (m *Comment) Args() []string {
+	return []string{"--comment", m.Text}
+}
+
+// Encode returns a xt_comment_info payload.
+func (m *Comment) Encode(family Family) ([]byte, error) {
+	var info xtCommentInfo
+	if err := putCString(info.Comment[:], m.Text); err != nil {
+		return nil, err
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeComment(family Family, data []byte) (Match, error) {
+	var info xtCommentInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &Comment{Text: cString(info.Comment[:])}, nil
+}
+
+func parseComment(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--comment is required")
+	}
+	return &Comment{Text: opts[0].value()}, nil
+}
@@ -0,0 +1,555 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConnState is a bitmask of connection tracking states, as matched by the 'state' and 'conntrack' matches.
+// Values are the ones used by the 'conntrack' match; the 'state' match is translated on encoding.
+type ConnState uint16
+
+const (
+	ConnStateInvalid     ConnState = 1 << 0
+	ConnStateEstablished ConnState = 1 << 1
+	ConnStateRelated     ConnState = 1 << 2
+	ConnStateNew         ConnState = 1 << 3
+	ConnStateSNAT        ConnState = 1 << 6
+	ConnStateDNAT        ConnState = 1 << 7
+	ConnStateUntracked   ConnState = 1 << 8
+)
+
+var connStateNames = []struct {
+	state ConnState
+	name  string
+}{
+	// same order as iptables-save
+	{ConnStateInvalid, "INVALID"},
+	{ConnStateNew, "NEW"},
+	{ConnStateRelated, "RELATED"},
+	{ConnStateEstablished, "ESTABLISHED"},
+	{ConnStateUntracked, "UNTRACKED"},
+	{ConnStateSNAT, "SNAT"},
+	{ConnStateDNAT, "DNAT"},
+}
+
+// String returns the comma-separated list of states, as printed by iptables-save.
+func (s ConnState) String() string {
+	var names []string
+	for _, n := range connStateNames {
+		if s&n.state != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseConnState parses a comma-separated list of states, like "RELATED,ESTABLISHED".
+func ParseConnState(s string) (ConnState, error) {
+	var state ConnState
+next:
+	for _, name := range strings.Split(s, ",") {
+		for _, n := range connStateNames {
+			if strings.EqualFold(name, n.name) {
+				state |= n.state
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid connection state %q", name)
+	}
+	return state, nil
+}
+
+// ConnStatus is a bitmask of connection tracking status bits (IPS_*), as matched by the 'conntrack' match.
+type ConnStatus uint16
+
+const (
+	ConnStatusExpected  ConnStatus = 1 << 0
+	ConnStatusSeenReply ConnStatus = 1 << 1
+	ConnStatusAssured   ConnStatus = 1 << 2
+	ConnStatusConfirmed ConnStatus = 1 << 3
+)
+
+var connStatusNames = []struct {
+	status ConnStatus
+	name   string
+}{
+	{ConnStatusExpected, "EXPECTED"},
+	{ConnStatusSeenReply, "SEEN_REPLY"},
+	{ConnStatusAssured, "ASSURED"},
+	{ConnStatusConfirmed, "CONFIRMED"},
+}
+
+// String returns the comma-separated list of status bits, as printed by iptables-save.
+func (s ConnStatus) String() string {
+	if s == 0 {
+		return "NONE"
+	}
+	var names []string
+	for _, n := range connStatusNames {
+		if s&n.status != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseConnStatus parses a comma-separated list of status bits, like "ASSURED,CONFIRMED".
+func ParseConnStatus(s string) (ConnStatus, error) {
+	var status ConnStatus
+next:
+	for _, name := range strings.Split(s, ",") {
+		if strings.EqualFold(name, "NONE") {
+			continue
+		}
+		for _, n := range connStatusNames {
+			if strings.EqualFold(name, n.name) {
+				status |= n.status
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid connection status %q", name)
+	}
+	return status, nil
+}
+
+// State is the 'state' match.
+type State struct {
+	// States cannot contain ConnStateSNAT or ConnStateDNAT.
+	States ConnState
+}
+
+const (
+	// state match uses a different bit for untracked connections
+	xtStateUntracked = 1 << 6
+)
+
+// xt_state_info
+type xtStateInfo struct {
+	Statemask uint32
+}
+
+// Name returns "state".
+func (m *State) Name() string {
+	return "state"
+}
+
+// Revision returns 0.
+func (m *State) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--state' option.
+func (m *State) Args() []string {
+	return []string{"--state", m.States.String()}
+}
+
+// Encode returns a xt_state_info payload.
+func (m *State) Encode(family Family) ([]byte, error) {
+	if m.States&(ConnStateSNAT|ConnStateDNAT) != 0 {
+		return nil, fmt.Errorf("SNAT/DNAT states are only supported by conntrack match")
+	}
+	info := xtStateInfo{Statemask: uint32(m.States &^ ConnStateUntracked)}
+	if m.States&ConnStateUntracked != 0 {
+		info.Statemask |= xtStateUntracked
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeState(family Family, data []byte) (Match, error) {
+	var info xtStateInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &State{States: ConnState(info.Statemask &^ xtStateUntracked)}
+	if info.Statemask&xtStateUntracked != 0 {
+		m.States |= ConnStateUntracked
+	}
+	return m, nil
+}
+
+const (
+	// the constants are copied from the flags enum in xt_conntrack.h
+	XT_CONNTRACK_STATE        = 1 << 0
+	XT_CONNTRACK_PROTO        = 1 << 1
+	XT_CONNTRACK_ORIGSRC      = 1 << 2
+	XT_CONNTRACK_ORIGDST      = 1 << 3
+	XT_CONNTRACK_REPLSRC      = 1 << 4
+	XT_CONNTRACK_REPLDST      = 1 << 5
+	XT_CONNTRACK_STATUS       = 1 << 6
+	XT_CONNTRACK_EXPIRES      = 1 << 7
+	XT_CONNTRACK_ORIGSRC_PORT = 1 << 8
+	XT_CONNTRACK_ORIGDST_PORT = 1 << 9
+	XT_CONNTRACK_REPLSRC_PORT = 1 << 10
+	XT_CONNTRACK_REPLDST_PORT = 1 << 11
+	XT_CONNTRACK_DIRECTION    = 1 << 12
+	XT_CONNTRACK_STATE_ALIAS  = 1 << 13
+)
+
+// Conntrack is the 'conntrack' match. Only the criteria selected in Flags are matched,
+// and each of them is negated when the same bit is set in Invert.
+// Direction is matched with XT_CONNTRACK_DIRECTION: set in Invert for '--ctdir ORIGINAL', clear for '--ctdir REPLY'.
+type Conntrack struct {
+	// Rev is the revision of the payload layout, from 1 to 3; zero selects the latest one.
+	// Revision 1 cannot match ConnStateUntracked, revisions 1 and 2 cannot match port ranges.
+	Rev uint8
+
+	Flags  uint16
+	Invert uint16
+
+	State  ConnState
+	Status ConnStatus
+	// Proto is the layer 4 protocol number.
+	Proto uint16
+
+	OrigSrc Net
+	OrigDst Net
+	ReplSrc Net
+	ReplDst Net
+
+	OrigSrcPort PortRange
+	OrigDstPort PortRange
+	ReplSrcPort PortRange
+	ReplDstPort PortRange
+
+	// ExpiresMin and ExpiresMax are the bounds of the remaining lifetime, in seconds.
+	ExpiresMin uint32
+	ExpiresMax uint32
+}
+
+// common head of all xt_conntrack_mtinfo revisions
+type xtConntrackMtinfoHead struct {
+	OrigsrcAddr, OrigsrcMask [16]byte
+	OrigdstAddr, OrigdstMask [16]byte
+	ReplsrcAddr, ReplsrcMask [16]byte
+	RepldstAddr, RepldstMask [16]byte
+	ExpiresMin, ExpiresMax   uint32
+	L4proto                  uint16
+	OrigsrcPort, OrigdstPort uint16
+	ReplsrcPort, RepldstPort uint16
+	MatchFlags, InvertFlags  uint16
+}
+
+// xt_conntrack_mtinfo1
+type xtConntrackMtinfo1 struct {
+	Head                  xtConntrackMtinfoHead
+	StateMask, StatusMask uint8
+}
+
+// xt_conntrack_mtinfo2
+type xtConntrackMtinfo2 struct {
+	Head                  xtConntrackMtinfoHead
+	StateMask, StatusMask uint16
+	_                     [2]byte
+}
+
+// xt_conntrack_mtinfo3
+type xtConntrackMtinfo3 struct {
+	Head                             xtConntrackMtinfoHead
+	StateMask, StatusMask            uint16
+	OrigsrcPortHigh, OrigdstPortHigh uint16
+	ReplsrcPortHigh, RepldstPortHigh uint16
+	_                                [2]byte
+}
+
+func init() {
+	RegisterMatch("state", 0, decodeState)
+	RegisterMatch("conntrack", 1, decodeConntrack)
+	RegisterMatch("conntrack", 2, decodeConntrack)
+	RegisterMatch("conntrack", 3, decodeConntrack)
+	registerMatchParser("state", map[string]optionSpec{"--state": {1, false}}, parseState)
+	registerMatchParser("conntrack", map[string]optionSpec{
+		"--ctstate": {1, true}, "--ctproto": {1, true}, "--ctorigsrc": {1, true}, "--ctorigdst": {1, true},
+		"--ctreplsrc": {1, true}, "--ctrepldst": {1, true}, "--ctorigsrcport": {1, true}, "--ctorigdstport": {1, true},
+		"--ctreplsrcport": {1, true}, "--ctrepldstport": {1, true}, "--ctstatus": {1, true}, "--ctexpire": {1, true},
+		"--ctdir": {1, false},
+	}, parseConntrack)
+}
+
+// Name returns "conntrack".
+func (m *Conntrack) Name() string {
+	return "conntrack"
+}
+
+// Revision returns the revision of the payload layout.
+func (m *Conntrack) Revision() uint8 {
+	if m.Rev == 0 {
+		return 3
+	}
+	return m.Rev
+}
+
+// Revisions returns Rev, or revisions 3 down to 1 when Rev is zero.
+func (m *Conntrack) Revisions() []uint8 {
+	return revisionsFrom(m.Rev, 3, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (m *Conntrack) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *m
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+// Args returns the options selected in Flags, in the order used by iptables-save.
+func (m *Conntrack) Args() []string {
+	var args []string
+	opt := func(flag uint16, name string, value string) {
+		if m.Flags&flag != 0 {
+			args = appendOpt(args, m.Invert&flag != 0, name, value)
+		}
+	}
+	opt(XT_CONNTRACK_STATE, "--ctstate", m.State.String())
+	opt(XT_CONNTRACK_PROTO, "--ctproto", ProtoName(m.Proto))
+	opt(XT_CONNTRACK_ORIGSRC, "--ctorigsrc", m.OrigSrc.String())
+	opt(XT_CONNTRACK_ORIGDST, "--ctorigdst", m.OrigDst.String())
+	opt(XT_CONNTRACK_REPLSRC, "--ctreplsrc", m.ReplSrc.String())
+	opt(XT_CONNTRACK_REPLDST, "--ctrepldst", m.ReplDst.String())
+	opt(XT_CONNTRACK_ORIGSRC_PORT, "--ctorigsrcport", m.OrigSrcPort.String())
+	opt(XT_CONNTRACK_ORIGDST_PORT, "--ctorigdstport", m.OrigDstPort.String())
+	opt(XT_CONNTRACK_REPLSRC_PORT, "--ctreplsrcport", m.ReplSrcPort.String())
+	opt(XT_CONNTRACK_REPLDST_PORT, "--ctrepldstport", m.ReplDstPort.String())
+	opt(XT_CONNTRACK_STATUS, "--ctstatus", m.Status.String())
+	expires := decArg(uint64(m.ExpiresMin))
+	if m.ExpiresMax != m.ExpiresMin {
+		expires += ":" + decArg(uint64(m.ExpiresMax))
+	}
+	opt(XT_CONNTRACK_EXPIRES, "--ctexpire", expires)
+	if m.Flags&XT_CONNTRACK_DIRECTION != 0 {
+		dir := "REPLY"
+		if m.Invert&XT_CONNTRACK_DIRECTION != 0 {
+			dir = "ORIGINAL"
+		}
+		args = append(args, "--ctdir", dir)
+	}
+	return args
+}
+
+// Encode returns a xt_conntrack_mtinfo1, xt_conntrack_mtinfo2 or xt_conntrack_mtinfo3 payload, depending on revision.
+func (m *Conntrack) Encode(family Family) ([]byte, error) {
+	var head xtConntrackMtinfoHead
+	var err error
+	if head.OrigsrcAddr, head.OrigsrcMask, err = putInetAddr(family, m.OrigSrc); err != nil {
+		return nil, err
+	}
+	if head.OrigdstAddr, head.OrigdstMask, err = putInetAddr(family, m.OrigDst); err != nil {
+		return nil, err
+	}
+	if head.ReplsrcAddr, head.ReplsrcMask, err = putInetAddr(family, m.ReplSrc); err != nil {
+		return nil, err
+	}
+	if head.RepldstAddr, head.RepldstMask, err = putInetAddr(family, m.ReplDst); err != nil {
+		return nil, err
+	}
+	head.ExpiresMin = m.ExpiresMin
+	head.ExpiresMax = m.ExpiresMax
+	head.L4proto = m.Proto
+	head.MatchFlags = m.Flags
+	head.InvertFlags = m.Invert
+
+	rev := m.Revision()
+	if rev == 3 {
+		head.OrigsrcPort, head.OrigdstPort = m.OrigSrcPort.Min, m.OrigDstPort.Min
+		head.ReplsrcPort, head.RepldstPort = m.ReplSrcPort.Min, m.ReplDstPort.Min
+		return encodeStruct(&xtConntrackMtinfo3{
+			Head:            head,
+			StateMask:       uint16(m.State),
+			StatusMask:      uint16(m.Status),
+			OrigsrcPortHigh: m.OrigSrcPort.Max,
+			OrigdstPortHigh: m.OrigDstPort.Max,
+			ReplsrcPortHigh: m.ReplSrcPort.Max,
+			RepldstPortHigh: m.ReplDstPort.Max,
+		}), nil
+	}
+
+	// revisions 1 and 2 only match single ports, in network byte order
+	for _, p := range []PortRange{m.OrigSrcPort, m.OrigDstPort, m.ReplSrcPort, m.ReplDstPort} {
+		if !p.IsSingle() {
+			return nil, fmt.Errorf("port ranges require revision 3")
+		}
+	}
+	head.OrigsrcPort, head.OrigdstPort = hton16(m.OrigSrcPort.Min), hton16(m.OrigDstPort.Min)
+	head.ReplsrcPort, head.RepldstPort = hton16(m.ReplSrcPort.Min), hton16(m.ReplDstPort.Min)
+
+	switch rev {
+	case 1:
+		if m.State > 0xff || m.Status > 0xff {
+			return nil, fmt.Errorf("state %s or status %s not supported by revision 1", m.State, m.Status)
+		}
+		return encodeStruct(&xtConntrackMtinfo1{
+			Head:       head,
+			StateMask:  uint8(m.State),
+			StatusMask: uint8(m.Status),
+		}), nil
+	case 2:
+		return encodeStruct(&xtConntrackMtinfo2{
+			Head:       head,
+			StateMask:  uint16(m.State),
+			StatusMask: uint16(m.Status),
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported revision %d", rev)
+}
+
+// decodeConntrack detects the revision from the payload size, since all revisions share the same decoder.
+func decodeConntrack(family Family, data []byte) (Match, error) {
+	var head xtConntrackMtinfoHead
+	m := &Conntrack{}
+	switch xtAlign(len(data)) {
+	case xtAlign(sizeOf(xtConntrackMtinfo1{})):
+		var info xtConntrackMtinfo1
+		if err := decodeStruct(data, &info); err != nil {
+			return nil, err
+		}
+		head = info.Head
+		m.Rev, m.State, m.Status = 1, ConnState(info.StateMask), ConnStatus(info.StatusMask)
+	case xtAlign(sizeOf(xtConntrackMtinfo2{})):
+		var info xtConntrackMtinfo2
+		if err := decodeStruct(data, &info); err != nil {
+			return nil, err
+		}
+		head = info.Head
+		m.Rev, m.State, m.Status = 2, ConnState(info.StateMask), ConnStatus(info.StatusMask)
+	case xtAlign(sizeOf(xtConntrackMtinfo3{})):
+		var info xtConntrackMtinfo3
+		if err := decodeStruct(data, &info); err != nil {
+			return nil, err
+		}
+		head = info.Head
+		m.Rev, m.State, m.Status = 3, ConnState(info.StateMask), ConnStatus(info.StatusMask)
+		m.OrigSrcPort = PortRange{head.OrigsrcPort, info.OrigsrcPortHigh}
+		m.OrigDstPort = PortRange{head.OrigdstPort, info.OrigdstPortHigh}
+		m.ReplSrcPort = PortRange{head.ReplsrcPort, info.ReplsrcPortHigh}
+		m.ReplDstPort = PortRange{head.RepldstPort, info.RepldstPortHigh}
+	default:
+		return nil, fmt.Errorf("unexpected conntrack payload size %d", len(data))
+	}
+
+	if m.Rev != 3 {
+		m.OrigSrcPort = singlePort(hton16(head.OrigsrcPort))
+		m.OrigDstPort = singlePort(hton16(head.OrigdstPort))
+		m.ReplSrcPort = singlePort(hton16(head.ReplsrcPort))
+		m.ReplDstPort = singlePort(hton16(head.RepldstPort))
+	}
+	m.Flags, m.Invert = head.MatchFlags, head.InvertFlags
+	m.Proto = head.L4proto
+	m.ExpiresMin, m.ExpiresMax = head.ExpiresMin, head.ExpiresMax
+	if m.Flags&XT_CONNTRACK_ORIGSRC != 0 {
+		m.OrigSrc = getInetAddr(family, head.OrigsrcAddr, head.OrigsrcMask)
+	}
+	if m.Flags&XT_CONNTRACK_ORIGDST != 0 {
+		m.OrigDst = getInetAddr(family, head.OrigdstAddr, head.OrigdstMask)
+	}
+	if m.Flags&XT_CONNTRACK_REPLSRC != 0 {
+		m.ReplSrc = getInetAddr(family, head.ReplsrcAddr, head.ReplsrcMask)
+	}
+	if m.Flags&XT_CONNTRACK_REPLDST != 0 {
+		m.ReplDst = getInetAddr(family, head.RepldstAddr, head.RepldstMask)
+	}
+	return m, nil
+}
+
+func singlePort(port uint16) PortRange {
+	return PortRange{port, port}
+}
+
+func parseState(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--state is required")
+	}
+	states, err := ParseConnState(opts[0].value())
+	if err != nil {
+		return nil, opts[0].errorf("%v", err)
+	}
+	if states&(ConnStateSNAT|ConnStateDNAT) != 0 {
+		return nil, opts[0].errorf("SNAT/DNAT states are only supported by conntrack match")
+	}
+	return &State{States: states}, nil
+}
+
+func parseConntrack(family Family, opts []parsedOption) (Match, error) {
+	m := &Conntrack{}
+	for _, o := range opts {
+		var flag uint16
+		var err error
+		switch o.name {
+		case "--ctstate":
+			flag = XT_CONNTRACK_STATE
+			m.State, err = ParseConnState(o.value())
+		case "--ctproto":
+			flag = XT_CONNTRACK_PROTO
+			m.Proto, err = ParseProto(o.value())
+		case "--ctorigsrc":
+			flag = XT_CONNTRACK_ORIGSRC
+			m.OrigSrc, err = parseFamilyNet(family, o.value())
+		case "--ctorigdst":
+			flag = XT_CONNTRACK_ORIGDST
+			m.OrigDst, err = parseFamilyNet(family, o.value())
+		case "--ctreplsrc":
+			flag = XT_CONNTRACK_REPLSRC
+			m.ReplSrc, err = parseFamilyNet(family, o.value())
+		case "--ctrepldst":
+			flag = XT_CONNTRACK_REPLDST
+			m.ReplDst, err = parseFamilyNet(family, o.value())
+		case "--ctorigsrcport":
+			flag = XT_CONNTRACK_ORIGSRC_PORT
+			m.OrigSrcPort, err = ParsePortRange(o.value())
+		case "--ctorigdstport":
+			flag = XT_CONNTRACK_ORIGDST_PORT
+			m.OrigDstPort, err = ParsePortRange(o.value())
+		case "--ctreplsrcport":
+			flag = XT_CONNTRACK_REPLSRC_PORT
+			m.ReplSrcPort, err = ParsePortRange(o.value())
+		case "--ctrepldstport":
+			flag = XT_CONNTRACK_REPLDST_PORT
+			m.ReplDstPort, err = ParsePortRange(o.value())
+		case "--ctstatus":
+			flag = XT_CONNTRACK_STATUS
+			m.Status, err = ParseConnStatus(o.value())
+		case "--ctexpire":
+			flag = XT_CONNTRACK_EXPIRES
+			var min, max uint64
+			min, max, err = parseRange(o.value(), ":", 32)
+			m.ExpiresMin, m.ExpiresMax = uint32(min), uint32(max)
+		case "--ctdir":
+			flag = XT_CONNTRACK_DIRECTION
+			switch strings.ToUpper(o.value()) {
+			case "ORIGINAL":
+				m.Invert |= XT_CONNTRACK_DIRECTION
+			case "REPLY":
+			default:
+				err = fmt.Errorf("invalid direction %q", o.value())
+			}
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+		m.Flags |= flag
+		if o.not {
+			m.Invert |= flag
+		}
+	}
+	if m.Flags == 0 {
+		return nil, fmt.Errorf("no conntrack option specified")
+	}
+	return m, nil
+}
@@ -0,0 +1,143 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	m := &State{States: ConnStateEstablished | ConnStateRelated | ConnStateUntracked}
+	data, err := m.Encode(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UNTRACKED is bit 6 for the state match
+	if nativeEndian.Uint32(data) != 1<<1|1<<2|1<<6 {
+		t.Fatalf("unexpected statemask %#x", nativeEndian.Uint32(data))
+	}
+
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+	if m.States.String() != "RELATED,ESTABLISHED,UNTRACKED" {
+		t.Fatalf("unexpected string %q", m.States.String())
+	}
+
+	_, err = (&State{States: ConnStateSNAT}).Encode(FamilyIPv4)
+	if err == nil {
+		t.Fatal("SNAT state encoded in state match")
+	}
+}
+
+func TestParseConnState(t *testing.T) {
+	s, err := ParseConnState("NEW,established")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != ConnStateNew|ConnStateEstablished {
+		t.Fatalf("unexpected state %s", s)
+	}
+	if _, err = ParseConnState("NEW,BOGUS"); err == nil {
+		t.Fatal("invalid state parsed")
+	}
+}
+
+func TestConntrack(t *testing.T) {
+	src := NetFromPrefix(netip.MustParsePrefix("192.168.0.0/16"))
+	dst6 := NetFromPrefix(netip.MustParsePrefix("2001:db8::/32"))
+
+	for _, tc := range []struct {
+		family Family
+		m      *Conntrack
+	}{
+		{FamilyIPv4, &Conntrack{
+			Rev:         1,
+			Flags:       XT_CONNTRACK_STATE | XT_CONNTRACK_ORIGSRC | XT_CONNTRACK_ORIGDST_PORT | XT_CONNTRACK_PROTO,
+			Invert:      XT_CONNTRACK_ORIGSRC,
+			State:       ConnStateNew | ConnStateDNAT,
+			Proto:       6,
+			OrigSrc:     src,
+			OrigDstPort: PortRange{80, 80},
+		}},
+		{FamilyIPv4, &Conntrack{
+			Rev:        2,
+			Flags:      XT_CONNTRACK_STATE | XT_CONNTRACK_STATUS | XT_CONNTRACK_EXPIRES | XT_CONNTRACK_DIRECTION,
+			Invert:     XT_CONNTRACK_DIRECTION,
+			State:      ConnStateUntracked,
+			Status:     ConnStatusAssured | ConnStatusConfirmed,
+			ExpiresMin: 10,
+			ExpiresMax: 100,
+		}},
+		{FamilyIPv6, &Conntrack{
+			Rev:         3,
+			Flags:       XT_CONNTRACK_REPLDST | XT_CONNTRACK_REPLSRC_PORT,
+			ReplDst:     dst6,
+			ReplSrcPort: PortRange{1024, 65535},
+		}},
+	} {
+		decoded := roundTripMatch(t, tc.family, tc.m)
+		if !reflect.DeepEqual(decoded, tc.m) {
+			t.Errorf("revision %d: expected %#v, got %#v", tc.m.Rev, tc.m, decoded)
+		}
+	}
+
+	_, err := (&Conntrack{Rev: 1, State: ConnStateUntracked}).Encode(FamilyIPv4)
+	if err == nil {
+		t.Error("untracked state encoded in revision 1")
+	}
+	_, err = (&Conntrack{Rev: 2, OrigSrcPort: PortRange{1, 2}}).Encode(FamilyIPv4)
+	if err == nil {
+		t.Error("port range encoded in revision 2")
+	}
+	_, err = (&Conntrack{OrigSrc: src}).Encode(FamilyIPv6)
+	if err == nil {
+		t.Error("IPv4 address encoded in IPv6 match")
+	}
+}
+
+func TestConntrackLayout(t *testing.T) {
+	// revisions 1 and 2 compare ports in network order, while revision 3 has host order ranges
+	for _, rev := range []uint8{1, 2} {
+		m := &Conntrack{Rev: rev, Flags: XT_CONNTRACK_STATE | XT_CONNTRACK_ORIGDST_PORT, State: ConnStateEstablished, OrigDstPort: PortRange{80, 80}}
+		data := payloadOf(t, FamilyIPv4, m)
+		if port := data[140:142]; port[0] != 0 || port[1] != 80 {
+			t.Errorf("revision %d: origdst_port % x", rev, port)
+		}
+		if flags := nativeEndian.Uint16(data[146:]); flags != m.Flags {
+			t.Errorf("revision %d: match_flags %#x", rev, flags)
+		}
+		if data[150] != uint8(ConnStateEstablished) {
+			t.Errorf("revision %d: state_mask %#x", rev, data[150])
+		}
+	}
+
+	m := &Conntrack{Flags: XT_CONNTRACK_STATE | XT_CONNTRACK_ORIGDST_PORT, State: ConnStateEstablished, OrigDstPort: PortRange{80, 90}}
+	data := payloadOf(t, FamilyIPv4, m)
+	if port, high := nativeEndian.Uint16(data[140:]), nativeEndian.Uint16(data[156:]); port != 80 || high != 90 {
+		t.Errorf("origdst_port %d, origdst_port_high %d", port, high)
+	}
+	if state := nativeEndian.Uint16(data[150:]); state != uint16(ConnStateEstablished) {
+		t.Errorf("state_mask %#x", state)
+	}
+}
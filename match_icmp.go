@@ -0,0 +1,277 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ICMPTypeAny matches any ICMP/ICMPv6 type, as '--icmp-type any'.
+	ICMPTypeAny = 0xff
+
+	// the constants are copied from #define declarations in ip_tables.h and ip6_tables.h
+	IPT_ICMP_INV  = 0x01
+	IP6T_ICMP_INV = 0x01
+)
+
+// ICMPCodes is an inclusive range of ICMP codes.
+type ICMPCodes struct {
+	Min uint8
+	Max uint8
+}
+
+// ICMP is the 'icmp' match, valid only in IPv4 rules with protocol ICMP.
+type ICMP struct {
+	// Type is the ICMP type, or ICMPTypeAny.
+	Type uint8
+	// Codes is nil to match any code.
+	Codes *ICMPCodes
+	Not   Not
+}
+
+// ICMPv6 is the 'icmp6' match, valid only in IPv6 rules with protocol ICMPv6.
+type ICMPv6 struct {
+	// Type is the ICMPv6 type, or ICMPTypeAny.
+	Type uint8
+	// Codes is nil to match any code.
+	Codes *ICMPCodes
+	Not   Not
+}
+
+// ipt_icmp and ip6t_icmp
+type xtICMP struct {
+	Type     uint8
+	Code     [2]uint8
+	Invflags uint8
+}
+
+func init() {
+	RegisterMatch("icmp", 0, decodeICMP)
+	RegisterMatch("icmp6", 0, decodeICMPv6)
+	registerMatchParser("icmp", map[string]optionSpec{"--icmp-type": {1, true}}, parseICMP)
+	registerMatchParser("icmp6", map[string]optionSpec{"--icmpv6-type": {1, true}}, parseICMPv6)
+}
+
+func putICMP(typ uint8, codes *ICMPCodes, not Not) []byte {
+	info := xtICMP{Type: typ, Code: [2]uint8{0, 0xff}}
+	if codes != nil {
+		info.Code = [2]uint8{codes.Min, codes.Max}
+	}
+	if not {
+		// same value for IPT_ICMP_INV and IP6T_ICMP_INV
+		info.Invflags = IPT_ICMP_INV
+	}
+	return encodeStruct(&info)
+}
+
+// icmpArg returns the type and code in iptables notation; iptables cannot express ranges of codes,
+// so only the first code is printed.
+func icmpArg(typ uint8, codes *ICMPCodes) string {
+	switch {
+	case typ == ICMPTypeAny:
+		return "any"
+	case codes == nil:
+		return decArg(uint64(typ))
+	}
+	return fmt.Sprintf("%d/%d", typ, codes.Min)
+}
+
+func getICMP(data []byte) (typ uint8, codes *ICMPCodes, not Not, err error) {
+	var info xtICMP
+	if err = decodeStruct(data, &info); err != nil {
+		return
+	}
+	typ = info.Type
+	if info.Code != [2]uint8{0, 0xff} {
+		codes = &ICMPCodes{info.Code[0], info.Code[1]}
+	}
+	not = info.Invflags&IPT_ICMP_INV != 0
+	return
+}
+
+// Name returns "icmp".
+func (m *ICMP) Name() string {
+	return "icmp"
+}
+
+// Revision returns 0.
+func (m *ICMP) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--icmp-type' option.
+func (m *ICMP) Args() []string {
+	return appendOpt(nil, m.Not, "--icmp-type", icmpArg(m.Type, m.Codes))
+}
+
+// Protocol returns IPPROTO_ICMP.
+func (m *ICMP) Protocol() uint16 {
+	return IPPROTO_ICMP
+}
+
+// Encode returns a ipt_icmp payload.
+func (m *ICMP) Encode(family Family) ([]byte, error) {
+	if family != FamilyIPv4 {
+		return nil, fmt.Errorf("not supported for %s", family)
+	}
+	return putICMP(m.Type, m.Codes, m.Not), nil
+}
+
+func decodeICMP(family Family, data []byte) (Match, error) {
+	m := &ICMP{}
+	var err error
+	m.Type, m.Codes, m.Not, err = getICMP(data)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Name returns "icmp6".
+func (m *ICMPv6) Name() string {
+	return "icmp6"
+}
+
+// Revision returns 0.
+func (m *ICMPv6) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--icmpv6-type' option.
+func (m *ICMPv6) Args() []string {
+	return appendOpt(nil, m.Not, "--icmpv6-type", icmpArg(m.Type, m.Codes))
+}
+
+// Protocol returns IPPROTO_ICMPV6.
+func (m *ICMPv6) Protocol() uint16 {
+	return IPPROTO_ICMPV6
+}
+
+// Encode returns a ip6t_icmp payload.
+func (m *ICMPv6) Encode(family Family) ([]byte, error) {
+	if family != FamilyIPv6 {
+		return nil, fmt.Errorf("not supported for %s", family)
+	}
+	return putICMP(m.Type, m.Codes, m.Not), nil
+}
+
+func decodeICMPv6(family Family, data []byte) (Match, error) {
+	m := &ICMPv6{}
+	var err error
+	m.Type, m.Codes, m.Not, err = getICMP(data)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var icmpTypeNames = map[string][2]uint8{
+	"echo-reply":              {0, 0xff},
+	"destination-unreachable": {3, 0xff},
+	"network-unreachable":     {3, 0},
+	"host-unreachable":        {3, 1},
+	"protocol-unreachable":    {3, 2},
+	"port-unreachable":        {3, 3},
+	"fragmentation-needed":    {3, 4},
+	"redirect":                {5, 0xff},
+	"echo-request":            {8, 0xff},
+	"time-exceeded":           {11, 0xff},
+	"parameter-problem":       {12, 0xff},
+	"timestamp-request":       {13, 0xff},
+	"timestamp-reply":         {14, 0xff},
+}
+
+var icmpv6TypeNames = map[string][2]uint8{
+	"destination-unreachable": {1, 0xff},
+	"no-route":                {1, 0},
+	"address-unreachable":     {1, 3},
+	"port-unreachable":        {1, 4},
+	"packet-too-big":          {2, 0xff},
+	"time-exceeded":           {3, 0xff},
+	"parameter-problem":       {4, 0xff},
+	"echo-request":            {128, 0xff},
+	"echo-reply":              {129, 0xff},
+	"router-solicitation":     {133, 0xff},
+	"router-advertisement":    {134, 0xff},
+	"neighbour-solicitation":  {135, 0xff},
+	"neighbour-advertisement": {136, 0xff},
+	"redirect":                {137, 0xff},
+}
+
+// parseICMPType parses "any", a type name from names, "type" or "type/code"; a 0xff code is any code.
+func parseICMPType(s string, names map[string][2]uint8) (typ uint8, codes *ICMPCodes, err error) {
+	if s == "any" {
+		return ICMPTypeAny, nil, nil
+	}
+	if tc, ok := names[s]; ok {
+		if tc[1] != 0xff {
+			codes = &ICMPCodes{tc[1], tc[1]}
+		}
+		return tc[0], codes, nil
+	}
+	typStr, codeStr, hasCode := strings.Cut(s, "/")
+	t, err := strconv.ParseUint(typStr, 10, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid ICMP type %q", s)
+	}
+	if hasCode {
+		c, err := strconv.ParseUint(codeStr, 10, 8)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid ICMP code %q", s)
+		}
+		codes = &ICMPCodes{uint8(c), uint8(c)}
+	}
+	return uint8(t), codes, nil
+}
+
+func parseICMP(family Family, opts []parsedOption) (Match, error) {
+	if family != FamilyIPv4 {
+		return nil, fmt.Errorf("not supported for %s, use icmp6", family)
+	}
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--icmp-type is required")
+	}
+	o := opts[0]
+	m := &ICMP{Not: o.not}
+	var err error
+	if m.Type, m.Codes, err = parseICMPType(o.value(), icmpTypeNames); err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return m, nil
+}
+
+func parseICMPv6(family Family, opts []parsedOption) (Match, error) {
+	if family != FamilyIPv6 {
+		return nil, fmt.Errorf("not supported for %s, use icmp", family)
+	}
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--icmpv6-type is required")
+	}
+	o := opts[0]
+	m := &ICMPv6{Not: o.not}
+	var err error
+	if m.Type, m.Codes, err = parseICMPType(o.value(), icmpv6TypeNames); err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return m, nil
+}
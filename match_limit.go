@@ -0,0 +1,789 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is an average rate of Count events per Period; Period must be a whole number of seconds.
+type Rate struct {
+	Count  uint64
+	Period time.Duration
+}
+
+var rateUnits = []struct {
+	name   string
+	period time.Duration
+}{
+	// same order and names as iptables-save
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"min", time.Minute},
+	{"sec", time.Second},
+}
+
+// ParseRate parses a rate as accepted by iptables, like "10/second", "3/hour" or "25/m";
+// a rate without unit is per second.
+func ParseRate(s string) (Rate, error) {
+	count, unit := s, "second"
+	if i := strings.IndexByte(s, '/'); i != -1 {
+		count, unit = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseUint(count, 10, 32)
+	if err != nil || n == 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", s)
+	}
+	// any prefix of the unit name is accepted
+	for _, u := range []struct {
+		name   string
+		period time.Duration
+	}{{"second", time.Second}, {"minute", time.Minute}, {"hour", time.Hour}, {"day", 24 * time.Hour}} {
+		if unit != "" && strings.HasPrefix(u.name, strings.ToLower(unit)) {
+			return Rate{Count: n, Period: u.period}, nil
+		}
+	}
+	return Rate{}, fmt.Errorf("invalid rate unit in %q", s)
+}
+
+// String returns the rate in iptables notation, like "10/sec".
+func (r Rate) String() string {
+	for _, u := range rateUnits {
+		if r.Period == u.period {
+			return fmt.Sprintf("%d/%s", r.Count, u.name)
+		}
+	}
+	return fmt.Sprintf("%d/%s", r.Count, r.Period)
+}
+
+// Interval returns the average interval between two events.
+func (r Rate) Interval() time.Duration {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Period / time.Duration(r.Count)
+}
+
+// avg returns the average interval between two events in 1/scale seconds, as used by the kernel.
+func (r Rate) avg(scale uint64) (uint64, error) {
+	if r.Count == 0 || r.Period <= 0 || r.Period%time.Second != 0 {
+		return 0, fmt.Errorf("invalid rate %s", r)
+	}
+	avg := scale * uint64(r.Period/time.Second) / r.Count
+	if avg == 0 {
+		return 0, fmt.Errorf("rate too fast: %s", r)
+	}
+	return avg, nil
+}
+
+// rateFromAvg is the counterpart of Rate.avg; it picks the same unit that iptables-save would print.
+func rateFromAvg(avg, scale uint64) Rate {
+	if avg == 0 {
+		return Rate{}
+	}
+	i := 1
+	for ; i < len(rateUnits); i++ {
+		mult := scale * uint64(rateUnits[i].period/time.Second)
+		if avg > mult || mult/avg < mult%avg {
+			break
+		}
+	}
+	u := rateUnits[i-1]
+	return Rate{Count: scale * uint64(u.period/time.Second) / avg, Period: u.period}
+}
+
+// XT_LIMIT_SCALE is the kernel unit of the 'limit' match average, in fractions of a second.
+const XT_LIMIT_SCALE = 10000
+
+// Limit is the 'limit' match, implementing a token bucket shared by all packets.
+type Limit struct {
+	Rate Rate
+	// Burst is the bucket size; zero stands for the iptables default of 5, as the kernel rejects it.
+	Burst uint32
+}
+
+// xt_rateinfo
+type xtRateinfo struct {
+	Avg       uint32
+	Burst     uint32
+	Prev      uint64
+	Credit    uint32
+	CreditCap uint32
+	Cost      uint32
+	_         [4]byte
+	Master    uint64
+}
+
+const (
+	// the constants are copied from #define declarations in xt_hashlimit.h
+	XT_HASHLIMIT_SCALE      = 10000
+	XT_HASHLIMIT_SCALE_v2   = 1000000
+	XT_HASHLIMIT_BYTE_SHIFT = 4
+
+	// the constants are copied from the mode enum in xt_hashlimit.h
+	XT_HASHLIMIT_HASH_DIP   = 1 << 0
+	XT_HASHLIMIT_HASH_DPT   = 1 << 1
+	XT_HASHLIMIT_HASH_SIP   = 1 << 2
+	XT_HASHLIMIT_HASH_SPT   = 1 << 3
+	XT_HASHLIMIT_INVERT     = 1 << 4
+	XT_HASHLIMIT_BYTES      = 1 << 5
+	XT_HASHLIMIT_RATE_MATCH = 1 << 6
+
+	// NAME_MAX is the size of a hashlimit table name for revisions 2 and 3, including terminating NUL.
+	NAME_MAX = 255
+)
+
+// HashLimit is the 'hashlimit' match, implementing a token bucket per group of packets.
+type HashLimit struct {
+	// Rev is the revision of the payload layout, from 1 to 3; zero selects the latest one.
+	Rev uint8
+	// Table is the name of the hash table, visible in /proc/net/ipt_hashlimit.
+	Table string
+	// Mode is a combination of XT_HASHLIMIT_* flags: the hashed fields, XT_HASHLIMIT_INVERT for
+	// '--hashlimit-above', XT_HASHLIMIT_BYTES for byte-based rates and XT_HASHLIMIT_RATE_MATCH (revision 3).
+	Mode uint32
+	// Rate is in packets, or in bytes per second when Mode has XT_HASHLIMIT_BYTES.
+	Rate Rate
+	// Burst is the bucket size; zero stands for the iptables default of 5, as the match never applies otherwise.
+	Burst uint64
+	// Size and Max are the number of buckets and entries of the hash table; zero for kernel defaults.
+	Size uint32
+	Max  uint32
+	// GCInterval and Expire have millisecond granularity; when zero iptables defaults are used (1s and 10s).
+	GCInterval time.Duration
+	Expire     time.Duration
+	// Interval is the rate-match interval (revision 3), with second granularity.
+	Interval time.Duration
+	// SrcMask and DstMask are the prefix lengths applied to addresses before hashing.
+	SrcMask uint8
+	DstMask uint8
+}
+
+// hashlimit_cfg1
+type hashlimitCfg1 struct {
+	Mode, Avg, Burst   uint32
+	Size, Max          uint32
+	GcInterval, Expire uint32
+	Srcmask, Dstmask   uint8
+	_                  [2]byte
+}
+
+// xt_hashlimit_mtinfo1
+type xtHashlimitMtinfo1 struct {
+	Name  [IFNAMSIZ]byte
+	Cfg   hashlimitCfg1
+	Hinfo uint64
+}
+
+// hashlimit_cfg2 and hashlimit_cfg3, the latter adding Interval
+type hashlimitCfg23 struct {
+	Avg, Burst         uint64
+	Mode               uint32
+	Size, Max          uint32
+	GcInterval, Expire uint32
+}
+
+// xt_hashlimit_mtinfo2
+type xtHashlimitMtinfo2 struct {
+	Name             [NAME_MAX]byte
+	_                [1]byte
+	Cfg              hashlimitCfg23
+	Srcmask, Dstmask uint8
+	_                [2]byte
+	Hinfo            uint64
+}
+
+// xt_hashlimit_mtinfo3
+type xtHashlimitMtinfo3 struct {
+	Name             [NAME_MAX]byte
+	_                [1]byte
+	Cfg              hashlimitCfg23
+	Interval         uint32
+	Srcmask, Dstmask uint8
+	_                [6]byte
+	Hinfo            uint64
+}
+
+// ConnLimit is the 'connlimit' match (revision 1), matching on the number of connections per group of addresses.
+type ConnLimit struct {
+	// Limit is the number of connections above which the match applies.
+	Limit uint32
+	// MaskLen is the prefix length used to group addresses; iptables uses 32 for IPv4 and 128 for IPv6 by default.
+	MaskLen uint8
+	// DstAddr groups connections by destination instead of source address.
+	DstAddr bool
+	// Not is set for '--connlimit-upto'.
+	Not Not
+}
+
+const (
+	// the constants are copied from the flags enum in xt_connlimit.h
+	XT_CONNLIMIT_INVERT = 1 << 0
+	XT_CONNLIMIT_DADDR  = 1 << 1
+)
+
+// xt_connlimit_info
+type xtConnlimitInfo struct {
+	Mask  [16]byte
+	Limit uint32
+	Flags uint32
+	Data  uint64
+}
+
+func init() {
+	RegisterMatch("limit", 0, decodeLimit)
+	RegisterMatch("hashlimit", 1, decodeHashLimit1)
+	RegisterMatch("hashlimit", 2, decodeHashLimit2)
+	RegisterMatch("hashlimit", 3, decodeHashLimit3)
+	RegisterMatch("connlimit", 1, decodeConnLimit)
+	registerMatchParser("limit", map[string]optionSpec{"--limit": {1, false}, "--limit-burst": {1, false}}, parseLimit)
+	registerMatchParser("hashlimit", map[string]optionSpec{
+		"--hashlimit-upto": {1, false}, "--hashlimit-above": {1, false}, "--hashlimit": {1, false},
+		"--hashlimit-burst": {1, false}, "--hashlimit-mode": {1, false}, "--hashlimit-name": {1, false},
+		"--hashlimit-htable-size": {1, false}, "--hashlimit-htable-max": {1, false},
+		"--hashlimit-htable-gcinterval": {1, false}, "--hashlimit-htable-expire": {1, false},
+		"--hashlimit-srcmask": {1, false}, "--hashlimit-dstmask": {1, false},
+		"--hashlimit-rate-match": {0, false}, "--hashlimit-rate-interval": {1, false},
+	}, parseHashLimit)
+	registerMatchParser("connlimit", map[string]optionSpec{
+		"--connlimit-upto": {1, false}, "--connlimit-above": {1, false}, "--connlimit-mask": {1, false},
+		"--connlimit-saddr": {0, false}, "--connlimit-daddr": {0, false},
+	}, parseConnLimit)
+}
+
+// Name returns "limit".
+func (m *Limit) Name() string {
+	return "limit"
+}
+
+// Revision returns 0.
+func (m *Limit) Revision() uint8 {
+	return 0
+}
+
+// burst returns Burst, or the default of 5 when it is zero.
+func (m *Limit) burst() uint32 {
+	if m.Burst == 0 {
+		return 5
+	}
+	return m.Burst
+}
+
+// Args returns the '--limit' and '--limit-burst' options; the latter is omitted for the default burst of 5.
+func (m *Limit) Args() []string {
+	args := []string{"--limit", m.Rate.String()}
+	if burst := m.burst(); burst != 5 {
+		args = append(args, "--limit-burst", decArg(uint64(burst)))
+	}
+	return args
+}
+
+// Encode returns a xt_rateinfo payload.
+func (m *Limit) Encode(family Family) ([]byte, error) {
+	avg, err := m.Rate.avg(XT_LIMIT_SCALE)
+	if err != nil {
+		return nil, err
+	}
+	if avg > math.MaxUint32 {
+		return nil, fmt.Errorf("rate too slow: %s", m.Rate)
+	}
+	return encodeStruct(&xtRateinfo{Avg: uint32(avg), Burst: m.burst()}), nil
+}
+
+func decodeLimit(family Family, data []byte) (Match, error) {
+	var info xtRateinfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &Limit{Rate: rateFromAvg(uint64(info.Avg), XT_LIMIT_SCALE), Burst: info.Burst}, nil
+}
+
+// Name returns "hashlimit".
+func (m *HashLimit) Name() string {
+	return "hashlimit"
+}
+
+// Revision returns the revision of the payload layout.
+func (m *HashLimit) Revision() uint8 {
+	if m.Rev == 0 {
+		return 3
+	}
+	return m.Rev
+}
+
+// Revisions returns Rev, or revisions 3 down to 1 when Rev is zero.
+func (m *HashLimit) Revisions() []uint8 {
+	return revisionsFrom(m.Rev, 3, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (m *HashLimit) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *m
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+var hashLimitModeNames = []struct {
+	mode uint32
+	name string
+}{
+	// same order as iptables-save
+	{XT_HASHLIMIT_HASH_SIP, "srcip"},
+	{XT_HASHLIMIT_HASH_SPT, "srcport"},
+	{XT_HASHLIMIT_HASH_DIP, "dstip"},
+	{XT_HASHLIMIT_HASH_DPT, "dstport"},
+}
+
+// burst returns Burst, or the default of 5 when it is zero.
+func (m *HashLimit) burst() uint64 {
+	if m.Burst == 0 {
+		return 5
+	}
+	return m.Burst
+}
+
+// Args returns the '--hashlimit-*' options; the burst is omitted when 5, other options when zero.
+func (m *HashLimit) Args() []string {
+	var args []string
+	if m.Mode&XT_HASHLIMIT_INVERT != 0 {
+		args = append(args, "--hashlimit-above")
+	} else {
+		args = append(args, "--hashlimit-upto")
+	}
+	if m.Mode&XT_HASHLIMIT_BYTES != 0 {
+		args = append(args, decArg(m.Rate.Count)+"b/s")
+	} else {
+		args = append(args, m.Rate.String())
+	}
+	if burst := m.burst(); burst != 5 {
+		args = append(args, "--hashlimit-burst", decArg(burst))
+	}
+	var modes []string
+	for _, n := range hashLimitModeNames {
+		if m.Mode&n.mode != 0 {
+			modes = append(modes, n.name)
+		}
+	}
+	if len(modes) > 0 {
+		args = append(args, "--hashlimit-mode", strings.Join(modes, ","))
+	}
+	if m.Size != 0 {
+		args = append(args, "--hashlimit-htable-size", decArg(uint64(m.Size)))
+	}
+	if m.Max != 0 {
+		args = append(args, "--hashlimit-htable-max", decArg(uint64(m.Max)))
+	}
+	if m.GCInterval != 0 {
+		args = append(args, "--hashlimit-htable-gcinterval", decArg(uint64(m.GCInterval/time.Millisecond)))
+	}
+	if m.Expire != 0 {
+		args = append(args, "--hashlimit-htable-expire", decArg(uint64(m.Expire/time.Millisecond)))
+	}
+	if m.SrcMask != 0 {
+		args = append(args, "--hashlimit-srcmask", decArg(uint64(m.SrcMask)))
+	}
+	if m.DstMask != 0 {
+		args = append(args, "--hashlimit-dstmask", decArg(uint64(m.DstMask)))
+	}
+	args = append(args, "--hashlimit-name", m.Table)
+	if m.Mode&XT_HASHLIMIT_RATE_MATCH != 0 {
+		args = append(args, "--hashlimit-rate-match")
+	}
+	if m.Interval != 0 {
+		args = append(args, "--hashlimit-rate-interval", decArg(uint64(m.Interval/time.Second)))
+	}
+	return args
+}
+
+// bytesToCost converts a byte rate to the cost used by the kernel, as iptables does.
+func bytesToCost(bytes uint64) uint64 {
+	r := bytes >> XT_HASHLIMIT_BYTE_SHIFT
+	return math.MaxUint32 / (r + 1)
+}
+
+// costToBytes is the counterpart of bytesToCost.
+func costToBytes(cost uint64) uint64 {
+	r := uint64(math.MaxUint32)
+	if cost != 0 {
+		r = math.MaxUint32 / cost
+	}
+	return (r - 1) << XT_HASHLIMIT_BYTE_SHIFT
+}
+
+// Encode returns a xt_hashlimit_mtinfo1, xt_hashlimit_mtinfo2 or xt_hashlimit_mtinfo3 payload, depending on revision.
+func (m *HashLimit) Encode(family Family) ([]byte, error) {
+	rev := m.Revision()
+	scale := uint64(XT_HASHLIMIT_SCALE_v2)
+	if rev == 1 {
+		scale = XT_HASHLIMIT_SCALE
+	}
+
+	var avg uint64
+	var err error
+	if m.Mode&XT_HASHLIMIT_BYTES != 0 {
+		if m.Rate.Period != time.Second || m.Rate.Count == 0 {
+			return nil, fmt.Errorf("byte rates must be per second")
+		}
+		avg = bytesToCost(m.Rate.Count)
+	} else if avg, err = m.Rate.avg(scale); err != nil {
+		return nil, err
+	}
+	if m.Mode&XT_HASHLIMIT_RATE_MATCH != 0 && rev < 3 {
+		return nil, fmt.Errorf("rate match requires revision 3")
+	}
+
+	gcInterval, expire := m.GCInterval, m.Expire
+	if gcInterval == 0 {
+		gcInterval = time.Second
+	}
+	if expire == 0 {
+		expire = 10 * time.Second
+	}
+	cfg := hashlimitCfg23{
+		Avg:        avg,
+		Burst:      m.burst(),
+		Mode:       m.Mode,
+		Size:       m.Size,
+		Max:        m.Max,
+		GcInterval: uint32(gcInterval / time.Millisecond),
+		Expire:     uint32(expire / time.Millisecond),
+	}
+
+	switch rev {
+	case 1:
+		if avg > math.MaxUint32 || cfg.Burst > math.MaxUint32 {
+			return nil, fmt.Errorf("rate or burst out of range for revision 1")
+		}
+		info := xtHashlimitMtinfo1{Cfg: hashlimitCfg1{
+			Mode:       cfg.Mode,
+			Avg:        uint32(cfg.Avg),
+			Burst:      uint32(cfg.Burst),
+			Size:       cfg.Size,
+			Max:        cfg.Max,
+			GcInterval: cfg.GcInterval,
+			Expire:     cfg.Expire,
+			Srcmask:    m.SrcMask,
+			Dstmask:    m.DstMask,
+		}}
+		if err := putCString(info.Name[:], m.Table); err != nil {
+			return nil, err
+		}
+		return encodeStruct(&info), nil
+	case 2:
+		info := xtHashlimitMtinfo2{Cfg: cfg, Srcmask: m.SrcMask, Dstmask: m.DstMask}
+		if err := putCString(info.Name[:], m.Table); err != nil {
+			return nil, err
+		}
+		return encodeStruct(&info), nil
+	case 3:
+		info := xtHashlimitMtinfo3{
+			Cfg:      cfg,
+			Interval: uint32(m.Interval / time.Second),
+			Srcmask:  m.SrcMask,
+			Dstmask:  m.DstMask,
+		}
+		if err := putCString(info.Name[:], m.Table); err != nil {
+			return nil, err
+		}
+		return encodeStruct(&info), nil
+	}
+	return nil, fmt.Errorf("unsupported revision %d", rev)
+}
+
+// setCfg fills the fields shared by all revisions.
+func (m *HashLimit) setCfg(cfg hashlimitCfg23, scale uint64) {
+	m.Mode = cfg.Mode
+	if m.Mode&XT_HASHLIMIT_BYTES != 0 {
+		m.Rate = Rate{Count: costToBytes(cfg.Avg), Period: time.Second}
+	} else {
+		m.Rate = rateFromAvg(cfg.Avg, scale)
+	}
+	m.Burst = cfg.Burst
+	m.Size = cfg.Size
+	m.Max = cfg.Max
+	m.GCInterval = time.Duration(cfg.GcInterval) * time.Millisecond
+	m.Expire = time.Duration(cfg.Expire) * time.Millisecond
+}
+
+func decodeHashLimit1(family Family, data []byte) (Match, error) {
+	var info xtHashlimitMtinfo1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &HashLimit{Rev: 1, Table: cString(info.Name[:]), SrcMask: info.Cfg.Srcmask, DstMask: info.Cfg.Dstmask}
+	m.setCfg(hashlimitCfg23{
+		Avg:        uint64(info.Cfg.Avg),
+		Burst:      uint64(info.Cfg.Burst),
+		Mode:       info.Cfg.Mode,
+		Size:       info.Cfg.Size,
+		Max:        info.Cfg.Max,
+		GcInterval: info.Cfg.GcInterval,
+		Expire:     info.Cfg.Expire,
+	}, XT_HASHLIMIT_SCALE)
+	return m, nil
+}
+
+func decodeHashLimit2(family Family, data []byte) (Match, error) {
+	var info xtHashlimitMtinfo2
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &HashLimit{Rev: 2, Table: cString(info.Name[:]), SrcMask: info.Srcmask, DstMask: info.Dstmask}
+	m.setCfg(info.Cfg, XT_HASHLIMIT_SCALE_v2)
+	return m, nil
+}
+
+func decodeHashLimit3(family Family, data []byte) (Match, error) {
+	var info xtHashlimitMtinfo3
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &HashLimit{
+		Rev:      3,
+		Table:    cString(info.Name[:]),
+		Interval: time.Duration(info.Interval) * time.Second,
+		SrcMask:  info.Srcmask,
+		DstMask:  info.Dstmask,
+	}
+	m.setCfg(info.Cfg, XT_HASHLIMIT_SCALE_v2)
+	return m, nil
+}
+
+// Name returns "connlimit".
+func (m *ConnLimit) Name() string {
+	return "connlimit"
+}
+
+// Revision returns 1.
+func (m *ConnLimit) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--connlimit-*' options.
+func (m *ConnLimit) Args() []string {
+	limit := "--connlimit-above"
+	if m.Not {
+		limit = "--connlimit-upto"
+	}
+	addr := "--connlimit-saddr"
+	if m.DstAddr {
+		addr = "--connlimit-daddr"
+	}
+	return []string{limit, decArg(uint64(m.Limit)), "--connlimit-mask", decArg(uint64(m.MaskLen)), addr}
+}
+
+// Encode returns a xt_connlimit_info payload.
+func (m *ConnLimit) Encode(family Family) ([]byte, error) {
+	bits := 8 * net.IPv6len
+	if family == FamilyIPv4 {
+		bits = 8 * net.IPv4len
+	}
+	if int(m.MaskLen) > bits {
+		return nil, fmt.Errorf("invalid mask length %d", m.MaskLen)
+	}
+	info := xtConnlimitInfo{Limit: m.Limit}
+	copy(info.Mask[:], net.CIDRMask(int(m.MaskLen), bits))
+	if m.Not {
+		info.Flags |= XT_CONNLIMIT_INVERT
+	}
+	if m.DstAddr {
+		info.Flags |= XT_CONNLIMIT_DADDR
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeConnLimit(family Family, data []byte) (Match, error) {
+	var info xtConnlimitInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	n := net.IPv6len
+	if family == FamilyIPv4 {
+		n = net.IPv4len
+	}
+	ones, bits := net.IPMask(info.Mask[:n]).Size()
+	if bits == 0 {
+		return nil, fmt.Errorf("non-contiguous mask %x", info.Mask[:n])
+	}
+	return &ConnLimit{
+		Limit:   info.Limit,
+		MaskLen: uint8(ones),
+		DstAddr: info.Flags&XT_CONNLIMIT_DADDR != 0,
+		Not:     info.Flags&XT_CONNLIMIT_INVERT != 0,
+	}, nil
+}
+
+func parseLimit(family Family, opts []parsedOption) (Match, error) {
+	m := &Limit{Rate: Rate{3, time.Hour}, Burst: 5}
+	for _, o := range opts {
+		var err error
+		if o.name == "--limit" {
+			m.Rate, err = ParseRate(o.value())
+		} else {
+			var burst uint64
+			burst, err = parseUint(o.value(), 32)
+			m.Burst = uint32(burst)
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return m, nil
+}
+
+// parseByteRate parses a byte rate as accepted by '--hashlimit-upto', like "512kb/s"; ok is false for packet rates.
+func parseByteRate(s string) (bytes uint64, ok bool, err error) {
+	if !strings.HasSuffix(s, "b/s") {
+		return 0, false, nil
+	}
+	n := strings.TrimSuffix(s, "b/s")
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(n, "k"):
+		mult, n = 1<<10, strings.TrimSuffix(n, "k")
+	case strings.HasSuffix(n, "m"):
+		mult, n = 1<<20, strings.TrimSuffix(n, "m")
+	}
+	bytes, err = strconv.ParseUint(n, 10, 64)
+	if err != nil || bytes == 0 {
+		return 0, true, fmt.Errorf("invalid rate %q", s)
+	}
+	return bytes * mult, true, nil
+}
+
+func parseHashLimit(family Family, opts []parsedOption) (Match, error) {
+	bits := uint8(128)
+	if family == FamilyIPv4 {
+		bits = 32
+	}
+	m := &HashLimit{Burst: 5, SrcMask: bits, DstMask: bits}
+	hasRate := false
+	for _, o := range opts {
+		var v uint64
+		var err error
+		switch o.name {
+		case "--hashlimit-upto", "--hashlimit-above", "--hashlimit":
+			if hasRate {
+				return nil, o.errorf("rate specified more than once")
+			}
+			hasRate = true
+			if o.name == "--hashlimit-above" {
+				m.Mode |= XT_HASHLIMIT_INVERT
+			}
+			var isBytes bool
+			if v, isBytes, err = parseByteRate(o.value()); isBytes {
+				m.Mode |= XT_HASHLIMIT_BYTES
+				m.Rate = Rate{Count: v, Period: time.Second}
+			} else {
+				m.Rate, err = ParseRate(o.value())
+			}
+		case "--hashlimit-burst":
+			m.Burst, err = parseUint(o.value(), 64)
+		case "--hashlimit-mode":
+		next:
+			for _, name := range strings.Split(o.value(), ",") {
+				for _, n := range hashLimitModeNames {
+					if name == n.name {
+						m.Mode |= n.mode
+						continue next
+					}
+				}
+				err = fmt.Errorf("invalid mode %q", name)
+			}
+		case "--hashlimit-name":
+			m.Table = o.value()
+		case "--hashlimit-htable-size":
+			v, err = parseUint(o.value(), 32)
+			m.Size = uint32(v)
+		case "--hashlimit-htable-max":
+			v, err = parseUint(o.value(), 32)
+			m.Max = uint32(v)
+		case "--hashlimit-htable-gcinterval":
+			v, err = parseUint(o.value(), 32)
+			m.GCInterval = time.Duration(v) * time.Millisecond
+		case "--hashlimit-htable-expire":
+			v, err = parseUint(o.value(), 32)
+			m.Expire = time.Duration(v) * time.Millisecond
+		case "--hashlimit-srcmask", "--hashlimit-dstmask":
+			if v, err = parseUint(o.value(), 8); err == nil && v > uint64(bits) {
+				err = fmt.Errorf("invalid mask length %d", v)
+			}
+			if o.name == "--hashlimit-srcmask" {
+				m.SrcMask = uint8(v)
+			} else {
+				m.DstMask = uint8(v)
+			}
+		case "--hashlimit-rate-match":
+			m.Mode |= XT_HASHLIMIT_RATE_MATCH
+		case "--hashlimit-rate-interval":
+			v, err = parseUint(o.value(), 32)
+			m.Interval = time.Duration(v) * time.Second
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if !hasRate || m.Table == "" {
+		return nil, fmt.Errorf("--hashlimit-upto or --hashlimit-above and --hashlimit-name are required")
+	}
+	return m, nil
+}
+
+func parseConnLimit(family Family, opts []parsedOption) (Match, error) {
+	m := &ConnLimit{MaskLen: 128}
+	if family == FamilyIPv4 {
+		m.MaskLen = 32
+	}
+	hasLimit := false
+	for _, o := range opts {
+		var err error
+		switch o.name {
+		case "--connlimit-upto", "--connlimit-above":
+			if hasLimit {
+				return nil, o.errorf("limit specified more than once")
+			}
+			hasLimit = true
+			var v uint64
+			v, err = parseUint(o.value(), 32)
+			m.Limit = uint32(v)
+			m.Not = o.name == "--connlimit-upto"
+		case "--connlimit-mask":
+			var v uint64
+			v, err = parseUint(o.value(), 8)
+			m.MaskLen = uint8(v)
+		case "--connlimit-saddr":
+			m.DstAddr = false
+		case "--connlimit-daddr":
+			m.DstAddr = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if !hasLimit {
+		return nil, fmt.Errorf("--connlimit-upto or --connlimit-above is required")
+	}
+	return m, nil
+}
@@ -0,0 +1,205 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	for s, expected := range map[string]Rate{
+		"10/second": {10, time.Second},
+		"3/hour":    {3, time.Hour},
+		"25/m":      {25, time.Minute},
+		"1/d":       {1, 24 * time.Hour},
+		"7":         {7, time.Second},
+	} {
+		r, err := ParseRate(s)
+		if err != nil || r != expected {
+			t.Errorf("%q: unexpected rate %v, %v", s, r, err)
+		}
+	}
+	for _, s := range []string{"", "0/sec", "10/fortnight", "x/s"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+
+	// same unit choice as iptables-save
+	for avg, expected := range map[uint64]string{
+		1000:     "10/sec",
+		12000000: "3/hour",
+		20000:    "30/min",
+	} {
+		if s := rateFromAvg(avg, XT_LIMIT_SCALE).String(); s != expected {
+			t.Errorf("avg %d: got %q, expected %q", avg, s, expected)
+		}
+	}
+
+	if i := (Rate{4, time.Second}).Interval(); i != 250*time.Millisecond {
+		t.Errorf("unexpected interval %s", i)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	match := &Limit{Rate: Rate{10, time.Second}, Burst: 5}
+	decoded := roundTripMatch(t, FamilyIPv4, match)
+	if !reflect.DeepEqual(decoded, match) {
+		t.Fatalf("expected %#v, got %#v", match, decoded)
+	}
+
+	// the kernel rejects a burst of zero
+	match.Burst = 0
+	decoded = roundTripMatch(t, FamilyIPv4, match)
+	if burst := decoded.(*Limit).Burst; burst != 5 {
+		t.Errorf("burst %d, expected 5", burst)
+	}
+	if args := strings.Join(match.Args(), " "); args != "--limit 10/sec" {
+		t.Errorf("unexpected args %q", args)
+	}
+
+	match.Rate = Rate{100000, time.Second}
+	if _, err := match.Encode(FamilyIPv4); err == nil {
+		t.Fatal("too fast rate encoded")
+	}
+}
+
+func TestHashLimit(t *testing.T) {
+	for _, rev := range []uint8{1, 2, 3} {
+		match := &HashLimit{
+			Rev:        rev,
+			Table:      "ssh",
+			Mode:       XT_HASHLIMIT_HASH_SIP | XT_HASHLIMIT_INVERT,
+			Rate:       Rate{3, time.Minute},
+			Burst:      5,
+			GCInterval: time.Second,
+			Expire:     time.Minute,
+			SrcMask:    24,
+			DstMask:    32,
+		}
+		decoded := roundTripMatch(t, FamilyIPv4, match)
+		if !reflect.DeepEqual(decoded, match) {
+			t.Errorf("revision %d: expected %#v, got %#v", rev, match, decoded)
+		}
+	}
+
+	match := &HashLimit{
+		Table:      "rate",
+		Mode:       XT_HASHLIMIT_HASH_DIP | XT_HASHLIMIT_RATE_MATCH,
+		Rate:       Rate{10, time.Second},
+		Burst:      5,
+		GCInterval: time.Second,
+		Expire:     10 * time.Second,
+		Interval:   5 * time.Second,
+		DstMask:    128,
+	}
+	decoded := roundTripMatch(t, FamilyIPv6, match)
+	match.Rev = 3
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+
+	match.Rev = 2
+	if _, err := match.Encode(FamilyIPv6); err == nil {
+		t.Error("rate match encoded with revision 2")
+	}
+
+	// the match never applies with a burst of zero
+	match = &HashLimit{Table: "zero", Rate: Rate{10, time.Second}}
+	decoded = roundTripMatch(t, FamilyIPv4, match)
+	if burst := decoded.(*HashLimit).Burst; burst != 5 {
+		t.Errorf("burst %d, expected 5", burst)
+	}
+	if args := strings.Join(match.Args(), " "); strings.Contains(args, "--hashlimit-burst") {
+		t.Errorf("unexpected args %q", args)
+	}
+
+	// byte costs are lossy, but stable once converted
+	match = &HashLimit{Rev: 3, Table: "bytes", Mode: XT_HASHLIMIT_BYTES, Rate: Rate{1024, time.Second}}
+	decoded = roundTripMatch(t, FamilyIPv4, match)
+	if again := roundTripMatch(t, FamilyIPv4, decoded); !reflect.DeepEqual(again, decoded) {
+		t.Errorf("expected %#v, got %#v", decoded, again)
+	}
+}
+
+func TestConnLimit(t *testing.T) {
+	for _, family := range []Family{FamilyIPv4, FamilyIPv6} {
+		match := &ConnLimit{Limit: 16, MaskLen: 24, DstAddr: true, Not: true}
+		decoded := roundTripMatch(t, family, match)
+		if !reflect.DeepEqual(decoded, match) {
+			t.Errorf("%s: expected %#v, got %#v", family, match, decoded)
+		}
+	}
+
+	match := &ConnLimit{Limit: 1, MaskLen: 64}
+	if _, err := match.Encode(FamilyIPv4); err == nil {
+		t.Fatal("invalid mask length encoded")
+	}
+}
+
+func TestLimitLayout(t *testing.T) {
+	data := payloadOf(t, FamilyIPv4, &Limit{Rate: Rate{1, time.Second}, Burst: 7})
+	if avg, burst := nativeEndian.Uint32(data[0:]), nativeEndian.Uint32(data[4:]); avg != XT_LIMIT_SCALE || burst != 7 {
+		t.Errorf("avg %d, burst %d", avg, burst)
+	}
+
+	// the configuration follows the name, and grows with 64-bit rates from revision 2
+	for _, tc := range []struct {
+		rev                    uint8
+		burst, interval, masks int
+	}{
+		{1, 24, -1, 44},
+		{3, 264, 292, 296},
+	} {
+		m := &HashLimit{Rev: tc.rev, Table: "ssh", Rate: Rate{1, time.Second}, Burst: 7, SrcMask: 24, DstMask: 32}
+		if tc.rev == 3 {
+			m.Interval = 2 * time.Second
+		}
+		data := payloadOf(t, FamilyIPv4, m)
+		if string(data[:3]) != "ssh" {
+			t.Errorf("revision %d: name %q", tc.rev, data[:3])
+		}
+		burst := uint64(nativeEndian.Uint32(data[tc.burst:]))
+		if tc.rev != 1 {
+			burst = nativeEndian.Uint64(data[tc.burst:])
+		}
+		if burst != 7 {
+			t.Errorf("revision %d: burst %d", tc.rev, burst)
+		}
+		if tc.interval >= 0 && nativeEndian.Uint32(data[tc.interval:]) != 2 {
+			t.Errorf("revision %d: interval %d", tc.rev, nativeEndian.Uint32(data[tc.interval:]))
+		}
+		if data[tc.masks] != 24 || data[tc.masks+1] != 32 {
+			t.Errorf("revision %d: srcmask %d, dstmask %d", tc.rev, data[tc.masks], data[tc.masks+1])
+		}
+	}
+
+	// the mask is in network order
+	data = payloadOf(t, FamilyIPv4, &ConnLimit{Limit: 16, MaskLen: 24, DstAddr: true})
+	if string(data[:4]) != "\xff\xff\xff\x00" {
+		t.Errorf("v4_mask % x", data[:4])
+	}
+	if limit, flags := nativeEndian.Uint32(data[16:]), nativeEndian.Uint32(data[20:]); limit != 16 || flags != XT_CONNLIMIT_DADDR {
+		t.Errorf("limit %d, flags %#x", limit, flags)
+	}
+}
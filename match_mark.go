@@ -0,0 +1,156 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// Mark is the 'mark' match (revision 1): it matches packets whose fwmark, masked with Mask, equals Mark.
+type Mark struct {
+	Mark uint32
+	Mask uint32
+	Not  Not
+}
+
+// ConnMark is the 'connmark' match (revision 1): it matches packets whose connection mark,
+// masked with Mask, equals Mark.
+type ConnMark struct {
+	Mark uint32
+	Mask uint32
+	Not  Not
+}
+
+// xt_mark_mtinfo1 and xt_connmark_mtinfo1
+type xtMarkMtinfo1 struct {
+	Mark   uint32
+	Mask   uint32
+	Invert uint8
+	_      [3]byte
+}
+
+func init() {
+	RegisterMatch("mark", 1, decodeMark)
+	RegisterMatch("connmark", 1, decodeConnMark)
+	registerMatchParser("mark", map[string]optionSpec{"--mark": {1, true}}, func(family Family, opts []parsedOption) (Match, error) {
+		m := &Mark{}
+		return m, parseMarkOption(opts, &m.Mark, &m.Mask, &m.Not)
+	})
+	registerMatchParser("connmark", map[string]optionSpec{"--mark": {1, true}}, func(family Family, opts []parsedOption) (Match, error) {
+		m := &ConnMark{}
+		return m, parseMarkOption(opts, &m.Mark, &m.Mask, &m.Not)
+	})
+}
+
+func putMark(mark, mask uint32, not Not) []byte {
+	info := xtMarkMtinfo1{Mark: mark, Mask: mask}
+	if not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info)
+}
+
+// markArg returns a mark in iptables notation, "0xmark/0xmask" or "0xmark" for a full mask.
+func markArg(mark, mask uint32) string {
+	if mask == 0xffffffff {
+		return hexArg(mark)
+	}
+	return hexArg(mark) + "/" + hexArg(mask)
+}
+
+func getMark(data []byte) (mark, mask uint32, not Not, err error) {
+	var info xtMarkMtinfo1
+	if err = decodeStruct(data, &info); err != nil {
+		return
+	}
+	return info.Mark, info.Mask, info.Invert != 0, nil
+}
+
+// Name returns "mark".
+func (m *Mark) Name() string {
+	return "mark"
+}
+
+// Revision returns 1.
+func (m *Mark) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--mark' option.
+func (m *Mark) Args() []string {
+	return appendOpt(nil, m.Not, "--mark", markArg(m.Mark, m.Mask))
+}
+
+// Encode returns a xt_mark_mtinfo1 payload.
+func (m *Mark) Encode(family Family) ([]byte, error) {
+	return putMark(m.Mark, m.Mask, m.Not), nil
+}
+
+func decodeMark(family Family, data []byte) (Match, error) {
+	m := &Mark{}
+	var err error
+	m.Mark, m.Mask, m.Not, err = getMark(data)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Name returns "connmark".
+func (m *ConnMark) Name() string {
+	return "connmark"
+}
+
+// Revision returns 1.
+func (m *ConnMark) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--mark' option.
+func (m *ConnMark) Args() []string {
+	return appendOpt(nil, m.Not, "--mark", markArg(m.Mark, m.Mask))
+}
+
+// Encode returns a xt_connmark_mtinfo1 payload.
+func (m *ConnMark) Encode(family Family) ([]byte, error) {
+	return putMark(m.Mark, m.Mask, m.Not), nil
+}
+
+func decodeConnMark(family Family, data []byte) (Match, error) {
+	m := &ConnMark{}
+	var err error
+	m.Mark, m.Mask, m.Not, err = getMark(data)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseMarkOption parses the '--mark value[/mask]' option shared by the mark and connmark matches.
+func parseMarkOption(opts []parsedOption, mark, mask *uint32, not *Not) error {
+	if len(opts) == 0 {
+		return fmt.Errorf("--mark is required")
+	}
+	o := opts[0]
+	value, m, err := parseValueMask(o.value(), 32)
+	if err != nil {
+		return o.errorf("%v", err)
+	}
+	*mark, *mask, *not = uint32(value), uint32(m), o.not
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MultiportMode selects which ports are compared by the 'multiport' match.
+type MultiportMode uint8
+
+const (
+	// the constants are copied from enum xt_multiport_flags in xt_multiport.h
+	XT_MULTIPORT_SOURCE MultiportMode = iota
+	XT_MULTIPORT_DESTINATION
+	XT_MULTIPORT_EITHER
+
+	// XT_MULTI_PORTS is the maximum number of ports; a range takes two.
+	XT_MULTI_PORTS = 15
+)
+
+// String returns the option name used by iptables for the mode.
+func (m MultiportMode) String() string {
+	switch m {
+	case XT_MULTIPORT_SOURCE:
+		return "sports"
+	case XT_MULTIPORT_DESTINATION:
+		return "dports"
+	case XT_MULTIPORT_EITHER:
+		return "ports"
+	}
+	return fmt.Sprintf("mode(%d)", uint8(m))
+}
+
+// Multiport is the 'multiport' match (revision 1); it is valid only in rules for protocols with ports.
+type Multiport struct {
+	Mode MultiportMode
+	// Ports are single ports or ranges; each range counts as two ports.
+	Ports []PortRange
+	Not   Not
+}
+
+// xt_multiport_v1
+type xtMultiportV1 struct {
+	Flags  uint8
+	Count  uint8
+	Ports  [XT_MULTI_PORTS]uint16
+	Pflags [XT_MULTI_PORTS]uint8
+	Invert uint8
+}
+
+func init() {
+	RegisterMatch("multiport", 1, decodeMultiport)
+	registerMatchParser("multiport", map[string]optionSpec{
+		"--sports": {1, true}, "--source-ports": {1, true}, "--dports": {1, true}, "--destination-ports": {1, true},
+		"--ports": {1, true},
+	}, parseMultiport)
+}
+
+// Name returns "multiport".
+func (m *Multiport) Name() string {
+	return "multiport"
+}
+
+// Revision returns 1.
+func (m *Multiport) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--sports', '--dports' or '--ports' option.
+func (m *Multiport) Args() []string {
+	ports := make([]string, len(m.Ports))
+	for i, p := range m.Ports {
+		ports[i] = p.String()
+	}
+	return appendOpt(nil, m.Not, "--"+m.Mode.String(), strings.Join(ports, ","))
+}
+
+// Encode returns a xt_multiport_v1 payload.
+func (m *Multiport) Encode(family Family) ([]byte, error) {
+	if m.Mode > XT_MULTIPORT_EITHER {
+		return nil, fmt.Errorf("invalid mode %d", m.Mode)
+	}
+	info := xtMultiportV1{Flags: uint8(m.Mode)}
+	for _, p := range m.Ports {
+		n := 1
+		if !p.IsSingle() {
+			n = 2
+		}
+		if int(info.Count)+n > XT_MULTI_PORTS {
+			return nil, fmt.Errorf("too many ports (max %d, ranges count twice)", XT_MULTI_PORTS)
+		}
+		info.Ports[info.Count] = p.Min
+		if n == 2 {
+			info.Pflags[info.Count] = 1
+			info.Ports[info.Count+1] = p.Max
+		}
+		info.Count += uint8(n)
+	}
+	if info.Count == 0 {
+		return nil, fmt.Errorf("no ports specified")
+	}
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeMultiport(family Family, data []byte) (Match, error) {
+	var info xtMultiportV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Count > XT_MULTI_PORTS {
+		return nil, fmt.Errorf("invalid ports count %d", info.Count)
+	}
+	m := &Multiport{Mode: MultiportMode(info.Flags), Not: info.Invert != 0}
+	for i := 0; i < int(info.Count); i++ {
+		p := PortRange{info.Ports[i], info.Ports[i]}
+		if info.Pflags[i] != 0 && i+1 < int(info.Count) {
+			i++
+			p.Max = info.Ports[i]
+		}
+		m.Ports = append(m.Ports, p)
+	}
+	return m, nil
+}
+
+func parseMultiport(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --sports, --dports and --ports is required")
+	}
+	o := opts[0]
+	m := &Multiport{Not: o.not}
+	switch o.name {
+	case "--sports", "--source-ports":
+		m.Mode = XT_MULTIPORT_SOURCE
+	case "--dports", "--destination-ports":
+		m.Mode = XT_MULTIPORT_DESTINATION
+	default:
+		m.Mode = XT_MULTIPORT_EITHER
+	}
+	for _, s := range strings.Split(o.value(), ",") {
+		p, err := ParsePortRange(s)
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+		m.Ports = append(m.Ports, p)
+	}
+	return m, nil
+}
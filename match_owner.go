@@ -0,0 +1,258 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the constants are copied from the anonymous enum in xt_owner.h
+	XT_OWNER_UID          = 1 << 0
+	XT_OWNER_GID          = 1 << 1
+	XT_OWNER_SOCKET       = 1 << 2
+	XT_OWNER_SUPPL_GROUPS = 1 << 3
+)
+
+// IDRange is an inclusive range of user or group IDs.
+type IDRange struct {
+	Min uint32
+	Max uint32
+}
+
+// String returns the range in iptables notation, "min" or "min-max".
+func (r IDRange) String() string {
+	if r.Min == r.Max {
+		return strconv.FormatUint(uint64(r.Min), 10)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// parseIDRange parses an ID, a range of IDs or a name resolved with lookup.
+func parseIDRange(s string, lookup func(string) (string, error)) (IDRange, error) {
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		min, err1 := strconv.ParseUint(s[:i], 10, 32)
+		max, err2 := strconv.ParseUint(s[i+1:], 10, 32)
+		if err1 == nil && err2 == nil && min <= max {
+			return IDRange{uint32(min), uint32(max)}, nil
+		}
+	}
+	if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return IDRange{uint32(id), uint32(id)}, nil
+	}
+	idStr, err := lookup(s)
+	if err != nil {
+		return IDRange{}, err
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return IDRange{}, err
+	}
+	return IDRange{uint32(id), uint32(id)}, nil
+}
+
+// ParseUIDRange parses a user name, a numeric UID or a range of UIDs like "1000-1999".
+func ParseUIDRange(s string) (IDRange, error) {
+	return parseIDRange(s, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+}
+
+// ParseGIDRange parses a group name, a numeric GID or a range of GIDs like "100-199".
+func ParseGIDRange(s string) (IDRange, error) {
+	return parseIDRange(s, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+}
+
+// UserName returns the name of the user with the specified UID, or the UID itself when unknown.
+func UserName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// GroupName returns the name of the group with the specified GID, or the GID itself when unknown.
+func GroupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// Owner is the 'owner' match (revision 1), matching the socket owner of locally generated packets.
+type Owner struct {
+	// UID and GID are nil when not matched.
+	UID *IDRange
+	GID *IDRange
+	// SocketExists matches packets associated to a socket.
+	SocketExists bool
+	// SupplGroups extends GID to the supplementary groups of the owner.
+	SupplGroups bool
+	Not         struct {
+		UID          Not
+		GID          Not
+		SocketExists Not
+	}
+}
+
+// xt_owner_match_info
+type xtOwnerMatchInfo struct {
+	UIDMin, UIDMax uint32
+	GIDMin, GIDMax uint32
+	Match, Invert  uint8
+	_              [2]byte
+}
+
+func init() {
+	RegisterMatch("owner", 1, decodeOwner)
+	registerMatchParser("owner", map[string]optionSpec{
+		"--uid-owner": {1, true}, "--gid-owner": {1, true}, "--socket-exists": {0, true}, "--suppl-groups": {0, false},
+	}, parseOwner)
+}
+
+// Name returns "owner".
+func (m *Owner) Name() string {
+	return "owner"
+}
+
+// Revision returns 1.
+func (m *Owner) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--socket-exists', '--uid-owner', '--gid-owner' and '--suppl-groups' options in use,
+// with numeric IDs as printed by iptables-save.
+func (m *Owner) Args() []string {
+	var args []string
+	if m.SocketExists {
+		args = appendOpt(args, m.Not.SocketExists, "--socket-exists")
+	}
+	if m.UID != nil {
+		args = appendOpt(args, m.Not.UID, "--uid-owner", m.UID.String())
+	}
+	if m.GID != nil {
+		args = appendOpt(args, m.Not.GID, "--gid-owner", m.GID.String())
+	}
+	if m.SupplGroups {
+		args = append(args, "--suppl-groups")
+	}
+	return args
+}
+
+// Encode returns a xt_owner_match_info payload.
+func (m *Owner) Encode(family Family) ([]byte, error) {
+	if m.SupplGroups && m.GID == nil {
+		return nil, fmt.Errorf("supplementary groups require a GID")
+	}
+	var info xtOwnerMatchInfo
+	if m.UID != nil {
+		if m.UID.Min > m.UID.Max {
+			return nil, fmt.Errorf("invalid UID range %s", m.UID)
+		}
+		info.UIDMin, info.UIDMax = m.UID.Min, m.UID.Max
+		info.Match |= XT_OWNER_UID
+		if m.Not.UID {
+			info.Invert |= XT_OWNER_UID
+		}
+	}
+	if m.GID != nil {
+		if m.GID.Min > m.GID.Max {
+			return nil, fmt.Errorf("invalid GID range %s", m.GID)
+		}
+		info.GIDMin, info.GIDMax = m.GID.Min, m.GID.Max
+		info.Match |= XT_OWNER_GID
+		if m.Not.GID {
+			info.Invert |= XT_OWNER_GID
+		}
+	}
+	if m.SocketExists {
+		info.Match |= XT_OWNER_SOCKET
+		if m.Not.SocketExists {
+			info.Invert |= XT_OWNER_SOCKET
+		}
+	}
+	if m.SupplGroups {
+		info.Match |= XT_OWNER_SUPPL_GROUPS
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeOwner(family Family, data []byte) (Match, error) {
+	var info xtOwnerMatchInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &Owner{
+		SocketExists: info.Match&XT_OWNER_SOCKET != 0,
+		SupplGroups:  info.Match&XT_OWNER_SUPPL_GROUPS != 0,
+	}
+	if info.Match&XT_OWNER_UID != 0 {
+		m.UID = &IDRange{info.UIDMin, info.UIDMax}
+	}
+	if info.Match&XT_OWNER_GID != 0 {
+		m.GID = &IDRange{info.GIDMin, info.GIDMax}
+	}
+	m.Not.UID = info.Invert&XT_OWNER_UID != 0
+	m.Not.GID = info.Invert&XT_OWNER_GID != 0
+	m.Not.SocketExists = info.Invert&XT_OWNER_SOCKET != 0
+	return m, nil
+}
+
+func parseOwner(family Family, opts []parsedOption) (Match, error) {
+	m := &Owner{}
+	for _, o := range opts {
+		var r IDRange
+		var err error
+		switch o.name {
+		case "--uid-owner":
+			r, err = ParseUIDRange(o.value())
+			m.UID, m.Not.UID = &r, o.not
+		case "--gid-owner":
+			r, err = ParseGIDRange(o.value())
+			m.GID, m.Not.GID = &r, o.not
+		case "--socket-exists":
+			m.SocketExists, m.Not.SocketExists = true, o.not
+		case "--suppl-groups":
+			m.SupplGroups = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if m.SupplGroups && m.GID == nil {
+		return nil, fmt.Errorf("--suppl-groups requires --gid-owner")
+	}
+	return m, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestOwnerMatch(t *testing.T) {
+	match := &Owner{UID: &IDRange{1000, 1999}, GID: &IDRange{100, 100}, SupplGroups: true, SocketExists: true}
+	match.Not.UID = true
+	match.Not.SocketExists = true
+	decoded := roundTripMatch(t, FamilyIPv4, match)
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+
+	if _, err := (&Owner{SupplGroups: true}).Encode(FamilyIPv4); err == nil {
+		t.Error("supplementary groups without GID encoded")
+	}
+
+	for s, expected := range map[string]IDRange{"0": {0, 0}, "root": {0, 0}, "1000-1999": {1000, 1999}} {
+		r, err := ParseUIDRange(s)
+		if err != nil || r != expected {
+			t.Errorf("%q: unexpected range %v, %v", s, r, err)
+		}
+	}
+	if _, err := ParseUIDRange("no-such-user-here"); err == nil {
+		t.Error("unknown user parsed")
+	}
+	if name := UserName(0); name != "root" {
+		t.Errorf("unexpected name %q for UID 0", name)
+	}
+}
+
+func TestPacketMatches(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	physdev := &Physdev{In: "vnet+", IsBridged: true}
+	physdev.Not.IsBridged = true
+	for _, match := range []Match{
+		&MAC{Src: mac, Not: true},
+		physdev,
+		&PktType{Type: PACKET_BROADCAST, Not: true},
+		&Length{Min: 0, Max: 64},
+	} {
+		for _, family := range []Family{FamilyIPv4, FamilyIPv6} {
+			decoded := roundTripMatch(t, family, match)
+			if !reflect.DeepEqual(decoded, match) {
+				t.Errorf("%s: expected %#v, got %#v", family, match, decoded)
+			}
+		}
+	}
+
+	for _, match := range []Match{&MAC{}, &Physdev{}, &Length{Min: 10, Max: 1}} {
+		if _, err := match.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", match)
+		}
+	}
+
+	for s, expected := range map[string]PacketType{"unicast": PACKET_HOST, "host": PACKET_HOST, "multicast": PACKET_MULTICAST} {
+		pt, err := ParsePacketType(s)
+		if err != nil || pt != expected {
+			t.Errorf("%q: unexpected packet type %s, %v", s, pt, err)
+		}
+	}
+}
+
+func TestOwnerLayout(t *testing.T) {
+	m := &Owner{GID: &IDRange{100, 200}}
+	m.Not.GID = true
+	data := payloadOf(t, FamilyIPv4, m)
+	if min, max := nativeEndian.Uint32(data[8:]), nativeEndian.Uint32(data[12:]); min != 100 || max != 200 {
+		t.Errorf("gid %d-%d", min, max)
+	}
+	if data[16] != XT_OWNER_GID || data[17] != XT_OWNER_GID {
+		t.Errorf("match %#x, invert %#x", data[16], data[17])
+	}
+
+	p := &Physdev{Out: "eth0"}
+	p.Not.Out = true
+	data = payloadOf(t, FamilyIPv4, p)
+	if string(data[32:37]) != "eth0\x00" || data[48] != 0xff {
+		t.Errorf("physoutdev %q, out_mask % x", data[32:37], data[48:53])
+	}
+	if data[64] != XT_PHYSDEV_OP_OUT || data[65] != XT_PHYSDEV_OP_OUT {
+		t.Errorf("invert %#x, bitmask %#x", data[64], data[65])
+	}
+}
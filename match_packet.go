@@ -0,0 +1,413 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ETH_ALEN is the length of an Ethernet address.
+const ETH_ALEN = 6
+
+// MAC is the 'mac' match, matching the source Ethernet address.
+type MAC struct {
+	Src net.HardwareAddr
+	Not Not
+}
+
+// xt_mac_info
+type xtMacInfo struct {
+	Srcaddr [ETH_ALEN]byte
+	_       [2]byte
+	Invert  int32
+}
+
+const (
+	// the constants are copied from #define declarations in xt_physdev.h
+	XT_PHYSDEV_OP_IN      = 0x01
+	XT_PHYSDEV_OP_OUT     = 0x02
+	XT_PHYSDEV_OP_BRIDGED = 0x04
+	XT_PHYSDEV_OP_ISIN    = 0x08
+	XT_PHYSDEV_OP_ISOUT   = 0x10
+	XT_PHYSDEV_OP_MASK    = 0x1f
+)
+
+// Physdev is the 'physdev' match, matching the bridge ports of bridged packets.
+type Physdev struct {
+	// In and Out are bridge port patterns; empty when not matched.
+	In  Interface
+	Out Interface
+	// IsIn, IsOut and IsBridged are set when the respective option is used, possibly negated.
+	IsIn      bool
+	IsOut     bool
+	IsBridged bool
+	Not       struct {
+		In        Not
+		Out       Not
+		IsIn      Not
+		IsOut     Not
+		IsBridged Not
+	}
+}
+
+// xt_physdev_info
+type xtPhysdevInfo struct {
+	Physindev  [IFNAMSIZ]byte
+	InMask     [IFNAMSIZ]byte
+	Physoutdev [IFNAMSIZ]byte
+	OutMask    [IFNAMSIZ]byte
+	Invert     uint8
+	Bitmask    uint8
+}
+
+// PacketType is the link layer packet type.
+type PacketType int32
+
+const (
+	// the constants are copied from #define declarations in if_packet.h
+	PACKET_HOST      PacketType = 0
+	PACKET_BROADCAST PacketType = 1
+	PACKET_MULTICAST PacketType = 2
+	PACKET_OTHERHOST PacketType = 3
+)
+
+var packetTypeNames = map[PacketType]string{
+	PACKET_HOST:      "unicast",
+	PACKET_BROADCAST: "broadcast",
+	PACKET_MULTICAST: "multicast",
+	PACKET_OTHERHOST: "otherhost",
+}
+
+// String returns the packet type as printed by iptables-save.
+func (t PacketType) String() string {
+	if name, ok := packetTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", int32(t))
+}
+
+// ParsePacketType parses a packet type as accepted by iptables, like "broadcast"; "host" is an alias of "unicast".
+func ParsePacketType(s string) (PacketType, error) {
+	if s == "host" {
+		return PACKET_HOST, nil
+	}
+	for t, name := range packetTypeNames {
+		if s == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid packet type %q", s)
+}
+
+// PktType is the 'pkttype' match.
+type PktType struct {
+	Type PacketType
+	Not  Not
+}
+
+// xt_pkttype_info
+type xtPkttypeInfo struct {
+	Pkttype int32
+	Invert  int32
+}
+
+// Length is the 'length' match, matching the length of the layer-3 packet.
+type Length struct {
+	Min uint16
+	Max uint16
+	Not Not
+}
+
+// xt_length_info
+type xtLengthInfo struct {
+	Min, Max uint16
+	Invert   uint8
+	_        [1]byte
+}
+
+func init() {
+	RegisterMatch("mac", 0, decodeMAC)
+	RegisterMatch("physdev", 0, decodePhysdev)
+	RegisterMatch("pkttype", 0, decodePktType)
+	RegisterMatch("length", 0, decodeLength)
+	registerMatchParser("mac", map[string]optionSpec{"--mac-source": {1, true}}, parseMAC)
+	registerMatchParser("physdev", map[string]optionSpec{
+		"--physdev-in": {1, true}, "--physdev-out": {1, true}, "--physdev-is-in": {0, true},
+		"--physdev-is-out": {0, true}, "--physdev-is-bridged": {0, true},
+	}, parsePhysdev)
+	registerMatchParser("pkttype", map[string]optionSpec{"--pkt-type": {1, true}}, parsePktType)
+	registerMatchParser("length", map[string]optionSpec{"--length": {1, true}}, parseLength)
+}
+
+// Name returns "mac".
+func (m *MAC) Name() string {
+	return "mac"
+}
+
+// Revision returns 0.
+func (m *MAC) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--mac-source' option.
+func (m *MAC) Args() []string {
+	return appendOpt(nil, m.Not, "--mac-source", strings.ToUpper(m.Src.String()))
+}
+
+// Encode returns a xt_mac_info payload.
+func (m *MAC) Encode(family Family) ([]byte, error) {
+	if len(m.Src) != ETH_ALEN {
+		return nil, fmt.Errorf("invalid MAC address %q", m.Src)
+	}
+	var info xtMacInfo
+	copy(info.Srcaddr[:], m.Src)
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeMAC(family Family, data []byte) (Match, error) {
+	var info xtMacInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &MAC{Src: net.HardwareAddr(append([]byte(nil), info.Srcaddr[:]...)), Not: info.Invert != 0}, nil
+}
+
+// Name returns "physdev".
+func (m *Physdev) Name() string {
+	return "physdev"
+}
+
+// Revision returns 0.
+func (m *Physdev) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--physdev-*' options in use.
+func (m *Physdev) Args() []string {
+	var args []string
+	if m.In != "" {
+		args = appendOpt(args, m.Not.In, "--physdev-in", string(m.In))
+	}
+	if m.Out != "" {
+		args = appendOpt(args, m.Not.Out, "--physdev-out", string(m.Out))
+	}
+	if m.IsIn {
+		args = appendOpt(args, m.Not.IsIn, "--physdev-is-in")
+	}
+	if m.IsOut {
+		args = appendOpt(args, m.Not.IsOut, "--physdev-is-out")
+	}
+	if m.IsBridged {
+		args = appendOpt(args, m.Not.IsBridged, "--physdev-is-bridged")
+	}
+	return args
+}
+
+// Encode returns a xt_physdev_info payload.
+func (m *Physdev) Encode(family Family) ([]byte, error) {
+	var info xtPhysdevInfo
+	var err error
+	set := func(op uint8, used bool, not Not) {
+		if used {
+			info.Bitmask |= op
+			if not {
+				info.Invert |= op
+			}
+		}
+	}
+	if info.Physindev, info.InMask, err = m.In.Entry(); err != nil {
+		return nil, err
+	}
+	if info.Physoutdev, info.OutMask, err = m.Out.Entry(); err != nil {
+		return nil, err
+	}
+	set(XT_PHYSDEV_OP_IN, m.In != "", m.Not.In)
+	set(XT_PHYSDEV_OP_OUT, m.Out != "", m.Not.Out)
+	set(XT_PHYSDEV_OP_ISIN, m.IsIn, m.Not.IsIn)
+	set(XT_PHYSDEV_OP_ISOUT, m.IsOut, m.Not.IsOut)
+	set(XT_PHYSDEV_OP_BRIDGED, m.IsBridged, m.Not.IsBridged)
+	if info.Bitmask == 0 {
+		return nil, fmt.Errorf("physdev match requires at least one option")
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodePhysdev(family Family, data []byte) (Match, error) {
+	var info xtPhysdevInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &Physdev{
+		IsIn:      info.Bitmask&XT_PHYSDEV_OP_ISIN != 0,
+		IsOut:     info.Bitmask&XT_PHYSDEV_OP_ISOUT != 0,
+		IsBridged: info.Bitmask&XT_PHYSDEV_OP_BRIDGED != 0,
+	}
+	if info.Bitmask&XT_PHYSDEV_OP_IN != 0 {
+		m.In = InterfaceFromEntry(info.Physindev, info.InMask)
+	}
+	if info.Bitmask&XT_PHYSDEV_OP_OUT != 0 {
+		m.Out = InterfaceFromEntry(info.Physoutdev, info.OutMask)
+	}
+	m.Not.In = info.Invert&XT_PHYSDEV_OP_IN != 0
+	m.Not.Out = info.Invert&XT_PHYSDEV_OP_OUT != 0
+	m.Not.IsIn = info.Invert&XT_PHYSDEV_OP_ISIN != 0
+	m.Not.IsOut = info.Invert&XT_PHYSDEV_OP_ISOUT != 0
+	m.Not.IsBridged = info.Invert&XT_PHYSDEV_OP_BRIDGED != 0
+	return m, nil
+}
+
+// Name returns "pkttype".
+func (m *PktType) Name() string {
+	return "pkttype"
+}
+
+// Revision returns 0.
+func (m *PktType) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--pkt-type' option.
+func (m *PktType) Args() []string {
+	return appendOpt(nil, m.Not, "--pkt-type", m.Type.String())
+}
+
+// Encode returns a xt_pkttype_info payload.
+func (m *PktType) Encode(family Family) ([]byte, error) {
+	info := xtPkttypeInfo{Pkttype: int32(m.Type)}
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodePktType(family Family, data []byte) (Match, error) {
+	var info xtPkttypeInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &PktType{Type: PacketType(info.Pkttype), Not: info.Invert != 0}, nil
+}
+
+// Name returns "length".
+func (m *Length) Name() string {
+	return "length"
+}
+
+// Revision returns 0.
+func (m *Length) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--length' option.
+func (m *Length) Args() []string {
+	length := decArg(uint64(m.Min))
+	if m.Max != m.Min {
+		length += ":" + decArg(uint64(m.Max))
+	}
+	return appendOpt(nil, m.Not, "--length", length)
+}
+
+// Encode returns a xt_length_info payload.
+func (m *Length) Encode(family Family) ([]byte, error) {
+	if m.Min > m.Max {
+		return nil, fmt.Errorf("invalid length range %d:%d", m.Min, m.Max)
+	}
+	info := xtLengthInfo{Min: m.Min, Max: m.Max}
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeLength(family Family, data []byte) (Match, error) {
+	var info xtLengthInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &Length{Min: info.Min, Max: info.Max, Not: info.Invert != 0}, nil
+}
+
+func parseMAC(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--mac-source is required")
+	}
+	o := opts[0]
+	mac, err := net.ParseMAC(o.value())
+	if err != nil || len(mac) != ETH_ALEN {
+		return nil, o.errorf("invalid Ethernet address %q", o.value())
+	}
+	return &MAC{Src: mac, Not: o.not}, nil
+}
+
+func parsePhysdev(family Family, opts []parsedOption) (Match, error) {
+	m := &Physdev{}
+	for _, o := range opts {
+		switch o.name {
+		case "--physdev-in", "--physdev-out":
+			if _, _, err := Interface(o.value()).Entry(); err != nil {
+				return nil, o.errorf("%v", err)
+			}
+			if o.name == "--physdev-in" {
+				m.In, m.Not.In = Interface(o.value()), o.not
+			} else {
+				m.Out, m.Not.Out = Interface(o.value()), o.not
+			}
+		case "--physdev-is-in":
+			m.IsIn, m.Not.IsIn = true, o.not
+		case "--physdev-is-out":
+			m.IsOut, m.Not.IsOut = true, o.not
+		case "--physdev-is-bridged":
+			m.IsBridged, m.Not.IsBridged = true, o.not
+		}
+	}
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("no physdev option specified")
+	}
+	return m, nil
+}
+
+func parsePktType(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--pkt-type is required")
+	}
+	o := opts[0]
+	t, err := ParsePacketType(o.value())
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return &PktType{Type: t, Not: o.not}, nil
+}
+
+func parseLength(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--length is required")
+	}
+	o := opts[0]
+	min, max, err := parseRange(o.value(), ":", 16)
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return &Length{Min: uint16(min), Max: uint16(max), Not: o.not}, nil
+}
@@ -0,0 +1,255 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+const (
+	// the constants are copied from the anonymous enum in xt_recent.h
+	XT_RECENT_CHECK    = 1 << 0
+	XT_RECENT_SET      = 1 << 1
+	XT_RECENT_UPDATE   = 1 << 2
+	XT_RECENT_REMOVE   = 1 << 3
+	XT_RECENT_TTL      = 1 << 4
+	XT_RECENT_REAP     = 1 << 5
+	XT_RECENT_SOURCE   = 0
+	XT_RECENT_DEST     = 1
+	XT_RECENT_NAME_LEN = 200
+)
+
+// RecentDefaultList is the list used by iptables when none is specified.
+const RecentDefaultList = "DEFAULT"
+
+// Recent is the 'recent' match (revision 1), tracking addresses in a named list.
+type Recent struct {
+	// List is the name of the list; RecentDefaultList is used when empty.
+	List string
+	// Command is one of XT_RECENT_CHECK, XT_RECENT_SET, XT_RECENT_UPDATE or XT_RECENT_REMOVE.
+	Command uint8
+	// Seconds and HitCount restrict checks and updates; zero when not used.
+	Seconds  uint32
+	HitCount uint32
+	// TTL and Reap are only valid with XT_RECENT_CHECK and XT_RECENT_UPDATE; Reap requires Seconds.
+	TTL  bool
+	Reap bool
+	// Dest tracks destination instead of source addresses.
+	Dest bool
+	// Mask is applied to addresses before tracking them; the zero Addr for a full mask.
+	Mask netip.Addr
+	Not  Not
+}
+
+// xt_recent_mtinfo_v1
+type xtRecentMtinfoV1 struct {
+	Seconds  uint32
+	HitCount uint32
+	CheckSet uint8
+	Invert   uint8
+	ListName [XT_RECENT_NAME_LEN]byte
+	Side     uint8
+	_        [1]byte
+	Mask     [16]byte
+}
+
+func init() {
+	RegisterMatch("recent", 1, decodeRecent)
+	registerMatchParser("recent", map[string]optionSpec{
+		"--set": {0, true}, "--rcheck": {0, true}, "--update": {0, true}, "--remove": {0, true},
+		"--seconds": {1, false}, "--reap": {0, false}, "--hitcount": {1, false}, "--rttl": {0, false},
+		"--name": {1, false}, "--mask": {1, false}, "--rsource": {0, false}, "--rdest": {0, false},
+	}, parseRecent)
+}
+
+// Name returns "recent".
+func (m *Recent) Name() string {
+	return "recent"
+}
+
+// Revision returns 1.
+func (m *Recent) Revision() uint8 {
+	return 1
+}
+
+var recentCommandNames = map[uint8]string{
+	XT_RECENT_CHECK:  "--rcheck",
+	XT_RECENT_SET:    "--set",
+	XT_RECENT_UPDATE: "--update",
+	XT_RECENT_REMOVE: "--remove",
+}
+
+// Args returns the command followed by the other options in use; '--mask' is omitted for a full mask.
+func (m *Recent) Args() []string {
+	args := appendOpt(nil, m.Not, recentCommandNames[m.Command])
+	if m.Seconds != 0 {
+		args = append(args, "--seconds", decArg(uint64(m.Seconds)))
+	}
+	if m.Reap {
+		args = append(args, "--reap")
+	}
+	if m.HitCount != 0 {
+		args = append(args, "--hitcount", decArg(uint64(m.HitCount)))
+	}
+	if m.TTL {
+		args = append(args, "--rttl")
+	}
+	if m.List != "" {
+		args = append(args, "--name", m.List)
+	}
+	if m.Mask.IsValid() {
+		args = append(args, "--mask", m.Mask.String())
+	}
+	if m.Dest {
+		return append(args, "--rdest")
+	}
+	return append(args, "--rsource")
+}
+
+// Encode returns a xt_recent_mtinfo_v1 payload.
+func (m *Recent) Encode(family Family) ([]byte, error) {
+	switch m.Command {
+	case XT_RECENT_CHECK, XT_RECENT_UPDATE:
+	case XT_RECENT_SET, XT_RECENT_REMOVE:
+		if m.TTL || m.Reap {
+			return nil, fmt.Errorf("TTL and reap are only valid with check and update")
+		}
+	default:
+		return nil, fmt.Errorf("invalid recent command %d", m.Command)
+	}
+	if m.Reap && m.Seconds == 0 {
+		return nil, fmt.Errorf("reap requires seconds")
+	}
+
+	info := xtRecentMtinfoV1{
+		Seconds:  m.Seconds,
+		HitCount: m.HitCount,
+		CheckSet: m.Command,
+	}
+	if m.TTL {
+		info.CheckSet |= XT_RECENT_TTL
+	}
+	if m.Reap {
+		info.CheckSet |= XT_RECENT_REAP
+	}
+	if m.Not {
+		info.Invert = 1
+	}
+	if m.Dest {
+		info.Side = XT_RECENT_DEST
+	}
+	list := m.List
+	if list == "" {
+		list = RecentDefaultList
+	}
+	var err error
+	if err = putCString(info.ListName[:], list); err != nil {
+		return nil, err
+	}
+
+	if m.Mask.IsValid() {
+		if info.Mask, err = putInetIP(family, m.Mask); err != nil {
+			return nil, err
+		}
+	} else {
+		n := len(info.Mask)
+		if family == FamilyIPv4 {
+			n = 4
+		}
+		for i := range info.Mask[:n] {
+			info.Mask[i] = 0xff
+		}
+	}
+
+	return encodeStruct(&info), nil
+}
+
+func decodeRecent(family Family, data []byte) (Match, error) {
+	var info xtRecentMtinfoV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &Recent{
+		List:     cString(info.ListName[:]),
+		Command:  info.CheckSet &^ (XT_RECENT_TTL | XT_RECENT_REAP),
+		Seconds:  info.Seconds,
+		HitCount: info.HitCount,
+		TTL:      info.CheckSet&XT_RECENT_TTL != 0,
+		Reap:     info.CheckSet&XT_RECENT_REAP != 0,
+		Dest:     info.Side == XT_RECENT_DEST,
+		Not:      info.Invert != 0,
+	}
+	mask := getInetIP(family, info.Mask)
+	if ones, ok := maskBits(mask); !ok || ones != mask.BitLen() {
+		m.Mask = mask
+	}
+	return m, nil
+}
+
+func parseRecent(family Family, opts []parsedOption) (Match, error) {
+	m := &Recent{}
+	for _, o := range opts {
+		var v uint64
+		var err error
+		switch o.name {
+		case "--set", "--rcheck", "--update", "--remove":
+			if m.Command != 0 {
+				return nil, o.errorf("only one of --set, --rcheck, --update and --remove is allowed")
+			}
+			for command, name := range recentCommandNames {
+				if name == o.name {
+					m.Command = command
+				}
+			}
+			m.Not = o.not
+		case "--seconds":
+			v, err = parseUint(o.value(), 32)
+			m.Seconds = uint32(v)
+		case "--reap":
+			m.Reap = true
+		case "--hitcount":
+			v, err = parseUint(o.value(), 32)
+			m.HitCount = uint32(v)
+		case "--rttl":
+			m.TTL = true
+		case "--name":
+			m.List = o.value()
+		case "--mask":
+			if m.Mask, err = netip.ParseAddr(o.value()); err == nil {
+				_, err = putInetIP(family, m.Mask)
+			}
+			if ones, ok := maskBits(m.Mask); err == nil && ok && ones == m.Mask.BitLen() {
+				m.Mask = netip.Addr{}
+			}
+		case "--rsource":
+			m.Dest = false
+		case "--rdest":
+			m.Dest = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if m.Command == 0 {
+		return nil, fmt.Errorf("one of --set, --rcheck, --update and --remove is required")
+	}
+	return m, nil
+}
@@ -0,0 +1,464 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	// #include "ipset.h"
+	"C"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+const (
+	// the constants are copied from ip_set.h
+	IPSET_MAXNAMELEN = 32
+	IPSET_INVALID_ID = 65535
+	IPSET_DIM_MAX    = 6
+
+	// the constants are copied from the ip_set_kopt enum in ip_set.h
+	IPSET_INV_MATCH      = 1 << 0
+	IPSET_RETURN_NOMATCH = 1 << 7
+
+	// the constants are copied from the ipset_cmd_flags enum in ip_set.h
+	IPSET_FLAG_SKIP_COUNTER_UPDATE    = 1 << 3
+	IPSET_FLAG_SKIP_SUBCOUNTER_UPDATE = 1 << 4
+	IPSET_FLAG_MATCH_COUNTERS         = 1 << 5
+	IPSET_FLAG_RETURN_NOMATCH         = 1 << 7
+
+	// the constants are copied from the counter comparison enum in ip_set.h
+	IPSET_COUNTER_NONE = 0
+	IPSET_COUNTER_EQ   = 1
+	IPSET_COUNTER_NE   = 2
+	IPSET_COUNTER_LT   = 3
+	IPSET_COUNTER_GT   = 4
+)
+
+// IPSetIndex returns the kernel index of the named ipset.
+func IPSetIndex(name string) (uint16, error) {
+	if len(name) >= IPSET_MAXNAMELEN {
+		return 0, fmt.Errorf("ipset name too long: %q", name)
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var index C.uint16_t
+	if r, err := C.ipset_get_index(cName, &index); r != 0 {
+		return 0, fmt.Errorf("ipset %q: %v", name, err)
+	}
+	return uint16(index), nil
+}
+
+// IPSetName returns the name of the ipset with the specified kernel index.
+func IPSetName(index uint16) (string, error) {
+	var name [IPSET_MAXNAMELEN]C.char
+	if r, err := C.ipset_get_name(C.uint16_t(index), &name[0]); r != 0 {
+		return "", fmt.Errorf("ipset #%d: %v", index, err)
+	}
+	return C.GoString(&name[0]), nil
+}
+
+// resolvers used by the set match, replaceable for testing
+var (
+	ipsetIndex = IPSetIndex
+	ipsetName  = IPSetName
+)
+
+// SetDir selects the packet field used for one dimension of a set lookup.
+type SetDir uint8
+
+const (
+	SetDst SetDir = iota
+	SetSrc
+)
+
+// String returns "src" or "dst".
+func (d SetDir) String() string {
+	if d == SetSrc {
+		return "src"
+	}
+	return "dst"
+}
+
+// SetCounter compares the packets or bytes counter of the matching set element.
+type SetCounter struct {
+	// Op is one of IPSET_COUNTER_EQ, IPSET_COUNTER_NE, IPSET_COUNTER_LT or IPSET_COUNTER_GT.
+	Op    uint8
+	Value uint64
+}
+
+// Set is the 'set' match, looking up packets in an ipset.
+type Set struct {
+	// Rev is the revision of the payload layout, from 1 to 4; zero selects the latest one.
+	Rev uint8
+	// SetName is resolved to its kernel index when encoding if not empty, otherwise Index is used;
+	// when decoding it is resolved from Index on a best effort basis.
+	SetName string
+	Index   uint16
+	// Dirs are the fields used for each dimension, like src,dst; at most IPSET_DIM_MAX.
+	Dirs []SetDir
+	Not  Not
+	// ReturnNomatch requires revision 2 or later.
+	ReturnNomatch bool
+	// the following fields require revision 3 or later
+	NoUpdateCounters    bool
+	NoUpdateSubcounters bool
+	Packets             *SetCounter
+	Bytes               *SetCounter
+}
+
+// xt_set_info
+type xtSetInfo struct {
+	Index uint16
+	Dim   uint8
+	Flags uint8
+}
+
+// ip_set_counter_match0
+type ipSetCounterMatch0 struct {
+	Op    uint8
+	_     [7]byte
+	Value uint64
+}
+
+// ip_set_counter_match
+type ipSetCounterMatch struct {
+	Value uint64
+	Op    uint8
+	_     [7]byte
+}
+
+// xt_set_info_match_v3
+type xtSetInfoMatchV3 struct {
+	MatchSet xtSetInfo
+	_        [4]byte
+	Packets  ipSetCounterMatch0
+	Bytes    ipSetCounterMatch0
+	Flags    uint32
+	_        [4]byte
+}
+
+// xt_set_info_match_v4
+type xtSetInfoMatchV4 struct {
+	MatchSet xtSetInfo
+	_        [4]byte
+	Packets  ipSetCounterMatch
+	Bytes    ipSetCounterMatch
+	Flags    uint32
+	_        [4]byte
+}
+
+func init() {
+	for rev := uint8(1); rev <= 4; rev++ {
+		rev := rev
+		RegisterMatch("set", rev, func(family Family, data []byte) (Match, error) {
+			return decodeSet(rev, data)
+		})
+	}
+	registerMatchParser("set", map[string]optionSpec{
+		"--match-set": {2, true}, "--return-nomatch": {0, false},
+		"--update-counters": {0, true}, "--update-subcounters": {0, true},
+		"--packets-eq": {1, true}, "--packets-lt": {1, false}, "--packets-gt": {1, false},
+		"--bytes-eq": {1, true}, "--bytes-lt": {1, false}, "--bytes-gt": {1, false},
+	}, parseSet)
+}
+
+// Name returns "set".
+func (m *Set) Name() string {
+	return "set"
+}
+
+// Revision returns the revision of the payload layout.
+func (m *Set) Revision() uint8 {
+	if m.Rev == 0 {
+		return 4
+	}
+	return m.Rev
+}
+
+// Revisions returns Rev, or revisions 4 down to 1 when Rev is zero.
+func (m *Set) Revisions() []uint8 {
+	return revisionsFrom(m.Rev, 4, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (m *Set) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *m
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+// String returns the set name and directions, like "blacklist src,dst".
+func (m *Set) String() string {
+	name, dirs := m.setArgs()
+	return name + " " + dirs
+}
+
+// setArgs returns the set name, or "#index" when unknown, and the comma-separated directions.
+func (m *Set) setArgs() (name, dirs string) {
+	name = m.SetName
+	if name == "" {
+		name = fmt.Sprintf("#%d", m.Index)
+	}
+	names := make([]string, len(m.Dirs))
+	for i, d := range m.Dirs {
+		names[i] = d.String()
+	}
+	return name, strings.Join(names, ",")
+}
+
+// Args returns the '--match-set' option followed by the flags and counter comparisons in use.
+func (m *Set) Args() []string {
+	name, dirs := m.setArgs()
+	args := appendOpt(nil, m.Not, "--match-set", name, dirs)
+	if m.ReturnNomatch {
+		args = append(args, "--return-nomatch")
+	}
+	if m.NoUpdateCounters {
+		args = append(args, "!", "--update-counters")
+	}
+	if m.NoUpdateSubcounters {
+		args = append(args, "!", "--update-subcounters")
+	}
+	args = appendSetCounter(args, "--packets", m.Packets)
+	return appendSetCounter(args, "--bytes", m.Bytes)
+}
+
+// appendSetCounter appends a counter comparison, like '--packets-gt 10'; '!=' is expressed as '! --packets-eq'.
+func appendSetCounter(args []string, prefix string, c *SetCounter) []string {
+	if c == nil {
+		return args
+	}
+	value := decArg(c.Value)
+	switch c.Op {
+	case IPSET_COUNTER_EQ:
+		return append(args, prefix+"-eq", value)
+	case IPSET_COUNTER_NE:
+		return append(args, "!", prefix+"-eq", value)
+	case IPSET_COUNTER_LT:
+		return append(args, prefix+"-lt", value)
+	case IPSET_COUNTER_GT:
+		return append(args, prefix+"-gt", value)
+	}
+	return args
+}
+
+// Encode returns a xt_set_info_match_v1, v3 or v4 payload depending on revision;
+// revision 2 shares the layout of revision 1.
+func (m *Set) Encode(family Family) ([]byte, error) {
+	rev := m.Revision()
+	if rev < 1 || rev > 4 {
+		return nil, fmt.Errorf("unsupported revision %d", rev)
+	}
+	if len(m.Dirs) == 0 || len(m.Dirs) > IPSET_DIM_MAX {
+		return nil, fmt.Errorf("invalid number of set dimensions %d", len(m.Dirs))
+	}
+	if m.ReturnNomatch && rev < 2 {
+		return nil, fmt.Errorf("return-nomatch requires revision 2")
+	}
+	if (m.NoUpdateCounters || m.NoUpdateSubcounters || m.Packets != nil || m.Bytes != nil) && rev < 3 {
+		return nil, fmt.Errorf("counters require revision 3")
+	}
+
+	index := m.Index
+	if m.SetName != "" {
+		var err error
+		if index, err = ipsetIndex(m.SetName); err != nil {
+			return nil, err
+		}
+	}
+
+	info := xtSetInfo{Index: index, Dim: uint8(len(m.Dirs))}
+	for i, d := range m.Dirs {
+		if d == SetSrc {
+			info.Flags |= 1 << uint(i+1)
+		}
+	}
+	if m.Not {
+		info.Flags |= IPSET_INV_MATCH
+	}
+	if rev < 3 {
+		if m.ReturnNomatch {
+			info.Flags |= IPSET_RETURN_NOMATCH
+		}
+		return encodeStruct(&info), nil
+	}
+
+	var flags uint32
+	if m.ReturnNomatch {
+		flags |= IPSET_FLAG_RETURN_NOMATCH
+	}
+	if m.NoUpdateCounters {
+		flags |= IPSET_FLAG_SKIP_COUNTER_UPDATE
+	}
+	if m.NoUpdateSubcounters {
+		flags |= IPSET_FLAG_SKIP_SUBCOUNTER_UPDATE
+	}
+	var packets, bytes SetCounter
+	if m.Packets != nil {
+		packets = *m.Packets
+		flags |= IPSET_FLAG_MATCH_COUNTERS
+	}
+	if m.Bytes != nil {
+		bytes = *m.Bytes
+		flags |= IPSET_FLAG_MATCH_COUNTERS
+	}
+
+	if rev == 3 {
+		return encodeStruct(&xtSetInfoMatchV3{
+			MatchSet: info,
+			Packets:  ipSetCounterMatch0{Op: packets.Op, Value: packets.Value},
+			Bytes:    ipSetCounterMatch0{Op: bytes.Op, Value: bytes.Value},
+			Flags:    flags,
+		}), nil
+	}
+	return encodeStruct(&xtSetInfoMatchV4{
+		MatchSet: info,
+		Packets:  ipSetCounterMatch{Op: packets.Op, Value: packets.Value},
+		Bytes:    ipSetCounterMatch{Op: bytes.Op, Value: bytes.Value},
+		Flags:    flags,
+	}), nil
+}
+
+func decodeSet(rev uint8, data []byte) (Match, error) {
+	var info xtSetInfo
+	var flags uint32
+	var packets, bytes SetCounter
+	switch rev {
+	case 1, 2:
+		if err := decodeStruct(data, &info); err != nil {
+			return nil, err
+		}
+	case 3:
+		var v3 xtSetInfoMatchV3
+		if err := decodeStruct(data, &v3); err != nil {
+			return nil, err
+		}
+		info, flags = v3.MatchSet, v3.Flags
+		packets = SetCounter{Op: v3.Packets.Op, Value: v3.Packets.Value}
+		bytes = SetCounter{Op: v3.Bytes.Op, Value: v3.Bytes.Value}
+	default:
+		var v4 xtSetInfoMatchV4
+		if err := decodeStruct(data, &v4); err != nil {
+			return nil, err
+		}
+		info, flags = v4.MatchSet, v4.Flags
+		packets = SetCounter{Op: v4.Packets.Op, Value: v4.Packets.Value}
+		bytes = SetCounter{Op: v4.Bytes.Op, Value: v4.Bytes.Value}
+	}
+	if info.Dim > IPSET_DIM_MAX {
+		return nil, fmt.Errorf("invalid number of set dimensions %d", info.Dim)
+	}
+
+	m := &Set{
+		Rev:                 rev,
+		Index:               info.Index,
+		Dirs:                make([]SetDir, info.Dim),
+		Not:                 info.Flags&IPSET_INV_MATCH != 0,
+		ReturnNomatch:       info.Flags&IPSET_RETURN_NOMATCH != 0 || flags&IPSET_FLAG_RETURN_NOMATCH != 0,
+		NoUpdateCounters:    flags&IPSET_FLAG_SKIP_COUNTER_UPDATE != 0,
+		NoUpdateSubcounters: flags&IPSET_FLAG_SKIP_SUBCOUNTER_UPDATE != 0,
+	}
+	for i := range m.Dirs {
+		if info.Flags&(1<<uint(i+1)) != 0 {
+			m.Dirs[i] = SetSrc
+		}
+	}
+	if flags&IPSET_FLAG_MATCH_COUNTERS != 0 {
+		if packets.Op != IPSET_COUNTER_NONE {
+			m.Packets = &packets
+		}
+		if bytes.Op != IPSET_COUNTER_NONE {
+			m.Bytes = &bytes
+		}
+	}
+	// the set might have been destroyed or renamed meanwhile, or privileges might be missing
+	if name, err := ipsetName(info.Index); err == nil {
+		m.SetName = name
+	}
+	return m, nil
+}
+
+func parseSet(family Family, opts []parsedOption) (Match, error) {
+	m := &Set{}
+	found := false
+	for _, o := range opts {
+		switch o.name {
+		case "--match-set":
+			found = true
+			m.Not = o.not
+			if strings.HasPrefix(o.values[0], "#") {
+				index, err := parseUint(o.values[0][1:], 16)
+				if err != nil {
+					return nil, o.errorf("invalid set index %q", o.values[0])
+				}
+				m.Index = uint16(index)
+			} else if len(o.values[0]) >= IPSET_MAXNAMELEN {
+				return nil, o.errorf("ipset name too long: %q", o.values[0])
+			} else {
+				m.SetName = o.values[0]
+			}
+			for _, dir := range strings.Split(o.values[1], ",") {
+				switch dir {
+				case "src":
+					m.Dirs = append(m.Dirs, SetSrc)
+				case "dst":
+					m.Dirs = append(m.Dirs, SetDst)
+				default:
+					return nil, o.errorf("invalid direction %q", dir)
+				}
+			}
+			if len(m.Dirs) > IPSET_DIM_MAX {
+				return nil, o.errorf("too many directions, at most %d are allowed", IPSET_DIM_MAX)
+			}
+		case "--return-nomatch":
+			m.ReturnNomatch = true
+		case "--update-counters":
+			m.NoUpdateCounters = bool(o.not)
+		case "--update-subcounters":
+			m.NoUpdateSubcounters = bool(o.not)
+		default:
+			value, err := parseUint(o.value(), 64)
+			if err != nil {
+				return nil, o.errorf("%v", err)
+			}
+			c := &SetCounter{Value: value}
+			switch {
+			case strings.HasSuffix(o.name, "-eq") && bool(o.not):
+				c.Op = IPSET_COUNTER_NE
+			case strings.HasSuffix(o.name, "-eq"):
+				c.Op = IPSET_COUNTER_EQ
+			case strings.HasSuffix(o.name, "-lt"):
+				c.Op = IPSET_COUNTER_LT
+			default:
+				c.Op = IPSET_COUNTER_GT
+			}
+			if strings.HasPrefix(o.name, "--packets") {
+				m.Packets = c
+			} else {
+				m.Bytes = c
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("--match-set is required")
+	}
+	return m, nil
+}
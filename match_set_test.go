@@ -0,0 +1,158 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	// fake kernel with a single set
+	defer func(index func(string) (uint16, error), name func(uint16) (string, error)) {
+		ipsetIndex, ipsetName = index, name
+	}(ipsetIndex, ipsetName)
+	ipsetIndex = func(name string) (uint16, error) {
+		if name != "blacklist" {
+			return 0, fmt.Errorf("ipset %q: no such file or directory", name)
+		}
+		return 3, nil
+	}
+	ipsetName = func(index uint16) (string, error) {
+		if index != 3 {
+			return "", fmt.Errorf("ipset #%d: no such file or directory", index)
+		}
+		return "blacklist", nil
+	}
+
+	for _, rev := range []uint8{1, 2, 3, 4} {
+		match := &Set{Rev: rev, SetName: "blacklist", Dirs: []SetDir{SetSrc, SetDst}, Not: true}
+		if rev >= 2 {
+			match.ReturnNomatch = true
+		}
+		if rev >= 3 {
+			match.NoUpdateCounters = true
+			match.Packets = &SetCounter{Op: IPSET_COUNTER_GT, Value: 100}
+		}
+		decoded := roundTripMatch(t, FamilyIPv4, match)
+		match.Index = 3
+		if !reflect.DeepEqual(decoded, match) {
+			t.Errorf("revision %d: expected %#v, got %#v", rev, match, decoded)
+		}
+	}
+
+	match := &Set{Index: 7, Dirs: []SetDir{SetDst}}
+	decoded := roundTripMatch(t, FamilyIPv6, match)
+	match.Rev = 4
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+	if s := decoded.(*Set).String(); s != "#7 dst" {
+		t.Errorf("unexpected string %q", s)
+	}
+
+	for _, m := range []*Set{
+		{SetName: "whitelist", Dirs: []SetDir{SetSrc}},
+		{Index: 3},
+		{Rev: 1, Index: 3, Dirs: []SetDir{SetSrc}, ReturnNomatch: true},
+		{Rev: 2, Index: 3, Dirs: []SetDir{SetSrc}, Bytes: &SetCounter{Op: IPSET_COUNTER_LT}},
+	} {
+		if _, err := m.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", m)
+		}
+	}
+}
+
+func TestRecent(t *testing.T) {
+	match := &Recent{List: "ssh", Command: XT_RECENT_UPDATE, Seconds: 60, HitCount: 4, TTL: true, Reap: true, Not: true}
+	decoded := roundTripMatch(t, FamilyIPv4, match)
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+
+	match = &Recent{Command: XT_RECENT_SET, Dest: true, Mask: netip.MustParseAddr("ffff:ffff:ffff:ffff::")}
+	decoded = roundTripMatch(t, FamilyIPv6, match)
+	match.List = RecentDefaultList
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+
+	for _, m := range []*Recent{
+		{Command: XT_RECENT_CHECK | XT_RECENT_SET},
+		{Command: XT_RECENT_SET, TTL: true},
+		{Command: XT_RECENT_CHECK, Reap: true},
+		{Command: XT_RECENT_CHECK, Mask: netip.MustParseAddr("ffff:ffff:ffff:ffff::")},
+	} {
+		if _, err := m.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", m)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	match := &String{Algo: "kmp", Pattern: []byte("GET /admin"), From: 40, IgnoreCase: true, Not: true}
+	decoded := roundTripMatch(t, FamilyIPv4, match)
+	if !reflect.DeepEqual(decoded, match) {
+		t.Errorf("expected %#v, got %#v", match, decoded)
+	}
+
+	for _, m := range []*String{
+		{Pattern: []byte("x")},
+		{Algo: "bm"},
+		{Algo: "bm", Pattern: make([]byte, XT_STRING_MAX_PATTERN_SIZE+1)},
+		{Algo: "bm", Pattern: []byte("x"), From: 100, To: 50},
+	} {
+		if _, err := m.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", m)
+		}
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	// revision 4 puts the value of counters before their operator
+	for _, tc := range []struct {
+		rev       uint8
+		op, value int
+	}{
+		{3, 8, 16},
+		{4, 16, 8},
+	} {
+		data := payloadOf(t, FamilyIPv4, &Set{Rev: tc.rev, Index: 3, Dirs: []SetDir{SetSrc}, Packets: &SetCounter{Op: IPSET_COUNTER_GT, Value: 100}})
+		if index := nativeEndian.Uint16(data[0:]); index != 3 || data[2] != 1 {
+			t.Errorf("revision %d: index %d, dim %d", tc.rev, index, data[2])
+		}
+		if op, value := data[tc.op], nativeEndian.Uint64(data[tc.value:]); op != IPSET_COUNTER_GT || value != 100 {
+			t.Errorf("revision %d: packets op %d, value %d", tc.rev, op, value)
+		}
+	}
+
+	data := payloadOf(t, FamilyIPv4, &Recent{List: "ssh", Command: XT_RECENT_UPDATE, Seconds: 60, HitCount: 4, Mask: netip.MustParseAddr("255.255.255.0")})
+	if seconds, hits := nativeEndian.Uint32(data[0:]), nativeEndian.Uint32(data[4:]); seconds != 60 || hits != 4 {
+		t.Errorf("seconds %d, hit_count %d", seconds, hits)
+	}
+	if data[8] != XT_RECENT_UPDATE || string(data[10:13]) != "ssh" {
+		t.Errorf("check_set %#x, name %q", data[8], data[10:13])
+	}
+	if string(data[212:216]) != "\xff\xff\xff\x00" {
+		t.Errorf("mask % x", data[212:216])
+	}
+}
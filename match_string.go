@@ -0,0 +1,232 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// the constants are copied from #define declarations in xt_string.h
+	XT_STRING_MAX_PATTERN_SIZE   = 128
+	XT_STRING_MAX_ALGO_NAME_SIZE = 16
+
+	// the constants are copied from the anonymous enum in xt_string.h
+	XT_STRING_FLAG_INVERT     = 0x01
+	XT_STRING_FLAG_IGNORECASE = 0x02
+)
+
+// String is the 'string' match (revision 1), searching a pattern in packet data.
+type String struct {
+	// Algo is the textsearch algorithm, "bm" (Boyer-Moore) or "kmp" (Knuth-Pratt-Morris).
+	Algo    string
+	Pattern []byte
+	// From and To are the offsets where the search starts and stops; a zero To means the end of the packet.
+	From uint16
+	To   uint16
+	// IgnoreCase is only supported by the "kmp" algorithm.
+	IgnoreCase bool
+	Not        Not
+}
+
+// xt_string_info
+type xtStringInfo struct {
+	FromOffset uint16
+	ToOffset   uint16
+	Algo       [XT_STRING_MAX_ALGO_NAME_SIZE]byte
+	Pattern    [XT_STRING_MAX_PATTERN_SIZE]byte
+	Patlen     uint8
+	Flags      uint8
+	_          [2]byte
+	Config     uint64
+}
+
+func init() {
+	RegisterMatch("string", 1, decodeString)
+	registerMatchParser("string", map[string]optionSpec{
+		"--string": {1, true}, "--hex-string": {1, true}, "--algo": {1, false},
+		"--from": {1, false}, "--to": {1, false}, "--icase": {0, false},
+	}, parseString)
+}
+
+// Name returns "string".
+func (m *String) Name() string {
+	return "string"
+}
+
+// Revision returns 1.
+func (m *String) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--string' option, or '--hex-string' for patterns with non-printable bytes,
+// followed by the other options in use.
+func (m *String) Args() []string {
+	printable := true
+	for _, c := range m.Pattern {
+		if c < 0x20 || c > 0x7e {
+			printable = false
+			break
+		}
+	}
+	var args []string
+	if printable {
+		args = appendOpt(nil, m.Not, "--string", string(m.Pattern))
+	} else {
+		args = appendOpt(nil, m.Not, "--hex-string", "|"+hex.EncodeToString(m.Pattern)+"|")
+	}
+	args = append(args, "--algo", m.Algo)
+	if m.From != 0 {
+		args = append(args, "--from", decArg(uint64(m.From)))
+	}
+	if m.To != 0 {
+		args = append(args, "--to", decArg(uint64(m.To)))
+	}
+	if m.IgnoreCase {
+		args = append(args, "--icase")
+	}
+	return args
+}
+
+// Encode returns a xt_string_info payload.
+func (m *String) Encode(family Family) ([]byte, error) {
+	if m.Algo == "" {
+		return nil, fmt.Errorf("string match requires an algorithm")
+	}
+	if len(m.Pattern) == 0 || len(m.Pattern) > XT_STRING_MAX_PATTERN_SIZE {
+		return nil, fmt.Errorf("invalid pattern length %d", len(m.Pattern))
+	}
+	to := m.To
+	if to == 0 {
+		to = math.MaxUint16
+	}
+	if m.From > to {
+		return nil, fmt.Errorf("invalid offsets %d:%d", m.From, to)
+	}
+
+	info := xtStringInfo{
+		FromOffset: m.From,
+		ToOffset:   to,
+		Patlen:     uint8(len(m.Pattern)),
+	}
+	if err := putCString(info.Algo[:], m.Algo); err != nil {
+		return nil, err
+	}
+	copy(info.Pattern[:], m.Pattern)
+	if m.Not {
+		info.Flags |= XT_STRING_FLAG_INVERT
+	}
+	if m.IgnoreCase {
+		info.Flags |= XT_STRING_FLAG_IGNORECASE
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeString(family Family, data []byte) (Match, error) {
+	var info xtStringInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Patlen > XT_STRING_MAX_PATTERN_SIZE {
+		return nil, fmt.Errorf("invalid pattern length %d", info.Patlen)
+	}
+	m := &String{
+		Algo:       cString(info.Algo[:]),
+		Pattern:    append([]byte(nil), info.Pattern[:info.Patlen]...),
+		From:       info.FromOffset,
+		To:         info.ToOffset,
+		IgnoreCase: info.Flags&XT_STRING_FLAG_IGNORECASE != 0,
+		Not:        info.Flags&XT_STRING_FLAG_INVERT != 0,
+	}
+	if m.To == math.MaxUint16 {
+		m.To = 0
+	}
+	return m, nil
+}
+
+// parseHexString decodes a pattern where hexadecimal bytes are enclosed in pipes, like "GET |2f|".
+func parseHexString(s string) ([]byte, error) {
+	parts := strings.Split(s, "|")
+	if len(parts)%2 == 0 {
+		return nil, fmt.Errorf("unterminated hex block in %q", s)
+	}
+	var pattern []byte
+	for i, part := range parts {
+		if i%2 == 0 {
+			pattern = append(pattern, part...)
+			continue
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(part, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex block %q", part)
+		}
+		pattern = append(pattern, b...)
+	}
+	return pattern, nil
+}
+
+func parseString(family Family, opts []parsedOption) (Match, error) {
+	m := &String{}
+	for _, o := range opts {
+		var v uint64
+		var err error
+		switch o.name {
+		case "--string", "--hex-string":
+			if m.Pattern != nil {
+				return nil, o.errorf("only one pattern is allowed")
+			}
+			if o.name == "--string" {
+				m.Pattern = []byte(o.value())
+			} else {
+				m.Pattern, err = parseHexString(o.value())
+			}
+			if err == nil && (len(m.Pattern) == 0 || len(m.Pattern) > XT_STRING_MAX_PATTERN_SIZE) {
+				err = fmt.Errorf("pattern length must be between 1 and %d bytes", XT_STRING_MAX_PATTERN_SIZE)
+			}
+			m.Not = o.not
+		case "--algo":
+			if len(o.value()) >= XT_STRING_MAX_ALGO_NAME_SIZE {
+				err = fmt.Errorf("algorithm name too long")
+			}
+			m.Algo = o.value()
+		case "--from":
+			v, err = parseUint(o.value(), 16)
+			m.From = uint16(v)
+		case "--to":
+			v, err = parseUint(o.value(), 16)
+			m.To = uint16(v)
+		case "--icase":
+			m.IgnoreCase = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if m.Pattern == nil {
+		return nil, fmt.Errorf("--string or --hex-string is required")
+	}
+	if m.Algo == "" {
+		return nil, fmt.Errorf("--algo is required")
+	}
+	return m, nil
+}
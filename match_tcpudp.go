@@ -0,0 +1,365 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TCPFlags is a bitmask of TCP header flags.
+type TCPFlags uint8
+
+const (
+	TCPFlagFIN TCPFlags = 0x01
+	TCPFlagSYN TCPFlags = 0x02
+	TCPFlagRST TCPFlags = 0x04
+	TCPFlagPSH TCPFlags = 0x08
+	TCPFlagACK TCPFlags = 0x10
+	TCPFlagURG TCPFlags = 0x20
+	TCPFlagALL TCPFlags = 0x3f
+)
+
+var tcpFlagNames = []struct {
+	flag TCPFlags
+	name string
+}{
+	{TCPFlagFIN, "FIN"},
+	{TCPFlagSYN, "SYN"},
+	{TCPFlagRST, "RST"},
+	{TCPFlagPSH, "PSH"},
+	{TCPFlagACK, "ACK"},
+	{TCPFlagURG, "URG"},
+}
+
+// String returns the comma-separated list of flags, as printed by iptables-save.
+func (f TCPFlags) String() string {
+	var names []string
+	for _, n := range tcpFlagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseTCPFlags parses a comma-separated list of flags, like "SYN,ACK"; "ALL" and "NONE" are recognized.
+func ParseTCPFlags(s string) (TCPFlags, error) {
+	var flags TCPFlags
+next:
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToUpper(name) {
+		case "ALL":
+			flags |= TCPFlagALL
+			continue
+		case "NONE":
+			continue
+		}
+		for _, n := range tcpFlagNames {
+			if strings.EqualFold(name, n.name) {
+				flags |= n.flag
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid TCP flag %q", name)
+	}
+	return flags, nil
+}
+
+const (
+	// the constants are copied from #define declarations in xt_tcpudp.h
+	XT_TCP_INV_SRCPT  = 0x01
+	XT_TCP_INV_DSTPT  = 0x02
+	XT_TCP_INV_FLAGS  = 0x04
+	XT_TCP_INV_OPTION = 0x08
+	XT_UDP_INV_SRCPT  = 0x01
+	XT_UDP_INV_DSTPT  = 0x02
+)
+
+// TCP is the 'tcp' match; it is only valid in rules with protocol TCP.
+type TCP struct {
+	// SrcPort and DstPort are nil to match any port.
+	SrcPort *PortRange
+	DstPort *PortRange
+	// FlagsMask are the flags to examine, of which FlagsSet must be set and the others unset.
+	FlagsMask TCPFlags
+	FlagsSet  TCPFlags
+	// Option is the number of a TCP option that must be present, zero for none.
+	Option uint8
+	Not    struct {
+		SrcPort Not
+		DstPort Not
+		Flags   Not
+		Option  Not
+	}
+}
+
+// xt_tcp
+type xtTCP struct {
+	Spts     [2]uint16
+	Dpts     [2]uint16
+	Option   uint8
+	FlgMask  uint8
+	FlgCmp   uint8
+	Invflags uint8
+}
+
+// UDP is the 'udp' match; it is only valid in rules with protocol UDP.
+type UDP struct {
+	// SrcPort and DstPort are nil to match any port.
+	SrcPort *PortRange
+	DstPort *PortRange
+	Not     struct {
+		SrcPort Not
+		DstPort Not
+	}
+}
+
+// xt_udp
+type xtUDP struct {
+	Spts     [2]uint16
+	Dpts     [2]uint16
+	Invflags uint8
+	_        [1]byte
+}
+
+func init() {
+	RegisterMatch("tcp", 0, decodeTCP)
+	RegisterMatch("udp", 0, decodeUDP)
+	registerMatchParser("tcp", map[string]optionSpec{
+		"--sport": {1, true}, "--source-port": {1, true}, "--dport": {1, true}, "--destination-port": {1, true},
+		"--tcp-flags": {2, true}, "--syn": {0, true}, "--tcp-option": {1, true},
+	}, parseTCP)
+	registerMatchParser("udp", map[string]optionSpec{
+		"--sport": {1, true}, "--source-port": {1, true}, "--dport": {1, true}, "--destination-port": {1, true},
+	}, parseUDP)
+}
+
+// putPorts converts an optional port range to the kernel representation, where any port is 0:65535.
+func putPorts(p *PortRange) [2]uint16 {
+	if p == nil {
+		return [2]uint16{0, 0xffff}
+	}
+	return [2]uint16{p.Min, p.Max}
+}
+
+// getPorts is the counterpart of putPorts.
+func getPorts(p [2]uint16) *PortRange {
+	if p[0] == 0 && p[1] == 0xffff {
+		return nil
+	}
+	return &PortRange{p[0], p[1]}
+}
+
+// Name returns "tcp".
+func (m *TCP) Name() string {
+	return "tcp"
+}
+
+// Revision returns 0.
+func (m *TCP) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--sport', '--dport', '--tcp-option' and '--tcp-flags' options in use.
+func (m *TCP) Args() []string {
+	var args []string
+	if m.SrcPort != nil {
+		args = appendOpt(args, m.Not.SrcPort, "--sport", m.SrcPort.String())
+	}
+	if m.DstPort != nil {
+		args = appendOpt(args, m.Not.DstPort, "--dport", m.DstPort.String())
+	}
+	if m.Option != 0 {
+		args = appendOpt(args, m.Not.Option, "--tcp-option", decArg(uint64(m.Option)))
+	}
+	if m.FlagsMask != 0 {
+		args = appendOpt(args, m.Not.Flags, "--tcp-flags", m.FlagsMask.String(), m.FlagsSet.String())
+	}
+	return args
+}
+
+// Protocol returns IPPROTO_TCP.
+func (m *TCP) Protocol() uint16 {
+	return IPPROTO_TCP
+}
+
+// Encode returns a xt_tcp payload.
+func (m *TCP) Encode(family Family) ([]byte, error) {
+	info := xtTCP{
+		Spts:    putPorts(m.SrcPort),
+		Dpts:    putPorts(m.DstPort),
+		Option:  m.Option,
+		FlgMask: uint8(m.FlagsMask),
+		FlgCmp:  uint8(m.FlagsSet),
+	}
+	if m.Not.SrcPort {
+		info.Invflags |= XT_TCP_INV_SRCPT
+	}
+	if m.Not.DstPort {
+		info.Invflags |= XT_TCP_INV_DSTPT
+	}
+	if m.Not.Flags {
+		info.Invflags |= XT_TCP_INV_FLAGS
+	}
+	if m.Not.Option {
+		info.Invflags |= XT_TCP_INV_OPTION
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeTCP(family Family, data []byte) (Match, error) {
+	var info xtTCP
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &TCP{
+		SrcPort:   getPorts(info.Spts),
+		DstPort:   getPorts(info.Dpts),
+		Option:    info.Option,
+		FlagsMask: TCPFlags(info.FlgMask),
+		FlagsSet:  TCPFlags(info.FlgCmp),
+	}
+	m.Not.SrcPort = info.Invflags&XT_TCP_INV_SRCPT != 0
+	m.Not.DstPort = info.Invflags&XT_TCP_INV_DSTPT != 0
+	m.Not.Flags = info.Invflags&XT_TCP_INV_FLAGS != 0
+	m.Not.Option = info.Invflags&XT_TCP_INV_OPTION != 0
+	return m, nil
+}
+
+// Name returns "udp".
+func (m *UDP) Name() string {
+	return "udp"
+}
+
+// Revision returns 0.
+func (m *UDP) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--sport' and '--dport' options in use.
+func (m *UDP) Args() []string {
+	var args []string
+	if m.SrcPort != nil {
+		args = appendOpt(args, m.Not.SrcPort, "--sport", m.SrcPort.String())
+	}
+	if m.DstPort != nil {
+		args = appendOpt(args, m.Not.DstPort, "--dport", m.DstPort.String())
+	}
+	return args
+}
+
+// Protocol returns IPPROTO_UDP.
+func (m *UDP) Protocol() uint16 {
+	return IPPROTO_UDP
+}
+
+// Encode returns a xt_udp payload.
+func (m *UDP) Encode(family Family) ([]byte, error) {
+	info := xtUDP{
+		Spts: putPorts(m.SrcPort),
+		Dpts: putPorts(m.DstPort),
+	}
+	if m.Not.SrcPort {
+		info.Invflags |= XT_UDP_INV_SRCPT
+	}
+	if m.Not.DstPort {
+		info.Invflags |= XT_UDP_INV_DSTPT
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeUDP(family Family, data []byte) (Match, error) {
+	var info xtUDP
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	m := &UDP{
+		SrcPort: getPorts(info.Spts),
+		DstPort: getPorts(info.Dpts),
+	}
+	m.Not.SrcPort = info.Invflags&XT_UDP_INV_SRCPT != 0
+	m.Not.DstPort = info.Invflags&XT_UDP_INV_DSTPT != 0
+	return m, nil
+}
+
+// parsePorts parses the value of a '--sport' or '--dport' option.
+func parsePorts(s string) (*PortRange, error) {
+	r, err := ParsePortRange(s)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func parseTCP(family Family, opts []parsedOption) (Match, error) {
+	m := &TCP{}
+	var err error
+	for _, o := range opts {
+		switch o.name {
+		case "--sport", "--source-port":
+			m.SrcPort, err = parsePorts(o.value())
+			m.Not.SrcPort = o.not
+		case "--dport", "--destination-port":
+			m.DstPort, err = parsePorts(o.value())
+			m.Not.DstPort = o.not
+		case "--tcp-flags":
+			if m.FlagsMask, err = ParseTCPFlags(o.values[0]); err == nil {
+				m.FlagsSet, err = ParseTCPFlags(o.values[1])
+			}
+			m.Not.Flags = o.not
+		case "--syn":
+			m.FlagsMask = TCPFlagSYN | TCPFlagRST | TCPFlagACK | TCPFlagFIN
+			m.FlagsSet = TCPFlagSYN
+			m.Not.Flags = o.not
+		case "--tcp-option":
+			var option uint64
+			option, err = parseUint(o.value(), 8)
+			m.Option = uint8(option)
+			m.Not.Option = o.not
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return m, nil
+}
+
+func parseUDP(family Family, opts []parsedOption) (Match, error) {
+	m := &UDP{}
+	var err error
+	for _, o := range opts {
+		switch o.name {
+		case "--sport", "--source-port":
+			m.SrcPort, err = parsePorts(o.value())
+			m.Not.SrcPort = o.not
+		case "--dport", "--destination-port":
+			m.DstPort, err = parsePorts(o.value())
+			m.Not.DstPort = o.not
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return m, nil
+}
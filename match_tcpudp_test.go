@@ -0,0 +1,131 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTCP(t *testing.T) {
+	m := &TCP{
+		DstPort:   &PortRange{22, 22},
+		FlagsMask: TCPFlagSYN | TCPFlagRST | TCPFlagACK | TCPFlagFIN,
+		FlagsSet:  TCPFlagSYN,
+	}
+	m.Not.DstPort = true
+	data, err := m.Encode(FamilyIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// source ports must default to 0:65535
+	if nativeEndian.Uint16(data[0:]) != 0 || nativeEndian.Uint16(data[2:]) != 0xffff {
+		t.Fatalf("unexpected source port range % x", data[0:4])
+	}
+
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+	if m.FlagsMask.String() != "FIN,SYN,RST,ACK" {
+		t.Fatalf("unexpected flags %q", m.FlagsMask.String())
+	}
+}
+
+func TestParseTCPFlags(t *testing.T) {
+	f, err := ParseTCPFlags("ALL")
+	if err != nil || f != TCPFlagALL {
+		t.Fatalf("unexpected flags %s, %v", f, err)
+	}
+	f, err = ParseTCPFlags("syn,ACK")
+	if err != nil || f != TCPFlagSYN|TCPFlagACK {
+		t.Fatalf("unexpected flags %s, %v", f, err)
+	}
+	if _, err = ParseTCPFlags("SYN,ECHO"); err == nil {
+		t.Fatal("invalid flag parsed")
+	}
+}
+
+func TestUDP(t *testing.T) {
+	m := &UDP{SrcPort: &PortRange{53, 53}, DstPort: &PortRange{1024, 2048}}
+	m.Not.SrcPort = true
+	decoded := roundTripMatch(t, FamilyIPv6, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+}
+
+func TestICMP(t *testing.T) {
+	m := &ICMP{Type: 3, Codes: &ICMPCodes{1, 1}, Not: true}
+	decoded := roundTripMatch(t, FamilyIPv4, m)
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("expected %#v, got %#v", m, decoded)
+	}
+
+	m6 := &ICMPv6{Type: 128}
+	decoded = roundTripMatch(t, FamilyIPv6, m6)
+	if !reflect.DeepEqual(decoded, m6) {
+		t.Fatalf("expected %#v, got %#v", m6, decoded)
+	}
+
+	if _, err := m.Encode(FamilyIPv6); err == nil {
+		t.Fatal("icmp match encoded for IPv6")
+	}
+	if _, err := m6.Encode(FamilyIPv4); err == nil {
+		t.Fatal("icmp6 match encoded for IPv4")
+	}
+}
+
+func TestEffectiveProto(t *testing.T) {
+	r := Rule{Matches: []Match{&Comment{}, &TCP{}}}
+	proto, err := r.EffectiveProto()
+	if err != nil || proto != IPPROTO_TCP {
+		t.Fatalf("unexpected protocol %d, %v", proto, err)
+	}
+
+	r.Proto = IPPROTO_UDP
+	if _, err = r.EffectiveProto(); err == nil {
+		t.Fatal("tcp match accepted with protocol udp")
+	}
+
+	r.Proto = IPPROTO_TCP
+	r.Not.Proto = true
+	if _, err = r.EffectiveProto(); err == nil {
+		t.Fatal("tcp match accepted with negated protocol")
+	}
+}
+
+func TestTCPUDPLayout(t *testing.T) {
+	// ports are in host order
+	m := &TCP{DstPort: &PortRange{22, 23}, FlagsMask: 0x3f, FlagsSet: 0x02}
+	m.Not.DstPort = true
+	data := payloadOf(t, FamilyIPv4, m)
+	if min, max := nativeEndian.Uint16(data[4:]), nativeEndian.Uint16(data[6:]); min != 22 || max != 23 {
+		t.Errorf("dpts %d:%d", min, max)
+	}
+	if data[9] != 0x3f || data[10] != 0x02 || data[11] != XT_TCP_INV_DSTPT {
+		t.Errorf("flg_mask %#x, flg_cmp %#x, invflags %#x", data[9], data[10], data[11])
+	}
+
+	data = payloadOf(t, FamilyIPv4, &UDP{DstPort: &PortRange{53, 53}})
+	if min, max := nativeEndian.Uint16(data[4:]), nativeEndian.Uint16(data[6:]); min != 53 || max != 53 {
+		t.Errorf("udp dpts %d:%d", min, max)
+	}
+}
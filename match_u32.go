@@ -0,0 +1,347 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// U32Op is an operator of an u32 location expression.
+type U32Op uint8
+
+const (
+	// the constants are copied from the xt_u32_ops enum in xt_u32.h
+	XT_U32_AND U32Op = iota
+	XT_U32_LEFTSH
+	XT_U32_RIGHTSH
+	XT_U32_AT
+
+	// XT_U32_MAXSIZE is copied from #define declarations in xt_u32.h; tests, location
+	// elements and values are limited to XT_U32_MAXSIZE+1 each.
+	XT_U32_MAXSIZE = 10
+)
+
+var u32OpNames = []string{"&", "<<", ">>", "@"}
+
+// String returns the operator as written in u32 expressions.
+func (op U32Op) String() string {
+	if int(op) < len(u32OpNames) {
+		return u32OpNames[op]
+	}
+	return fmt.Sprintf("op%d", uint8(op))
+}
+
+// U32Location is an element of a location expression; Op combines Number with the
+// result of the preceding elements and is ignored for the first element.
+type U32Location struct {
+	Op     U32Op
+	Number uint32
+}
+
+// U32Range is an inclusive range of values.
+type U32Range struct {
+	Min uint32
+	Max uint32
+}
+
+// U32Test compares the 32-bit value at Location with a list of ranges.
+type U32Test struct {
+	Location []U32Location
+	Values   []U32Range
+}
+
+// U32 is the 'u32' match; all tests must succeed for the match to apply.
+type U32 struct {
+	Tests []U32Test
+	Not   Not
+}
+
+// xt_u32_location_element
+type xtU32LocationElement struct {
+	Number uint32
+	Nextop uint8
+	_      [3]byte
+}
+
+// xt_u32_value_element
+type xtU32ValueElement struct {
+	Min, Max uint32
+}
+
+// xt_u32_test
+type xtU32Test struct {
+	Location [XT_U32_MAXSIZE + 1]xtU32LocationElement
+	Value    [XT_U32_MAXSIZE + 1]xtU32ValueElement
+	Nnums    uint8
+	Nvalues  uint8
+	_        [2]byte
+}
+
+// xt_u32
+type xtU32 struct {
+	Tests  [XT_U32_MAXSIZE + 1]xtU32Test
+	Ntests uint8
+	Invert uint8
+	_      [2]byte
+}
+
+func init() {
+	RegisterMatch("u32", 0, decodeU32)
+	registerMatchParser("u32", map[string]optionSpec{"--u32": {1, true}}, parseU32)
+}
+
+// u32Parser holds the state of ParseU32.
+type u32Parser struct {
+	expr string
+	pos  int
+}
+
+func (p *u32Parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("u32 expression %q at offset %d: %s", p.expr, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *u32Parser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t' || p.expr[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// consume skips spaces and then token if present.
+func (p *u32Parser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.expr[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// number parses a number in C notation (decimal, 0x-prefixed hexadecimal or 0-prefixed octal).
+func (p *u32Parser) number() (uint32, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.expr) && (p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' ||
+		p.expr[p.pos] >= 'a' && p.expr[p.pos] <= 'f' || p.expr[p.pos] >= 'A' && p.expr[p.pos] <= 'F' ||
+		p.expr[p.pos] == 'x' || p.expr[p.pos] == 'X') {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("expected number")
+	}
+	token := p.expr[start:p.pos]
+	n, err := strconv.ParseUint(token, 0, 32)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("invalid number %q", token)
+	}
+	return uint32(n), nil
+}
+
+// ParseU32 parses an expression in the u32 match language, like "0>>22&0x3C@12>>26&0x3C@0=0x1:0xff&&6&0xFF=6".
+func ParseU32(expr string) (*U32, error) {
+	p := &u32Parser{expr: expr}
+	m := &U32{}
+	for {
+		if len(m.Tests) > XT_U32_MAXSIZE {
+			return nil, p.errorf("too many tests")
+		}
+		var test U32Test
+
+		// location
+		op := XT_U32_AND
+		for {
+			if len(test.Location) > XT_U32_MAXSIZE {
+				return nil, p.errorf("too many operators")
+			}
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			test.Location = append(test.Location, U32Location{Op: op, Number: n})
+
+			if p.consume("=") {
+				break
+			}
+			found := false
+			for i, name := range u32OpNames {
+				if p.consume(name) {
+					op, found = U32Op(i), true
+					break
+				}
+			}
+			if !found {
+				return nil, p.errorf("expected operator or '='")
+			}
+		}
+
+		// values
+		for {
+			if len(test.Values) > XT_U32_MAXSIZE {
+				return nil, p.errorf("too many ranges")
+			}
+			min, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			max := min
+			if p.consume(":") {
+				if max, err = p.number(); err != nil {
+					return nil, err
+				}
+			}
+			test.Values = append(test.Values, U32Range{Min: min, Max: max})
+			if !p.consume(",") {
+				break
+			}
+		}
+		m.Tests = append(m.Tests, test)
+
+		if p.consume("&&") {
+			continue
+		}
+		p.skipSpace()
+		if p.pos != len(p.expr) {
+			return nil, p.errorf("unexpected character %q", p.expr[p.pos])
+		}
+		return m, nil
+	}
+}
+
+// String returns the expression as printed by iptables-save, which additionally wraps it in double quotes.
+func (m *U32) String() string {
+	var b strings.Builder
+	for i, test := range m.Tests {
+		if i > 0 {
+			b.WriteString("&&")
+		}
+		for j, loc := range test.Location {
+			if j > 0 {
+				b.WriteString(loc.Op.String())
+			}
+			fmt.Fprintf(&b, "0x%x", loc.Number)
+		}
+		b.WriteByte('=')
+		for j, v := range test.Values {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			if v.Min == v.Max {
+				fmt.Fprintf(&b, "0x%x", v.Min)
+			} else {
+				fmt.Fprintf(&b, "0x%x:0x%x", v.Min, v.Max)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Name returns "u32".
+func (m *U32) Name() string {
+	return "u32"
+}
+
+// Revision returns 0.
+func (m *U32) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--u32' option.
+func (m *U32) Args() []string {
+	return appendOpt(nil, m.Not, "--u32", m.String())
+}
+
+// Encode returns a xt_u32 payload.
+func (m *U32) Encode(family Family) ([]byte, error) {
+	if len(m.Tests) == 0 || len(m.Tests) > XT_U32_MAXSIZE+1 {
+		return nil, fmt.Errorf("invalid number of u32 tests %d", len(m.Tests))
+	}
+	var info xtU32
+	for i, test := range m.Tests {
+		if len(test.Location) == 0 || len(test.Location) > XT_U32_MAXSIZE+1 {
+			return nil, fmt.Errorf("invalid number of u32 location elements %d", len(test.Location))
+		}
+		if len(test.Values) == 0 || len(test.Values) > XT_U32_MAXSIZE+1 {
+			return nil, fmt.Errorf("invalid number of u32 values %d", len(test.Values))
+		}
+		t := &info.Tests[i]
+		for j, loc := range test.Location {
+			if loc.Op > XT_U32_AT {
+				return nil, fmt.Errorf("invalid u32 operator %d", loc.Op)
+			}
+			t.Location[j] = xtU32LocationElement{Number: loc.Number}
+			if j > 0 {
+				t.Location[j].Nextop = uint8(loc.Op)
+			}
+		}
+		for j, v := range test.Values {
+			t.Value[j] = xtU32ValueElement{Min: v.Min, Max: v.Max}
+		}
+		t.Nnums = uint8(len(test.Location))
+		t.Nvalues = uint8(len(test.Values))
+	}
+	info.Ntests = uint8(len(m.Tests))
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeU32(family Family, data []byte) (Match, error) {
+	var info xtU32
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Ntests > XT_U32_MAXSIZE+1 {
+		return nil, fmt.Errorf("invalid number of u32 tests %d", info.Ntests)
+	}
+	m := &U32{Tests: make([]U32Test, info.Ntests), Not: info.Invert != 0}
+	for i := range m.Tests {
+		t := &info.Tests[i]
+		if t.Nnums == 0 || t.Nnums > XT_U32_MAXSIZE+1 || t.Nvalues > XT_U32_MAXSIZE+1 {
+			return nil, fmt.Errorf("invalid u32 test %d", i)
+		}
+		test := &m.Tests[i]
+		test.Location = make([]U32Location, t.Nnums)
+		for j := range test.Location {
+			test.Location[j] = U32Location{Op: U32Op(t.Location[j].Nextop), Number: t.Location[j].Number}
+		}
+		test.Location[0].Op = XT_U32_AND
+		test.Values = make([]U32Range, t.Nvalues)
+		for j := range test.Values {
+			test.Values[j] = U32Range{Min: t.Value[j].Min, Max: t.Value[j].Max}
+		}
+	}
+	return m, nil
+}
+
+func parseU32(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--u32 is required")
+	}
+	o := opts[0]
+	m, err := ParseU32(o.value())
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	m.Not = o.not
+	return m, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseU32(t *testing.T) {
+	for expr, expected := range map[string]string{
+		// examples from the iptables u32 manual page
+		"0>>22&0x3C@ 12>>26&0x3C@ 0 & 0xFFFF=0x50":   "0x0>>0x16&0x3c@0xc>>0x1a&0x3c@0x0&0xffff=0x50",
+		"6 & 0xFF = 1 && 4 & 0x3FFF = 0":             "0x6&0xff=0x1&&0x4&0x3fff=0x0",
+		"0 & 0xFFFF = 0x100:0xFFFF":                  "0x0&0xffff=0x100:0xffff",
+		"3&0x3F=0x20,0x30:0x3f,010":                  "0x3&0x3f=0x20,0x30:0x3f,0x8",
+		"0x0>>0x16&0x3c@0x4>>0x10=0x1:0xffff":        "0x0>>0x16&0x3c@0x4>>0x10=0x1:0xffff",
+		"0x0>>0x16&0x3c@0x0<<0x8=0x0&&0x6&0xff=0x11": "0x0>>0x16&0x3c@0x0<<0x8=0x0&&0x6&0xff=0x11",
+	} {
+		m, err := ParseU32(expr)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+			continue
+		}
+		if s := m.String(); s != expected {
+			t.Errorf("%q: rendered as %q, expected %q", expr, s, expected)
+		}
+		m.Not = true
+		decoded := roundTripMatch(t, FamilyIPv4, m)
+		if !reflect.DeepEqual(decoded, m) {
+			t.Errorf("%q: expected %#v, got %#v", expr, m, decoded)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"6&0xFF",
+		"6&0xFF=",
+		"6^0xFF=1",
+		"6&0xFF=1&&",
+		"6&0xFF=1 junk",
+		"0x100000000=1",
+		"1@1@1@1@1@1@1@1@1@1@1@1=1",
+		"1=1,2,3,4,5,6,7,8,9,10,11,12",
+	} {
+		if _, err := ParseU32(expr); err == nil {
+			t.Errorf("%q: parsed", expr)
+		}
+	}
+}
+
+func TestBPF(t *testing.T) {
+	bytecode := "4,48 0 0 9,21 0 1 6,6 0 0 1,6 0 0 0"
+	program, err := ParseBPFBytecode(bytecode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := FormatBPFBytecode(program); s != bytecode {
+		t.Errorf("rendered as %q, expected %q", s, bytecode)
+	}
+
+	for _, match := range []*BPF{{Program: program}, {Path: "/sys/fs/bpf/filter"}} {
+		decoded := roundTripMatch(t, FamilyIPv6, match)
+		if !reflect.DeepEqual(decoded, match) {
+			t.Errorf("expected %#v, got %#v", match, decoded)
+		}
+	}
+
+	for _, match := range []*BPF{{}, {Program: program, Path: "/sys/fs/bpf/filter"}, {Program: make([]BPFInstruction, 65)}} {
+		if _, err := match.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", match)
+		}
+	}
+
+	for _, s := range []string{"", "2,6 0 0 0", "1,6 0 0", "1,6 0 0 x"} {
+		if _, err := ParseBPFBytecode(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+}
+
+func TestU32Layout(t *testing.T) {
+	test := U32Test{
+		Location: []U32Location{{Number: 6}, {Op: XT_U32_AND, Number: 0xff}},
+		Values:   []U32Range{{1, 1}},
+	}
+	data := payloadOf(t, FamilyIPv4, &U32{Tests: []U32Test{test, test}, Not: true})
+	// the second test starts after the 180 bytes of the first one
+	for _, base := range []int{0, 180} {
+		if number, op := nativeEndian.Uint32(data[base+8:]), data[base+12]; number != 0xff || op != uint8(XT_U32_AND) {
+			t.Errorf("test at %d: location[1] %#x, nextop %d", base, number, op)
+		}
+		if min := nativeEndian.Uint32(data[base+88:]); min != 1 || data[base+176] != 2 || data[base+177] != 1 {
+			t.Errorf("test at %d: value[0] %d, nnums %d, nvalues %d", base, min, data[base+176], data[base+177])
+		}
+	}
+	if data[1980] != 2 || data[1981] != 1 {
+		t.Errorf("ntests %d, invert %d", data[1980], data[1981])
+	}
+
+	data = payloadOf(t, FamilyIPv4, &BPF{Program: []BPFInstruction{{Code: 6, K: 0xffff}}})
+	if mode, n := nativeEndian.Uint16(data[0:]), nativeEndian.Uint16(data[2:]); mode != XT_BPF_MODE_BYTECODE || n != 1 {
+		t.Errorf("mode %d, bpf_program_num_elem %d", mode, n)
+	}
+	if code, k := nativeEndian.Uint16(data[8:]), nativeEndian.Uint32(data[12:]); code != 6 || k != 0xffff {
+		t.Errorf("bpf_program[0] code %d, k %#x", code, k)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+// Package nstest runs the tests of a package inside new user and network namespaces, where the
+// current user is mapped to root; tables can then be changed without privileges and without
+// affecting the host, as each network namespace has its own tables, counters and xtables lock.
+package nstest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// envMarker is set in the environment of the re-executed test binary.
+const envMarker = "GO_LIBIPTC_NSTEST"
+
+var isolated = os.Getenv(envMarker) != ""
+
+// Main runs the tests inside new user and network namespaces and exits with their status; it is meant
+// to be called by TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		nstest.Main(m)
+//	}
+//
+// The test binary is executed again with the same arguments in the namespaces, where the loopback
+// interface is brought up. When the namespaces cannot be created, for example because unprivileged
+// user namespaces are disabled, tests run in the current process and Require skips them.
+func Main(m *testing.M) {
+	if isolated {
+		if err := loopbackUp(); err != nil {
+			fmt.Fprintf(os.Stderr, "nstest: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(m.Run())
+	}
+
+	code, err := reexec()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nstest: cannot create namespaces, isolated tests will be skipped: %v\n", err)
+		os.Exit(m.Run())
+	}
+	os.Exit(code)
+}
+
+// Isolated returns true when the tests run inside the namespaces created by Main.
+func Isolated() bool {
+	return isolated
+}
+
+// Require skips the test unless it runs inside the namespaces created by Main.
+func Require(t testing.TB) {
+	t.Helper()
+	if !isolated {
+		t.Skip("not running in an isolated network namespace")
+	}
+}
+
+// reexec executes the test binary in new namespaces and returns its exit code.
+func reexec() (int, error) {
+	cmd := exec.Command("/proc/self/exe", os.Args[1:]...)
+	cmd.Args[0] = os.Args[0]
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envMarker+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER,
+		// the network namespace is created once the ID mappings are written, otherwise its /proc/net
+		// files are owned by an unmapped root and cannot be read
+		Unshareflags: syscall.CLONE_NEWNET,
+		UidMappings:  []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:  []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		// setgroups must be denied for an unprivileged user to write the GID mapping
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	err := cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if code := exitErr.ExitCode(); code > 0 {
+			return code, nil
+		}
+		// killed by a signal
+		return 1, nil
+	}
+	return 0, err
+}
+
+// ifreqFlags is struct ifreq as used by SIOCGIFFLAGS and SIOCSIFFLAGS.
+type ifreqFlags struct {
+	name  [syscall.IFNAMSIZ]byte
+	flags uint16
+	_     [22]byte
+}
+
+// loopbackUp brings up the loopback interface, which is down in a new network namespace.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("loopback: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	var req ifreqFlags
+	copy(req.name[:], "lo")
+	if err := ioctl(fd, syscall.SIOCGIFFLAGS, &req); err != nil {
+		return fmt.Errorf("loopback: %v", err)
+	}
+	req.flags |= syscall.IFF_UP
+	if err := ioctl(fd, syscall.SIOCSIFFLAGS, &req); err != nil {
+		return fmt.Errorf("loopback: %v", err)
+	}
+	return nil
+}
+
+func ioctl(fd int, op uintptr, req *ifreqFlags) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), op, uintptr(unsafe.Pointer(req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
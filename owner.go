@@ -0,0 +1,54 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "strings"
+
+// OwnerTagPrefix is the prefix of the comment used to tag the owner of a rule.
+const OwnerTagPrefix = "owner:"
+
+// Owner returns the owner tag carried by one of the rule's comment matches, if any.
+func (r Rule) Owner() (string, bool) {
+	for _, m := range r.Matches {
+		if c, ok := m.(*Comment); ok && strings.HasPrefix(c.Text, OwnerTagPrefix) {
+			return c.Text[len(OwnerTagPrefix):], true
+		}
+	}
+	return "", false
+}
+
+// IsOwnedBy returns true if the rule carries the specified owner tag.
+func (r Rule) IsOwnedBy(owner string) bool {
+	o, ok := r.Owner()
+	return ok && o == owner
+}
+
+// SetOwner tags the rule with the specified owner, replacing any previous owner tag.
+// The tag is a comment match and it is placed first, before any other match.
+func (r *Rule) SetOwner(owner string) {
+	matches := []Match{&Comment{Text: OwnerTagPrefix + owner}}
+	for _, m := range r.Matches {
+		if c, ok := m.(*Comment); ok && strings.HasPrefix(c.Text, OwnerTagPrefix) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	r.Matches = matches
+}
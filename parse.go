@@ -0,0 +1,557 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseError reports an invalid argument of a rule.
+type ParseError struct {
+	// Index is the position of the bad argument, starting from zero.
+	Index int
+	Arg   string
+	Err   error
+}
+
+// Error returns the error message, pointing to the bad argument.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("argument %d %q: %s", e.Index+1, e.Arg, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// optionSpec describes an option of a match or target extension.
+type optionSpec struct {
+	// nargs is the number of values following the option.
+	nargs int
+	// invert is set for options that can be preceded by '!'.
+	invert bool
+}
+
+// parsedOption is an extension option with its values, as found in the arguments.
+type parsedOption struct {
+	name   string
+	not    Not
+	values []string
+	// index is the position of the option name in the arguments
+	index int
+}
+
+// errorf returns a ParseError pointing to the option.
+func (o *parsedOption) errorf(format string, args ...interface{}) error {
+	return &ParseError{Index: o.index, Arg: o.name, Err: fmt.Errorf(format, args...)}
+}
+
+// value returns the first value of the option.
+func (o *parsedOption) value() string {
+	return o.values[0]
+}
+
+type matchParser struct {
+	options map[string]optionSpec
+	parse   func(family Family, opts []parsedOption) (Match, error)
+}
+
+type targetParser struct {
+	options map[string]optionSpec
+	parse   func(family Family, opts []parsedOption) (Target, error)
+}
+
+var (
+	matchParsers  = map[string]matchParser{}
+	targetParsers = map[string]targetParser{}
+)
+
+// registerMatchParser registers the options of a match extension and the function building the match from them.
+func registerMatchParser(name string, options map[string]optionSpec, parse func(family Family, opts []parsedOption) (Match, error)) {
+	if _, ok := matchParsers[name]; ok {
+		panic("match parser already registered: " + name)
+	}
+	matchParsers[name] = matchParser{options, parse}
+}
+
+// registerTargetParser registers the options of a target extension and the function building the target from them.
+func registerTargetParser(name string, options map[string]optionSpec, parse func(family Family, opts []parsedOption) (Target, error)) {
+	if _, ok := targetParsers[name]; ok {
+		panic("target parser already registered: " + name)
+	}
+	targetParsers[name] = targetParser{options, parse}
+}
+
+// parsedExtension collects the options of a match or target while parsing.
+type parsedExtension struct {
+	name string
+	// index is the position of the argument naming the extension, or of the option loading it implicitly
+	index   int
+	options map[string]optionSpec
+	opts    []parsedOption
+}
+
+// ParseRuleString splits s as a shell would, see SplitArgs, and parses the resulting arguments with ParseRule.
+func ParseRuleString(family Family, s string) (*Rule, error) {
+	args, err := SplitArgs(s)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRule(family, args)
+}
+
+// ParseRule parses iptables arguments for family into a rule, like "-s 10.0.0.0/8 -p tcp --dport 22 -j ACCEPT".
+// Chain commands like '-A CHAIN' are not accepted. As iptables does, options of the protocol match are recognized
+// without '-m tcp', and '!' negates the option that follows it. Targets without a registered parser are
+// taken as user-defined chains. Errors are of type *ParseError and point to the bad argument.
+func ParseRule(family Family, args []string) (*Rule, error) {
+	p := ruleParser{family: family, args: args, seen: map[string]bool{}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return &p.rule, nil
+}
+
+type ruleParser struct {
+	family  Family
+	args    []string
+	pos     int
+	rule    Rule
+	seen    map[string]bool
+	matches []*parsedExtension
+	target  *parsedExtension
+}
+
+func (p *ruleParser) errorf(index int, format string, args ...interface{}) error {
+	arg := ""
+	if index < len(p.args) {
+		arg = p.args[index]
+	}
+	return &ParseError{Index: index, Arg: arg, Err: fmt.Errorf(format, args...)}
+}
+
+// next returns the value of the option at index.
+func (p *ruleParser) next(index int) (string, error) {
+	if p.pos >= len(p.args) {
+		return "", p.errorf(index, "option requires an argument")
+	}
+	p.pos++
+	return p.args[p.pos-1], nil
+}
+
+// core option names, with the canonical short form
+var coreOptions = map[string]string{
+	"-s": "-s", "--source": "-s", "--src": "-s",
+	"-d": "-d", "--destination": "-d", "--dst": "-d",
+	"-i": "-i", "--in-interface": "-i",
+	"-o": "-o", "--out-interface": "-o",
+	"-p": "-p", "--protocol": "-p",
+	"-m": "-m", "--match": "-m",
+	"-j": "-j", "--jump": "-j",
+	"-g": "-g", "--goto": "-g",
+	"-c": "-c", "--set-counters": "-c",
+	"-4": "-4", "--ipv4": "-4",
+	"-6": "-6", "--ipv6": "-6",
+	"-f": "-f", "--fragment": "-f",
+}
+
+func (p *ruleParser) parse() error {
+	for p.pos < len(p.args) {
+		index := p.pos
+		arg := p.args[p.pos]
+		p.pos++
+
+		var not Not
+		if arg == "!" {
+			if p.pos >= len(p.args) {
+				return p.errorf(index, "'!' must be followed by an option")
+			}
+			not = true
+			index = p.pos
+			arg = p.args[p.pos]
+			p.pos++
+		}
+
+		if opt, ok := coreOptions[arg]; ok {
+			if err := p.parseCore(index, opt, not); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return p.errorf(index, "unexpected argument")
+		}
+		if err := p.parseExtensionOption(index, arg, not); err != nil {
+			return err
+		}
+	}
+	return p.finish()
+}
+
+func (p *ruleParser) parseCore(index int, opt string, not Not) error {
+	switch opt {
+	case "-m", "-4", "-6", "-f":
+	default:
+		if p.seen[opt] {
+			return p.errorf(index, "option specified more than once")
+		}
+		p.seen[opt] = true
+	}
+	switch opt {
+	case "-s", "-d", "-i", "-o", "-p":
+	default:
+		if not {
+			return p.errorf(index, "option cannot be negated")
+		}
+	}
+
+	switch opt {
+	case "-4", "-6":
+		if (opt == "-4") != (p.family == FamilyIPv4) {
+			return p.errorf(index, "rule is not for %s", p.family)
+		}
+		return nil
+	case "-f":
+		return p.errorf(index, "fragment matching is not supported")
+	case "-c":
+		pcnt, err := p.next(index)
+		if err != nil {
+			return err
+		}
+		bcnt, err := p.next(index)
+		if err != nil {
+			return err
+		}
+		if p.rule.Pcnt, err = strconv.ParseUint(pcnt, 10, 64); err != nil {
+			return p.errorf(index+1, "invalid packet counter")
+		}
+		if p.rule.Bcnt, err = strconv.ParseUint(bcnt, 10, 64); err != nil {
+			return p.errorf(index+2, "invalid byte counter")
+		}
+		return nil
+	}
+
+	value, err := p.next(index)
+	if err != nil {
+		return err
+	}
+	switch opt {
+	case "-s", "-d":
+		n, err := parseFamilyNet(p.family, value)
+		if err != nil {
+			return p.errorf(index+1, "%v", err)
+		}
+		if opt == "-s" {
+			p.rule.Src, p.rule.Not.Src = n, not
+		} else {
+			p.rule.Dest, p.rule.Not.Dest = n, not
+		}
+	case "-i", "-o":
+		if _, _, err := Interface(value).Entry(); err != nil {
+			return p.errorf(index+1, "%v", err)
+		}
+		if opt == "-i" {
+			p.rule.InDev, p.rule.Not.InDev = Interface(value), not
+		} else {
+			p.rule.OutDev, p.rule.Not.OutDev = Interface(value), not
+		}
+	case "-p":
+		proto, err := ParseProto(value)
+		if err != nil {
+			return p.errorf(index+1, "%v", err)
+		}
+		p.rule.Proto, p.rule.Not.Proto = proto, not
+	case "-m":
+		return p.loadMatch(index, value)
+	case "-j", "-g":
+		if p.seen["-j"] && p.seen["-g"] {
+			return p.errorf(index, "both -j and -g specified")
+		}
+		p.rule.Target = value
+		p.rule.Goto = opt == "-g"
+		if tp, ok := targetParsers[value]; ok && opt == "-j" {
+			p.target = &parsedExtension{name: value, index: index + 1, options: tp.options}
+		}
+	}
+	return nil
+}
+
+func (p *ruleParser) loadMatch(index int, name string) error {
+	mp, ok := matchParsers[name]
+	if !ok {
+		return p.errorf(index+1, "unknown match")
+	}
+	p.matches = append(p.matches, &parsedExtension{name: name, index: index + 1, options: mp.options})
+	return nil
+}
+
+// owner returns the extension accepting option name: the target first, then matches from the last one loaded.
+func (p *ruleParser) owner(name string) *parsedExtension {
+	if p.target != nil {
+		if _, ok := p.target.options[name]; ok {
+			return p.target
+		}
+	}
+	for i := len(p.matches) - 1; i >= 0; i-- {
+		if _, ok := p.matches[i].options[name]; ok {
+			return p.matches[i]
+		}
+	}
+	return nil
+}
+
+// implicitMatch returns the name of the match loaded implicitly for the rule protocol, as iptables does.
+func (p *ruleParser) implicitMatch() string {
+	if p.rule.Proto == 0 || p.rule.Not.Proto {
+		return ""
+	}
+	name := ProtoName(p.rule.Proto)
+	if p.rule.Proto == IPPROTO_ICMPV6 {
+		name = "icmp6"
+	}
+	for _, m := range p.matches {
+		if m.name == name {
+			return ""
+		}
+	}
+	if _, ok := matchParsers[name]; !ok {
+		return ""
+	}
+	return name
+}
+
+func (p *ruleParser) parseExtensionOption(index int, arg string, not Not) error {
+	name, inline, hasInline := strings.Cut(arg, "=")
+	ext := p.owner(name)
+	if ext == nil {
+		if implicit := p.implicitMatch(); implicit != "" {
+			p.matches = append(p.matches, &parsedExtension{name: implicit, index: index, options: matchParsers[implicit].options})
+			ext = p.owner(name)
+		}
+	}
+	if ext == nil {
+		return p.errorf(index, "unknown option")
+	}
+	spec := ext.options[name]
+	if not && !Not(spec.invert) {
+		return p.errorf(index, "option cannot be negated")
+	}
+	for _, o := range ext.opts {
+		if o.name == name {
+			return p.errorf(index, "option specified more than once")
+		}
+	}
+
+	o := parsedOption{name: name, not: not, index: index}
+	switch {
+	case hasInline && spec.nargs != 1:
+		return p.errorf(index, "option does not take a single argument")
+	case hasInline:
+		o.values = []string{inline}
+	default:
+		for i := 0; i < spec.nargs; i++ {
+			value, err := p.next(index)
+			if err != nil {
+				return err
+			}
+			o.values = append(o.values, value)
+		}
+	}
+	ext.opts = append(ext.opts, o)
+	return nil
+}
+
+// extensionError points errors not already pointing to an argument to the extension.
+func (p *ruleParser) extensionError(ext *parsedExtension, err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &ParseError{Index: ext.index, Arg: p.args[ext.index], Err: err}
+}
+
+func (p *ruleParser) finish() error {
+	for _, ext := range p.matches {
+		m, err := matchParsers[ext.name].parse(p.family, ext.opts)
+		if err != nil {
+			return p.extensionError(ext, err)
+		}
+		p.rule.Matches = append(p.rule.Matches, m)
+		if pm, ok := m.(ProtocolMatch); ok && (bool(p.rule.Not.Proto) || (p.rule.Proto != 0 && p.rule.Proto != pm.Protocol())) {
+			return p.extensionError(ext, fmt.Errorf("match requires protocol %s", ProtoName(pm.Protocol())))
+		}
+	}
+	if p.target != nil {
+		t, err := targetParsers[p.target.name].parse(p.family, p.target.opts)
+		if err != nil {
+			return p.extensionError(p.target, err)
+		}
+		p.rule.TargetExt = t
+	}
+	return nil
+}
+
+// ParseProto parses a protocol name or number, as accepted by '-p'; "all" is zero.
+func ParseProto(s string) (uint16, error) {
+	switch strings.ToLower(s) {
+	case "all":
+		return 0, nil
+	case "icmpv6":
+		return IPPROTO_ICMPV6, nil
+	}
+	for _, p := range protoNames {
+		if strings.EqualFold(s, p.name) {
+			return p.proto, nil
+		}
+	}
+	proto, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown protocol %q", s)
+	}
+	return uint16(proto), nil
+}
+
+// SplitArgs splits a command line into arguments as a POSIX shell would, handling single quotes, double
+// quotes and backslash escapes; variables and other expansions are not supported. As in iptables-restore,
+// a backslash escapes any character within double quotes, so that lines of iptables-save are read back.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var b strings.Builder
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+			continue
+		case c == '\\':
+			i++
+			if i == len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			b.WriteByte(s[i])
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote at offset %d", i)
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			start := i
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated double quote at offset %d", start)
+			}
+		default:
+			b.WriteByte(c)
+		}
+		inArg = true
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args, nil
+}
+
+// parseUint parses a decimal or hexadecimal ("0x") number of the specified size.
+func parseUint(s string, bitSize int) (uint64, error) {
+	v, err := strconv.ParseUint(s, 0, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return v, nil
+}
+
+// parseValueMask parses "value/mask" or "value", in which case mask is full.
+func parseValueMask(s string, bitSize int) (value, mask uint64, err error) {
+	valueStr, maskStr, hasMask := strings.Cut(s, "/")
+	if value, err = parseUint(valueStr, bitSize); err != nil {
+		return
+	}
+	mask = 1<<uint(bitSize) - 1
+	if hasMask {
+		mask, err = parseUint(maskStr, bitSize)
+	}
+	return
+}
+
+// parsePort parses a port number or a service name.
+func parsePort(s string) (uint16, error) {
+	if port, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return uint16(port), nil
+	}
+	port, err := net.LookupPort("tcp", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(port), nil
+}
+
+// ParsePortRange parses a port or a range in iptables notation, like "22", "1024:65535", ":1023" or "1024:".
+func ParsePortRange(s string) (PortRange, error) {
+	minStr, maxStr, isRange := strings.Cut(s, ":")
+	r := PortRange{0, 0xffff}
+	var err error
+	if minStr != "" || !isRange {
+		if r.Min, err = parsePort(minStr); err != nil {
+			return PortRange{}, err
+		}
+	}
+	if !isRange {
+		r.Max = r.Min
+	} else if maxStr != "" {
+		if r.Max, err = parsePort(maxStr); err != nil {
+			return PortRange{}, err
+		}
+	}
+	if r.Min > r.Max {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return r, nil
+}
+
+// parseRange parses "min[sep max]" as a range of numbers of the specified size.
+func parseRange(s, sep string, bitSize int) (min, max uint64, err error) {
+	minStr, maxStr, isRange := strings.Cut(s, sep)
+	if min, err = strconv.ParseUint(minStr, 10, bitSize); err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	max = min
+	if isRange {
+		if max, err = strconv.ParseUint(maxStr, 10, bitSize); err != nil || min > max {
+			return 0, 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	return min, max, nil
+}
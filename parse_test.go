@@ -0,0 +1,181 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule(FamilyIPv4, []string{"!", "-s", "10.0.0.0/8", "-p", "tcp", "!", "--dport", "22", "--syn", "-j", "ACCEPT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Rule{Src: NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8")), Proto: IPPROTO_TCP, Target: IPTC_LABEL_ACCEPT,
+		Matches: []Match{&TCP{DstPort: &PortRange{22, 22}, FlagsMask: TCPFlagSYN | TCPFlagRST | TCPFlagACK | TCPFlagFIN, FlagsSet: TCPFlagSYN}}}
+	expected.Not.Src = true
+	expected.Matches[0].(*TCP).Not.DstPort = true
+	if !reflect.DeepEqual(*r, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *r)
+	}
+
+	r, err = ParseRuleString(FamilyIPv4, `-m comment --comment "allow 'web'" -g WEB`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Matches) != 1 || r.Matches[0].(*Comment).Text != "allow 'web'" || r.Target != "WEB" || !r.Goto || r.TargetExt != nil {
+		t.Errorf("unexpected rule %+v", *r)
+	}
+
+	r, err = ParseRule(FamilyIPv6, []string{"-p", "ipv6-icmp", "--icmpv6-type", "echo-request", "-j", "REJECT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Matches, []Match{&ICMPv6{Type: 128}}) {
+		t.Errorf("unexpected matches %v", r.Matches)
+	}
+	if !reflect.DeepEqual(r.TargetExt, &Reject6Target{With: IP6T_ICMP6_PORT_UNREACH}) {
+		t.Errorf("unexpected target %v", r.TargetExt)
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		family Family
+		args   []string
+		index  int
+	}{
+		{FamilyIPv4, []string{"-s", "10.0.0.300"}, 1},
+		{FamilyIPv4, []string{"-p", "tcp", "--bogus"}, 2},
+		{FamilyIPv4, []string{"-j"}, 0},
+		{FamilyIPv4, []string{"-p", "tcp", "!", "--syn", "--tcp-flags", "SYN"}, 4},
+		{FamilyIPv4, []string{"-m", "comment", "!", "--comment", "x"}, 3},
+		{FamilyIPv4, []string{"-s", "2001:db8::1"}, 1},
+		{FamilyIPv6, []string{"-p", "icmp", "--icmp-type", "8"}, 2},
+		{FamilyIPv4, []string{"-p", "udp", "-m", "tcp", "--dport", "1"}, 3},
+		{FamilyIPv4, []string{"-m", "limit", "--limit", "fast"}, 2},
+		{FamilyIPv4, []string{"-j", "MARK", "--set-mark", "0x1", "--or-mark", "2"}, 1},
+	} {
+		_, err := ParseRule(tc.family, tc.args)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%v: expected ParseError, got %v", tc.args, err)
+			continue
+		}
+		if perr.Index != tc.index || perr.Arg != tc.args[tc.index] {
+			t.Errorf("%v: expected error at %d, got %v", tc.args, tc.index, perr)
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	v4 := NetFromPrefix(netip.MustParsePrefix("192.168.0.0/16"))
+	v6 := NetFromPrefix(netip.MustParsePrefix("2001:db8::/32"))
+	for _, tc := range []struct {
+		family Family
+		rule   Rule
+	}{
+		{FamilyIPv4, Rule{Src: v4, InDev: "eth+", Proto: IPPROTO_TCP, Target: IPTC_LABEL_ACCEPT,
+			Matches: []Match{&TCP{SrcPort: &PortRange{1024, 65535}, FlagsMask: TCPFlagSYN | TCPFlagACK, FlagsSet: TCPFlagSYN},
+				&Conntrack{Flags: XT_CONNTRACK_STATE, State: ConnStateNew},
+				&Limit{Rate: Rate{3, time.Minute}, Burst: 5}}}},
+		{FamilyIPv4, Rule{Proto: IPPROTO_UDP, Target: "LOGDROP",
+			Matches: []Match{&Multiport{Mode: XT_MULTIPORT_DESTINATION, Ports: []PortRange{{53, 53}, {5353, 5360}}, Not: true},
+				&Recent{Command: XT_RECENT_UPDATE, Seconds: 60, HitCount: 4, List: "dns", Not: true},
+				&Set{SetName: "blacklist", Dirs: []SetDir{SetSrc, SetDst}, NoUpdateCounters: true, Packets: &SetCounter{IPSET_COUNTER_NE, 0}}}}},
+		{FamilyIPv4, Rule{Dest: v4, OutDev: "wg0", Proto: IPPROTO_ICMP,
+			Matches:   []Match{&ICMP{Type: 3, Codes: &ICMPCodes{1, 1}, Not: true}, &String{Algo: "bm", Pattern: []byte("\r\n"), To: 100}},
+			TargetExt: &LogTarget{Level: LogLevelInfo, Prefix: "icmp: ", Flags: XT_LOG_UID}}},
+		{FamilyIPv4, Rule{Matches: []Match{&Owner{UID: &IDRange{1000, 1999}, SocketExists: true}, &TTL{Mode: IPT_TTL_NE, Value: 64}},
+			TargetExt: &ConnMarkTarget{Mode: XT_CONNMARK_RESTORE, NfMask: 0xff, CtMask: 0xff00, ShiftDir: D_SHIFT_RIGHT, ShiftBits: 8}}},
+		{FamilyIPv4, Rule{Matches: []Match{&HashLimit{Table: "ssh", Mode: XT_HASHLIMIT_HASH_SIP | XT_HASHLIMIT_INVERT,
+			Rate: Rate{10, time.Second}, Burst: 20, SrcMask: 24, DstMask: 32}},
+			TargetExt: &NFQueueTarget{Num: 4, Total: 4, Bypass: true}}},
+		{FamilyIPv6, Rule{Dest: v6, Proto: IPPROTO_ICMPV6, Matches: []Match{&ICMPv6{Type: 128, Codes: &ICMPCodes{0, 0}}},
+			TargetExt: &Reject6Target{With: IP6T_ICMP6_ADM_PROHIBITED}}},
+		{FamilyIPv6, Rule{Matches: []Match{&HL{Mode: IP6T_HL_LT, Value: 2}, &ConnLimit{Limit: 16, MaskLen: 64, DstAddr: true, Not: true}},
+			TargetExt: &TProxyTarget{Port: 3128, Addr: netip.MustParseAddr("::1"), Mark: 0x1, Mask: 0x1}}},
+		{FamilyIPv6, Rule{Matches: []Match{&DSCP{DSCP: 0x2e}}, TargetExt: &CTTarget{Helper: "ftp", Zone: 1, ZoneOrig: true}}},
+	} {
+		// as for rules read from the kernel, Target is the name of the extension target
+		if tc.rule.TargetExt != nil {
+			tc.rule.Target = tc.rule.TargetExt.Name()
+		}
+		args, err := tc.rule.Args()
+		if err != nil {
+			t.Errorf("%+v: %v", tc.rule, err)
+			continue
+		}
+		r, err := ParseRule(tc.family, args)
+		if err != nil {
+			t.Errorf("%q: %v", args, err)
+			continue
+		}
+		if !reflect.DeepEqual(*r, tc.rule) {
+			t.Errorf("%q: expected %+v, got %+v", args, tc.rule, *r)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for s, expected := range map[string][]string{
+		`-A INPUT  -j ACCEPT`:       {"-A", "INPUT", "-j", "ACCEPT"},
+		`--comment "a \"b\" c"`:     {"--comment", `a "b" c`},
+		`--comment "it\'s"`:         {"--comment", "it's"},
+		`--log-prefix 'x y: '`:      {"--log-prefix", "x y: "},
+		`--comment ""`:              {"--comment", ""},
+		`a\ b`:                      {"a b"},
+		`--hex-string "|0d0a|"tail`: {"--hex-string", "|0d0a|tail"},
+	} {
+		args, err := SplitArgs(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("%s: expected %q, got %q", s, expected, args)
+		}
+	}
+	for _, s := range []string{`"open`, `'open`, `trailing\`} {
+		if _, err := SplitArgs(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	for s, expected := range map[string]PortRange{"22": {22, 22}, "1024:": {1024, 65535}, ":1023": {0, 1023}, "80:8080": {80, 8080}} {
+		r, err := ParsePortRange(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+		} else if r != expected {
+			t.Errorf("%s: expected %v, got %v", s, expected, r)
+		}
+	}
+	for _, s := range []string{"8080:80", "65536", "a:b:c"} {
+		if _, err := ParsePortRange(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RuleID is the identity of a rule, which unlike its number does not change when other rules of the chain
+// are inserted or deleted.
+type RuleID struct {
+	Chain XtChainLabel `json:"chain" yaml:"chain"`
+	// Tag is the text of the first comment match of the rule that is not an owner tag; rules without
+	// such comment are identified by Hash instead.
+	Tag  string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Hash string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	// Occurrence tells apart the rules of the chain with the same tag or content, starting at 0 in chain order.
+	Occurrence int `json:"occurrence,omitempty" yaml:"occurrence,omitempty"`
+}
+
+// String returns the identity as "CHAIN/comment:TAG" or "CHAIN/HASH", followed by "#OCCURRENCE" if not zero.
+func (id RuleID) String() string {
+	s := string(id.Chain) + "/"
+	if id.Tag != "" {
+		s += "comment:" + id.Tag
+	} else {
+		s += id.Hash
+	}
+	if id.Occurrence != 0 {
+		s += fmt.Sprintf("#%d", id.Occurrence)
+	}
+	return s
+}
+
+// Identity returns the identity of a rule of chain, with a zero Occurrence. The hash of rules without
+// comments is computed on the key of the rule for family, thus it does not depend on counters.
+func (r Rule) Identity(family Family, chain XtChainLabel) (RuleID, error) {
+	for _, m := range r.Matches {
+		if c, ok := m.(*Comment); ok && !strings.HasPrefix(c.Text, OwnerTagPrefix) {
+			return RuleID{Chain: chain, Tag: c.Text}, nil
+		}
+	}
+	k, err := r.Key(family)
+	if err != nil {
+		return RuleID{}, err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s %s %s %d %v %q %t %q %q", k.Src, k.Dest, k.InDev, k.OutDev, k.Proto, k.Not,
+		k.Target, k.Goto, k.Matches, k.TargetExt)
+	return RuleID{Chain: chain, Hash: hex.EncodeToString(h.Sum(nil)[:8])}, nil
+}
+
+// CounterRate is the increase of counters over an interval.
+type CounterRate struct {
+	Delta XtCounters `json:"delta" yaml:"delta"`
+	// PacketsPerSecond and BytesPerSecond are zero when the interval is.
+	PacketsPerSecond float64 `json:"packets_per_second" yaml:"packets_per_second"`
+	BytesPerSecond   float64 `json:"bytes_per_second" yaml:"bytes_per_second"`
+}
+
+func newCounterRate(delta XtCounters, interval time.Duration) CounterRate {
+	r := CounterRate{Delta: delta}
+	if interval > 0 {
+		r.PacketsPerSecond = float64(delta.Pcnt) / interval.Seconds()
+		r.BytesPerSecond = float64(delta.Bcnt) / interval.Seconds()
+	}
+	return r
+}
+
+// counterDelta returns the increase from previous to current counters; counters that decreased were
+// zeroed or replaced in between, and current ones are taken as the increase.
+func counterDelta(previous, current XtCounters) XtCounters {
+	if current.Pcnt < previous.Pcnt || current.Bcnt < previous.Bcnt {
+		return current
+	}
+	return XtCounters{Pcnt: current.Pcnt - previous.Pcnt, Bcnt: current.Bcnt - previous.Bcnt}
+}
+
+// RuleDelta is the increase of the counters of a rule since the previous poll.
+type RuleDelta struct {
+	ID RuleID `json:"id" yaml:"id"`
+	// Num is the position of the rule in its chain, starting at 1.
+	Num uint `json:"num" yaml:"num"`
+	// Rule is the rule as polled, with its absolute counters.
+	Rule *Rule `json:"rule" yaml:"rule"`
+	// New is set for rules that were not present at the previous poll, whose CounterRate is zero.
+	New         bool `json:"new,omitempty" yaml:"new,omitempty"`
+	CounterRate `yaml:",inline"`
+}
+
+// ChainDelta is the increase of the counters of a chain since the previous poll.
+type ChainDelta struct {
+	Chain XtChainLabel `json:"chain" yaml:"chain"`
+	// Policy is the increase of the policy counters of a built-in chain, zero for user-defined chains.
+	Policy CounterRate `json:"policy" yaml:"policy"`
+	// Rules is the sum of the increases of the rules of the chain, except new ones.
+	Rules CounterRate `json:"rules" yaml:"rules"`
+}
+
+// CounterDeltas are the increases of the counters of a table between two polls.
+type CounterDeltas struct {
+	Table  string    `json:"table" yaml:"table"`
+	Family Family    `json:"family" yaml:"family"`
+	Time   time.Time `json:"time" yaml:"time"`
+	// Interval is the time elapsed since the previous poll, zero for the first one.
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// Rules and Chains are in the order of the table.
+	Rules  []RuleDelta  `json:"rules" yaml:"rules"`
+	Chains []ChainDelta `json:"chains" yaml:"chains"`
+}
+
+// Poller snapshots the counters of a table and computes their increases between snapshots. Rules are
+// tracked by RuleID, thus their deltas are correct when other rules are inserted or deleted in between.
+// A Poller must not be used concurrently.
+type Poller struct {
+	open func() (Handle, error)
+
+	last   time.Time
+	rules  map[RuleID]XtCounters
+	chains map[XtChainLabel]XtCounters
+}
+
+// NewPoller returns a poller that gets a new handle of the table with open at each poll; a handle only
+// reads counters when initialized. The handle is freed after the poll.
+func NewPoller(open func() (Handle, error)) *Poller {
+	return &Poller{open: open}
+}
+
+// Poll snapshots the counters and returns their increases since the previous poll. At the first poll all
+// rules are new.
+func (p *Poller) Poll() (*CounterDeltas, error) {
+	h, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	table, err := h.Snapshot()
+	h.Free()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &CounterDeltas{Table: table.Name, Family: table.Family, Time: time.Now()}
+	if !p.last.IsZero() {
+		d.Interval = d.Time.Sub(p.last)
+	}
+	rules := map[RuleID]XtCounters{}
+	chains := map[XtChainLabel]XtCounters{}
+	for _, c := range table.Chains {
+		occurrences := map[RuleID]int{}
+		var sum XtCounters
+		for i, r := range c.Rules {
+			id, err := r.Identity(table.Family, c.Name)
+			if err != nil {
+				return nil, fmt.Errorf("chain %s: rule %d: %v", c.Name, i+1, err)
+			}
+			id.Occurrence = occurrences[id]
+			occurrences[id]++
+			rules[id] = r.XtCounters
+
+			rd := RuleDelta{ID: id, Num: uint(i + 1), Rule: r}
+			if previous, ok := p.rules[id]; ok {
+				rd.CounterRate = newCounterRate(counterDelta(previous, r.XtCounters), d.Interval)
+				sum.Pcnt += rd.Delta.Pcnt
+				sum.Bcnt += rd.Delta.Bcnt
+			} else {
+				rd.New = true
+			}
+			d.Rules = append(d.Rules, rd)
+		}
+
+		cd := ChainDelta{Chain: c.Name, Rules: newCounterRate(sum, d.Interval)}
+		if c.IsBuiltin() {
+			if previous, ok := p.chains[c.Name]; ok {
+				cd.Policy = newCounterRate(counterDelta(previous, c.Counters), d.Interval)
+			}
+			chains[c.Name] = c.Counters
+		}
+		d.Chains = append(d.Chains, cd)
+	}
+
+	p.last, p.rules, p.chains = d.Time, rules, chains
+	return d, nil
+}
+
+// Run polls every interval and sends the deltas on ch until ctx is done or a poll fails, returning the
+// cause; ch is closed on return. A first poll is made when Run starts if there was none, and is not sent.
+func (p *Poller) Run(ctx context.Context, interval time.Duration, ch chan<- *CounterDeltas) error {
+	defer close(ch)
+	if p.last.IsZero() {
+		if _, err := p.Poll(); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		d, err := p.Poll()
+		if err != nil {
+			return err
+		}
+		select {
+		case ch <- d:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRuleIdentity(t *testing.T) {
+	src := NetFromPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+	tagged := Rule{Src: src, Matches: []Match{&Comment{Text: "ssh"}}, Target: IPTC_LABEL_ACCEPT}
+	tagged.SetOwner("test")
+	id, err := tagged.Identity(FamilyIPv4, "INPUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != (RuleID{Chain: "INPUT", Tag: "ssh"}) || id.String() != "INPUT/comment:ssh" {
+		t.Errorf("unexpected identity %#v", id)
+	}
+
+	// owner tags do not identify rules, which are then hashed
+	owned := Rule{Src: src, Target: IPTC_LABEL_ACCEPT}
+	owned.SetOwner("test")
+	ownedID, err := owned.Identity(FamilyIPv4, "INPUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ownedID.Tag != "" || len(ownedID.Hash) != 16 {
+		t.Errorf("unexpected identity %#v", ownedID)
+	}
+
+	rule := Rule{Src: src, Matches: []Match{&UDP{}}, Target: IPTC_LABEL_ACCEPT}
+	ruleID, err := rule.Identity(FamilyIPv4, "INPUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// counters are not part of the identity, while the implied protocol is
+	counted := rule
+	counted.Proto, counted.XtCounters = IPPROTO_UDP, XtCounters{Pcnt: 1, Bcnt: 100}
+	if id, _ := counted.Identity(FamilyIPv4, "INPUT"); id != ruleID {
+		t.Errorf("expected identity %v, got %v", ruleID, id)
+	}
+	for _, other := range []Rule{
+		{Src: src, Matches: []Match{&UDP{}}, Target: IPTC_LABEL_DROP},
+		{Dest: src, Matches: []Match{&UDP{}}, Target: IPTC_LABEL_ACCEPT},
+		{Src: src, Matches: []Match{&TCP{}}, Target: IPTC_LABEL_ACCEPT},
+	} {
+		if id, _ := other.Identity(FamilyIPv4, "INPUT"); id == ruleID || id == ownedID {
+			t.Errorf("rule %v has identity %v", other, id)
+		}
+	}
+	if id, _ := rule.Identity(FamilyIPv4, "OUTPUT"); id.Hash != ruleID.Hash || id == ruleID {
+		t.Errorf("unexpected identity %v in another chain", id)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+#include <errno.h>
+#include <stddef.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+#include <sys/socket.h>
+#include <netinet/in.h>
+#include <linux/netfilter_ipv6/ip6_tables.h>
+
+#include "rawtable.h"
+
+_Static_assert(sizeof(struct ipt_getinfo) == sizeof(struct ip6t_getinfo), "getinfo layout mismatch");
+_Static_assert(offsetof(struct ipt_get_entries, entrytable) == offsetof(struct ip6t_get_entries, entrytable), "get_entries layout mismatch");
+_Static_assert(offsetof(struct ipt_replace, entries) == offsetof(struct ip6t_replace, entries), "replace layout mismatch");
+_Static_assert(sizeof(struct ipt_replace) == sizeof(struct ip6t_replace), "replace layout mismatch");
+
+// opens the raw socket used for the getsockopt()/setsockopt() interface of iptables and ip6tables
+static int raw_socket(int family, int *level) {
+	*level = family == AF_INET6 ? IPPROTO_IPV6 : IPPROTO_IP;
+	return socket(family, SOCK_RAW, IPPROTO_RAW);
+}
+
+// close() must not clobber errno of a failed request
+static int raw_close(int sockfd, int ret) {
+	int saved_errno = errno;
+	close(sockfd);
+	errno = saved_errno;
+	return ret;
+}
+
+int xt_raw_get_info(int family, struct ipt_getinfo *info) {
+	int level;
+	int sockfd = raw_socket(family, &level);
+	if (sockfd < 0)
+		return -1;
+
+	socklen_t size = sizeof(*info);
+	int ret = getsockopt(sockfd, level, family == AF_INET6 ? IP6T_SO_GET_INFO : IPT_SO_GET_INFO, info, &size);
+	return raw_close(sockfd, ret);
+}
+
+// size must be the one returned by xt_raw_get_info(); EAGAIN is reported if the table changed in between
+int xt_raw_get_entries(int family, const char *name, void *entries, unsigned int size) {
+	int level;
+	int sockfd = raw_socket(family, &level);
+	if (sockfd < 0)
+		return -1;
+
+	socklen_t len = offsetof(struct ipt_get_entries, entrytable) + size;
+	struct ipt_get_entries *req = calloc(1, len);
+	if (req == NULL)
+		return raw_close(sockfd, -1);
+	strncpy(req->name, name, XT_TABLE_MAXNAMELEN - 1);
+	req->size = size;
+
+	int ret = getsockopt(sockfd, level, family == AF_INET6 ? IP6T_SO_GET_ENTRIES : IPT_SO_GET_ENTRIES, req, &len);
+	if (ret == 0 && req->size != size) {
+		errno = EAGAIN;
+		ret = -1;
+	}
+	if (ret == 0)
+		memcpy(entries, req->entrytable, size);
+	free(req);
+	return raw_close(sockfd, ret);
+}
+
+// num_counters must be the number of entries of the table being replaced, whose counters are returned by the kernel
+int xt_raw_replace(int family, const struct ipt_getinfo *info, const void *entries, unsigned int num_counters) {
+	int level;
+	int sockfd = raw_socket(family, &level);
+	if (sockfd < 0)
+		return -1;
+
+	socklen_t len = sizeof(struct ipt_replace) + info->size;
+	struct ipt_replace *repl = calloc(1, len);
+	struct xt_counters *counters = calloc(num_counters ? num_counters : 1, sizeof(struct xt_counters));
+	int ret = -1;
+	if (repl != NULL && counters != NULL) {
+		strncpy(repl->name, info->name, XT_TABLE_MAXNAMELEN - 1);
+		repl->valid_hooks = info->valid_hooks;
+		repl->num_entries = info->num_entries;
+		repl->size = info->size;
+		memcpy(repl->hook_entry, info->hook_entry, sizeof(repl->hook_entry));
+		memcpy(repl->underflow, info->underflow, sizeof(repl->underflow));
+		repl->num_counters = num_counters;
+		repl->counters = counters;
+		memcpy(repl->entries, entries, info->size);
+
+		ret = setsockopt(sockfd, level, family == AF_INET6 ? IP6T_SO_SET_REPLACE : IPT_SO_SET_REPLACE, repl, len);
+	} else {
+		errno = ENOMEM;
+	}
+	free(counters);
+	free(repl);
+	return raw_close(sockfd, ret);
+}
+
+int xt_raw_add_counters(int family, const char *name, const struct xt_counters *counters, unsigned int num_counters) {
+	int level;
+	int sockfd = raw_socket(family, &level);
+	if (sockfd < 0)
+		return -1;
+
+	socklen_t len = sizeof(struct xt_counters_info) + num_counters * sizeof(struct xt_counters);
+	struct xt_counters_info *req = calloc(1, len);
+	if (req == NULL)
+		return raw_close(sockfd, -1);
+	strncpy(req->name, name, XT_TABLE_MAXNAMELEN - 1);
+	req->num_counters = num_counters;
+	memcpy(req->counters, counters, num_counters * sizeof(struct xt_counters));
+
+	int ret = setsockopt(sockfd, level, family == AF_INET6 ? IP6T_SO_SET_ADD_COUNTERS : IPT_SO_SET_ADD_COUNTERS, req, len);
+	free(req);
+	return raw_close(sockfd, ret);
+}
+
+// succeeds when the requested revision is supported, returning the highest revision of the extension on
+// kernels which report it and 0 on the others; the kernel reports EPROTONOSUPPORT for unknown revisions
+// and ENOENT for unknown extensions
+int xt_raw_get_revision(int family, int target, const char *name, unsigned char revision) {
+	int level;
+	int sockfd = raw_socket(family, &level);
+	if (sockfd < 0)
+		return -1;
+
+	struct xt_get_revision rev;
+	memset(&rev, 0, sizeof(rev));
+	strncpy(rev.name, name, XT_EXTENSION_MAXNAMELEN - 1);
+	rev.revision = revision;
+
+	int opt;
+	if (family == AF_INET6)
+		opt = target ? IP6T_SO_GET_REVISION_TARGET : IP6T_SO_GET_REVISION_MATCH;
+	else
+		opt = target ? IPT_SO_GET_REVISION_TARGET : IPT_SO_GET_REVISION_MATCH;
+	socklen_t size = sizeof(rev);
+	int ret = getsockopt(sockfd, level, opt, &rev, &size);
+	return raw_close(sockfd, ret);
+}
@@ -0,0 +1,337 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	// #include <sys/socket.h>
+	// #include "rawtable.h"
+	"C"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// the constants are copied from the nf_inet_hooks enum in netfilter.h
+	NF_INET_PRE_ROUTING  = 0
+	NF_INET_LOCAL_IN     = 1
+	NF_INET_FORWARD      = 2
+	NF_INET_LOCAL_OUT    = 3
+	NF_INET_POST_ROUTING = 4
+	NF_INET_NUMHOOKS     = 5
+
+	// the constants are copied from #define declarations in x_tables.h
+	XT_TABLE_MAXNAMELEN = 32
+	XT_ERROR_TARGET     = "ERROR"
+	XT_STANDARD_TARGET  = ""
+)
+
+// rawEntryLayout describes struct ipt_entry and struct ip6t_entry, which only differ in the size of
+// the address part; offsets are those of target_offset, next_offset and counters.
+type rawEntryLayout struct {
+	size, targetOffset, nextOffset, counters int
+}
+
+var rawEntryLayouts = map[Family]rawEntryLayout{
+	FamilyIPv4: {size: 112, targetOffset: 88, nextOffset: 90, counters: 96},
+	FamilyIPv6: {size: 168, targetOffset: 140, nextOffset: 142, counters: 152},
+}
+
+// RawTable is the kernel representation of a table, as read with IPT_SO_GET_ENTRIES and installed
+// with IPT_SO_SET_REPLACE. Entries are in the layout and byte order of the host that exported them.
+type RawTable struct {
+	Family Family
+	Name   string
+	// ValidHooks is a bitmask of the hooks, like 1<<NF_INET_LOCAL_IN, to which the table is attached.
+	ValidHooks uint32
+	// HookEntry and Underflow are the offsets in Entries of the first and of the policy entry of each built-in chain.
+	HookEntry  [NF_INET_NUMHOOKS]uint32
+	Underflow  [NF_INET_NUMHOOKS]uint32
+	NumEntries uint32
+	Entries    []byte
+}
+
+// ExportRaw reads the kernel representation of a table, including counters.
+func ExportRaw(family Family, table string) (*RawTable, error) {
+	cFamily, err := socketFamily(family)
+	if err != nil {
+		return nil, err
+	}
+	if table == "" || len(table) >= XT_TABLE_MAXNAMELEN {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	// entries are read with a second request, which fails with EAGAIN when the table changed in between
+	for attempt := 1; ; attempt++ {
+		info, err := rawInfo(cFamily, table)
+		if err != nil {
+			return nil, fmt.Errorf("%s table %s: %v", family, table, err)
+		}
+		ti := newTableInfo(&info)
+		t := &RawTable{Family: family, Name: table, ValidHooks: ti.ValidHooks, HookEntry: ti.HookEntry, Underflow: ti.Underflow,
+			NumEntries: ti.NumEntries, Entries: make([]byte, ti.Size)}
+
+		var entries unsafe.Pointer
+		if len(t.Entries) != 0 {
+			entries = unsafe.Pointer(&t.Entries[0])
+		}
+		if r, err := C.xt_raw_get_entries(cFamily, &info.name[0], entries, info.size); r != 0 {
+			if errors.Is(err, syscall.EAGAIN) && attempt < 3 {
+				continue
+			}
+			return nil, fmt.Errorf("%s table %s: %v", family, table, err)
+		}
+		return t, nil
+	}
+}
+
+// ImportRaw validates a table and atomically replaces the kernel one with the same name, as a libiptc commit
+// does. Counters are then restored from the entries; this last step is not atomic, and its failure is reported
+// after the table has been replaced. The caller should hold the xtables lock, see XtablesLock.
+func ImportRaw(t *RawTable) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	cFamily, _ := socketFamily(t.Family)
+
+	var info C.struct_ipt_getinfo
+	for i := 0; i < len(t.Name); i++ {
+		info.name[i] = C.char(t.Name[i])
+	}
+	info.valid_hooks = C.uint(t.ValidHooks)
+	info.num_entries = C.uint(t.NumEntries)
+	info.size = C.uint(len(t.Entries))
+	for i := range t.HookEntry {
+		info.hook_entry[i] = C.uint(t.HookEntry[i])
+		info.underflow[i] = C.uint(t.Underflow[i])
+	}
+
+	// the kernel returns the counters of the replaced table, which must have the expected number of entries
+	for attempt := 1; ; attempt++ {
+		old, err := rawInfo(cFamily, t.Name)
+		if err != nil {
+			return fmt.Errorf("%s table %s: %v", t.Family, t.Name, err)
+		}
+		r, err := C.xt_raw_replace(cFamily, &info, unsafe.Pointer(&t.Entries[0]), old.num_entries)
+		if r == 0 {
+			break
+		}
+		if errors.Is(err, syscall.EAGAIN) && attempt < 3 {
+			continue
+		}
+		return fmt.Errorf("%s table %s: %v", t.Family, t.Name, err)
+	}
+
+	// XtCounters has the layout of struct xt_counters
+	counters := t.Counters()
+	if r, err := C.xt_raw_add_counters(cFamily, &info.name[0], (*C.struct_xt_counters)(unsafe.Pointer(&counters[0])), C.uint(len(counters))); r != 0 {
+		return fmt.Errorf("%s table %s: replaced, but counters could not be restored: %v", t.Family, t.Name, err)
+	}
+	return nil
+}
+
+// socketFamily returns the address family of the sockets used to exchange tables of family with the kernel.
+func socketFamily(family Family) (C.int, error) {
+	switch family {
+	case FamilyIPv4:
+		return C.AF_INET, nil
+	case FamilyIPv6:
+		return C.AF_INET6, nil
+	}
+	return 0, fmt.Errorf("invalid family %d", uint8(family))
+}
+
+// rawInfo requests IPT_SO_GET_INFO or IP6T_SO_GET_INFO for a table.
+func rawInfo(cFamily C.int, table string) (info C.struct_ipt_getinfo, err error) {
+	for i := 0; i < len(table); i++ {
+		info.name[i] = C.char(table[i])
+	}
+	if r, cErr := C.xt_raw_get_info(cFamily, &info); r != 0 {
+		err = cErr
+	}
+	return
+}
+
+// Validate checks that entries are well-formed and consistent with the other fields; the kernel
+// performs further checks, like the ones on extensions and loops, when the table is installed.
+func (t *RawTable) Validate() error {
+	layout, ok := rawEntryLayouts[t.Family]
+	if !ok {
+		return fmt.Errorf("invalid family %d", uint8(t.Family))
+	}
+	if t.Name == "" || len(t.Name) >= XT_TABLE_MAXNAMELEN {
+		return fmt.Errorf("invalid table name %q", t.Name)
+	}
+	if t.ValidHooks == 0 || t.ValidHooks>>NF_INET_NUMHOOKS != 0 {
+		return fmt.Errorf("table %s: invalid hooks %#x", t.Name, t.ValidHooks)
+	}
+
+	if len(t.Entries) == 0 {
+		return fmt.Errorf("table %s: no entries", t.Name)
+	}
+
+	offsets := map[uint32]bool{}
+	var last int
+	n := uint32(0)
+	for off := 0; off < len(t.Entries); n++ {
+		if off+layout.size > len(t.Entries) {
+			return fmt.Errorf("table %s: entry %d at %d is truncated", t.Name, n, off)
+		}
+		targetOffset := int(nativeEndian.Uint16(t.Entries[off+layout.targetOffset:]))
+		nextOffset := int(nativeEndian.Uint16(t.Entries[off+layout.nextOffset:]))
+		if targetOffset < layout.size || targetOffset+extensionHeaderSize > nextOffset ||
+			nextOffset%extensionAlign != 0 || off+nextOffset > len(t.Entries) {
+			return fmt.Errorf("table %s: entry %d at %d has invalid offsets %d and %d", t.Name, n, off, targetOffset, nextOffset)
+		}
+		offsets[uint32(off)] = true
+		last = off
+		off += nextOffset
+	}
+	if n != t.NumEntries {
+		return fmt.Errorf("table %s: %d entries found, %d expected", t.Name, n, t.NumEntries)
+	}
+	for hook := 0; hook < NF_INET_NUMHOOKS; hook++ {
+		if t.ValidHooks&(1<<uint(hook)) == 0 {
+			continue
+		}
+		if !offsets[t.HookEntry[hook]] || !offsets[t.Underflow[hook]] || t.HookEntry[hook] > t.Underflow[hook] {
+			return fmt.Errorf("table %s: invalid entry or underflow offset for hook %d", t.Name, hook)
+		}
+	}
+
+	// as libiptc does, tables end with an ERROR target
+	name := t.Entries[last+int(nativeEndian.Uint16(t.Entries[last+layout.targetOffset:]))+2:]
+	if cString(name[:XT_EXTENSION_MAXNAMELEN]) != XT_ERROR_TARGET {
+		return fmt.Errorf("table %s: last entry is not an %s target", t.Name, XT_ERROR_TARGET)
+	}
+	return nil
+}
+
+// Counters returns the counters of all entries, in order; entries must be valid.
+func (t *RawTable) Counters() []XtCounters {
+	layout := rawEntryLayouts[t.Family]
+	counters := make([]XtCounters, 0, t.NumEntries)
+	for off := 0; off < len(t.Entries); off += int(nativeEndian.Uint16(t.Entries[off+layout.nextOffset:])) {
+		counters = append(counters, XtCounters{
+			Pcnt: nativeEndian.Uint64(t.Entries[off+layout.counters:]),
+			Bcnt: nativeEndian.Uint64(t.Entries[off+layout.counters+8:]),
+		})
+	}
+	return counters
+}
+
+const (
+	// rawTableMagic starts the files written by MarshalBinary.
+	rawTableMagic = "XTRAWTBL"
+	// rawTableVersion is incremented when the file format changes.
+	rawTableVersion = 1
+	// rawTableBigEndian is set in the header flags when entries are big-endian.
+	rawTableBigEndian = 1 << 0
+)
+
+// rawTableHeader is the header of the files written by MarshalBinary; it is little-endian, and followed
+// by the entries and a CRC-32 (IEEE) of all the previous bytes.
+type rawTableHeader struct {
+	Magic      [8]byte
+	Version    uint16
+	Family     uint8
+	Flags      uint8
+	Name       [XT_TABLE_MAXNAMELEN]byte
+	ValidHooks uint32
+	HookEntry  [NF_INET_NUMHOOKS]uint32
+	Underflow  [NF_INET_NUMHOOKS]uint32
+	NumEntries uint32
+	Size       uint32
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, returning a versioned file format suitable for storage.
+func (t *RawTable) MarshalBinary() ([]byte, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	h := rawTableHeader{
+		Version:    rawTableVersion,
+		Family:     uint8(t.Family),
+		ValidHooks: t.ValidHooks,
+		HookEntry:  t.HookEntry,
+		Underflow:  t.Underflow,
+		NumEntries: t.NumEntries,
+		Size:       uint32(len(t.Entries)),
+	}
+	copy(h.Magic[:], rawTableMagic)
+	copy(h.Name[:], t.Name)
+	if nativeEndian == binary.ByteOrder(binary.BigEndian) {
+		h.Flags |= rawTableBigEndian
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	buf.Write(t.Entries)
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, as the counterpart of MarshalBinary; tables
+// exported on hosts with a different byte order are rejected.
+func (t *RawTable) UnmarshalBinary(data []byte) error {
+	var h rawTableHeader
+	headerSize := binary.Size(&h)
+	if len(data) < headerSize+4 || string(data[:len(rawTableMagic)]) != rawTableMagic {
+		return errors.New("not a raw table file")
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	if h.Version != rawTableVersion {
+		return fmt.Errorf("unsupported raw table file version %d", h.Version)
+	}
+	if len(data) != headerSize+int(h.Size)+4 {
+		return fmt.Errorf("raw table file has %d bytes, %d expected", len(data), headerSize+int(h.Size)+4)
+	}
+	if crc32.ChecksumIEEE(data[:len(data)-4]) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return errors.New("raw table file checksum mismatch")
+	}
+	if (h.Flags&rawTableBigEndian != 0) != (nativeEndian == binary.ByteOrder(binary.BigEndian)) {
+		return errors.New("raw table file was exported on a host with a different byte order")
+	}
+
+	raw := RawTable{
+		Family:     Family(h.Family),
+		Name:       cString(h.Name[:]),
+		ValidHooks: h.ValidHooks,
+		HookEntry:  h.HookEntry,
+		Underflow:  h.Underflow,
+		NumEntries: h.NumEntries,
+		Entries:    append([]byte(nil), data[headerSize:headerSize+int(h.Size)]...),
+	}
+	if err := raw.Validate(); err != nil {
+		return err
+	}
+	*t = raw
+	return nil
+}
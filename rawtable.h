@@ -0,0 +1,28 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+#include <linux/netfilter/x_tables.h>
+#include <linux/netfilter_ipv4/ip_tables.h>
+
+// IPv6 structures share the layout of the IPv4 ones, except for entries
+int xt_raw_get_info(int family, struct ipt_getinfo *info);
+int xt_raw_get_entries(int family, const char *name, void *entries, unsigned int size);
+int xt_raw_replace(int family, const struct ipt_getinfo *info, const void *entries, unsigned int num_counters);
+int xt_raw_add_counters(int family, const char *name, const struct xt_counters *counters, unsigned int num_counters);
+int xt_raw_get_revision(int family, int target, const char *name, unsigned char revision);
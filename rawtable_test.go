@@ -0,0 +1,113 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rawEntry returns an entry with an empty address part and a target with the specified name and payload size.
+func rawEntry(family Family, target string, payloadSize int, counters XtCounters) []byte {
+	layout := rawEntryLayouts[family]
+	targetSize := xtAlign(extensionHeaderSize + payloadSize)
+	entry := make([]byte, layout.size+targetSize)
+	nativeEndian.PutUint16(entry[layout.targetOffset:], uint16(layout.size))
+	nativeEndian.PutUint16(entry[layout.nextOffset:], uint16(len(entry)))
+	nativeEndian.PutUint64(entry[layout.counters:], counters.Pcnt)
+	nativeEndian.PutUint64(entry[layout.counters+8:], counters.Bcnt)
+	nativeEndian.PutUint16(entry[layout.size:], uint16(targetSize))
+	copy(entry[layout.size+2:], target)
+	return entry
+}
+
+// rawFilterTable returns a table with the INPUT, FORWARD and OUTPUT policies only, as an empty filter table.
+func rawFilterTable(family Family) *RawTable {
+	t := &RawTable{Family: family, Name: "filter",
+		ValidHooks: 1<<NF_INET_LOCAL_IN | 1<<NF_INET_FORWARD | 1<<NF_INET_LOCAL_OUT, NumEntries: 4}
+	for i, hook := range []int{NF_INET_LOCAL_IN, NF_INET_FORWARD, NF_INET_LOCAL_OUT} {
+		t.HookEntry[hook] = uint32(len(t.Entries))
+		t.Underflow[hook] = uint32(len(t.Entries))
+		t.Entries = append(t.Entries, rawEntry(family, XT_STANDARD_TARGET, 4, XtCounters{uint64(i), uint64(i * 100)})...)
+	}
+	t.Entries = append(t.Entries, rawEntry(family, XT_ERROR_TARGET, 30, XtCounters{})...)
+	return t
+}
+
+func TestRawTable(t *testing.T) {
+	for _, family := range []Family{FamilyIPv4, FamilyIPv6} {
+		table := rawFilterTable(family)
+		if err := table.Validate(); err != nil {
+			t.Fatalf("%s: %v", family, err)
+		}
+		expected := []XtCounters{{0, 0}, {1, 100}, {2, 200}, {0, 0}}
+		if counters := table.Counters(); !reflect.DeepEqual(counters, expected) {
+			t.Errorf("%s: expected counters %v, got %v", family, expected, counters)
+		}
+
+		data, err := table.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", family, err)
+		}
+		var decoded RawTable
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", family, err)
+		}
+		if !reflect.DeepEqual(&decoded, table) {
+			t.Errorf("%s: expected %+v, got %+v", family, table, decoded)
+		}
+
+		corrupted := append([]byte(nil), data...)
+		corrupted[len(corrupted)/2] ^= 0xff
+		if err := decoded.UnmarshalBinary(corrupted); err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("%s: corrupted file: unexpected error %v", family, err)
+		}
+		if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Errorf("%s: truncated file decoded", family)
+		}
+		future := append([]byte(nil), data...)
+		future[8] = rawTableVersion + 1
+		if err := decoded.UnmarshalBinary(future); err == nil || !strings.Contains(err.Error(), "version") {
+			t.Errorf("%s: future version: unexpected error %v", family, err)
+		}
+	}
+}
+
+func TestRawTableValidate(t *testing.T) {
+	for name, corrupt := range map[string]func(*RawTable){
+		"entry count":     func(t *RawTable) { t.NumEntries = 3 },
+		"hook offset":     func(t *RawTable) { t.HookEntry[NF_INET_FORWARD] += 8 },
+		"unknown hook":    func(t *RawTable) { t.ValidHooks |= 1 << NF_INET_NUMHOOKS },
+		"truncated":       func(t *RawTable) { t.Entries = t.Entries[:len(t.Entries)-8] },
+		"family":          func(t *RawTable) { t.Family = FamilyIPv6 },
+		"name":            func(t *RawTable) { t.Name = "" },
+		"no error target": func(t *RawTable) { copy(t.Entries[len(t.Entries)-64+2:], "FOO\x00\x00") },
+		"next offset": func(t *RawTable) {
+			nativeEndian.PutUint16(t.Entries[rawEntryLayouts[FamilyIPv4].nextOffset:], 4)
+		},
+	} {
+		table := rawFilterTable(FamilyIPv4)
+		corrupt(table)
+		if err := table.Validate(); err == nil {
+			t.Errorf("%s: invalid table validated", name)
+		}
+	}
+}
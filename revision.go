@@ -0,0 +1,315 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	// #include <stdlib.h>
+	// #include "rawtable.h"
+	"C"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// ExtensionKind tells matches from targets, which are registered separately by the kernel.
+type ExtensionKind uint8
+
+const (
+	ExtensionMatch ExtensionKind = iota
+	ExtensionTarget
+)
+
+// String returns "match" or "target".
+func (k ExtensionKind) String() string {
+	if k == ExtensionTarget {
+		return "target"
+	}
+	return "match"
+}
+
+// RevisionSelector is implemented by extensions which can be encoded with several revisions of their
+// payload layout; rules are installed with the highest one supported by both the library and the kernel.
+type RevisionSelector interface {
+	// Revisions returns the revisions which may be used, from the preferred one.
+	Revisions() []uint8
+	// EncodeRevision returns the payload for the specified revision, without header.
+	EncodeRevision(family Family, rev uint8) ([]byte, error)
+}
+
+type revisionKey struct {
+	family Family
+	kind   ExtensionKind
+	name   string
+	rev    uint8
+}
+
+// revisionAnswer is what the kernel replied about a revision.
+type revisionAnswer struct {
+	supported bool
+	// highest is the highest revision of the extension, when reported by the kernel
+	highest uint8
+}
+
+var (
+	revisionsMu sync.Mutex
+	// revisions caches the answers of the kernel, as it is asked on each rule otherwise; errors are not cached
+	revisions = map[revisionKey]revisionAnswer{}
+	// getRevision queries the kernel, replaceable for testing
+	getRevision = kernelRevision
+)
+
+// kernelRevision asks the kernel whether it supports a revision with IPT_SO_GET_REVISION_MATCH/TARGET
+// or their IPv6 equivalents; it fails with EPROTONOSUPPORT for unknown revisions and with ENOENT for
+// unknown extensions. Some kernels return the highest revision of the extension, others return 0.
+func kernelRevision(family Family, kind ExtensionKind, name string, rev uint8) (int, error) {
+	cFamily, err := socketFamily(family)
+	if err != nil {
+		return 0, err
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	r, err := C.xt_raw_get_revision(cFamily, C.int(kind), cName, C.uchar(rev))
+	if r < 0 {
+		return 0, err
+	}
+	return int(r), nil
+}
+
+// queryRevision returns the answer of the kernel about a revision of an extension; unknown extensions
+// are reported as errors.
+func queryRevision(family Family, kind ExtensionKind, name string, rev uint8) (revisionAnswer, error) {
+	if name == "" || len(name) >= XT_EXTENSION_MAXNAMELEN {
+		return revisionAnswer{}, fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	key := revisionKey{family, kind, name, rev}
+	revisionsMu.Lock()
+	defer revisionsMu.Unlock()
+	if answer, ok := revisions[key]; ok {
+		return answer, nil
+	}
+
+	highest, err := getRevision(family, kind, name, rev)
+	switch err {
+	case nil:
+		answer := revisionAnswer{supported: true}
+		if highest > int(rev) && highest <= 0xff {
+			answer.highest = uint8(highest)
+		}
+		revisions[key] = answer
+	case syscall.EPROTONOSUPPORT:
+		// the extension exists, but not with the requested revision
+		revisions[key] = revisionAnswer{}
+	case syscall.ENOENT:
+		return revisionAnswer{}, &queryError{fmt.Sprintf("%s %s %s not supported by the kernel", family, kind, name), err}
+	default:
+		return revisionAnswer{}, &queryError{fmt.Sprintf("cannot query revision %d of %s %s %s: %v", rev, family, kind, name, err), err}
+	}
+	return revisions[key], nil
+}
+
+// queryError is a revision query which the kernel did not answer, keeping the error of the system call.
+type queryError struct {
+	msg string
+	err error
+}
+
+func (e *queryError) Error() string {
+	return e.msg
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+// revisionSupported returns whether the kernel supports a revision of an extension.
+func revisionSupported(family Family, kind ExtensionKind, name string, rev uint8) (bool, error) {
+	answer, err := queryRevision(family, kind, name, rev)
+	return answer.supported, err
+}
+
+// knownRevisions returns the revisions of an extension for which a decoder is registered, from the highest.
+func knownRevisions(kind ExtensionKind, name string) []uint8 {
+	var revs []uint8
+	if kind == ExtensionTarget {
+		for key := range targetDecoders {
+			if key.name == name {
+				revs = append(revs, key.revision)
+			}
+		}
+	} else {
+		for key := range matchDecoders {
+			if key.name == name {
+				revs = append(revs, key.revision)
+			}
+		}
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i] > revs[j] })
+	return revs
+}
+
+// SupportedRevision returns the highest revision of a match or target extension supported by the kernel;
+// the module of the extension is loaded by the kernel if needed.
+// The kernel is asked about the revisions known to the library, from the highest, or about revision 0 for
+// other extensions; kernels which report their highest revision are answered with it directly.
+func SupportedRevision(family Family, kind ExtensionKind, name string) (uint8, error) {
+	candidates := knownRevisions(kind, name)
+	if len(candidates) == 0 {
+		candidates = []uint8{0}
+	}
+	for _, rev := range candidates {
+		answer, err := queryRevision(family, kind, name, rev)
+		if err != nil {
+			return 0, err
+		}
+		if answer.highest != 0 {
+			return answer.highest, nil
+		}
+		if answer.supported {
+			return rev, nil
+		}
+	}
+	return 0, fmt.Errorf("%s %s %s: none of revisions %v supported by the kernel", family, kind, name, candidates)
+}
+
+// extension is the method set shared by matches and targets.
+type extension interface {
+	Name() string
+	Revision() uint8
+	Encode(family Family) ([]byte, error)
+}
+
+// encodeSupported returns the header and payload of ext, encoded with the highest revision supported by
+// both the library and the kernel. The kernel is only asked about RevisionSelector extensions with several
+// candidate revisions; when it cannot be asked, for lack of privileges or because the module of the
+// extension is not loaded, the highest candidate which can be encoded is used.
+func encodeSupported(family Family, kind ExtensionKind, ext extension) ([]byte, error) {
+	name := ext.Name()
+	sel, ok := ext.(RevisionSelector)
+	if !ok || len(sel.Revisions()) < 2 {
+		// there is nothing to select, unsupported revisions are rejected by the kernel on commit
+		payload, err := ext.Encode(family)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s", kind, name, err)
+		}
+		return encodeExtension(name, ext.Revision(), payload)
+	}
+
+	// candidates are tried in order, as older revisions may lack features in use
+	var supported []uint8
+	var encodeErr error
+	for _, rev := range sel.Revisions() {
+		ok, err := revisionSupported(family, kind, name, rev)
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOENT) {
+			return encodeHighest(family, kind, name, sel)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		supported = append(supported, rev)
+		payload, err := sel.EncodeRevision(family, rev)
+		if err != nil {
+			if encodeErr == nil {
+				encodeErr = err
+			}
+			continue
+		}
+		return encodeExtension(name, rev, payload)
+	}
+	if encodeErr != nil {
+		return nil, fmt.Errorf("%s %s: %s (kernel supports revisions %v)", kind, name, encodeErr, supported)
+	}
+	return nil, fmt.Errorf("%s %s: none of revisions %v supported by the kernel", kind, name, sel.Revisions())
+}
+
+// encodeHighest returns the header and payload of the first revision of sel which can be encoded.
+func encodeHighest(family Family, kind ExtensionKind, name string, sel RevisionSelector) ([]byte, error) {
+	var encodeErr error
+	for _, rev := range sel.Revisions() {
+		payload, err := sel.EncodeRevision(family, rev)
+		if err == nil {
+			return encodeExtension(name, rev, payload)
+		}
+		if encodeErr == nil {
+			encodeErr = err
+		}
+	}
+	return nil, fmt.Errorf("%s %s: %s", kind, name, encodeErr)
+}
+
+// encodeKeyExtension returns the header and payload of ext as compared by Rule.Key. RevisionSelector extensions
+// are encoded with the highest revision known to the library, whatever the revision they were installed with,
+// as encodeSupported may have selected an older one; they keep their own revision if it cannot be used.
+func encodeKeyExtension(family Family, kind ExtensionKind, ext extension) ([]byte, error) {
+	name := ext.Name()
+	if sel, ok := ext.(RevisionSelector); ok {
+		if known := knownRevisions(kind, name); len(known) != 0 {
+			if payload, err := sel.EncodeRevision(family, known[0]); err == nil {
+				return encodeExtension(name, known[0], payload)
+			}
+		}
+	}
+	payload, err := ext.Encode(family)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", kind, name, err)
+	}
+	return encodeExtension(name, ext.Revision(), payload)
+}
+
+// EncodeSupportedMatches is like EncodeMatches, but each match is encoded with the highest revision supported
+// by both the library and the running kernel, so that rules are not rejected when committed.
+func EncodeSupportedMatches(family Family, matches []Match) ([]byte, error) {
+	var buf []byte
+	for _, m := range matches {
+		ext, err := encodeSupported(family, ExtensionMatch, m)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, ext...)
+	}
+	return buf, nil
+}
+
+// EncodeSupportedRuleTarget is like EncodeRuleTarget, with the revision of target extensions selected
+// as by EncodeSupportedMatches.
+func EncodeSupportedRuleTarget(family Family, r *Rule) ([]byte, bool, error) {
+	return encodeRuleTarget(family, r, func(family Family, t Target) ([]byte, error) {
+		return encodeSupported(family, ExtensionTarget, t)
+	})
+}
+
+// revisionsFrom returns the revisions from latest down to oldest, or only rev when it is not zero.
+func revisionsFrom(rev, latest, oldest uint8) []uint8 {
+	if rev != 0 {
+		return []uint8{rev}
+	}
+	var revs []uint8
+	for r := latest; ; r-- {
+		revs = append(revs, r)
+		if r == oldest {
+			return revs
+		}
+	}
+}
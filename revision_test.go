@@ -0,0 +1,243 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeRevisions replaces the kernel with one supporting the specified revisions, returning the number of queries.
+func fakeRevisions(t *testing.T, supported map[string][]uint8) *int {
+	saved, savedCache := getRevision, revisions
+	t.Cleanup(func() {
+		getRevision, revisions = saved, savedCache
+	})
+	revisions = map[revisionKey]revisionAnswer{}
+	queries := new(int)
+	getRevision = func(family Family, kind ExtensionKind, name string, rev uint8) (int, error) {
+		*queries++
+		revs, ok := supported[kind.String()+" "+name]
+		if !ok {
+			return 0, syscall.ENOENT
+		}
+		for _, r := range revs {
+			if r == rev {
+				return 0, nil
+			}
+		}
+		return 0, syscall.EPROTONOSUPPORT
+	}
+	return queries
+}
+
+func TestSupportedRevision(t *testing.T) {
+	queries := fakeRevisions(t, map[string][]uint8{
+		"match conntrack": {1, 2},
+		"target MARK":     {0, 2},
+		"match unknown":   {0},
+	})
+
+	for _, tc := range []struct {
+		kind ExtensionKind
+		name string
+		best uint8
+	}{
+		{ExtensionMatch, "conntrack", 2},
+		{ExtensionTarget, "MARK", 2},
+		// only revision 0 is asked for extensions without a decoder
+		{ExtensionMatch, "unknown", 0},
+	} {
+		best, err := SupportedRevision(FamilyIPv4, tc.kind, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if best != tc.best {
+			t.Errorf("%s %s: revision %d, expected %d", tc.kind, tc.name, best, tc.best)
+		}
+	}
+	// only the revisions known to the library are asked, from the highest
+	if *queries != 4 {
+		t.Errorf("%d queries, expected 4", *queries)
+	}
+	if _, err := SupportedRevision(FamilyIPv4, ExtensionMatch, "conntrack"); err != nil || *queries != 4 {
+		t.Errorf("revision not cached: %v, %d queries", err, *queries)
+	}
+
+	// targets and matches are separate
+	if _, err := SupportedRevision(FamilyIPv4, ExtensionMatch, "MARK"); err == nil || !strings.Contains(err.Error(), "not supported by the kernel") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := SupportedRevision(FamilyIPv4, ExtensionTarget, "unknown"); err == nil || !strings.Contains(err.Error(), "not supported by the kernel") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// the highest revision is used when reported by the kernel
+	queries = fakeRevisions(t, nil)
+	getRevision = func(family Family, kind ExtensionKind, name string, rev uint8) (int, error) {
+		*queries++
+		return 4, nil
+	}
+	if best, err := SupportedRevision(FamilyIPv4, ExtensionMatch, "conntrack"); err != nil || best != 4 || *queries != 1 {
+		t.Errorf("revision %d, %d queries: %v", best, *queries, err)
+	}
+}
+
+func TestEncodeSupported(t *testing.T) {
+	queries := fakeRevisions(t, map[string][]uint8{
+		"match conntrack": {1, 2},
+		"match comment":   {0},
+		"target NFQUEUE":  {1, 2, 3},
+		"target CT":       {0, 1},
+	})
+
+	revisionOf := func(data []byte) uint8 {
+		_, rev, _, _, err := decodeExtension(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+
+	// the latest revision known by the kernel is selected
+	data, err := EncodeSupportedMatches(FamilyIPv4, []Match{&Conntrack{Flags: XT_CONNTRACK_STATE, State: ConnStateEstablished}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revisionOf(data) != 2 {
+		t.Errorf("revision %d, expected 2", revisionOf(data))
+	}
+
+	data, err = EncodeSupportedMatches(FamilyIPv4, []Match{&Comment{Text: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revisionOf(data) != 0 {
+		t.Errorf("revision %d, expected 0", revisionOf(data))
+	}
+
+	rule := Rule{TargetExt: &NFQueueTarget{Num: 1, CPUFanout: true}}
+	target, _, err := EncodeSupportedRuleTarget(FamilyIPv6, &rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revisionOf(target) != 3 {
+		t.Errorf("revision %d, expected 3", revisionOf(target))
+	}
+
+	for _, tc := range []struct {
+		match Match
+		err   string
+	}{
+		{&Conntrack{Flags: XT_CONNTRACK_ORIGDST_PORT, OrigDstPort: PortRange{80, 90}}, "port ranges require revision 3 (kernel supports revisions [2 1])"},
+	} {
+		_, err := EncodeSupportedMatches(FamilyIPv4, []Match{tc.match})
+		if err == nil || !strings.HasSuffix(err.Error(), tc.err) {
+			t.Errorf("%#v: unexpected error %v", tc.match, err)
+		}
+	}
+
+	// the kernel is not asked when there is a single candidate, even if it rejects it on commit
+	*queries = 0
+	for _, m := range []Match{&Conntrack{Rev: 3}, &RawMatch{MatchName: "comment", MatchRevision: 1}, &RawMatch{MatchName: "bogus"}} {
+		if _, err := EncodeSupportedMatches(FamilyIPv4, []Match{m}); err != nil {
+			t.Errorf("%#v: %v", m, err)
+		}
+	}
+	if *queries != 0 {
+		t.Errorf("%d queries, expected none", *queries)
+	}
+
+	// CT flags other than notrack require revision 2
+	rule.TargetExt = &CTTarget{ZoneOrig: true}
+	if _, _, err := EncodeSupportedRuleTarget(FamilyIPv4, &rule); err == nil || !strings.Contains(err.Error(), "require revision 2") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEncodeSupportedUnavailable(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.EPERM, syscall.ENOENT} {
+		fakeRevisions(t, nil)
+		getRevision = func(family Family, kind ExtensionKind, name string, rev uint8) (int, error) {
+			return 0, errno
+		}
+
+		// the highest candidate is used when the kernel cannot be asked
+		data, err := EncodeSupportedMatches(FamilyIPv4, []Match{&Conntrack{Flags: XT_CONNTRACK_STATE, State: ConnStateEstablished}})
+		if err != nil {
+			t.Fatalf("%v: %v", errno, err)
+		}
+		if _, rev, _, _, err := decodeExtension(data); err != nil || rev != 3 {
+			t.Errorf("%v: revision %d, expected 3 (%v)", errno, rev, err)
+		}
+	}
+
+	// other errors are reported
+	getRevision = func(family Family, kind ExtensionKind, name string, rev uint8) (int, error) {
+		return 0, syscall.EINVAL
+	}
+	if _, err := EncodeSupportedMatches(FamilyIPv4, []Match{&Conntrack{}}); err == nil || !strings.Contains(err.Error(), "cannot query revision") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestKeyDowngradedRevision(t *testing.T) {
+	fakeRevisions(t, map[string][]uint8{
+		"match conntrack": {1},
+		"target NFQUEUE":  {1, 2},
+	})
+
+	rule := Rule{
+		Matches:   []Match{&Conntrack{Flags: XT_CONNTRACK_STATE, State: ConnStateEstablished}},
+		TargetExt: &NFQueueTarget{Num: 1},
+	}
+	matches, err := EncodeSupportedMatches(FamilyIPv4, rule.Matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _, err := EncodeSupportedRuleTarget(FamilyIPv4, &rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rule as read back from the kernel has the downgraded revisions
+	var installed Rule
+	if installed.Matches, err = DecodeMatches(FamilyIPv4, matches); err != nil {
+		t.Fatal(err)
+	}
+	if installed.TargetExt, err = DecodeTarget(FamilyIPv4, target); err != nil {
+		t.Fatal(err)
+	}
+	if rev := installed.Matches[0].Revision(); rev != 1 {
+		t.Fatalf("match revision %d, expected 1", rev)
+	}
+	if rev := installed.TargetExt.Revision(); rev != 2 {
+		t.Fatalf("target revision %d, expected 2", rev)
+	}
+
+	i, err := IndexRule(FamilyIPv4, []*Rule{&installed}, &rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 0 {
+		t.Error("rule installed with older revisions not found")
+	}
+}
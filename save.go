@@ -0,0 +1,163 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseSave parses the output of iptables-save or ip6tables-save for family, returning the tables in the order
+// they appear. Counters are taken from chain declarations and from the '[packets:bytes]' prefix or '-c' option
+// of rules, as printed by 'iptables-save -c'; only '-A' commands are accepted in tables.
+func ParseSave(family Family, r io.Reader) ([]*Table, error) {
+	var tables []*Table
+	var table *Table
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseSaveLine(family, &table, &tables, line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if table != nil {
+		return nil, fmt.Errorf("table %s: missing COMMIT", table.Name)
+	}
+	return tables, nil
+}
+
+// parseSaveLine parses a line of a table, or opening one; table is the table being parsed, nil between tables.
+func parseSaveLine(family Family, table **Table, tables *[]*Table, line string) error {
+	if strings.HasPrefix(line, "*") {
+		if *table != nil {
+			return fmt.Errorf("table %s: missing COMMIT", (*table).Name)
+		}
+		name := line[1:]
+		if name == "" || len(name) >= XT_TABLE_MAXNAMELEN {
+			return fmt.Errorf("invalid table name %q", name)
+		}
+		for _, t := range *tables {
+			if t.Name == name {
+				return fmt.Errorf("table %s specified more than once", name)
+			}
+		}
+		*table = &Table{Name: name, Family: family, Chains: []*Chain{}}
+		return nil
+	}
+	t := *table
+	if t == nil {
+		return fmt.Errorf("%q outside of a table", line)
+	}
+
+	switch {
+	case line == "COMMIT":
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		*tables = append(*tables, t)
+		*table = nil
+		return nil
+	case strings.HasPrefix(line, ":"):
+		return parseSaveChain(t, line[1:])
+	}
+
+	var counters XtCounters
+	if strings.HasPrefix(line, "[") {
+		end := strings.IndexByte(line, ']')
+		if end < 0 {
+			return fmt.Errorf("unterminated counters")
+		}
+		var err error
+		if counters, err = parseSaveCounters(line[:end+1]); err != nil {
+			return err
+		}
+		line = line[end+1:]
+	}
+	args, err := SplitArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 || args[0] != "-A" && args[0] != "--append" {
+		return fmt.Errorf("unsupported command %q", line)
+	}
+	chain := t.Chain(XtChainLabel(args[1]))
+	if chain == nil {
+		return fmt.Errorf("chain %s not declared", args[1])
+	}
+	rule, err := ParseRule(family, args[2:])
+	if err != nil {
+		return err
+	}
+	if counters != (XtCounters{}) {
+		rule.XtCounters = counters
+	}
+	chain.Rules = append(chain.Rules, rule)
+	return nil
+}
+
+// parseSaveChain parses a chain declaration like "INPUT ACCEPT [10:1200]"; the policy of user-defined chains is '-'.
+func parseSaveChain(t *Table, decl string) error {
+	fields := strings.Fields(decl)
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("invalid chain declaration %q", decl)
+	}
+	if len(fields[0]) >= XT_TABLE_MAXNAMELEN {
+		return fmt.Errorf("chain name too long: %s", fields[0])
+	}
+	chain := &Chain{Name: XtChainLabel(fields[0]), Rules: []*Rule{}}
+	if t.Chain(chain.Name) != nil {
+		return fmt.Errorf("chain %s declared more than once", chain.Name)
+	}
+	if fields[1] != "-" {
+		chain.Policy = fields[1]
+	}
+	if len(fields) == 3 {
+		var err error
+		if chain.Counters, err = parseSaveCounters(fields[2]); err != nil {
+			return err
+		}
+	}
+	t.Chains = append(t.Chains, chain)
+	return nil
+}
+
+// parseSaveCounters parses counters like "[10:1200]".
+func parseSaveCounters(s string) (c XtCounters, err error) {
+	fields := strings.Split(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), ":")
+	if len(fields) != 2 || !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return c, fmt.Errorf("invalid counters %q", s)
+	}
+	if c.Pcnt, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid packet counter %q", fields[0])
+	}
+	if c.Bcnt, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid byte counter %q", fields[1])
+	}
+	return c, nil
+}
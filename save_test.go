@@ -0,0 +1,104 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"strings"
+	"testing"
+)
+
+const saveOutput = `# Generated by iptables-save v1.8.7 on Mon Oct 19 10:00:00 2026
+*mangle
+:PREROUTING ACCEPT [0:0]
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+-A POSTROUTING -o eth0 -j MARK --set-xmark 0x1/0xffffffff
+COMMIT
+*filter
+:INPUT DROP [120:9600]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:SSH - [0:0]
+[5:300] -A INPUT -p tcp -m tcp --dport 22 -j SSH
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -c 7 420 -j ACCEPT
+-A SSH -s 10.0.0.0/8 -m comment --comment "owner:office network" -j ACCEPT
+COMMIT
+# Completed on Mon Oct 19 10:00:00 2026
+`
+
+func TestParseSave(t *testing.T) {
+	tables, err := ParseSave(FamilyIPv4, strings.NewReader(saveOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0].Name != "mangle" || tables[1].Name != "filter" {
+		t.Fatalf("unexpected tables %+v", tables)
+	}
+
+	mangle := tables[0]
+	if len(mangle.Chains) != 5 || len(mangle.Chain("POSTROUTING").Rules) != 1 {
+		t.Errorf("unexpected mangle table %+v", mangle)
+	}
+	if r := mangle.Chain("POSTROUTING").Rules[0]; r.OutDev != "eth0" || r.TargetExt == nil || r.TargetExt.Name() != "MARK" {
+		t.Errorf("unexpected rule %+v", r)
+	}
+
+	filter := tables[1]
+	input, ssh := filter.Chain("INPUT"), filter.Chain("SSH")
+	if input.Policy != "DROP" || input.Counters != (XtCounters{Pcnt: 120, Bcnt: 9600}) {
+		t.Errorf("unexpected INPUT chain %+v", input)
+	}
+	if ssh.IsBuiltin() || len(ssh.Rules) != 1 {
+		t.Errorf("unexpected SSH chain %+v", ssh)
+	}
+	if r := input.Rules[0]; r.Target != "SSH" || r.Proto != IPPROTO_TCP || r.XtCounters != (XtCounters{Pcnt: 5, Bcnt: 300}) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if r := input.Rules[1]; r.Target != "ACCEPT" || r.XtCounters != (XtCounters{Pcnt: 7, Bcnt: 420}) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if owner, _ := ssh.Rules[0].Owner(); owner != "office network" {
+		t.Errorf("unexpected comment %q", owner)
+	}
+}
+
+func TestParseSaveErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		err   string
+	}{
+		{"*filter\n:INPUT ACCEPT [0:0]\n", "table filter: missing COMMIT"},
+		{"*filter\n*nat\n", "line 2: table filter: missing COMMIT"},
+		{"-A INPUT -j ACCEPT\n", `line 1: "-A INPUT -j ACCEPT" outside of a table`},
+		{"*filter\n-A INPUT -j ACCEPT\n", "line 2: chain INPUT not declared"},
+		{"*filter\n:INPUT ACCEPT [0:0]\n-I INPUT -j ACCEPT\n", `line 3: unsupported command "-I INPUT -j ACCEPT"`},
+		{"*filter\n:INPUT ACCEPT [x:0]\n", `line 2: invalid packet counter "x"`},
+		// targets without a parser are taken as chains
+		{"*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -j MASQUERADE\nCOMMIT\n", "line 4: table nat: chain POSTROUTING: rule 1 jumps to unknown chain MASQUERADE"},
+		{"*filter\nCOMMIT\n*filter\n", "line 3: table filter specified more than once"},
+	} {
+		_, err := ParseSave(FamilyIPv4, strings.NewReader(tc.input))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%q: expected error %q, got %v", tc.input, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// Chain is a snapshot of a chain and its rules.
+type Chain struct {
+	Name XtChainLabel `json:"name" yaml:"name"`
+	// Policy is the policy of a built-in chain, and empty for user-defined chains.
+	Policy   string     `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Counters XtCounters `json:"counters" yaml:"counters"`
+	Rules    []*Rule    `json:"rules" yaml:"rules"`
+}
+
+// IsBuiltin returns true for built-in chains, which are the ones with a policy.
+func (c *Chain) IsBuiltin() bool {
+	return c.Policy != ""
+}
+
+// Table is a snapshot of all the chains of a table, in the order returned by libiptc.
+type Table struct {
+	Name   string   `json:"name" yaml:"name"`
+	Family Family   `json:"family" yaml:"family"`
+	Chains []*Chain `json:"chains" yaml:"chains"`
+}
+
+// Chain returns the chain with the specified name, or nil if there is none.
+func (t *Table) Chain(name XtChainLabel) *Chain {
+	for _, c := range t.Chains {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Validate checks that chain names are unique, and that rules only jump to chains of the table.
+func (t *Table) Validate() error {
+	names := map[XtChainLabel]bool{}
+	for _, c := range t.Chains {
+		if c.Name == "" {
+			return fmt.Errorf("table %s: empty chain name", t.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("table %s: duplicate chain %s", t.Name, c.Name)
+		}
+		names[c.Name] = true
+	}
+	for _, c := range t.Chains {
+		for i, r := range c.Rules {
+			if r == nil {
+				return fmt.Errorf("table %s: chain %s: rule %d is nil", t.Name, c.Name, i+1)
+			}
+			switch r.TargetKind() {
+			case TargetJump, TargetGoto:
+				if !names[XtChainLabel(r.Target)] {
+					return fmt.Errorf("table %s: chain %s: rule %d jumps to unknown chain %s", t.Name, c.Name, i+1, r.Target)
+				}
+			}
+		}
+	}
+	return nil
+}
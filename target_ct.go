@@ -0,0 +1,325 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// the constants are copied from the anonymous enum in xt_CT.h
+	XT_CT_NOTRACK       = 1 << 0
+	XT_CT_NOTRACK_ALIAS = 1 << 1
+	XT_CT_ZONE_DIR_ORIG = 1 << 2
+	XT_CT_ZONE_DIR_REPL = 1 << 3
+	XT_CT_ZONE_MARK     = 1 << 4
+)
+
+// CtEvents is a bitmask of conntrack events, from the ip_conntrack_events enum.
+type CtEvents uint32
+
+const (
+	CtEventNew CtEvents = 1 << iota
+	CtEventRelated
+	CtEventDestroy
+	CtEventReply
+	CtEventAssured
+	CtEventProtoinfo
+	CtEventHelper
+	CtEventMark
+	CtEventNATSeqInfo
+	CtEventSecmark
+)
+
+var ctEventNames = []string{"new", "related", "destroy", "reply", "assured", "protoinfo", "helper", "mark", "natseqinfo", "secmark"}
+
+// String returns the comma-separated list of events, as printed by iptables-save.
+func (e CtEvents) String() string {
+	var names []string
+	for i, name := range ctEventNames {
+		if e&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseCtEvents parses a comma-separated list of conntrack events, like "new,destroy".
+func ParseCtEvents(s string) (CtEvents, error) {
+	var e CtEvents
+next:
+	for _, name := range strings.Split(s, ",") {
+		for i, n := range ctEventNames {
+			if name == n {
+				e |= 1 << uint(i)
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid conntrack event %q", name)
+	}
+	return e, nil
+}
+
+// ExpEventNew is the only expectation event, from the ip_conntrack_expect_events enum.
+const ExpEventNew = 1 << 0
+
+// CTTarget is the CT target, only valid in the raw table; it attaches a template to new connections,
+// or disables connection tracking altogether.
+type CTTarget struct {
+	// Rev is the revision of the target, 1 or 2; zero selects the latest one.
+	// Revision 2 is required for zone directions, zone from mark and NoTrackAlias.
+	Rev uint8
+	// NoTrack disables connection tracking; other fields are ignored by the kernel.
+	NoTrack bool
+	// NoTrackAlias is set by iptables when NOTRACK is translated to CT.
+	NoTrackAlias bool
+	Zone         uint16
+	// ZoneOrig and ZoneReply restrict the zone to one direction; both unset means any direction.
+	ZoneOrig  bool
+	ZoneReply bool
+	// ZoneMark derives the zone from the fwmark instead of Zone.
+	ZoneMark bool
+	// Helper and Timeout are the names of the helper and timeout policy to use, if any.
+	Helper  string
+	Timeout string
+	// CtEvents and ExpEvents restrict the events generated for connections and expectations; zero for all.
+	CtEvents  CtEvents
+	ExpEvents uint32
+}
+
+// xt_ct_target_info_v1
+type xtCtTargetInfoV1 struct {
+	Flags     uint16
+	Zone      uint16
+	CtEvents  uint32
+	ExpEvents uint32
+	Helper    [16]byte
+	Timeout   [32]byte
+	_         [4]byte
+	Ct        uint64
+}
+
+// NoTrackTarget is the legacy NOTRACK target; modern iptables translates it to CT with NoTrack.
+type NoTrackTarget struct{}
+
+func init() {
+	RegisterTarget("CT", 1, func(family Family, data []byte) (Target, error) {
+		return decodeCTTarget(1, data)
+	})
+	RegisterTarget("CT", 2, func(family Family, data []byte) (Target, error) {
+		return decodeCTTarget(2, data)
+	})
+	RegisterTarget("NOTRACK", 0, decodeNoTrackTarget)
+	registerTargetParser("CT", map[string]optionSpec{
+		"--notrack": {0, false}, "--helper": {1, false}, "--timeout": {1, false},
+		"--ctevents": {1, false}, "--expevents": {1, false},
+		"--zone": {1, false}, "--zone-orig": {1, false}, "--zone-reply": {1, false},
+	}, parseCTTarget)
+	registerTargetParser("NOTRACK", nil, func(family Family, opts []parsedOption) (Target, error) {
+		return &NoTrackTarget{}, nil
+	})
+}
+
+// Name returns "CT".
+func (t *CTTarget) Name() string {
+	return "CT"
+}
+
+// Revision returns the revision of the target.
+func (t *CTTarget) Revision() uint8 {
+	if t.Rev == 0 {
+		return 2
+	}
+	return t.Rev
+}
+
+// Revisions returns Rev, or revisions 2 down to 1 when Rev is zero.
+func (t *CTTarget) Revisions() []uint8 {
+	return revisionsFrom(t.Rev, 2, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (t *CTTarget) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *t
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+// Args returns the '--notrack', '--helper', '--timeout', '--ctevents', '--expevents' and zone options in use.
+// NoTrackAlias is not represented, as iptables-save prints such targets as '-j NOTRACK'.
+func (t *CTTarget) Args() []string {
+	var args []string
+	if t.NoTrack || t.NoTrackAlias {
+		args = append(args, "--notrack")
+	}
+	if t.Helper != "" {
+		args = append(args, "--helper", t.Helper)
+	}
+	if t.Timeout != "" {
+		args = append(args, "--timeout", t.Timeout)
+	}
+	if t.CtEvents != 0 {
+		args = append(args, "--ctevents", t.CtEvents.String())
+	}
+	if t.ExpEvents&ExpEventNew != 0 {
+		args = append(args, "--expevents", "new")
+	}
+	if t.Zone != 0 || t.ZoneMark {
+		opt := "--zone"
+		switch {
+		case t.ZoneOrig && !t.ZoneReply:
+			opt = "--zone-orig"
+		case t.ZoneReply && !t.ZoneOrig:
+			opt = "--zone-reply"
+		}
+		zone := decArg(uint64(t.Zone))
+		if t.ZoneMark {
+			zone = "mark"
+		}
+		args = append(args, opt, zone)
+	}
+	return args
+}
+
+// Encode returns a xt_ct_target_info_v1 payload, which is shared by revisions 1 and 2.
+func (t *CTTarget) Encode(family Family) ([]byte, error) {
+	info := xtCtTargetInfoV1{
+		Zone:      t.Zone,
+		CtEvents:  uint32(t.CtEvents),
+		ExpEvents: t.ExpEvents,
+	}
+	if t.NoTrack {
+		info.Flags |= XT_CT_NOTRACK
+	}
+	if t.NoTrackAlias {
+		info.Flags |= XT_CT_NOTRACK_ALIAS
+	}
+	if t.ZoneOrig {
+		info.Flags |= XT_CT_ZONE_DIR_ORIG
+	}
+	if t.ZoneReply {
+		info.Flags |= XT_CT_ZONE_DIR_REPL
+	}
+	if t.ZoneMark {
+		info.Flags |= XT_CT_ZONE_MARK
+	}
+	if info.Flags&^XT_CT_NOTRACK != 0 && t.Revision() < 2 {
+		return nil, fmt.Errorf("CT flags %#x require revision 2", info.Flags)
+	}
+	if err := putCString(info.Helper[:], t.Helper); err != nil {
+		return nil, err
+	}
+	if err := putCString(info.Timeout[:], t.Timeout); err != nil {
+		return nil, err
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeCTTarget(rev uint8, data []byte) (Target, error) {
+	var info xtCtTargetInfoV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &CTTarget{
+		Rev:          rev,
+		NoTrack:      info.Flags&XT_CT_NOTRACK != 0,
+		NoTrackAlias: info.Flags&XT_CT_NOTRACK_ALIAS != 0,
+		Zone:         info.Zone,
+		ZoneOrig:     info.Flags&XT_CT_ZONE_DIR_ORIG != 0,
+		ZoneReply:    info.Flags&XT_CT_ZONE_DIR_REPL != 0,
+		ZoneMark:     info.Flags&XT_CT_ZONE_MARK != 0,
+		Helper:       cString(info.Helper[:]),
+		Timeout:      cString(info.Timeout[:]),
+		CtEvents:     CtEvents(info.CtEvents),
+		ExpEvents:    info.ExpEvents,
+	}, nil
+}
+
+// Name returns "NOTRACK".
+func (t *NoTrackTarget) Name() string {
+	return "NOTRACK"
+}
+
+// Revision returns 0.
+func (t *NoTrackTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns no options.
+func (t *NoTrackTarget) Args() []string {
+	return nil
+}
+
+// Encode returns an empty payload.
+func (t *NoTrackTarget) Encode(family Family) ([]byte, error) {
+	return nil, nil
+}
+
+func decodeNoTrackTarget(family Family, data []byte) (Target, error) {
+	return &NoTrackTarget{}, nil
+}
+
+func parseCTTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &CTTarget{}
+	zoneSet := false
+	for _, o := range opts {
+		var err error
+		switch o.name {
+		case "--notrack":
+			t.NoTrack = true
+		case "--helper":
+			if len(o.value()) >= 16 {
+				err = fmt.Errorf("helper name too long")
+			}
+			t.Helper = o.value()
+		case "--timeout":
+			if len(o.value()) >= 32 {
+				err = fmt.Errorf("timeout policy name too long")
+			}
+			t.Timeout = o.value()
+		case "--ctevents":
+			t.CtEvents, err = ParseCtEvents(o.value())
+		case "--expevents":
+			if o.value() != "new" {
+				err = fmt.Errorf("invalid expectation event %q", o.value())
+			}
+			t.ExpEvents = ExpEventNew
+		default:
+			if zoneSet {
+				return nil, o.errorf("only one zone option is allowed")
+			}
+			zoneSet = true
+			t.ZoneOrig = o.name == "--zone-orig"
+			t.ZoneReply = o.name == "--zone-reply"
+			if o.value() == "mark" {
+				t.ZoneMark = true
+			} else {
+				var zone uint64
+				zone, err = parseUint(o.value(), 16)
+				t.Zone = uint16(zone)
+			}
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,106 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestProxyTargets(t *testing.T) {
+	for _, tc := range []struct {
+		family Family
+		target Target
+	}{
+		{FamilyIPv4, &TProxyTarget{Addr: netip.MustParseAddr("127.0.0.1"), Port: 3128, Mark: 0x1, Mask: 0x1}},
+		{FamilyIPv6, &TProxyTarget{Addr: netip.MustParseAddr("::1"), Port: 3128}},
+		{FamilyIPv4, &TProxyTarget{Port: 8080}},
+		{FamilyIPv4, &TCPMSSTarget{MSS: 1360}},
+		{FamilyIPv6, &TCPMSSTarget{MSS: XT_TCPMSS_CLAMP_PMTU}},
+		{FamilyIPv4, &NoTrackTarget{}},
+	} {
+		decoded := roundTripTarget(t, tc.family, tc.target)
+		if !reflect.DeepEqual(decoded, tc.target) {
+			t.Errorf("expected %#v, got %#v", tc.target, decoded)
+		}
+	}
+
+	if _, err := (&TProxyTarget{Addr: netip.MustParseAddr("::1")}).Encode(FamilyIPv4); err == nil {
+		t.Error("IPv6 address encoded for IPv4")
+	}
+	if _, err := (&TCPMSSTarget{}).Encode(FamilyIPv4); err == nil {
+		t.Error("zero MSS encoded")
+	}
+}
+
+func TestCTTarget(t *testing.T) {
+	for _, target := range []*CTTarget{
+		{Rev: 1, NoTrack: true},
+		{Rev: 1, Zone: 5, Helper: "ftp", Timeout: "short-udp", CtEvents: CtEventNew | CtEventDestroy, ExpEvents: ExpEventNew},
+		{Rev: 2, Zone: 7, ZoneOrig: true},
+		{Rev: 2, ZoneMark: true, ZoneReply: true},
+		{Rev: 2, NoTrack: true, NoTrackAlias: true},
+	} {
+		decoded := roundTripTarget(t, FamilyIPv4, target)
+		if !reflect.DeepEqual(decoded, target) {
+			t.Errorf("expected %#v, got %#v", target, decoded)
+		}
+	}
+
+	for _, target := range []*CTTarget{
+		{Rev: 1, ZoneOrig: true},
+		{Helper: "this-helper-name-is-too-long"},
+	} {
+		if _, err := target.Encode(FamilyIPv4); err == nil {
+			t.Errorf("%#v: encoded", target)
+		}
+	}
+
+	e, err := ParseCtEvents("new,related,natseqinfo")
+	if err != nil || e != CtEventNew|CtEventRelated|CtEventNATSeqInfo {
+		t.Errorf("unexpected events %s, %v", e, err)
+	}
+	if s := e.String(); s != "new,related,natseqinfo" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestCTLayout(t *testing.T) {
+	data := payloadOf(t, FamilyIPv4, &CTTarget{Rev: 1, NoTrack: true, Zone: 7, CtEvents: 3, Helper: "ftp", Timeout: "short"})
+	if flags, zone := nativeEndian.Uint16(data[0:]), nativeEndian.Uint16(data[2:]); flags != XT_CT_NOTRACK || zone != 7 {
+		t.Errorf("flags %#x, zone %d", flags, zone)
+	}
+	if events := nativeEndian.Uint32(data[4:]); events != 3 {
+		t.Errorf("ct_events %#x", events)
+	}
+	if string(data[12:16]) != "ftp\x00" || string(data[28:33]) != "short" {
+		t.Errorf("helper %q, timeout %q", data[12:16], data[28:33])
+	}
+
+	// the port is in network order
+	data = payloadOf(t, FamilyIPv4, &TProxyTarget{Addr: netip.MustParseAddr("127.0.0.1"), Port: 3128, Mark: 1, Mask: 1})
+	if addr, _ := netip.AddrFromSlice(data[8:12]); addr.String() != "127.0.0.1" {
+		t.Errorf("laddr %s", addr)
+	}
+	if string(data[24:26]) != "\x0c\x38" {
+		t.Errorf("lport % x", data[24:26])
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the constants are copied from #define declarations in xt_dscp.h
+	XT_DSCP_MASK  = 0xfc
+	XT_DSCP_SHIFT = 2
+	XT_DSCP_MAX   = 0x3f
+)
+
+// ParseDSCPClass returns the DSCP value of a DiffServ class, like "EF", "AF41" or "CS1", as accepted by
+// '--set-dscp-class' and '--dscp-class'; "BE" is the default class.
+func ParseDSCPClass(class string) (uint8, error) {
+	c := strings.ToUpper(class)
+	switch {
+	case c == "BE":
+		return 0, nil
+	case c == "EF":
+		return 0x2e, nil
+	case len(c) == 3 && strings.HasPrefix(c, "CS") && c[2] >= '0' && c[2] <= '7':
+		return (c[2] - '0') << 3, nil
+	case len(c) == 4 && strings.HasPrefix(c, "AF") && c[2] >= '1' && c[2] <= '4' && c[3] >= '1' && c[3] <= '3':
+		return (c[2]-'0')<<3 | (c[3]-'0')<<1, nil
+	}
+	return 0, fmt.Errorf("invalid DSCP class %q", class)
+}
+
+// DSCPTarget is the DSCP target, only valid in the mangle table; it replaces the DSCP bits of the TOS/traffic class field.
+type DSCPTarget struct {
+	DSCP uint8
+}
+
+// xt_DSCP_info
+type xtDSCPInfo struct {
+	Dscp uint8
+}
+
+// TOSTarget is the TOS target (revision 1), only valid in the mangle table; the new TOS/traffic class
+// field is computed as (tos &^ Mask) ^ Value, like MarkTarget does for the fwmark.
+type TOSTarget struct {
+	Value uint8
+	Mask  uint8
+}
+
+// NewSetTOS returns a TOS target equivalent to '--set-tos value/mask'.
+func NewSetTOS(value, mask uint8) *TOSTarget {
+	return &TOSTarget{Value: value, Mask: mask}
+}
+
+// NewAndTOS returns a TOS target equivalent to '--and-tos bits'.
+func NewAndTOS(bits uint8) *TOSTarget {
+	return &TOSTarget{Value: 0, Mask: ^bits}
+}
+
+// NewOrTOS returns a TOS target equivalent to '--or-tos bits'.
+func NewOrTOS(bits uint8) *TOSTarget {
+	return &TOSTarget{Value: bits, Mask: bits}
+}
+
+// NewXorTOS returns a TOS target equivalent to '--xor-tos bits'.
+func NewXorTOS(bits uint8) *TOSTarget {
+	return &TOSTarget{Value: bits, Mask: 0}
+}
+
+// xt_tos_target_info
+type xtTosTargetInfo struct {
+	TosValue uint8
+	TosMask  uint8
+}
+
+// DSCP is the 'dscp' match.
+type DSCP struct {
+	DSCP uint8
+	Not  Not
+}
+
+// xt_dscp_info
+type xtDscpInfo struct {
+	Dscp   uint8
+	Invert uint8
+}
+
+// TOS is the 'tos' match (revision 1), matching when (tos & Mask) == Value.
+type TOS struct {
+	Value uint8
+	Mask  uint8
+	Not   Not
+}
+
+// xt_tos_match_info
+type xtTosMatchInfo struct {
+	TosMask  uint8
+	TosValue uint8
+	Invert   uint8
+}
+
+func init() {
+	RegisterTarget("DSCP", 0, decodeDSCPTarget)
+	RegisterTarget("TOS", 1, decodeTOSTarget)
+	RegisterMatch("dscp", 0, decodeDSCP)
+	RegisterMatch("tos", 1, decodeTOS)
+	registerTargetParser("DSCP", map[string]optionSpec{"--set-dscp": {1, false}, "--set-dscp-class": {1, false}}, parseDSCPTarget)
+	registerTargetParser("TOS", map[string]optionSpec{
+		"--set-tos": {1, false}, "--and-tos": {1, false}, "--or-tos": {1, false}, "--xor-tos": {1, false},
+	}, parseTOSTarget)
+	registerMatchParser("dscp", map[string]optionSpec{"--dscp": {1, true}, "--dscp-class": {1, true}}, parseDSCP)
+	registerMatchParser("tos", map[string]optionSpec{"--tos": {1, true}}, parseTOS)
+}
+
+// Name returns "DSCP".
+func (t *DSCPTarget) Name() string {
+	return "DSCP"
+}
+
+// Revision returns 0.
+func (t *DSCPTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--set-dscp' option.
+func (t *DSCPTarget) Args() []string {
+	return []string{"--set-dscp", hexArg(uint32(t.DSCP))}
+}
+
+// Encode returns a xt_DSCP_info payload.
+func (t *DSCPTarget) Encode(family Family) ([]byte, error) {
+	if t.DSCP > XT_DSCP_MAX {
+		return nil, fmt.Errorf("invalid DSCP value %#x", t.DSCP)
+	}
+	return encodeStruct(&xtDSCPInfo{Dscp: t.DSCP}), nil
+}
+
+func decodeDSCPTarget(family Family, data []byte) (Target, error) {
+	var info xtDSCPInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &DSCPTarget{DSCP: info.Dscp}, nil
+}
+
+// Name returns "TOS".
+func (t *TOSTarget) Name() string {
+	return "TOS"
+}
+
+// Revision returns 1.
+func (t *TOSTarget) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--set-tos' option, which iptables-save uses for all TOS operations.
+func (t *TOSTarget) Args() []string {
+	return []string{"--set-tos", hexArg(uint32(t.Value)) + "/" + hexArg(uint32(t.Mask))}
+}
+
+// Encode returns a xt_tos_target_info payload.
+func (t *TOSTarget) Encode(family Family) ([]byte, error) {
+	return encodeStruct(&xtTosTargetInfo{TosValue: t.Value, TosMask: t.Mask}), nil
+}
+
+func decodeTOSTarget(family Family, data []byte) (Target, error) {
+	var info xtTosTargetInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &TOSTarget{Value: info.TosValue, Mask: info.TosMask}, nil
+}
+
+// Name returns "dscp".
+func (m *DSCP) Name() string {
+	return "dscp"
+}
+
+// Revision returns 0.
+func (m *DSCP) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--dscp' option.
+func (m *DSCP) Args() []string {
+	return appendOpt(nil, m.Not, "--dscp", hexArg(uint32(m.DSCP)))
+}
+
+// Encode returns a xt_dscp_info payload.
+func (m *DSCP) Encode(family Family) ([]byte, error) {
+	if m.DSCP > XT_DSCP_MAX {
+		return nil, fmt.Errorf("invalid DSCP value %#x", m.DSCP)
+	}
+	info := xtDscpInfo{Dscp: m.DSCP}
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeDSCP(family Family, data []byte) (Match, error) {
+	var info xtDscpInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &DSCP{DSCP: info.Dscp, Not: info.Invert != 0}, nil
+}
+
+// Name returns "tos".
+func (m *TOS) Name() string {
+	return "tos"
+}
+
+// Revision returns 1.
+func (m *TOS) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--tos' option.
+func (m *TOS) Args() []string {
+	return appendOpt(nil, m.Not, "--tos", m.String())
+}
+
+// String returns the match value in iptables notation, "0xvalue/0xmask".
+func (m *TOS) String() string {
+	return "0x" + strconv.FormatUint(uint64(m.Value), 16) + "/0x" + strconv.FormatUint(uint64(m.Mask), 16)
+}
+
+// Encode returns a xt_tos_match_info payload.
+func (m *TOS) Encode(family Family) ([]byte, error) {
+	info := xtTosMatchInfo{TosMask: m.Mask, TosValue: m.Value}
+	if m.Not {
+		info.Invert = 1
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeTOS(family Family, data []byte) (Match, error) {
+	var info xtTosMatchInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &TOS{Value: info.TosValue, Mask: info.TosMask, Not: info.Invert != 0}, nil
+}
+
+// parseDSCPOption parses the value of '--dscp' or '--set-dscp', or the class of '--dscp-class' or '--set-dscp-class'.
+func parseDSCPOption(o parsedOption) (uint8, error) {
+	if strings.HasSuffix(o.name, "-class") {
+		dscp, err := ParseDSCPClass(o.value())
+		if err != nil {
+			return 0, o.errorf("%v", err)
+		}
+		return dscp, nil
+	}
+	dscp, err := parseUint(o.value(), 8)
+	if err == nil && dscp > XT_DSCP_MAX {
+		err = fmt.Errorf("DSCP value %#x out of range", dscp)
+	}
+	if err != nil {
+		return 0, o.errorf("%v", err)
+	}
+	return uint8(dscp), nil
+}
+
+func parseDSCPTarget(family Family, opts []parsedOption) (Target, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --set-dscp and --set-dscp-class is required")
+	}
+	dscp, err := parseDSCPOption(opts[0])
+	if err != nil {
+		return nil, err
+	}
+	return &DSCPTarget{DSCP: dscp}, nil
+}
+
+func parseTOSTarget(family Family, opts []parsedOption) (Target, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --set-tos, --and-tos, --or-tos and --xor-tos is required")
+	}
+	o := opts[0]
+	if o.name == "--set-tos" {
+		value, mask, err := parseValueMask(o.value(), 8)
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+		return NewSetTOS(uint8(value), uint8(mask)), nil
+	}
+	bits, err := parseUint(o.value(), 8)
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	switch o.name {
+	case "--and-tos":
+		return NewAndTOS(uint8(bits)), nil
+	case "--or-tos":
+		return NewOrTOS(uint8(bits)), nil
+	}
+	return NewXorTOS(uint8(bits)), nil
+}
+
+func parseDSCP(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --dscp and --dscp-class is required")
+	}
+	dscp, err := parseDSCPOption(opts[0])
+	if err != nil {
+		return nil, err
+	}
+	return &DSCP{DSCP: dscp, Not: opts[0].not}, nil
+}
+
+func parseTOS(family Family, opts []parsedOption) (Match, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--tos is required")
+	}
+	o := opts[0]
+	value, mask, err := parseValueMask(o.value(), 8)
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return &TOS{Value: uint8(value), Mask: uint8(mask), Not: o.not}, nil
+}
@@ -0,0 +1,140 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQoSTargets(t *testing.T) {
+	for _, tc := range []struct {
+		family Family
+		target Target
+	}{
+		{FamilyIPv4, &DSCPTarget{DSCP: 0x2e}},
+		{FamilyIPv6, NewOrTOS(0x10)},
+		{FamilyIPv4, &TTLTarget{Mode: IPT_TTL_DEC, Value: 1}},
+		{FamilyIPv6, &HLTarget{Mode: IP6T_HL_SET, Value: 64}},
+		{FamilyIPv4, &ClassifyTarget{Major: 1, Minor: 0x10}},
+		{FamilyIPv4, &NFQueueTarget{Rev: 1, Num: 4, Total: 4}},
+		{FamilyIPv4, &NFQueueTarget{Rev: 2, Num: 1, Bypass: true}},
+		{FamilyIPv6, &NFQueueTarget{Rev: 3, Num: 8, Total: 2, Bypass: true, CPUFanout: true}},
+	} {
+		decoded := roundTripTarget(t, tc.family, tc.target)
+		if !reflect.DeepEqual(decoded, tc.target) {
+			t.Errorf("expected %#v, got %#v", tc.target, decoded)
+		}
+	}
+
+	for _, tc := range []struct {
+		family Family
+		target Target
+	}{
+		{FamilyIPv4, &DSCPTarget{DSCP: 0x40}},
+		{FamilyIPv6, &TTLTarget{Mode: IPT_TTL_SET, Value: 64}},
+		{FamilyIPv4, &HLTarget{Mode: IP6T_HL_SET, Value: 64}},
+		{FamilyIPv4, &TTLTarget{Mode: IPT_TTL_INC}},
+		{FamilyIPv4, &NFQueueTarget{Rev: 1, Bypass: true}},
+		{FamilyIPv4, &NFQueueTarget{Rev: 2, CPUFanout: true}},
+		{FamilyIPv4, &NFQueueTarget{Num: 0xffff, Total: 2}},
+	} {
+		if _, err := tc.target.Encode(tc.family); err == nil {
+			t.Errorf("%#v: encoded for %s", tc.target, tc.family)
+		}
+	}
+
+	if tos := NewAndTOS(0x0f); tos.Value != 0 || tos.Mask != 0xf0 {
+		t.Errorf("unexpected TOS target %#v", tos)
+	}
+
+	class, err := ParseClassify("1:a")
+	if err != nil || *class != (ClassifyTarget{Major: 1, Minor: 10}) {
+		t.Errorf("unexpected class %v, %v", class, err)
+	}
+	if s := class.String(); s != "1:a" {
+		t.Errorf("unexpected string %q", s)
+	}
+	for _, s := range []string{"", "1", "1:x", "1:2:3", "10000:1"} {
+		if _, err := ParseClassify(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+}
+
+func TestQoSMatches(t *testing.T) {
+	for _, tc := range []struct {
+		family Family
+		match  Match
+	}{
+		{FamilyIPv4, &DSCP{DSCP: 0x0a, Not: true}},
+		{FamilyIPv6, &TOS{Value: 0x10, Mask: 0x3f}},
+		{FamilyIPv4, &TTL{Mode: IPT_TTL_LT, Value: 5}},
+		{FamilyIPv6, &HL{Mode: IP6T_HL_NE, Value: 255}},
+	} {
+		decoded := roundTripMatch(t, tc.family, tc.match)
+		if !reflect.DeepEqual(decoded, tc.match) {
+			t.Errorf("expected %#v, got %#v", tc.match, decoded)
+		}
+	}
+
+	// TTL is IPv4 only, hence decoded as raw for IPv6
+	data := encodeStruct(&xtTTLInfo{Mode: IPT_TTL_EQ, Value: 1})
+	if _, err := decodeTTL(FamilyIPv6, data); err == nil {
+		t.Error("ttl decoded for IPv6")
+	}
+
+	for class, expected := range map[string]uint8{"BE": 0, "EF": 0x2e, "af41": 0x22, "CS7": 0x38} {
+		v, err := ParseDSCPClass(class)
+		if err != nil || v != expected {
+			t.Errorf("%q: unexpected value %#x, %v", class, v, err)
+		}
+	}
+	if _, err := ParseDSCPClass("AF44"); err == nil {
+		t.Error("invalid class parsed")
+	}
+}
+
+func TestQoSLayout(t *testing.T) {
+	// revision 1 ends before the flags
+	for _, tc := range []struct {
+		target *NFQueueTarget
+		size   int
+	}{
+		{&NFQueueTarget{Rev: 1, Num: 4, Total: 2}, 4},
+		{&NFQueueTarget{Rev: 3, Num: 4, Total: 2, Bypass: true, CPUFanout: true}, 6},
+	} {
+		data := payloadOf(t, FamilyIPv4, tc.target)
+		if len(data) != tc.size {
+			t.Fatalf("revision %d: size %d, expected %d", tc.target.Rev, len(data), tc.size)
+		}
+		if num, total := nativeEndian.Uint16(data[0:]), nativeEndian.Uint16(data[2:]); num != 4 || total != 2 {
+			t.Errorf("revision %d: queuenum %d, queues_total %d", tc.target.Rev, num, total)
+		}
+		if tc.size == 6 && nativeEndian.Uint16(data[4:]) != NFQ_FLAG_BYPASS|NFQ_FLAG_CPU_FANOUT {
+			t.Errorf("flags %#x", nativeEndian.Uint16(data[4:]))
+		}
+	}
+
+	data := payloadOf(t, FamilyIPv4, &TOSTarget{Value: 0x10, Mask: 0x3f})
+	if data[0] != 0x10 || data[1] != 0x3f {
+		t.Errorf("tos_value %#x, tos_mask %#x", data[0], data[1])
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// LogLevel is a syslog priority level.
+type LogLevel uint8
+
+const (
+	LogLevelEmerg LogLevel = iota
+	LogLevelAlert
+	LogLevelCrit
+	LogLevelErr
+	LogLevelWarning
+	LogLevelNotice
+	LogLevelInfo
+	LogLevelDebug
+)
+
+var logLevelNames = []string{"emerg", "alert", "crit", "error", "warning", "notice", "info", "debug"}
+
+// String returns the level name, as accepted by '--log-level'.
+func (l LogLevel) String() string {
+	if int(l) < len(logLevelNames) {
+		return logLevelNames[l]
+	}
+	return fmt.Sprintf("%d", uint8(l))
+}
+
+// ParseLogLevel parses a level name or number, like "info" or "6".
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if s == name {
+			return LogLevel(i), nil
+		}
+	}
+	// alias accepted by iptables
+	if s == "panic" {
+		return LogLevelEmerg, nil
+	}
+	l, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || l > uint64(LogLevelDebug) {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return LogLevel(l), nil
+}
+
+const (
+	// the constants are copied from #define declarations in xt_LOG.h
+	XT_LOG_TCPSEQ    = 0x01
+	XT_LOG_TCPOPT    = 0x02
+	XT_LOG_IPOPT     = 0x04
+	XT_LOG_UID       = 0x08
+	XT_LOG_MACDECODE = 0x20
+	XT_LOG_MASK      = 0x2f
+
+	// XT_LOG_PREFIX_LEN is the size of a LOG prefix, including terminating NUL.
+	XT_LOG_PREFIX_LEN = 30
+)
+
+// LogTarget is the LOG target, which logs packets through the kernel log.
+type LogTarget struct {
+	// Level is the syslog level; iptables uses LogLevelWarning by default.
+	Level LogLevel
+	// Flags is a combination of XT_LOG_* flags.
+	Flags  uint8
+	Prefix string
+}
+
+// xt_log_info
+type xtLogInfo struct {
+	Level    uint8
+	Logflags uint8
+	Prefix   [XT_LOG_PREFIX_LEN]byte
+}
+
+const (
+	// the constants are copied from #define declarations in xt_NFLOG.h
+	XT_NFLOG_DEFAULT_GROUP     = 0x1
+	XT_NFLOG_DEFAULT_THRESHOLD = 0
+	XT_NFLOG_F_COPY_LEN        = 0x1
+
+	// XT_NFLOG_PREFIX_LEN is the size of a NFLOG prefix, including terminating NUL.
+	XT_NFLOG_PREFIX_LEN = 64
+)
+
+// NFLogTarget is the NFLOG target, which sends packets to userspace through nfnetlink_log.
+type NFLogTarget struct {
+	Group  uint16
+	Prefix string
+	// Threshold is the number of packets queued in kernel before sending them to userspace.
+	Threshold uint16
+	// Snaplen is the number of bytes copied to userspace; nil copies the whole packet.
+	Snaplen *uint32
+}
+
+// xt_nflog_info
+type xtNFLogInfo struct {
+	Len       uint32
+	Group     uint16
+	Threshold uint16
+	Flags     uint16
+	_         uint16
+	Prefix    [XT_NFLOG_PREFIX_LEN]byte
+}
+
+func init() {
+	RegisterTarget("LOG", 0, decodeLogTarget)
+	RegisterTarget("NFLOG", 0, decodeNFLogTarget)
+	registerTargetParser("LOG", map[string]optionSpec{
+		"--log-level": {1, false}, "--log-prefix": {1, false}, "--log-tcp-sequence": {0, false},
+		"--log-tcp-options": {0, false}, "--log-ip-options": {0, false}, "--log-uid": {0, false},
+		"--log-macdecode": {0, false},
+	}, parseLogTarget)
+	registerTargetParser("NFLOG", map[string]optionSpec{
+		"--nflog-group": {1, false}, "--nflog-prefix": {1, false}, "--nflog-size": {1, false},
+		"--nflog-range": {1, false}, "--nflog-threshold": {1, false},
+	}, parseNFLogTarget)
+}
+
+// Name returns "LOG".
+func (t *LogTarget) Name() string {
+	return "LOG"
+}
+
+// Revision returns 0.
+func (t *LogTarget) Revision() uint8 {
+	return 0
+}
+
+var logFlagNames = []struct {
+	flag uint8
+	name string
+}{
+	// same order as iptables-save
+	{XT_LOG_TCPSEQ, "--log-tcp-sequence"},
+	{XT_LOG_TCPOPT, "--log-tcp-options"},
+	{XT_LOG_IPOPT, "--log-ip-options"},
+	{XT_LOG_UID, "--log-uid"},
+	{XT_LOG_MACDECODE, "--log-macdecode"},
+}
+
+// Args returns the '--log-*' options in use; the level is numeric and omitted for LogLevelWarning,
+// as iptables-save does.
+func (t *LogTarget) Args() []string {
+	var args []string
+	if t.Prefix != "" {
+		args = append(args, "--log-prefix", t.Prefix)
+	}
+	if t.Level != LogLevelWarning {
+		args = append(args, "--log-level", decArg(uint64(t.Level)))
+	}
+	for _, n := range logFlagNames {
+		if t.Flags&n.flag != 0 {
+			args = append(args, n.name)
+		}
+	}
+	return args
+}
+
+// Encode returns a xt_log_info payload.
+func (t *LogTarget) Encode(family Family) ([]byte, error) {
+	if t.Level > LogLevelDebug {
+		return nil, fmt.Errorf("invalid log level %d", t.Level)
+	}
+	if t.Flags&^XT_LOG_MASK != 0 {
+		return nil, fmt.Errorf("invalid log flags %#x", t.Flags)
+	}
+	info := xtLogInfo{Level: uint8(t.Level), Logflags: t.Flags}
+	if err := putCString(info.Prefix[:], t.Prefix); err != nil {
+		return nil, err
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeLogTarget(family Family, data []byte) (Target, error) {
+	var info xtLogInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &LogTarget{
+		Level:  LogLevel(info.Level),
+		Flags:  info.Logflags,
+		Prefix: cString(info.Prefix[:]),
+	}, nil
+}
+
+// Name returns "NFLOG".
+func (t *NFLogTarget) Name() string {
+	return "NFLOG"
+}
+
+// Revision returns 0.
+func (t *NFLogTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--nflog-*' options in use.
+func (t *NFLogTarget) Args() []string {
+	var args []string
+	if t.Prefix != "" {
+		args = append(args, "--nflog-prefix", t.Prefix)
+	}
+	if t.Group != 0 {
+		args = append(args, "--nflog-group", decArg(uint64(t.Group)))
+	}
+	if t.Snaplen != nil {
+		args = append(args, "--nflog-size", decArg(uint64(*t.Snaplen)))
+	}
+	if t.Threshold != 0 {
+		args = append(args, "--nflog-threshold", decArg(uint64(t.Threshold)))
+	}
+	return args
+}
+
+// Encode returns a xt_nflog_info payload.
+func (t *NFLogTarget) Encode(family Family) ([]byte, error) {
+	info := xtNFLogInfo{Group: t.Group, Threshold: t.Threshold}
+	if t.Snaplen != nil {
+		info.Len = *t.Snaplen
+		info.Flags |= XT_NFLOG_F_COPY_LEN
+	}
+	if err := putCString(info.Prefix[:], t.Prefix); err != nil {
+		return nil, err
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeNFLogTarget(family Family, data []byte) (Target, error) {
+	var info xtNFLogInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	t := &NFLogTarget{
+		Group:     info.Group,
+		Threshold: info.Threshold,
+		Prefix:    cString(info.Prefix[:]),
+	}
+	if info.Flags&XT_NFLOG_F_COPY_LEN != 0 {
+		snaplen := info.Len
+		t.Snaplen = &snaplen
+	}
+	return t, nil
+}
+
+func parseLogTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &LogTarget{Level: LogLevelWarning}
+next:
+	for _, o := range opts {
+		var err error
+		switch o.name {
+		case "--log-level":
+			t.Level, err = ParseLogLevel(o.value())
+		case "--log-prefix":
+			if len(o.value()) >= XT_LOG_PREFIX_LEN {
+				err = fmt.Errorf("prefix too long, at most %d characters are allowed", XT_LOG_PREFIX_LEN-1)
+			}
+			t.Prefix = o.value()
+		default:
+			for _, n := range logFlagNames {
+				if n.name == o.name {
+					t.Flags |= n.flag
+					continue next
+				}
+			}
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return t, nil
+}
+
+func parseNFLogTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &NFLogTarget{}
+	for _, o := range opts {
+		var v uint64
+		var err error
+		switch o.name {
+		case "--nflog-group":
+			v, err = parseUint(o.value(), 16)
+			t.Group = uint16(v)
+		case "--nflog-prefix":
+			if len(o.value()) >= XT_NFLOG_PREFIX_LEN {
+				err = fmt.Errorf("prefix too long, at most %d characters are allowed", XT_NFLOG_PREFIX_LEN-1)
+			}
+			t.Prefix = o.value()
+		case "--nflog-size", "--nflog-range":
+			v, err = parseUint(o.value(), 32)
+			snaplen := uint32(v)
+			t.Snaplen = &snaplen
+		case "--nflog-threshold":
+			v, err = parseUint(o.value(), 16)
+			t.Threshold = uint16(v)
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return t, nil
+}
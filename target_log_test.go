@@ -0,0 +1,100 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLogTarget(t *testing.T) {
+	target := &LogTarget{Level: LogLevelInfo, Flags: XT_LOG_TCPSEQ | XT_LOG_UID, Prefix: "dropped: "}
+	decoded := roundTripTarget(t, FamilyIPv4, target)
+	if !reflect.DeepEqual(decoded, target) {
+		t.Fatalf("expected %#v, got %#v", target, decoded)
+	}
+
+	target.Prefix = "this prefix is way too long to fit"
+	if _, err := target.Encode(FamilyIPv4); err == nil {
+		t.Fatal("long prefix encoded")
+	}
+
+	for s, expected := range map[string]LogLevel{"info": LogLevelInfo, "7": LogLevelDebug, "panic": LogLevelEmerg} {
+		l, err := ParseLogLevel(s)
+		if err != nil || l != expected {
+			t.Errorf("%q: unexpected level %s, %v", s, l, err)
+		}
+	}
+	if _, err := ParseLogLevel("8"); err == nil {
+		t.Error("invalid level parsed")
+	}
+}
+
+func TestNFLogTarget(t *testing.T) {
+	snaplen := uint32(128)
+	for _, target := range []*NFLogTarget{
+		{Group: 5, Prefix: "nflog", Threshold: 10, Snaplen: &snaplen},
+		{Group: XT_NFLOG_DEFAULT_GROUP},
+	} {
+		decoded := roundTripTarget(t, FamilyIPv6, target)
+		if !reflect.DeepEqual(decoded, target) {
+			t.Errorf("expected %#v, got %#v", target, decoded)
+		}
+	}
+}
+
+func TestRejectTarget(t *testing.T) {
+	target := &RejectTarget{With: IPT_TCP_RESET}
+	decoded := roundTripTarget(t, FamilyIPv4, target)
+	if !reflect.DeepEqual(decoded, target) {
+		t.Fatalf("expected %#v, got %#v", target, decoded)
+	}
+
+	target6 := &Reject6Target{With: IP6T_ICMP6_ADM_PROHIBITED}
+	decoded = roundTripTarget(t, FamilyIPv6, target6)
+	if !reflect.DeepEqual(decoded, target6) {
+		t.Fatalf("expected %#v, got %#v", target6, decoded)
+	}
+
+	if _, err := target.Encode(FamilyIPv6); err == nil {
+		t.Fatal("IPv4 reject encoded for IPv6")
+	}
+	if w, err := ParseReject6With("icmp6-port-unreachable"); err != nil || w != IP6T_ICMP6_PORT_UNREACH {
+		t.Fatalf("unexpected reject type %s, %v", w, err)
+	}
+	if _, err := ParseRejectWith("icmp6-port-unreachable"); err == nil {
+		t.Fatal("IPv6 reject type parsed for IPv4")
+	}
+}
+
+func TestLogLayout(t *testing.T) {
+	data := payloadOf(t, FamilyIPv4, &LogTarget{Level: LogLevelInfo, Prefix: "ssh: "})
+	if data[0] != uint8(LogLevelInfo) || string(data[2:7]) != "ssh: " {
+		t.Errorf("level %d, prefix %q", data[0], data[2:7])
+	}
+
+	data = payloadOf(t, FamilyIPv4, &NFLogTarget{Group: 5, Threshold: 3, Prefix: "drop"})
+	if group, threshold := nativeEndian.Uint16(data[4:]), nativeEndian.Uint16(data[6:]); group != 5 || threshold != 3 {
+		t.Errorf("group %d, threshold %d", group, threshold)
+	}
+	if string(data[12:16]) != "drop" {
+		t.Errorf("prefix %q", data[12:16])
+	}
+}
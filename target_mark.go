@@ -0,0 +1,382 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// MarkTarget is the MARK target (revision 2); the new fwmark is computed as (fwmark &^ Mask) ^ Mark,
+// which covers all '--set-xmark', '--set-mark', '--and-mark', '--or-mark' and '--xor-mark' operations.
+type MarkTarget struct {
+	Mark uint32
+	Mask uint32
+}
+
+// NewSetXMark returns a MARK target equivalent to '--set-xmark value/mask'.
+func NewSetXMark(value, mask uint32) *MarkTarget {
+	return &MarkTarget{Mark: value, Mask: mask}
+}
+
+// NewSetMark returns a MARK target equivalent to '--set-mark value/mask': bits in mask are zeroed and value is ORed.
+func NewSetMark(value, mask uint32) *MarkTarget {
+	return &MarkTarget{Mark: value, Mask: mask | value}
+}
+
+// NewAndMark returns a MARK target equivalent to '--and-mark bits'.
+func NewAndMark(bits uint32) *MarkTarget {
+	return &MarkTarget{Mark: 0, Mask: ^bits}
+}
+
+// NewOrMark returns a MARK target equivalent to '--or-mark bits'.
+func NewOrMark(bits uint32) *MarkTarget {
+	return &MarkTarget{Mark: bits, Mask: bits}
+}
+
+// NewXorMark returns a MARK target equivalent to '--xor-mark bits'.
+func NewXorMark(bits uint32) *MarkTarget {
+	return &MarkTarget{Mark: bits, Mask: 0}
+}
+
+// xt_mark_tginfo2
+type xtMarkTginfo2 struct {
+	Mark uint32
+	Mask uint32
+}
+
+// ConnMarkMode is the operation performed by the CONNMARK target.
+type ConnMarkMode uint8
+
+const (
+	// the constants are copied from the mode enum in xt_connmark.h
+	XT_CONNMARK_SET ConnMarkMode = iota
+	XT_CONNMARK_SAVE
+	XT_CONNMARK_RESTORE
+)
+
+// String returns the mode name.
+func (m ConnMarkMode) String() string {
+	switch m {
+	case XT_CONNMARK_SET:
+		return "set"
+	case XT_CONNMARK_SAVE:
+		return "save"
+	case XT_CONNMARK_RESTORE:
+		return "restore"
+	}
+	return fmt.Sprintf("mode(%d)", uint8(m))
+}
+
+const (
+	// the constants are copied from the shift direction enum in xt_connmark.h
+	D_SHIFT_LEFT  = 0
+	D_SHIFT_RIGHT = 1
+)
+
+// ConnMarkTarget is the CONNMARK target. Depending on Mode:
+//   - XT_CONNMARK_SET: ctmark = (ctmark &^ CtMask) ^ CtMark
+//   - XT_CONNMARK_SAVE: ctmark = (ctmark &^ CtMask) ^ (fwmark & NfMask)
+//   - XT_CONNMARK_RESTORE: fwmark = (fwmark &^ NfMask) ^ (ctmark & CtMask)
+//
+// Revision 2 can additionally shift the copied mark by ShiftBits towards ShiftDir.
+type ConnMarkTarget struct {
+	// Rev is the revision of the payload layout, 1 or 2; zero selects the latest one.
+	Rev    uint8
+	Mode   ConnMarkMode
+	CtMark uint32
+	CtMask uint32
+	NfMask uint32
+	// ShiftDir is D_SHIFT_LEFT or D_SHIFT_RIGHT; shifts require revision 2.
+	ShiftDir  uint8
+	ShiftBits uint8
+}
+
+// NewConnMarkSave returns a CONNMARK target equivalent to '--save-mark --nfmask nfMask --ctmask ctMask'.
+func NewConnMarkSave(nfMask, ctMask uint32) *ConnMarkTarget {
+	return &ConnMarkTarget{Mode: XT_CONNMARK_SAVE, NfMask: nfMask, CtMask: ctMask}
+}
+
+// NewConnMarkRestore returns a CONNMARK target equivalent to '--restore-mark --nfmask nfMask --ctmask ctMask'.
+func NewConnMarkRestore(nfMask, ctMask uint32) *ConnMarkTarget {
+	return &ConnMarkTarget{Mode: XT_CONNMARK_RESTORE, NfMask: nfMask, CtMask: ctMask}
+}
+
+// NewConnMarkSetXMark returns a CONNMARK target equivalent to '--set-xmark value/mask'.
+func NewConnMarkSetXMark(value, mask uint32) *ConnMarkTarget {
+	return &ConnMarkTarget{Mode: XT_CONNMARK_SET, CtMark: value, CtMask: mask}
+}
+
+// xt_connmark_tginfo1
+type xtConnMarkTginfo1 struct {
+	Ctmark, Ctmask, Nfmask uint32
+	Mode                   uint8
+	_                      [3]byte
+}
+
+// xt_connmark_tginfo2
+type xtConnMarkTginfo2 struct {
+	Ctmark, Ctmask, Nfmask uint32
+	ShiftDir, ShiftBits    uint8
+	Mode                   uint8
+	_                      [1]byte
+}
+
+func init() {
+	RegisterTarget("MARK", 2, decodeMarkTarget)
+	RegisterTarget("CONNMARK", 1, decodeConnMarkTarget1)
+	RegisterTarget("CONNMARK", 2, decodeConnMarkTarget2)
+	registerTargetParser("MARK", map[string]optionSpec{
+		"--set-xmark": {1, false}, "--set-mark": {1, false},
+		"--and-mark": {1, false}, "--or-mark": {1, false}, "--xor-mark": {1, false},
+	}, parseMarkTarget)
+	registerTargetParser("CONNMARK", map[string]optionSpec{
+		"--set-xmark": {1, false}, "--set-mark": {1, false},
+		"--and-mark": {1, false}, "--or-mark": {1, false}, "--xor-mark": {1, false},
+		"--save-mark": {0, false}, "--restore-mark": {0, false},
+		"--nfmask": {1, false}, "--ctmask": {1, false}, "--mask": {1, false},
+		"--left-shift-mark": {1, false}, "--right-shift-mark": {1, false},
+	}, parseConnMarkTarget)
+}
+
+// Name returns "MARK".
+func (t *MarkTarget) Name() string {
+	return "MARK"
+}
+
+// Revision returns 2.
+func (t *MarkTarget) Revision() uint8 {
+	return 2
+}
+
+// Args returns the '--set-xmark' option, which iptables-save uses for all MARK operations.
+func (t *MarkTarget) Args() []string {
+	return []string{"--set-xmark", hexArg(t.Mark) + "/" + hexArg(t.Mask)}
+}
+
+// Encode returns a xt_mark_tginfo2 payload.
+func (t *MarkTarget) Encode(family Family) ([]byte, error) {
+	return encodeStruct(&xtMarkTginfo2{Mark: t.Mark, Mask: t.Mask}), nil
+}
+
+func decodeMarkTarget(family Family, data []byte) (Target, error) {
+	var info xtMarkTginfo2
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &MarkTarget{Mark: info.Mark, Mask: info.Mask}, nil
+}
+
+// Name returns "CONNMARK".
+func (t *ConnMarkTarget) Name() string {
+	return "CONNMARK"
+}
+
+// Revision returns the revision of the payload layout.
+func (t *ConnMarkTarget) Revision() uint8 {
+	if t.Rev == 0 {
+		return 2
+	}
+	return t.Rev
+}
+
+// Revisions returns Rev, or revisions 2 down to 1 when Rev is zero.
+func (t *ConnMarkTarget) Revisions() []uint8 {
+	return revisionsFrom(t.Rev, 2, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (t *ConnMarkTarget) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *t
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+// Args returns the options of the mode, followed by the shift options when ShiftBits is not zero.
+func (t *ConnMarkTarget) Args() []string {
+	var args []string
+	switch t.Mode {
+	case XT_CONNMARK_SET:
+		args = []string{"--set-xmark", hexArg(t.CtMark) + "/" + hexArg(t.CtMask)}
+	case XT_CONNMARK_SAVE:
+		args = []string{"--save-mark", "--nfmask", hexArg(t.NfMask), "--ctmask", hexArg(t.CtMask)}
+	case XT_CONNMARK_RESTORE:
+		args = []string{"--restore-mark", "--nfmask", hexArg(t.NfMask), "--ctmask", hexArg(t.CtMask)}
+	}
+	if t.ShiftBits != 0 {
+		shift := "--left-shift-mark"
+		if t.ShiftDir == D_SHIFT_RIGHT {
+			shift = "--right-shift-mark"
+		}
+		args = append(args, shift, decArg(uint64(t.ShiftBits)))
+	}
+	return args
+}
+
+// Encode returns a xt_connmark_tginfo1 or xt_connmark_tginfo2 payload, depending on revision.
+func (t *ConnMarkTarget) Encode(family Family) ([]byte, error) {
+	if t.Mode > XT_CONNMARK_RESTORE {
+		return nil, fmt.Errorf("invalid mode %d", t.Mode)
+	}
+	switch t.Revision() {
+	case 1:
+		if t.ShiftBits != 0 {
+			return nil, fmt.Errorf("shifts require revision 2")
+		}
+		return encodeStruct(&xtConnMarkTginfo1{
+			Ctmark: t.CtMark,
+			Ctmask: t.CtMask,
+			Nfmask: t.NfMask,
+			Mode:   uint8(t.Mode),
+		}), nil
+	case 2:
+		if t.ShiftDir > D_SHIFT_RIGHT || t.ShiftBits > 31 {
+			return nil, fmt.Errorf("invalid shift %d/%d", t.ShiftDir, t.ShiftBits)
+		}
+		return encodeStruct(&xtConnMarkTginfo2{
+			Ctmark:    t.CtMark,
+			Ctmask:    t.CtMask,
+			Nfmask:    t.NfMask,
+			ShiftDir:  t.ShiftDir,
+			ShiftBits: t.ShiftBits,
+			Mode:      uint8(t.Mode),
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported revision %d", t.Rev)
+}
+
+func decodeConnMarkTarget1(family Family, data []byte) (Target, error) {
+	var info xtConnMarkTginfo1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &ConnMarkTarget{
+		Rev:    1,
+		Mode:   ConnMarkMode(info.Mode),
+		CtMark: info.Ctmark,
+		CtMask: info.Ctmask,
+		NfMask: info.Nfmask,
+	}, nil
+}
+
+func decodeConnMarkTarget2(family Family, data []byte) (Target, error) {
+	var info xtConnMarkTginfo2
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &ConnMarkTarget{
+		Rev:       2,
+		Mode:      ConnMarkMode(info.Mode),
+		CtMark:    info.Ctmark,
+		CtMask:    info.Ctmask,
+		NfMask:    info.Nfmask,
+		ShiftDir:  info.ShiftDir,
+		ShiftBits: info.ShiftBits,
+	}, nil
+}
+
+// parseMarkOperation parses one of the '--set-xmark', '--set-mark', '--and-mark', '--or-mark' and '--xor-mark'
+// options shared by MARK and CONNMARK into the resulting mark and mask.
+func parseMarkOperation(o parsedOption) (*MarkTarget, error) {
+	if o.name == "--set-xmark" || o.name == "--set-mark" {
+		value, mask, err := parseValueMask(o.value(), 32)
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+		if o.name == "--set-mark" {
+			return NewSetMark(uint32(value), uint32(mask)), nil
+		}
+		return NewSetXMark(uint32(value), uint32(mask)), nil
+	}
+	bits, err := parseUint(o.value(), 32)
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	switch o.name {
+	case "--and-mark":
+		return NewAndMark(uint32(bits)), nil
+	case "--or-mark":
+		return NewOrMark(uint32(bits)), nil
+	}
+	return NewXorMark(uint32(bits)), nil
+}
+
+func parseMarkTarget(family Family, opts []parsedOption) (Target, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --set-xmark, --set-mark, --and-mark, --or-mark and --xor-mark is required")
+	}
+	return parseMarkOperation(opts[0])
+}
+
+func parseConnMarkTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &ConnMarkTarget{NfMask: 0xffffffff, CtMask: 0xffffffff}
+	modes, masks := 0, false
+	for _, o := range opts {
+		var v uint64
+		var err error
+		switch o.name {
+		case "--save-mark", "--restore-mark":
+			modes++
+			t.Mode = XT_CONNMARK_SAVE
+			if o.name == "--restore-mark" {
+				t.Mode = XT_CONNMARK_RESTORE
+			}
+		case "--nfmask":
+			masks = true
+			v, err = parseUint(o.value(), 32)
+			t.NfMask = uint32(v)
+		case "--ctmask":
+			masks = true
+			v, err = parseUint(o.value(), 32)
+			t.CtMask = uint32(v)
+		case "--mask":
+			masks = true
+			v, err = parseUint(o.value(), 32)
+			t.NfMask, t.CtMask = uint32(v), uint32(v)
+		case "--left-shift-mark", "--right-shift-mark":
+			if t.ShiftBits != 0 {
+				return nil, o.errorf("only one shift option is allowed")
+			}
+			v, err = parseUint(o.value(), 8)
+			if err == nil && v > 31 {
+				err = fmt.Errorf("shift must be between 0 and 31")
+			}
+			t.ShiftDir = D_SHIFT_LEFT
+			if o.name == "--right-shift-mark" {
+				t.ShiftDir = D_SHIFT_RIGHT
+			}
+			t.ShiftBits = uint8(v)
+		default:
+			modes++
+			var mark *MarkTarget
+			if mark, err = parseMarkOperation(o); err != nil {
+				return nil, err
+			}
+			t.Mode, t.CtMark, t.CtMask = XT_CONNMARK_SET, mark.Mark, mark.Mask
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if modes != 1 {
+		return nil, fmt.Errorf("exactly one of --set-xmark, --set-mark, --and-mark, --or-mark, --xor-mark, --save-mark and --restore-mark is required")
+	}
+	if masks && t.Mode == XT_CONNMARK_SET {
+		return nil, fmt.Errorf("--nfmask, --ctmask and --mask are only valid with --save-mark and --restore-mark")
+	}
+	return t, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkMatches(t *testing.T) {
+	for _, m := range []Match{
+		&Mark{Mark: 0x10, Mask: 0xff, Not: true},
+		&ConnMark{Mark: 0x1, Mask: 0xffffffff},
+	} {
+		decoded := roundTripMatch(t, FamilyIPv4, m)
+		if !reflect.DeepEqual(decoded, m) {
+			t.Errorf("expected %#v, got %#v", m, decoded)
+		}
+	}
+}
+
+func TestMarkTarget(t *testing.T) {
+	for _, tc := range []struct {
+		target      *MarkTarget
+		old, fwmark uint32
+	}{
+		{NewSetXMark(0x1, 0xff), 0x1234, 0x1201},
+		{NewSetMark(0x1, 0xf), 0x1234, 0x1231},
+		{NewAndMark(0xf0), 0x1234, 0x0030},
+		{NewOrMark(0x1), 0x1234, 0x1235},
+		{NewXorMark(0x4), 0x1234, 0x1230},
+	} {
+		// same computation as the kernel
+		if got := (tc.old &^ tc.target.Mask) ^ tc.target.Mark; got != tc.fwmark {
+			t.Errorf("%#v: expected %#x, got %#x", tc.target, tc.fwmark, got)
+		}
+		decoded := roundTripTarget(t, FamilyIPv4, tc.target)
+		if !reflect.DeepEqual(decoded, tc.target) {
+			t.Errorf("expected %#v, got %#v", tc.target, decoded)
+		}
+	}
+}
+
+func TestConnMarkTarget(t *testing.T) {
+	for _, target := range []*ConnMarkTarget{
+		{Rev: 1, Mode: XT_CONNMARK_SAVE, NfMask: 0xff, CtMask: 0xff},
+		{Rev: 2, Mode: XT_CONNMARK_RESTORE, NfMask: 0xff00, CtMask: 0xff, ShiftDir: D_SHIFT_LEFT, ShiftBits: 8},
+		{Rev: 2, Mode: XT_CONNMARK_SET, CtMark: 0x1, CtMask: 0x1},
+	} {
+		decoded := roundTripTarget(t, FamilyIPv6, target)
+		if !reflect.DeepEqual(decoded, target) {
+			t.Errorf("expected %#v, got %#v", target, decoded)
+		}
+	}
+
+	_, err := (&ConnMarkTarget{Rev: 1, ShiftBits: 1}).Encode(FamilyIPv4)
+	if err == nil {
+		t.Error("shift encoded in revision 1")
+	}
+}
+
+func TestMarkLayout(t *testing.T) {
+	data := payloadOf(t, FamilyIPv4, &Mark{Mark: 1, Mask: 0xff, Not: true})
+	if mark, mask := nativeEndian.Uint32(data[0:]), nativeEndian.Uint32(data[4:]); mark != 1 || mask != 0xff || data[8] != 1 {
+		t.Errorf("mark %#x, mask %#x, invert %d", mark, mask, data[8])
+	}
+
+	// revision 2 inserts the shift between nfmask and mode
+	for _, tc := range []struct {
+		target *ConnMarkTarget
+		mode   int
+	}{
+		{&ConnMarkTarget{Rev: 1, Mode: XT_CONNMARK_RESTORE, NfMask: 0xff00}, 12},
+		{&ConnMarkTarget{Rev: 2, Mode: XT_CONNMARK_RESTORE, NfMask: 0xff00, ShiftDir: D_SHIFT_RIGHT, ShiftBits: 8}, 14},
+	} {
+		data := payloadOf(t, FamilyIPv4, tc.target)
+		if nfmask := nativeEndian.Uint32(data[8:]); nfmask != 0xff00 {
+			t.Errorf("revision %d: nfmask %#x", tc.target.Rev, nfmask)
+		}
+		if data[tc.mode] != uint8(XT_CONNMARK_RESTORE) {
+			t.Errorf("revision %d: mode %d", tc.target.Rev, data[tc.mode])
+		}
+		if tc.target.Rev == 2 && (data[12] != D_SHIFT_RIGHT || data[13] != 8) {
+			t.Errorf("shift_dir %d, shift_bits %d", data[12], data[13])
+		}
+	}
+}
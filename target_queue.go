@@ -0,0 +1,263 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// ClassifyTarget is the CLASSIFY target, setting the traffic control class of packets.
+type ClassifyTarget struct {
+	Major uint16
+	Minor uint16
+}
+
+// ParseClassify parses a class in tc notation, "major:minor" with hexadecimal numbers.
+func ParseClassify(s string) (*ClassifyTarget, error) {
+	var t ClassifyTarget
+	var rest string
+	if n, _ := fmt.Sscanf(s+" ", "%x:%x%s", &t.Major, &t.Minor, &rest); n != 2 {
+		return nil, fmt.Errorf("invalid class %q", s)
+	}
+	return &t, nil
+}
+
+// String returns the class in tc notation, as printed by iptables-save.
+func (t *ClassifyTarget) String() string {
+	return fmt.Sprintf("%x:%x", t.Major, t.Minor)
+}
+
+// xt_classify_target_info
+type xtClassifyTargetInfo struct {
+	Priority uint32
+}
+
+const (
+	// the constants are copied from #define declarations in xt_NFQUEUE.h
+	NFQ_FLAG_BYPASS     = 0x01
+	NFQ_FLAG_CPU_FANOUT = 0x02
+)
+
+// NFQueueTarget is the NFQUEUE target, passing packets to userspace.
+type NFQueueTarget struct {
+	// Rev is the revision of the target, from 1 to 3; zero selects the latest one.
+	Rev uint8
+	// Num is the queue number, or the first queue when balancing.
+	Num uint16
+	// Total is the number of queues for '--queue-balance Num:Num+Total-1'; zero or one for a single queue.
+	Total uint16
+	// Bypass accepts packets when no program is listening (revision 2 or later).
+	Bypass bool
+	// CPUFanout selects the queue by CPU instead of by flow hash when balancing (revision 3).
+	CPUFanout bool
+}
+
+// xt_NFQ_info_v3; earlier revisions are prefixes of it
+type xtNFQInfoV3 struct {
+	Queuenum    uint16
+	QueuesTotal uint16
+	Flags       uint16
+}
+
+func init() {
+	RegisterTarget("CLASSIFY", 0, decodeClassifyTarget)
+	for rev := uint8(1); rev <= 3; rev++ {
+		rev := rev
+		RegisterTarget("NFQUEUE", rev, func(family Family, data []byte) (Target, error) {
+			return decodeNFQueueTarget(rev, data)
+		})
+	}
+	registerTargetParser("CLASSIFY", map[string]optionSpec{"--set-class": {1, false}}, parseClassifyTarget)
+	registerTargetParser("NFQUEUE", map[string]optionSpec{
+		"--queue-num": {1, false}, "--queue-balance": {1, false}, "--queue-bypass": {0, false}, "--queue-cpu-fanout": {0, false},
+	}, parseNFQueueTarget)
+}
+
+// Name returns "CLASSIFY".
+func (t *ClassifyTarget) Name() string {
+	return "CLASSIFY"
+}
+
+// Revision returns 0.
+func (t *ClassifyTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--set-class' option.
+func (t *ClassifyTarget) Args() []string {
+	return []string{"--set-class", t.String()}
+}
+
+// Encode returns a xt_classify_target_info payload.
+func (t *ClassifyTarget) Encode(family Family) ([]byte, error) {
+	return encodeStruct(&xtClassifyTargetInfo{Priority: uint32(t.Major)<<16 | uint32(t.Minor)}), nil
+}
+
+func decodeClassifyTarget(family Family, data []byte) (Target, error) {
+	var info xtClassifyTargetInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &ClassifyTarget{Major: uint16(info.Priority >> 16), Minor: uint16(info.Priority)}, nil
+}
+
+// Name returns "NFQUEUE".
+func (t *NFQueueTarget) Name() string {
+	return "NFQUEUE"
+}
+
+// Revision returns the revision of the target.
+func (t *NFQueueTarget) Revision() uint8 {
+	if t.Rev == 0 {
+		return 3
+	}
+	return t.Rev
+}
+
+// Revisions returns Rev, or revisions 3 down to 1 when Rev is zero.
+func (t *NFQueueTarget) Revisions() []uint8 {
+	return revisionsFrom(t.Rev, 3, 1)
+}
+
+// EncodeRevision returns the payload of the specified revision, see Encode.
+func (t *NFQueueTarget) EncodeRevision(family Family, rev uint8) ([]byte, error) {
+	c := *t
+	c.Rev = rev
+	return c.Encode(family)
+}
+
+// Args returns the '--queue-num' option, or '--queue-balance' for multiple queues, followed by the flags in use.
+func (t *NFQueueTarget) Args() []string {
+	var args []string
+	if t.Total > 1 {
+		args = []string{"--queue-balance", fmt.Sprintf("%d:%d", t.Num, int(t.Num)+int(t.Total)-1)}
+	} else {
+		args = []string{"--queue-num", decArg(uint64(t.Num))}
+	}
+	if t.Bypass {
+		args = append(args, "--queue-bypass")
+	}
+	if t.CPUFanout {
+		args = append(args, "--queue-cpu-fanout")
+	}
+	return args
+}
+
+// Encode returns a xt_NFQ_info_v1, xt_NFQ_info_v2 or xt_NFQ_info_v3 payload, depending on revision.
+func (t *NFQueueTarget) Encode(family Family) ([]byte, error) {
+	rev := t.Revision()
+	info := xtNFQInfoV3{Queuenum: t.Num, QueuesTotal: t.Total}
+	if info.QueuesTotal == 0 {
+		info.QueuesTotal = 1
+	}
+	if uint32(info.Queuenum)+uint32(info.QueuesTotal)-1 > 0xffff {
+		return nil, fmt.Errorf("queue balance range %d:%d out of bounds", t.Num, uint32(t.Num)+uint32(t.Total)-1)
+	}
+	if t.Bypass {
+		info.Flags |= NFQ_FLAG_BYPASS
+	}
+	if t.CPUFanout {
+		info.Flags |= NFQ_FLAG_CPU_FANOUT
+	}
+
+	data := encodeStruct(&info)
+	switch {
+	case rev > 3:
+		return nil, fmt.Errorf("unsupported revision %d", rev)
+	case rev < 2 && t.Bypass:
+		return nil, fmt.Errorf("queue bypass requires revision 2")
+	case rev < 3 && t.CPUFanout:
+		return nil, fmt.Errorf("CPU fanout requires revision 3")
+	case rev == 1:
+		return data[:4], nil
+	}
+	return data, nil
+}
+
+func decodeNFQueueTarget(rev uint8, data []byte) (Target, error) {
+	// pad earlier revisions to the latest layout
+	var info xtNFQInfoV3
+	size := 6
+	if rev == 1 {
+		size = 4
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("payload too short: %d bytes, expected %d", len(data), size)
+	}
+	padded := make([]byte, sizeOf(info))
+	copy(padded, data[:size])
+	if err := decodeStruct(padded, &info); err != nil {
+		return nil, err
+	}
+	t := &NFQueueTarget{
+		Rev:       rev,
+		Num:       info.Queuenum,
+		Total:     info.QueuesTotal,
+		Bypass:    info.Flags&NFQ_FLAG_BYPASS != 0,
+		CPUFanout: info.Flags&NFQ_FLAG_CPU_FANOUT != 0,
+	}
+	if t.Total == 1 {
+		t.Total = 0
+	}
+	return t, nil
+}
+
+func parseClassifyTarget(family Family, opts []parsedOption) (Target, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("--set-class is required")
+	}
+	t, err := ParseClassify(opts[0].value())
+	if err != nil {
+		return nil, opts[0].errorf("%v", err)
+	}
+	return t, nil
+}
+
+func parseNFQueueTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &NFQueueTarget{}
+	queues := 0
+	for _, o := range opts {
+		var err error
+		switch o.name {
+		case "--queue-num":
+			queues++
+			var num uint64
+			num, err = parseUint(o.value(), 16)
+			t.Num = uint16(num)
+		case "--queue-balance":
+			queues++
+			var first, last uint64
+			first, last, err = parseRange(o.value(), ":", 16)
+			if err == nil && first == last {
+				err = fmt.Errorf("queue range %q must include at least two queues", o.value())
+			}
+			t.Num, t.Total = uint16(first), uint16(last-first+1)
+		case "--queue-bypass":
+			t.Bypass = true
+		case "--queue-cpu-fanout":
+			t.CPUFanout = true
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if queues > 1 {
+		return nil, fmt.Errorf("--queue-num and --queue-balance are mutually exclusive")
+	}
+	return t, nil
+}
@@ -0,0 +1,223 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+// RejectWith is the type of reply sent by the IPv4 REJECT target, as in enum ipt_reject_with.
+type RejectWith uint32
+
+const (
+	// the constants are copied from enum ipt_reject_with in ipt_REJECT.h
+	IPT_ICMP_NET_UNREACHABLE RejectWith = iota
+	IPT_ICMP_HOST_UNREACHABLE
+	IPT_ICMP_PROT_UNREACHABLE
+	IPT_ICMP_PORT_UNREACHABLE
+	IPT_ICMP_ECHOREPLY
+	IPT_ICMP_NET_PROHIBITED
+	IPT_ICMP_HOST_PROHIBITED
+	IPT_TCP_RESET
+	IPT_ICMP_ADMIN_PROHIBITED
+)
+
+var rejectWithNames = []string{
+	"icmp-net-unreachable",
+	"icmp-host-unreachable",
+	"icmp-proto-unreachable",
+	"icmp-port-unreachable",
+	"icmp-echo-reply",
+	"icmp-net-prohibited",
+	"icmp-host-prohibited",
+	"tcp-reset",
+	"icmp-admin-prohibited",
+}
+
+// String returns the reply type name, as accepted by '--reject-with'.
+func (w RejectWith) String() string {
+	if int(w) < len(rejectWithNames) {
+		return rejectWithNames[w]
+	}
+	return fmt.Sprintf("reject-with(%d)", uint32(w))
+}
+
+// ParseRejectWith parses an IPv4 reply type name, like "tcp-reset".
+func ParseRejectWith(s string) (RejectWith, error) {
+	for i, name := range rejectWithNames {
+		if s == name {
+			return RejectWith(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid IPv4 reject type %q", s)
+}
+
+// Reject6With is the type of reply sent by the IPv6 REJECT target, as in enum ip6t_reject_with.
+type Reject6With uint32
+
+const (
+	// the constants are copied from enum ip6t_reject_with in ip6t_REJECT.h
+	IP6T_ICMP6_NO_ROUTE Reject6With = iota
+	IP6T_ICMP6_ADM_PROHIBITED
+	IP6T_ICMP6_NOT_NEIGHBOUR
+	IP6T_ICMP6_ADDR_UNREACH
+	IP6T_ICMP6_PORT_UNREACH
+	IP6T_ICMP6_ECHOREPLY
+	IP6T_TCP_RESET
+	IP6T_ICMP6_POLICY_FAIL
+	IP6T_ICMP6_REJECT_ROUTE
+)
+
+var reject6WithNames = []string{
+	"icmp6-no-route",
+	"icmp6-adm-prohibited",
+	"icmp6-not-neighbour",
+	"icmp6-addr-unreachable",
+	"icmp6-port-unreachable",
+	"icmp6-echo-reply",
+	"tcp-reset",
+	"icmp6-policy-fail",
+	"icmp6-reject-route",
+}
+
+// String returns the reply type name, as accepted by '--reject-with'.
+func (w Reject6With) String() string {
+	if int(w) < len(reject6WithNames) {
+		return reject6WithNames[w]
+	}
+	return fmt.Sprintf("reject-with(%d)", uint32(w))
+}
+
+// ParseReject6With parses an IPv6 reply type name, like "icmp6-adm-prohibited".
+func ParseReject6With(s string) (Reject6With, error) {
+	for i, name := range reject6WithNames {
+		if s == name {
+			return Reject6With(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid IPv6 reject type %q", s)
+}
+
+// RejectTarget is the IPv4 REJECT target; iptables uses IPT_ICMP_PORT_UNREACHABLE by default.
+type RejectTarget struct {
+	With RejectWith
+}
+
+// Reject6Target is the IPv6 REJECT target; ip6tables uses IP6T_ICMP6_PORT_UNREACH by default.
+type Reject6Target struct {
+	With Reject6With
+}
+
+// ipt_reject_info and ip6t_reject_info
+type xtRejectInfo struct {
+	With uint32
+}
+
+func init() {
+	RegisterTarget("REJECT", 0, decodeRejectTarget)
+	registerTargetParser("REJECT", map[string]optionSpec{"--reject-with": {1, false}}, parseRejectTarget)
+}
+
+// Name returns "REJECT".
+func (t *RejectTarget) Name() string {
+	return "REJECT"
+}
+
+// Revision returns 0.
+func (t *RejectTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--reject-with' option.
+func (t *RejectTarget) Args() []string {
+	return []string{"--reject-with", t.With.String()}
+}
+
+// Encode returns a ipt_reject_info payload.
+func (t *RejectTarget) Encode(family Family) ([]byte, error) {
+	if family != FamilyIPv4 {
+		return nil, fmt.Errorf("not supported for %s", family)
+	}
+	if t.With > IPT_ICMP_ADMIN_PROHIBITED {
+		return nil, fmt.Errorf("invalid reject type %d", t.With)
+	}
+	return encodeStruct(&xtRejectInfo{With: uint32(t.With)}), nil
+}
+
+// Name returns "REJECT".
+func (t *Reject6Target) Name() string {
+	return "REJECT"
+}
+
+// Revision returns 0.
+func (t *Reject6Target) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--reject-with' option.
+func (t *Reject6Target) Args() []string {
+	return []string{"--reject-with", t.With.String()}
+}
+
+// Encode returns a ip6t_reject_info payload.
+func (t *Reject6Target) Encode(family Family) ([]byte, error) {
+	if family != FamilyIPv6 {
+		return nil, fmt.Errorf("not supported for %s", family)
+	}
+	if t.With > IP6T_ICMP6_REJECT_ROUTE {
+		return nil, fmt.Errorf("invalid reject type %d", t.With)
+	}
+	return encodeStruct(&xtRejectInfo{With: uint32(t.With)}), nil
+}
+
+// decodeRejectTarget returns a RejectTarget or a Reject6Target, depending on family.
+func decodeRejectTarget(family Family, data []byte) (Target, error) {
+	var info xtRejectInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	switch family {
+	case FamilyIPv4:
+		return &RejectTarget{With: RejectWith(info.With)}, nil
+	case FamilyIPv6:
+		return &Reject6Target{With: Reject6With(info.With)}, nil
+	}
+	return nil, fmt.Errorf("not supported for %s", family)
+}
+
+// parseRejectTarget returns a RejectTarget or a Reject6Target depending on family.
+func parseRejectTarget(family Family, opts []parsedOption) (Target, error) {
+	if family == FamilyIPv6 {
+		t := &Reject6Target{With: IP6T_ICMP6_PORT_UNREACH}
+		for _, o := range opts {
+			var err error
+			if t.With, err = ParseReject6With(o.value()); err != nil {
+				return nil, o.errorf("%v", err)
+			}
+		}
+		return t, nil
+	}
+	t := &RejectTarget{With: IPT_ICMP_PORT_UNREACHABLE}
+	for _, o := range opts {
+		var err error
+		if t.With, err = ParseRejectWith(o.value()); err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	return t, nil
+}
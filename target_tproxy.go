@@ -0,0 +1,203 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// TProxyTarget is the TPROXY target (revision 1), redirecting packets to a local socket without changing them;
+// it is only valid in the mangle table.
+type TProxyTarget struct {
+	// Addr is the address to redirect to; the zero Addr for the primary address of the incoming interface.
+	Addr netip.Addr
+	// Port is the port to redirect to; zero to keep the destination port.
+	Port uint16
+	// Mark and Mask set the fwmark of redirected packets, as (fwmark &^ Mask) ^ Mark.
+	Mark uint32
+	Mask uint32
+}
+
+// xt_tproxy_target_info_v1
+type xtTproxyTargetInfoV1 struct {
+	MarkMask  uint32
+	MarkValue uint32
+	Laddr     [16]byte
+	Lport     uint16
+	_         [2]byte
+}
+
+// XT_TCPMSS_CLAMP_PMTU is copied from #define declarations in xt_TCPMSS.h.
+const XT_TCPMSS_CLAMP_PMTU = 0xffff
+
+// TCPMSSTarget is the TCPMSS target, rewriting the MSS option of TCP SYN packets.
+type TCPMSSTarget struct {
+	// MSS is the new value, or XT_TCPMSS_CLAMP_PMTU for '--clamp-mss-to-pmtu'.
+	MSS uint16
+}
+
+// xt_tcpmss_info
+type xtTcpmssInfo struct {
+	Mss uint16
+}
+
+func init() {
+	RegisterTarget("TPROXY", 1, decodeTProxyTarget)
+	RegisterTarget("TCPMSS", 0, decodeTCPMSSTarget)
+	registerTargetParser("TPROXY", map[string]optionSpec{
+		"--on-port": {1, false}, "--on-ip": {1, false}, "--tproxy-mark": {1, false},
+	}, parseTProxyTarget)
+	registerTargetParser("TCPMSS", map[string]optionSpec{"--set-mss": {1, false}, "--clamp-mss-to-pmtu": {0, false}}, parseTCPMSSTarget)
+}
+
+// Name returns "TPROXY".
+func (t *TProxyTarget) Name() string {
+	return "TPROXY"
+}
+
+// Revision returns 1.
+func (t *TProxyTarget) Revision() uint8 {
+	return 1
+}
+
+// Args returns the '--on-port', '--on-ip' and '--tproxy-mark' options in use.
+func (t *TProxyTarget) Args() []string {
+	args := []string{"--on-port", decArg(uint64(t.Port))}
+	if t.Addr.IsValid() {
+		args = append(args, "--on-ip", t.Addr.String())
+	}
+	if t.Mark != 0 || t.Mask != 0 {
+		args = append(args, "--tproxy-mark", hexArg(t.Mark)+"/"+hexArg(t.Mask))
+	}
+	return args
+}
+
+// Encode returns a xt_tproxy_target_info_v1 payload.
+func (t *TProxyTarget) Encode(family Family) ([]byte, error) {
+	info := xtTproxyTargetInfoV1{
+		MarkMask:  t.Mask,
+		MarkValue: t.Mark,
+		Lport:     hton16(t.Port),
+	}
+	if t.Addr.IsValid() {
+		var err error
+		if info.Laddr, err = putInetIP(family, t.Addr); err != nil {
+			return nil, err
+		}
+	}
+	return encodeStruct(&info), nil
+}
+
+func decodeTProxyTarget(family Family, data []byte) (Target, error) {
+	var info xtTproxyTargetInfoV1
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	t := &TProxyTarget{
+		Port: hton16(info.Lport),
+		Mark: info.MarkValue,
+		Mask: info.MarkMask,
+	}
+	if info.Laddr != [16]byte{} {
+		t.Addr = getInetIP(family, info.Laddr)
+	}
+	return t, nil
+}
+
+// Name returns "TCPMSS".
+func (t *TCPMSSTarget) Name() string {
+	return "TCPMSS"
+}
+
+// Revision returns 0.
+func (t *TCPMSSTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--set-mss' or '--clamp-mss-to-pmtu' option.
+func (t *TCPMSSTarget) Args() []string {
+	if t.MSS == XT_TCPMSS_CLAMP_PMTU {
+		return []string{"--clamp-mss-to-pmtu"}
+	}
+	return []string{"--set-mss", decArg(uint64(t.MSS))}
+}
+
+// Encode returns a xt_tcpmss_info payload.
+func (t *TCPMSSTarget) Encode(family Family) ([]byte, error) {
+	if t.MSS == 0 {
+		return nil, fmt.Errorf("invalid MSS 0")
+	}
+	return encodeStruct(&xtTcpmssInfo{Mss: t.MSS}), nil
+}
+
+func decodeTCPMSSTarget(family Family, data []byte) (Target, error) {
+	var info xtTcpmssInfo
+	if err := decodeStruct(data, &info); err != nil {
+		return nil, err
+	}
+	return &TCPMSSTarget{MSS: info.Mss}, nil
+}
+
+func parseTProxyTarget(family Family, opts []parsedOption) (Target, error) {
+	t := &TProxyTarget{}
+	hasPort := false
+	for _, o := range opts {
+		var err error
+		switch o.name {
+		case "--on-port":
+			hasPort = true
+			t.Port, err = parsePort(o.value())
+		case "--on-ip":
+			if t.Addr, err = netip.ParseAddr(o.value()); err == nil {
+				_, err = putInetIP(family, t.Addr)
+			}
+		case "--tproxy-mark":
+			var mark, mask uint64
+			mark, mask, err = parseValueMask(o.value(), 32)
+			t.Mark, t.Mask = uint32(mark), uint32(mask)
+		}
+		if err != nil {
+			return nil, o.errorf("%v", err)
+		}
+	}
+	if !hasPort {
+		return nil, fmt.Errorf("--on-port is required")
+	}
+	return t, nil
+}
+
+func parseTCPMSSTarget(family Family, opts []parsedOption) (Target, error) {
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("exactly one of --set-mss and --clamp-mss-to-pmtu is required")
+	}
+	o := opts[0]
+	if o.name == "--clamp-mss-to-pmtu" {
+		return &TCPMSSTarget{MSS: XT_TCPMSS_CLAMP_PMTU}, nil
+	}
+	mss, err := parseUint(o.value(), 16)
+	if err == nil && mss == XT_TCPMSS_CLAMP_PMTU {
+		err = fmt.Errorf("MSS %d is reserved", mss)
+	}
+	if err != nil {
+		return nil, o.errorf("%v", err)
+	}
+	return &TCPMSSTarget{MSS: uint16(mss)}, nil
+}
@@ -0,0 +1,305 @@
+/*
+ * go-libiptc v0.3.1 - libiptc bindings for Go language
+ * Copyright (C) 2015~2016 gdm85 - https://github.com/gdm85/go-libiptc/
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+*/
+
+package libiptc
+
+import "fmt"
+
+const (
+	// the constants are copied from the anonymous enums in ipt_TTL.h and ip6t_HL.h
+	IPT_TTL_SET = 0
+	IPT_TTL_INC = 1
+	IPT_TTL_DEC = 2
+
+	IP6T_HL_SET = 0
+	IP6T_HL_INC = 1
+	IP6T_HL_DEC = 2
+
+	// the constants are copied from the anonymous enums in ipt_ttl.h and ip6t_hl.h
+	IPT_TTL_EQ = 0
+	IPT_TTL_NE = 1
+	IPT_TTL_LT = 2
+	IPT_TTL_GT = 3
+
+	IP6T_HL_EQ = 0
+	IP6T_HL_NE = 1
+	IP6T_HL_LT = 2
+	IP6T_HL_GT = 3
+)
+
+// TTLTarget is the IPv4 TTL target, only valid in the mangle table.
+type TTLTarget struct {
+	// Mode is one of IPT_TTL_SET, IPT_TTL_INC or IPT_TTL_DEC.
+	Mode  uint8
+	Value uint8
+}
+
+// HLTarget is the IPv6 HL target, only valid in the mangle table.
+type HLTarget struct {
+	// Mode is one of IP6T_HL_SET, IP6T_HL_INC or IP6T_HL_DEC.
+	Mode  uint8
+	Value uint8
+}
+
+// TTL is the IPv4 'ttl' match; '! --ttl-eq' is expressed with IPT_TTL_NE.
+type TTL struct {
+	// Mode is one of IPT_TTL_EQ, IPT_TTL_NE, IPT_TTL_LT or IPT_TTL_GT.
+	Mode  uint8
+	Value uint8
+}
+
+// HL is the IPv6 'hl' match; '! --hl-eq' is expressed with IP6T_HL_NE.
+type HL struct {
+	// Mode is one of IP6T_HL_EQ, IP6T_HL_NE, IP6T_HL_LT or IP6T_HL_GT.
+	Mode  uint8
+	Value uint8
+}
+
+// ipt_TTL_info, ip6t_HL_info, ipt_ttl_info and ip6t_hl_info
+type xtTTLInfo struct {
+	Mode  uint8
+	Value uint8
+}
+
+func init() {
+	RegisterTarget("TTL", 0, decodeTTLTarget)
+	RegisterTarget("HL", 0, decodeHLTarget)
+	RegisterMatch("ttl", 0, decodeTTL)
+	RegisterMatch("hl", 0, decodeHL)
+	registerTargetParser("TTL", map[string]optionSpec{
+		"--ttl-set": {1, false}, "--ttl-inc": {1, false}, "--ttl-dec": {1, false},
+	}, func(family Family, opts []parsedOption) (Target, error) {
+		mode, value, err := parseTTLOption(family, FamilyIPv4, "--ttl", false, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &TTLTarget{Mode: mode, Value: value}, nil
+	})
+	registerTargetParser("HL", map[string]optionSpec{
+		"--hl-set": {1, false}, "--hl-inc": {1, false}, "--hl-dec": {1, false},
+	}, func(family Family, opts []parsedOption) (Target, error) {
+		mode, value, err := parseTTLOption(family, FamilyIPv6, "--hl", false, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &HLTarget{Mode: mode, Value: value}, nil
+	})
+	registerMatchParser("ttl", map[string]optionSpec{
+		"--ttl-eq": {1, true}, "--ttl-lt": {1, false}, "--ttl-gt": {1, false},
+	}, func(family Family, opts []parsedOption) (Match, error) {
+		mode, value, err := parseTTLOption(family, FamilyIPv4, "--ttl", true, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &TTL{Mode: mode, Value: value}, nil
+	})
+	registerMatchParser("hl", map[string]optionSpec{
+		"--hl-eq": {1, true}, "--hl-lt": {1, false}, "--hl-gt": {1, false},
+	}, func(family Family, opts []parsedOption) (Match, error) {
+		mode, value, err := parseTTLOption(family, FamilyIPv6, "--hl", true, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &HL{Mode: mode, Value: value}, nil
+	})
+}
+
+// encodeTTLInfo validates family and mode for all the TTL and hop limit extensions.
+func encodeTTLInfo(family, expected Family, mode, maxMode, value uint8) ([]byte, error) {
+	if family != expected {
+		return nil, fmt.Errorf("not supported for %s", family)
+	}
+	if mode > maxMode {
+		return nil, fmt.Errorf("invalid mode %d", mode)
+	}
+	return encodeStruct(&xtTTLInfo{Mode: mode, Value: value}), nil
+}
+
+// ttlArgs returns the option of the TTL and hop limit extensions, like '--ttl-set 64' or '! --hl-eq 1';
+// prefix is "--ttl" or "--hl".
+func ttlArgs(prefix string, isMatch bool, mode, value uint8) []string {
+	names := []string{"-set", "-inc", "-dec"}
+	if isMatch {
+		names = []string{"-eq", "-eq", "-lt", "-gt"}
+	}
+	if int(mode) >= len(names) {
+		return nil
+	}
+	// IPT_TTL_NE and IP6T_HL_NE share the same value
+	return appendOpt(nil, Not(isMatch && mode == IPT_TTL_NE), prefix+names[mode], decArg(uint64(value)))
+}
+
+// decodeTTLInfo is the counterpart of encodeTTLInfo.
+func decodeTTLInfo(family, expected Family, data []byte) (info xtTTLInfo, err error) {
+	if family != expected {
+		err = fmt.Errorf("not supported for %s", family)
+		return
+	}
+	err = decodeStruct(data, &info)
+	return
+}
+
+// Name returns "TTL".
+func (t *TTLTarget) Name() string {
+	return "TTL"
+}
+
+// Revision returns 0.
+func (t *TTLTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--ttl-set', '--ttl-inc' or '--ttl-dec' option.
+func (t *TTLTarget) Args() []string {
+	return ttlArgs("--ttl", false, t.Mode, t.Value)
+}
+
+// Encode returns a ipt_TTL_info payload.
+func (t *TTLTarget) Encode(family Family) ([]byte, error) {
+	if t.Mode != IPT_TTL_SET && t.Value == 0 {
+		return nil, fmt.Errorf("increment or decrement by zero")
+	}
+	return encodeTTLInfo(family, FamilyIPv4, t.Mode, IPT_TTL_DEC, t.Value)
+}
+
+func decodeTTLTarget(family Family, data []byte) (Target, error) {
+	info, err := decodeTTLInfo(family, FamilyIPv4, data)
+	if err != nil {
+		return nil, err
+	}
+	return &TTLTarget{Mode: info.Mode, Value: info.Value}, nil
+}
+
+// Name returns "HL".
+func (t *HLTarget) Name() string {
+	return "HL"
+}
+
+// Revision returns 0.
+func (t *HLTarget) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--hl-set', '--hl-inc' or '--hl-dec' option.
+func (t *HLTarget) Args() []string {
+	return ttlArgs("--hl", false, t.Mode, t.Value)
+}
+
+// Encode returns a ip6t_HL_info payload.
+func (t *HLTarget) Encode(family Family) ([]byte, error) {
+	if t.Mode != IP6T_HL_SET && t.Value == 0 {
+		return nil, fmt.Errorf("increment or decrement by zero")
+	}
+	return encodeTTLInfo(family, FamilyIPv6, t.Mode, IP6T_HL_DEC, t.Value)
+}
+
+func decodeHLTarget(family Family, data []byte) (Target, error) {
+	info, err := decodeTTLInfo(family, FamilyIPv6, data)
+	if err != nil {
+		return nil, err
+	}
+	return &HLTarget{Mode: info.Mode, Value: info.Value}, nil
+}
+
+// Name returns "ttl".
+func (m *TTL) Name() string {
+	return "ttl"
+}
+
+// Revision returns 0.
+func (m *TTL) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--ttl-eq', '--ttl-lt' or '--ttl-gt' option.
+func (m *TTL) Args() []string {
+	return ttlArgs("--ttl", true, m.Mode, m.Value)
+}
+
+// Encode returns a ipt_ttl_info payload.
+func (m *TTL) Encode(family Family) ([]byte, error) {
+	return encodeTTLInfo(family, FamilyIPv4, m.Mode, IPT_TTL_GT, m.Value)
+}
+
+func decodeTTL(family Family, data []byte) (Match, error) {
+	info, err := decodeTTLInfo(family, FamilyIPv4, data)
+	if err != nil {
+		return nil, err
+	}
+	return &TTL{Mode: info.Mode, Value: info.Value}, nil
+}
+
+// Name returns "hl".
+func (m *HL) Name() string {
+	return "hl"
+}
+
+// Revision returns 0.
+func (m *HL) Revision() uint8 {
+	return 0
+}
+
+// Args returns the '--hl-eq', '--hl-lt' or '--hl-gt' option.
+func (m *HL) Args() []string {
+	return ttlArgs("--hl", true, m.Mode, m.Value)
+}
+
+// Encode returns a ip6t_hl_info payload.
+func (m *HL) Encode(family Family) ([]byte, error) {
+	return encodeTTLInfo(family, FamilyIPv6, m.Mode, IP6T_HL_GT, m.Value)
+}
+
+func decodeHL(family Family, data []byte) (Match, error) {
+	info, err := decodeTTLInfo(family, FamilyIPv6, data)
+	if err != nil {
+		return nil, err
+	}
+	return &HL{Mode: info.Mode, Value: info.Value}, nil
+}
+
+// parseTTLOption is the counterpart of ttlArgs, parsing the single option of the TTL and hop limit extensions.
+func parseTTLOption(family, expected Family, prefix string, isMatch bool, opts []parsedOption) (mode, value uint8, err error) {
+	if family != expected {
+		return 0, 0, fmt.Errorf("not supported for %s", family)
+	}
+	names := []string{"-set", "-inc", "-dec"}
+	if isMatch {
+		names = []string{"-eq", "", "-lt", "-gt"}
+	}
+	if len(opts) != 1 {
+		return 0, 0, fmt.Errorf("exactly one %s option is required", prefix)
+	}
+	o := opts[0]
+	for i, name := range names {
+		if name != "" && o.name == prefix+name {
+			mode = uint8(i)
+		}
+	}
+	if isMatch && mode == IPT_TTL_EQ && bool(o.not) {
+		mode = IPT_TTL_NE
+	}
+	v, err := parseUint(o.value(), 8)
+	if err != nil {
+		return 0, 0, o.errorf("%v", err)
+	}
+	if !isMatch && mode != IPT_TTL_SET && v == 0 {
+		return 0, 0, o.errorf("value must be greater than 0")
+	}
+	return mode, uint8(v), nil
+}